@@ -65,6 +65,13 @@ type Configuration struct {
 	// Reporting is the configuration for error reporting
 	Reporting Reporting `yaml:"reporting,omitempty"`
 
+	// Tracing is the configuration for the export of OpenTelemetry traces
+	Tracing Tracing `yaml:"tracing,omitempty"`
+
+	// Audit is the configuration for the audit log, which is separate from
+	// the logs configured by Log.
+	Audit Audit `yaml:"audit,omitempty"`
+
 	// HTTP contains configuration parameters for the registry's http
 	// interface.
 	HTTP struct {
@@ -91,6 +98,12 @@ type Configuration struct {
 		// receives a stop signal
 		DrainTimeout time.Duration `yaml:"draintimeout,omitempty"`
 
+		// TrustedProxies are the addresses, or CIDR networks, of the proxies
+		// in front of the registry. The X-Forwarded-For and X-Real-Ip headers
+		// of their requests name the client, for the rate limits and the
+		// audit log, while these headers are ignored from other clients.
+		TrustedProxies []string `yaml:"trustedproxies,omitempty"`
+
 		// TLS instructs the http server to listen with a TLS configuration.
 		// This only support simple tls configuration with a cert and key.
 		// Mostly, this is useful for testing situations or simple deployments
@@ -154,6 +167,9 @@ type Configuration struct {
 			Prometheus struct {
 				Enabled bool   `yaml:"enabled,omitempty"`
 				Path    string `yaml:"path,omitempty"`
+				// Repositories configures the repository label of the
+				// registry metrics.
+				Repositories MetricsRepositories `yaml:"repositories,omitempty"`
 			} `yaml:"prometheus,omitempty"`
 		} `yaml:"debug,omitempty"`
 
@@ -268,9 +284,171 @@ type Configuration struct {
 			// the class in authorized resources.
 			Classes []string `yaml:"classes"`
 		} `yaml:"repository,omitempty"`
+
+		// Retention configures rules which remove tags and manifests
+		// that are no longer needed.
+		Retention Retention `yaml:"retention,omitempty"`
+
+		// Quota configures limits on the storage used by repositories
+		// and namespaces.
+		Quota Quota `yaml:"quota,omitempty"`
+
+		// RateLimit configures limits on the rate of requests of clients
+		// and to repositories.
+		RateLimit RateLimit `yaml:"ratelimit,omitempty"`
+
+		// ImmutableTags configures the tags which cannot be moved to
+		// another manifest or deleted once pushed.
+		ImmutableTags ImmutableTags `yaml:"immutabletags,omitempty"`
 	} `yaml:"policy,omitempty"`
 }
 
+// Retention configures the retention policies which the registry enforces
+// periodically on its repositories.
+type Retention struct {
+	// Enabled schedules the evaluation of the rules.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Interval is the time between evaluations of the rules. Defaults to
+	// 24 hours.
+	Interval time.Duration `yaml:"interval,omitempty"`
+
+	// DryRun reports what the rules would remove to the log and to the
+	// notification endpoints without removing anything.
+	DryRun bool `yaml:"dryrun,omitempty"`
+
+	// Rules is the list of retention rules to apply.
+	Rules []RetentionRule `yaml:"rules,omitempty"`
+}
+
+// RetentionRule selects tags or manifests of a set of repositories to keep
+// or remove.
+type RetentionRule struct {
+	// Repository is a regular expression selecting the repositories to
+	// which the rule applies. An empty expression selects all repositories.
+	Repository string `yaml:"repository,omitempty"`
+
+	// Tags is a regular expression selecting the tags to which the rule
+	// applies. An empty expression selects all tags.
+	Tags string `yaml:"tags,omitempty"`
+
+	// Protect keeps the selected tags, whatever the other rules say.
+	Protect bool `yaml:"protect,omitempty"`
+
+	// KeepLast removes all but the given number of most recently pushed
+	// selected tags in each repository.
+	KeepLast int `yaml:"keeplast,omitempty"`
+
+	// UntaggedOlderThan removes untagged manifests which were pushed longer
+	// ago than the given duration.
+	UntaggedOlderThan time.Duration `yaml:"untaggedolderthan,omitempty"`
+}
+
+// Quota configures limits on the number of bytes which repositories and
+// namespaces may store.
+type Quota struct {
+	// Enabled accounts the usage of repositories and rejects pushes which
+	// would exceed the limits.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Usage selects where the usage counters are kept, either "storage"
+	// (the default) or "redis".
+	Usage string `yaml:"usage,omitempty"`
+
+	// Repository is the limit, in bytes, of each repository without a
+	// limit of its own. Zero means no limit.
+	Repository int64 `yaml:"repository,omitempty"`
+
+	// Limits is the list of limits of specific repositories and
+	// namespaces.
+	Limits []QuotaLimit `yaml:"limits,omitempty"`
+}
+
+// QuotaLimit limits the number of bytes stored by a repository or by all the
+// repositories of a namespace.
+type QuotaLimit struct {
+	// Repository is the name of the repository which the limit applies to.
+	Repository string `yaml:"repository,omitempty"`
+
+	// Namespace is a namespace, such as "team-a", whose repositories
+	// ("team-a/app", "team-a/tools/builder", ...) share the limit.
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// Limit is the number of bytes which may be stored.
+	Limit int64 `yaml:"limit"`
+}
+
+// RateLimit configures token buckets limiting the rate of requests. A
+// request takes a token from the bucket of its user, from the bucket of its
+// remote IP and from the bucket of its repository, and is rejected when one of
+// them is empty.
+type RateLimit struct {
+	// Enabled enforces the limits.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Store selects where the buckets are kept, either "inmemory" (the
+	// default), limiting each registry instance on its own, or "redis",
+	// sharing the limits between the instances using the same redis.
+	Store string `yaml:"store,omitempty"`
+
+	// Pull limits the GET and HEAD requests to repositories.
+	Pull RateLimits `yaml:"pull,omitempty"`
+
+	// Push limits the other requests to repositories.
+	Push RateLimits `yaml:"push,omitempty"`
+
+	// Catalog limits the requests to the catalog, which has no repository
+	// limit.
+	Catalog RateLimits `yaml:"catalog,omitempty"`
+}
+
+// RateLimits configures the buckets of a kind of requests.
+type RateLimits struct {
+	// User is the bucket of each authenticated user.
+	User RateLimitBucket `yaml:"user,omitempty"`
+
+	// IP is the bucket of each remote IP, taking the forwarding headers of
+	// the trusted proxies into account.
+	IP RateLimitBucket `yaml:"ip,omitempty"`
+
+	// Repository is the bucket of each repository.
+	Repository RateLimitBucket `yaml:"repository,omitempty"`
+}
+
+// RateLimitBucket configures a token bucket. A zero rate means no limit.
+type RateLimitBucket struct {
+	// Rate is the number of tokens added to the bucket per second.
+	Rate float64 `yaml:"rate,omitempty"`
+
+	// Burst is the capacity of the bucket, the number of requests which
+	// may be made at once. Defaults to the rate, rounded up.
+	Burst int `yaml:"burst,omitempty"`
+}
+
+// ImmutableTags configures the tags which, once pushed, cannot be pushed again
+// with another manifest, nor deleted.
+type ImmutableTags struct {
+	// Tags are regular expressions matching the immutable tags of all the
+	// repositories.
+	Tags []string `yaml:"tags,omitempty"`
+
+	// Repositories lists the immutable tags of the repositories whose name
+	// starts with a prefix.
+	Repositories []ImmutableTagsRule `yaml:"repositories,omitempty"`
+}
+
+// ImmutableTagsRule configures the immutable tags of the repositories whose
+// name starts with a prefix.
+type ImmutableTagsRule struct {
+	// Prefix is the prefix of the names of the repositories, such as
+	// "team-a/".
+	Prefix string `yaml:"prefix"`
+
+	// Tags are regular expressions matching the immutable tags of the
+	// repositories.
+	Tags []string `yaml:"tags"`
+}
+
 // Catalog is composed of MaxEntries.
 // Catalog endpoint (/v2/_catalog) configuration, it provides the configuration
 // options to control the maximum number of entries returned by the catalog endpoint.
@@ -600,6 +778,9 @@ type Notifications struct {
 	// respond to webhook notifications. In the future, we may allow other
 	// kinds of endpoints, such as external queues.
 	Endpoints []Endpoint `yaml:"endpoints,omitempty"`
+	// Replication is a list of registries to which the manifests pushed to
+	// this registry, and the content they reference, are copied.
+	Replication []ReplicationTarget `yaml:"replication,omitempty"`
 }
 
 // Endpoint describes the configuration of an http webhook notification
@@ -616,6 +797,19 @@ type Endpoint struct {
 	Ignore            Ignore        `yaml:"ignore"`            // ignore event types
 }
 
+// ReplicationTarget describes a registry to which the pushes are replicated.
+type ReplicationTarget struct {
+	Name       string        `yaml:"name"`       // identifies the target in the registry instance.
+	Disabled   bool          `yaml:"disabled"`   // disables the replication to the target
+	URL        string        `yaml:"url"`        // base url of the target registry.
+	Username   string        `yaml:"username"`   // username to authenticate to the target registry
+	Password   string        `yaml:"password"`   // password to authenticate to the target registry
+	Repository string        `yaml:"repository"` // regular expression matching the repositories to replicate
+	Tags       string        `yaml:"tags"`       // regular expression matching the tags to replicate
+	Threshold  int           `yaml:"threshold"`  // circuit breaker threshold before backing off on failure
+	Backoff    time.Duration `yaml:"backoff"`    // backoff duration
+}
+
 // Events configures notification events.
 type Events struct {
 	IncludeReferences bool `yaml:"includereferences"` // include reference data in manifest events
@@ -635,6 +829,76 @@ type Reporting struct {
 	NewRelic NewRelicReporting `yaml:"newrelic,omitempty"`
 }
 
+// MetricsRepositories configures the repository label of the registry
+// metrics. Labelling the metrics with every repository can create too many
+// time series, so the label is empty unless enabled.
+type MetricsRepositories struct {
+	// Enabled labels the metrics with the repository.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Prefixes limits the label to the repositories whose name starts with
+	// one of the prefixes. The metrics of the other repositories have an
+	// empty label.
+	Prefixes []string `yaml:"prefixes,omitempty"`
+}
+
+// Tracing configures the export of the spans of the requests served by the
+// registry, and of the calls they make, to an OpenTelemetry collector.
+type Tracing struct {
+	// Enabled turns tracing on.
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Endpoint is the URL of the OTLP/HTTP traces endpoint of the collector,
+	// such as https://collector:4318/v1/traces. If empty, the standard
+	// OTEL_EXPORTER_OTLP_* environment variables apply.
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// Headers are sent along with the spans, to authenticate to the
+	// collector for instance.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// ServiceName is the service name of the spans. Defaults to "registry".
+	ServiceName string `yaml:"servicename,omitempty"`
+	// SamplingRatio is the ratio of the traces started by the registry
+	// which are sampled, greater than 0 and at most 1. Defaults to 1. The
+	// traces started by clients are sampled as decided by the clients.
+	SamplingRatio float64 `yaml:"samplingratio,omitempty"`
+}
+
+// Audit configures the audit log, recording as JSON lines who pushed, tagged,
+// mounted or deleted what, and the requests which were denied access.
+type Audit struct {
+	// Enabled turns the audit log on.
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Output is where the records are written, either "file" (the default)
+	// or "syslog".
+	Output string `yaml:"output,omitempty"`
+	// File configures the "file" output.
+	File AuditFile `yaml:"file,omitempty"`
+	// Syslog configures the "syslog" output.
+	Syslog AuditSyslog `yaml:"syslog,omitempty"`
+}
+
+// AuditFile configures the file the audit records are appended to.
+type AuditFile struct {
+	// Path is the path of the file.
+	Path string `yaml:"path,omitempty"`
+	// MaxSize is the size, in bytes, beyond which the file is rotated. Zero
+	// means the file is never rotated.
+	MaxSize int64 `yaml:"maxsize,omitempty"`
+	// MaxBackups is the number of rotated files kept, the oldest ones being
+	// removed. Zero keeps them all.
+	MaxBackups int `yaml:"maxbackups,omitempty"`
+}
+
+// AuditSyslog configures the syslog server the audit records are sent to.
+type AuditSyslog struct {
+	// Network is the network of the syslog server, such as "udp" or "tcp".
+	// If empty, the records are sent to the local syslog server.
+	Network string `yaml:"network,omitempty"`
+	// Address is the address of the syslog server, unless Network is empty.
+	Address string `yaml:"address,omitempty"`
+	// Tag is the tag of the records. Defaults to "registry".
+	Tag string `yaml:"tag,omitempty"`
+}
+
 // BugsnagReporting configures error reporting for Bugsnag (bugsnag.com).
 type BugsnagReporting struct {
 	// APIKey is the Bugsnag api key.
@@ -681,6 +945,53 @@ type Proxy struct {
 	// if not set, defaults to 7 * 24 hours
 	// If set to zero, will never expire cache
 	TTL *time.Duration `yaml:"ttl,omitempty"`
+
+	// Upstreams configures the registry as a pull through cache for several
+	// remote registries at once, each serving the repositories under its
+	// prefix. It may not be combined with RemoteURL.
+	Upstreams []ProxyUpstream `yaml:"upstreams,omitempty"`
+
+	// Offline configures how the cached content is served while a remote
+	// registry is unreachable
+	Offline ProxyOffline `yaml:"offline,omitempty"`
+}
+
+// ProxyOffline configures the circuit breaker which stops a pull through
+// cache from contacting a remote registry which keeps failing. While the
+// circuit is open, tags are resolved from the cache and marked as stale.
+type ProxyOffline struct {
+	// Enabled turns on the circuit breaker
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Failures is the number of consecutive failed requests after which the
+	// remote registry is considered unreachable. Defaults to 3.
+	Failures int `yaml:"failures,omitempty"`
+
+	// RetryAfter is how long a remote registry considered unreachable is not
+	// contacted. Defaults to 30 seconds.
+	RetryAfter time.Duration `yaml:"retryafter,omitempty"`
+}
+
+// ProxyUpstream configures a remote registry proxied for the repositories
+// under a name prefix
+type ProxyUpstream struct {
+	// Prefix is the first component(s) of the names of the repositories
+	// proxied from the remote registry, e.g. "dockerhub". It is stripped
+	// from the names before they are requested from the remote registry.
+	Prefix string `yaml:"prefix"`
+
+	// RemoteURL is the URL of the remote registry
+	RemoteURL string `yaml:"remoteurl"`
+
+	// Username of the remote registry user
+	Username string `yaml:"username"`
+
+	// Password of the remote registry user
+	Password string `yaml:"password"`
+
+	// TTL is the expiry time of the content pulled from the remote registry,
+	// with the same defaults as Proxy.TTL
+	TTL *time.Duration `yaml:"ttl,omitempty"`
 }
 
 // Parse parses an input configuration yaml document into a Configuration struct
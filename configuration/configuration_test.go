@@ -75,14 +75,15 @@ var configStruct = Configuration{
 		MaxEntries: 1000,
 	},
 	HTTP: struct {
-		Addr         string        `yaml:"addr,omitempty"`
-		Net          string        `yaml:"net,omitempty"`
-		Host         string        `yaml:"host,omitempty"`
-		Prefix       string        `yaml:"prefix,omitempty"`
-		Secret       string        `yaml:"secret,omitempty"`
-		RelativeURLs bool          `yaml:"relativeurls,omitempty"`
-		DrainTimeout time.Duration `yaml:"draintimeout,omitempty"`
-		TLS          struct {
+		Addr           string        `yaml:"addr,omitempty"`
+		Net            string        `yaml:"net,omitempty"`
+		Host           string        `yaml:"host,omitempty"`
+		Prefix         string        `yaml:"prefix,omitempty"`
+		Secret         string        `yaml:"secret,omitempty"`
+		RelativeURLs   bool          `yaml:"relativeurls,omitempty"`
+		DrainTimeout   time.Duration `yaml:"draintimeout,omitempty"`
+		TrustedProxies []string      `yaml:"trustedproxies,omitempty"`
+		TLS            struct {
 			Certificate  string   `yaml:"certificate,omitempty"`
 			Key          string   `yaml:"key,omitempty"`
 			ClientCAs    []string `yaml:"clientcas,omitempty"`
@@ -99,8 +100,9 @@ var configStruct = Configuration{
 		Debug   struct {
 			Addr       string `yaml:"addr,omitempty"`
 			Prometheus struct {
-				Enabled bool   `yaml:"enabled,omitempty"`
-				Path    string `yaml:"path,omitempty"`
+				Enabled      bool                `yaml:"enabled,omitempty"`
+				Path         string              `yaml:"path,omitempty"`
+				Repositories MetricsRepositories `yaml:"repositories,omitempty"`
 			} `yaml:"prometheus,omitempty"`
 		} `yaml:"debug,omitempty"`
 		HTTP2 struct {
@@ -466,6 +468,22 @@ func (suite *ConfigSuite) TestParseWithDifferentEnvReporting(c *check.C) {
 	c.Assert(config, check.DeepEquals, suite.expectedConfig)
 }
 
+// TestParseWithDifferentEnvTracing validates that environment variables
+// properly override tracing parameters
+func (suite *ConfigSuite) TestParseWithDifferentEnvTracing(c *check.C) {
+	suite.expectedConfig.Tracing.Enabled = true
+	suite.expectedConfig.Tracing.Endpoint = "http://localhost:4318/v1/traces"
+	suite.expectedConfig.Tracing.SamplingRatio = 0.25
+
+	os.Setenv("REGISTRY_TRACING_ENABLED", "true")
+	os.Setenv("REGISTRY_TRACING_ENDPOINT", "http://localhost:4318/v1/traces")
+	os.Setenv("REGISTRY_TRACING_SAMPLINGRATIO", "0.25")
+
+	config, err := Parse(bytes.NewReader([]byte(configYamlV0_1)))
+	c.Assert(err, check.IsNil)
+	c.Assert(config, check.DeepEquals, suite.expectedConfig)
+}
+
 // TestParseInvalidVersion validates that the parser will fail to parse a newer configuration
 // version than the CurrentVersion
 func (suite *ConfigSuite) TestParseInvalidVersion(c *check.C) {
@@ -560,6 +578,195 @@ func (suite *ConfigSuite) TestParseEnvMany(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+// TestParseRetention validates that retention rules can be parsed from the
+// policy section.
+func (suite *ConfigSuite) TestParseRetention(c *check.C) {
+	retentionYaml := configYamlV0_1 + `
+policy:
+  retention:
+    enabled: true
+    interval: 12h
+    dryrun: true
+    rules:
+      - tags: ^v\d+
+        protect: true
+      - repository: ^library/
+        tags: ^build-
+        keeplast: 10
+      - untaggedolderthan: 720h
+`
+	config, err := Parse(bytes.NewReader([]byte(retentionYaml)))
+	c.Assert(err, check.IsNil)
+	c.Assert(config.Policy.Retention, check.DeepEquals, Retention{
+		Enabled:  true,
+		Interval: 12 * time.Hour,
+		DryRun:   true,
+		Rules: []RetentionRule{
+			{Tags: `^v\d+`, Protect: true},
+			{Repository: "^library/", Tags: "^build-", KeepLast: 10},
+			{UntaggedOlderThan: 720 * time.Hour},
+		},
+	})
+}
+
+// TestParseQuota validates that quota limits can be parsed from the policy
+// section.
+func (suite *ConfigSuite) TestParseQuota(c *check.C) {
+	quotaYaml := configYamlV0_1 + `
+policy:
+  quota:
+    enabled: true
+    usage: redis
+    repository: 10737418240
+    limits:
+      - namespace: team-a
+        limit: 107374182400
+      - repository: team-a/builder
+        limit: 1073741824
+`
+	config, err := Parse(bytes.NewReader([]byte(quotaYaml)))
+	c.Assert(err, check.IsNil)
+	c.Assert(config.Policy.Quota, check.DeepEquals, Quota{
+		Enabled:    true,
+		Usage:      "redis",
+		Repository: 10737418240,
+		Limits: []QuotaLimit{
+			{Namespace: "team-a", Limit: 107374182400},
+			{Repository: "team-a/builder", Limit: 1073741824},
+		},
+	})
+}
+
+// TestParseRateLimit validates that rate limits can be parsed from the policy
+// section.
+func (suite *ConfigSuite) TestParseRateLimit(c *check.C) {
+	rateLimitYaml := configYamlV0_1 + `
+policy:
+  ratelimit:
+    enabled: true
+    store: redis
+    pull:
+      user:
+        rate: 10
+        burst: 50
+      ip:
+        rate: 2.5
+    push:
+      repository:
+        rate: 1
+    catalog:
+      ip:
+        rate: 0.1
+        burst: 1
+`
+	config, err := Parse(bytes.NewReader([]byte(rateLimitYaml)))
+	c.Assert(err, check.IsNil)
+	c.Assert(config.Policy.RateLimit, check.DeepEquals, RateLimit{
+		Enabled: true,
+		Store:   "redis",
+		Pull: RateLimits{
+			User: RateLimitBucket{Rate: 10, Burst: 50},
+			IP:   RateLimitBucket{Rate: 2.5},
+		},
+		Push: RateLimits{
+			Repository: RateLimitBucket{Rate: 1},
+		},
+		Catalog: RateLimits{
+			IP: RateLimitBucket{Rate: 0.1, Burst: 1},
+		},
+	})
+}
+
+// TestParseImmutableTags validates that immutable tags can be parsed from the
+// policy section.
+func (suite *ConfigSuite) TestParseImmutableTags(c *check.C) {
+	immutableTagsYaml := configYamlV0_1 + `
+policy:
+  immutabletags:
+    tags:
+      - ^v\d+\.\d+\.\d+$
+    repositories:
+      - prefix: team-a/
+        tags:
+          - ^release-
+          - ^stable$
+`
+	config, err := Parse(bytes.NewReader([]byte(immutableTagsYaml)))
+	c.Assert(err, check.IsNil)
+	c.Assert(config.Policy.ImmutableTags, check.DeepEquals, ImmutableTags{
+		Tags: []string{`^v\d+\.\d+\.\d+$`},
+		Repositories: []ImmutableTagsRule{
+			{Prefix: "team-a/", Tags: []string{"^release-", "^stable$"}},
+		},
+	})
+}
+
+func (suite *ConfigSuite) TestParseProxyUpstreams(c *check.C) {
+	proxyYaml := configYamlV0_1 + `
+proxy:
+  upstreams:
+    - prefix: dockerhub
+      remoteurl: https://registry-1.docker.io
+      username: hubuser
+      password: hubpassword
+    - prefix: ghcr
+      remoteurl: https://ghcr.io
+      ttl: 1h
+`
+	config, err := Parse(bytes.NewReader([]byte(proxyYaml)))
+	c.Assert(err, check.IsNil)
+	ttl := time.Hour
+	c.Assert(config.Proxy.Upstreams, check.DeepEquals, []ProxyUpstream{
+		{Prefix: "dockerhub", RemoteURL: "https://registry-1.docker.io", Username: "hubuser", Password: "hubpassword"},
+		{Prefix: "ghcr", RemoteURL: "https://ghcr.io", TTL: &ttl},
+	})
+}
+
+func (suite *ConfigSuite) TestParseProxyOffline(c *check.C) {
+	proxyYaml := configYamlV0_1 + `
+proxy:
+  remoteurl: https://registry-1.docker.io
+  offline:
+    enabled: true
+    failures: 5
+    retryafter: 1m
+`
+	config, err := Parse(bytes.NewReader([]byte(proxyYaml)))
+	c.Assert(err, check.IsNil)
+	c.Assert(config.Proxy.Offline, check.DeepEquals, ProxyOffline{
+		Enabled:    true,
+		Failures:   5,
+		RetryAfter: time.Minute,
+	})
+}
+
+func (suite *ConfigSuite) TestParseReplication(c *check.C) {
+	replicationYaml := configYamlV0_1 + `
+notifications:
+  replication:
+    - name: mirror
+      url: https://mirror.example.com
+      username: replicator
+      password: secret
+      repository: ^library/
+      tags: ^v[0-9]
+      threshold: 5
+      backoff: 2s
+`
+	config, err := Parse(bytes.NewReader([]byte(replicationYaml)))
+	c.Assert(err, check.IsNil)
+	c.Assert(config.Notifications.Replication, check.DeepEquals, []ReplicationTarget{{
+		Name:       "mirror",
+		URL:        "https://mirror.example.com",
+		Username:   "replicator",
+		Password:   "secret",
+		Repository: "^library/",
+		Tags:       "^v[0-9]",
+		Threshold:  5,
+		Backoff:    2 * time.Second,
+	}})
+}
+
 func checkStructs(c *check.C, t reflect.Type, structsChecked map[string]struct{}) {
 	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Map || t.Kind() == reflect.Slice {
 		t = t.Elem()
@@ -636,6 +843,7 @@ func copyConfig(config Configuration) *Configuration {
 	}
 
 	configCopy.Redis = config.Redis
+	configCopy.Tracing = config.Tracing
 
 	return configCopy
 }
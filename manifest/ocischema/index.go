@@ -55,6 +55,14 @@ type ImageIndex struct {
 	// Annotations is an optional field that contains arbitrary metadata for the
 	// image index
 	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// ArtifactType is the IANA media type of the artifact when the index is
+	// used for an artifact other than a multi-platform image.
+	ArtifactType string `json:"artifactType,omitempty"`
+
+	// Subject is an optional link from this index to another manifest,
+	// forming an association which is exposed through the referrers API.
+	Subject *distribution.Descriptor `json:"subject,omitempty"`
 }
 
 // References returns the distribution descriptors for the referenced image
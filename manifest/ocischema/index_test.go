@@ -134,6 +134,38 @@ func TestOCIImageIndex(t *testing.T) {
 	}
 }
 
+func TestOCIImageIndexSubjectRoundTrip(t *testing.T) {
+	manifestDescriptors, deserialized := makeTestOCIImageIndex(t, v1.MediaTypeImageIndex)
+
+	index := deserialized.ImageIndex
+	index.ArtifactType = "application/vnd.example.bundle"
+	index.Subject = &distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Digest:    "sha256:1a9ec845ee94c202b2d5da74a24f0ed2058318bfa9879fa541efaecba272e86b",
+		Size:      985,
+	}
+
+	canonical, err := json.MarshalIndent(&index, "", "   ")
+	if err != nil {
+		t.Fatalf("error marshaling image index: %v", err)
+	}
+
+	var unmarshalled DeserializedImageIndex
+	if err := json.Unmarshal(canonical, &unmarshalled); err != nil {
+		t.Fatalf("error unmarshaling image index: %v", err)
+	}
+
+	if unmarshalled.ArtifactType != index.ArtifactType {
+		t.Fatalf("unexpected artifact type: %s", unmarshalled.ArtifactType)
+	}
+	if unmarshalled.Subject == nil || !reflect.DeepEqual(*unmarshalled.Subject, *index.Subject) {
+		t.Fatalf("unexpected subject: %v", unmarshalled.Subject)
+	}
+	if !reflect.DeepEqual(unmarshalled.References(), manifestDescriptors) {
+		t.Fatalf("subject must not be listed as a reference: %v", unmarshalled.References())
+	}
+}
+
 func indexMediaTypeTest(contentType string, mediaType string, shouldError bool) func(*testing.T) {
 	return func(t *testing.T) {
 		var m *DeserializedImageIndex
@@ -51,6 +51,14 @@ type Manifest struct {
 
 	// Annotations contains arbitrary metadata for the image manifest.
 	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// ArtifactType is the IANA media type of the artifact when the manifest
+	// is used for an artifact other than a container image.
+	ArtifactType string `json:"artifactType,omitempty"`
+
+	// Subject is an optional link from this manifest to another manifest,
+	// forming an association which is exposed through the referrers API.
+	Subject *distribution.Descriptor `json:"subject,omitempty"`
 }
 
 // References returns the descriptors of this manifests references.
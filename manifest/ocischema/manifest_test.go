@@ -142,6 +142,41 @@ func TestManifest(t *testing.T) {
 	}
 }
 
+func TestManifestSubjectRoundTrip(t *testing.T) {
+	mfst := makeTestManifest(v1.MediaTypeImageManifest)
+	mfst.ArtifactType = "application/vnd.example.signature"
+	mfst.Subject = &distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Digest:    "sha256:6346340964309634683409684360934680934608934608934608934068934608",
+		Size:      2392,
+	}
+
+	deserialized, err := FromStruct(mfst)
+	if err != nil {
+		t.Fatalf("error creating DeserializedManifest: %v", err)
+	}
+
+	var unmarshalled DeserializedManifest
+	if err := json.Unmarshal(deserialized.canonical, &unmarshalled); err != nil {
+		t.Fatalf("error unmarshaling manifest: %v", err)
+	}
+
+	if !reflect.DeepEqual(&unmarshalled, deserialized) {
+		t.Fatalf("manifests are different after unmarshaling: %v != %v", unmarshalled, *deserialized)
+	}
+	if unmarshalled.ArtifactType != mfst.ArtifactType {
+		t.Fatalf("unexpected artifact type: %s", unmarshalled.ArtifactType)
+	}
+	if unmarshalled.Subject == nil || !reflect.DeepEqual(*unmarshalled.Subject, *mfst.Subject) {
+		t.Fatalf("unexpected subject: %v", unmarshalled.Subject)
+	}
+
+	// The subject is not a dependency of the manifest.
+	if len(unmarshalled.References()) != 2 {
+		t.Fatalf("unexpected number of references: %d", len(unmarshalled.References()))
+	}
+}
+
 func manifestMediaTypeTest(mediaType string, shouldError bool) func(*testing.T) {
 	return func(t *testing.T) {
 		mfst := makeTestManifest(mediaType)
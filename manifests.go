@@ -69,6 +69,14 @@ type ManifestEnumerator interface {
 	Enumerate(ctx context.Context, ingester func(digest.Digest) error) error
 }
 
+// ReferrersProvider provides access to the manifests which declare a given
+// manifest as their subject.
+type ReferrersProvider interface {
+	// Referrers returns the descriptors of the manifests referring to the
+	// subject digest. There is no ordering guaranteed.
+	Referrers(ctx context.Context, subject digest.Digest) ([]Descriptor, error)
+}
+
 // Describable is an interface for descriptors
 type Describable interface {
 	Descriptor() Descriptor
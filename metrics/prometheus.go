@@ -13,4 +13,16 @@ var (
 
 	// NotificationsNamespace is the prometheus namespace of notification related metrics
 	NotificationsNamespace = metrics.NewNamespace(NamespacePrefix, "notifications", nil)
+
+	// ProxyNamespace is the prometheus namespace of pull through cache related metrics
+	ProxyNamespace = metrics.NewNamespace(NamespacePrefix, "proxy", nil)
+
+	// ManifestsNamespace is the prometheus namespace of manifest pulls and pushes
+	ManifestsNamespace = metrics.NewNamespace(NamespacePrefix, "manifests", nil)
+
+	// BlobsNamespace is the prometheus namespace of blob pulls, uploads and mounts
+	BlobsNamespace = metrics.NewNamespace(NamespacePrefix, "blobs", nil)
+
+	// AuthNamespace is the prometheus namespace of authorization related metrics
+	AuthNamespace = metrics.NewNamespace(NamespacePrefix, "auth", nil)
 )
@@ -84,6 +84,13 @@ func (e *Endpoint) URL() string {
 	return e.url
 }
 
+// Close flushes the events queued and closes the endpoint, whose metrics are
+// no longer reported.
+func (e *Endpoint) Close() error {
+	unregister(e)
+	return e.Sink.Close()
+}
+
 // ReadMetrics populates em with metrics from the endpoint.
 func (e *Endpoint) ReadMetrics(em *EndpointMetrics) {
 	e.metrics.Lock()
@@ -14,6 +14,7 @@ const (
 	EventActionPush   = "push"
 	EventActionMount  = "mount"
 	EventActionDelete = "delete"
+	EventActionExpire = "expire"
 )
 
 const (
@@ -2,13 +2,16 @@ package notifications
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/docker/distribution/tracing"
 	events "github.com/docker/go-events"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // httpSink implements a single-flight, http notification endpoint. This is
@@ -20,6 +23,7 @@ type httpSink struct {
 	mu        sync.Mutex
 	closed    bool
 	client    *http.Client
+	transport *headerRoundTripper
 	listeners []httpStatusListener
 
 	// TODO(stevvooe): Allow one to configure the media type accepted by this
@@ -32,16 +36,18 @@ func newHTTPSink(u string, timeout time.Duration, headers http.Header, transport
 	if transport == nil {
 		transport = http.DefaultTransport.(*http.Transport)
 	}
+	hrt := &headerRoundTripper{
+		Transport: transport,
+		headers:   headers,
+	}
 	return &httpSink{
 		url:       u,
 		listeners: listeners,
 		client: &http.Client{
-			Transport: &headerRoundTripper{
-				Transport: transport,
-				headers:   headers,
-			},
-			Timeout: timeout,
+			Transport: tracing.Transport(hrt),
+			Timeout:   timeout,
 		},
+		transport: hrt,
 	}
 }
 
@@ -58,12 +64,24 @@ type httpStatusListener interface {
 func (hs *httpSink) Write(event events.Event) error {
 	hs.mu.Lock()
 	defer hs.mu.Unlock()
-	defer hs.client.Transport.(*headerRoundTripper).CloseIdleConnections()
+	defer hs.transport.CloseIdleConnections()
 
 	if hs.closed {
 		return ErrSinkClosed
 	}
 
+	// the events are delivered apart from the requests causing them, each
+	// delivery starts a trace
+	attrs := []attribute.KeyValue{attribute.String("notification.endpoint", hs.url)}
+	if e, ok := event.(Event); ok {
+		attrs = append(attrs,
+			attribute.String("notification.event", e.ID),
+			attribute.String("notification.action", e.Action),
+			attribute.String("registry.repository", e.Target.Repository))
+	}
+	ctx, span := tracing.StartSpan(context.Background(), "notifications.deliver", attrs...)
+	defer span.End()
+
 	envelope := Envelope{
 		Events: []events.Event{event},
 	}
@@ -77,17 +95,24 @@ func (hs *httpSink) Write(event events.Event) error {
 		for _, listener := range hs.listeners {
 			listener.err(err, event)
 		}
-		return fmt.Errorf("%v: error marshaling event envelope: %v", hs, err)
+		return tracing.RecordError(span, fmt.Errorf("%v: error marshaling event envelope: %v", hs, err))
 	}
 
-	body := bytes.NewReader(p)
-	resp, err := hs.client.Post(hs.url, EventsMediaType, body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hs.url, bytes.NewReader(p))
+	if err != nil {
+		for _, listener := range hs.listeners {
+			listener.err(err, event)
+		}
+		return tracing.RecordError(span, fmt.Errorf("%v: error posting: %v", hs, err))
+	}
+	req.Header.Set("Content-Type", EventsMediaType)
+	resp, err := hs.client.Do(req)
 	if err != nil {
 		for _, listener := range hs.listeners {
 			listener.err(err, event)
 		}
 
-		return fmt.Errorf("%v: error posting: %v", hs, err)
+		return tracing.RecordError(span, fmt.Errorf("%v: error posting: %v", hs, err))
 	}
 	defer resp.Body.Close()
 
@@ -108,7 +133,7 @@ func (hs *httpSink) Write(event events.Event) error {
 		for _, listener := range hs.listeners {
 			listener.failure(resp.StatusCode, event)
 		}
-		return fmt.Errorf("%v: response status %v unaccepted", hs, resp.Status)
+		return tracing.RecordError(span, fmt.Errorf("%v: response status %v unaccepted", hs, resp.Status))
 	}
 }
 
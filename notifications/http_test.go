@@ -14,6 +14,7 @@ import (
 	"testing"
 
 	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/tracing/tracingtest"
 	events "github.com/docker/go-events"
 )
 
@@ -207,3 +208,36 @@ func createTestEvent(action, repo, typ string) Event {
 
 	return *event
 }
+
+// TestHTTPSinkTracing ensures that each delivery is traced, and that the trace
+// is propagated to the endpoint.
+func TestHTTPSinkTracing(t *testing.T) {
+	recorder, restore := tracingtest.Record()
+	defer restore()
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sink := newHTTPSink(server.URL, 0, nil, nil)
+	event := Event{ID: "asdf-asdf-asdf-asdf-0", Action: EventActionPush}
+	event.Target.Repository = "library/test"
+	if err := sink.Write(event); err != nil {
+		t.Fatalf("unexpected error writing event: %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected a delivery and a request span, got %d spans", len(spans))
+	}
+	request, delivery := spans[0], spans[1]
+	if delivery.Name() != "notifications.deliver" || request.Parent().SpanID() != delivery.SpanContext().SpanID() {
+		t.Errorf("expected the request span %s to be a child of the delivery span %s", request.Name(), delivery.Name())
+	}
+	if !strings.Contains(traceparent, delivery.SpanContext().TraceID().String()) {
+		t.Errorf("expected the trace to be propagated, got traceparent %q", traceparent)
+	}
+}
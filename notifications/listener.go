@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/docker/distribution"
 
@@ -126,6 +127,17 @@ func (msl *manifestServiceListener) Put(ctx context.Context, sm distribution.Man
 	return dgst, err
 }
 
+// Referrers passes through to the underlying manifest service, if it is able
+// to provide referrers. Listing referrers does not dispatch any events.
+func (msl *manifestServiceListener) Referrers(ctx context.Context, subject digest.Digest) ([]distribution.Descriptor, error) {
+	referrersProvider, ok := msl.ManifestService.(distribution.ReferrersProvider)
+	if !ok {
+		return nil, distribution.ErrUnsupported
+	}
+
+	return referrersProvider.Referrers(ctx, subject)
+}
+
 type blobServiceListener struct {
 	distribution.BlobStore
 	parent *repositoryListener
@@ -252,6 +264,22 @@ func (rl *repositoryListener) Tags(ctx context.Context) distribution.TagService
 	}
 }
 
+func (tagSL *tagServiceListener) Describe(ctx context.Context, tag string) (distribution.TagDescription, error) {
+	describer, ok := tagSL.TagService.(distribution.TagDescriber)
+	if !ok {
+		return distribution.TagDescription{}, distribution.ErrUnsupported
+	}
+	return describer.Describe(ctx, tag)
+}
+
+func (tagSL *tagServiceListener) ModTime(ctx context.Context, tag string) (time.Time, error) {
+	describer, ok := tagSL.TagService.(distribution.TagDescriber)
+	if !ok {
+		return time.Time{}, distribution.ErrUnsupported
+	}
+	return describer.ModTime(ctx, tag)
+}
+
 func (tagSL *tagServiceListener) Untag(ctx context.Context, tag string) error {
 	if err := tagSL.TagService.Untag(ctx, tag); err != nil {
 		return err
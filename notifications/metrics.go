@@ -63,6 +63,14 @@ func (sm *safeMetrics) eventQueueListener() eventQueueListener {
 	}
 }
 
+// replicationListener returns the listener for the replication sink that
+// updates the relevant counters.
+func (sm *safeMetrics) replicationListener() replicationListener {
+	return &endpointMetricsReplicationListener{
+		safeMetrics: sm,
+	}
+}
+
 // endpointMetricsHTTPStatusListener increments counters related to http sinks
 // for the relevant events.
 type endpointMetricsHTTPStatusListener struct {
@@ -99,6 +107,38 @@ func (emsl *endpointMetricsHTTPStatusListener) err(err error, event events.Event
 	eventsCounter.WithValues("Errors", emsl.EndpointName).Inc(1)
 }
 
+// endpointMetricsReplicationListener increments counters related to
+// replication sinks for the relevant events.
+type endpointMetricsReplicationListener struct {
+	*safeMetrics
+}
+
+var _ replicationListener = &endpointMetricsReplicationListener{}
+
+func (emrl *endpointMetricsReplicationListener) success(event events.Event) {
+	emrl.safeMetrics.Lock()
+	defer emrl.safeMetrics.Unlock()
+	emrl.Successes++
+
+	eventsCounter.WithValues("Successes", emrl.EndpointName).Inc(1)
+}
+
+func (emrl *endpointMetricsReplicationListener) failure(err error, event events.Event) {
+	emrl.safeMetrics.Lock()
+	defer emrl.safeMetrics.Unlock()
+	emrl.Failures++
+
+	eventsCounter.WithValues("Failures", emrl.EndpointName).Inc(1)
+}
+
+func (emrl *endpointMetricsReplicationListener) err(err error, event events.Event) {
+	emrl.safeMetrics.Lock()
+	defer emrl.safeMetrics.Unlock()
+	emrl.Errors++
+
+	eventsCounter.WithValues("Errors", emrl.EndpointName).Inc(1)
+}
+
 // endpointMetricsEventQueueListener maintains the incoming events counter and
 // the queues pending count.
 type endpointMetricsEventQueueListener struct {
@@ -137,6 +177,19 @@ func register(e *Endpoint) {
 	endpoints.registered = append(endpoints.registered, e)
 }
 
+// unregister removes the endpoint from expvar once it is closed.
+func unregister(e *Endpoint) {
+	endpoints.mu.Lock()
+	defer endpoints.mu.Unlock()
+
+	for i, registered := range endpoints.registered {
+		if registered == e {
+			endpoints.registered = append(endpoints.registered[:i], endpoints.registered[i+1:]...)
+			return
+		}
+	}
+}
+
 func init() {
 	// NOTE(stevvooe): Setup registry metrics structure to report to expvar.
 	// Ideally, we do more metrics through logging but we need some nice
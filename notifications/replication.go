@@ -0,0 +1,465 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/client"
+	"github.com/docker/distribution/registry/client/auth"
+	"github.com/docker/distribution/registry/client/auth/challenge"
+	"github.com/docker/distribution/registry/client/transport"
+	events "github.com/docker/go-events"
+	"github.com/opencontainers/go-digest"
+)
+
+// maxMountSources bounds the number of blobs for which a replicator remembers
+// a repository of the target registry to mount them from.
+const maxMountSources = 10000
+
+// ReplicationConfig covers the optional configuration parameters of a
+// replicator.
+type ReplicationConfig struct {
+	Username   string
+	Password   string         `json:"-"`
+	Repository *regexp.Regexp // repositories to replicate, all if nil
+	Tags       *regexp.Regexp // tags to replicate, all if nil
+	Threshold  int
+	Backoff    time.Duration
+	Transport  http.RoundTripper `json:"-"`
+}
+
+// defaults set any zero-valued fields to a reasonable default.
+func (rc *ReplicationConfig) defaults() {
+	if rc.Threshold <= 0 {
+		rc.Threshold = 10
+	}
+
+	if rc.Backoff <= 0 {
+		rc.Backoff = time.Second
+	}
+
+	if rc.Transport == nil {
+		rc.Transport = http.DefaultTransport
+	}
+}
+
+// Replicator is a reliable, queued, thread-safe sink which copies the
+// manifests pushed to the registry, along with the content they reference,
+// to a target registry. Writes are non-blocking and always succeed for
+// callers, the replication happening asynchronously.
+type Replicator struct {
+	events.Sink
+	url  string
+	name string
+
+	ReplicationConfig
+
+	metrics *safeMetrics
+}
+
+// NewReplicator returns a running replicator, copying the content pushed to
+// the registry to the registry at url.
+func NewReplicator(name, url string, registry distribution.Namespace, config ReplicationConfig) *Replicator {
+	var replicator Replicator
+	replicator.name = name
+	replicator.url = url
+	replicator.ReplicationConfig = config
+	replicator.defaults()
+	replicator.metrics = newSafeMetrics(name)
+
+	// Configures the inmemory queue, retry, replication pipeline.
+	replicator.Sink = newReplicationSink(
+		replicator.url, registry, replicator.ReplicationConfig,
+		replicator.metrics.replicationListener())
+	replicator.Sink = events.NewRetryingSink(replicator.Sink, events.NewBreaker(replicator.Threshold, replicator.Backoff))
+	replicator.Sink = newEventQueue(replicator.Sink, replicator.metrics.eventQueueListener())
+	replicator.Sink = newReplicationFilter(replicator.Sink, replicator.Repository, replicator.Tags)
+
+	return &replicator
+}
+
+// Name returns the name of the replicator, generally used for debugging.
+func (r *Replicator) Name() string {
+	return r.name
+}
+
+// URL returns the url of the target registry.
+func (r *Replicator) URL() string {
+	return r.url
+}
+
+// replicationFilter passes along the manifest push events of the
+// repositories and tags to replicate, discarding the other events.
+type replicationFilter struct {
+	events.Sink
+	repository *regexp.Regexp
+	tags       *regexp.Regexp
+	manifests  map[string]bool
+}
+
+func newReplicationFilter(sink events.Sink, repository, tags *regexp.Regexp) events.Sink {
+	manifests := make(map[string]bool)
+	for _, mediaType := range distribution.ManifestMediaTypes() {
+		manifests[mediaType] = true
+	}
+
+	return &replicationFilter{
+		Sink:       sink,
+		repository: repository,
+		tags:       tags,
+		manifests:  manifests,
+	}
+}
+
+// Write discards the events which are not replicated and passes the rest
+// along.
+func (rf *replicationFilter) Write(event events.Event) error {
+	e, ok := event.(Event)
+	if !ok || e.Action != EventActionPush || !rf.manifests[e.Target.MediaType] {
+		return nil
+	}
+	if rf.repository != nil && !rf.repository.MatchString(e.Target.Repository) {
+		return nil
+	}
+	// manifests pushed by digest only are replicated when no tags are
+	// selected
+	if rf.tags != nil && (e.Target.Tag == "" || !rf.tags.MatchString(e.Target.Tag)) {
+		return nil
+	}
+
+	return rf.Sink.Write(event)
+}
+
+// replicationListener is called on the outcomes of replicating events.
+type replicationListener interface {
+	success(event events.Event)
+	failure(err error, event events.Event)
+	err(err error, event events.Event)
+}
+
+// replicationSink copies the manifest of a push event, and the content it
+// references, from the registry to a target registry. It makes a single
+// attempt at replicating each event: reliability should be provided by the
+// caller.
+type replicationSink struct {
+	url       string
+	registry  distribution.Namespace
+	config    ReplicationConfig
+	listeners []replicationListener
+
+	// cm holds the auth challenges of the target registry.
+	cm challenge.Manager
+
+	mu     sync.Mutex
+	closed bool
+
+	// mountSources maps blobs known to exist in the target registry to a
+	// repository they can be mounted from.
+	mountSources map[digest.Digest]reference.Named
+}
+
+func newReplicationSink(u string, registry distribution.Namespace, config ReplicationConfig, listeners ...replicationListener) *replicationSink {
+	return &replicationSink{
+		url:          u,
+		registry:     registry,
+		config:       config,
+		listeners:    listeners,
+		cm:           challenge.NewSimpleManager(),
+		mountSources: make(map[digest.Digest]reference.Named),
+	}
+}
+
+// Write replicates the manifest of the event, returning an error if the
+// replication should be retried. Errors which retrying cannot fix, such as
+// content removed from the registry since the event, drop the event.
+func (rs *replicationSink) Write(event events.Event) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.closed {
+		return ErrSinkClosed
+	}
+
+	e := event.(Event)
+	err := rs.replicate(context.Background(), e)
+	switch {
+	case err == nil:
+		for _, listener := range rs.listeners {
+			listener.success(event)
+		}
+		return nil
+	case permanent(err):
+		for _, listener := range rs.listeners {
+			listener.failure(err, event)
+		}
+		dcontext.GetLogger(context.Background()).Errorf("%v: dropping replication of %s@%s: %v", rs, e.Target.Repository, e.Target.Digest, err)
+		return nil
+	default:
+		for _, listener := range rs.listeners {
+			listener.err(err, event)
+		}
+		return fmt.Errorf("%v: error replicating %s@%s: %v", rs, e.Target.Repository, e.Target.Digest, err)
+	}
+}
+
+// Close the replication sink.
+func (rs *replicationSink) Close() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.closed {
+		return fmt.Errorf("replicationsink: already closed")
+	}
+
+	rs.closed = true
+	return nil
+}
+
+func (rs *replicationSink) String() string {
+	return fmt.Sprintf("replicationSink{%s}", rs.url)
+}
+
+// permanent returns whether retrying to replicate after err is pointless.
+func permanent(err error) bool {
+	switch err := err.(type) {
+	case distribution.ErrManifestUnknownRevision, distribution.ErrRepositoryUnknown:
+		return true
+	case errcode.Errors:
+		for _, e := range err {
+			if !permanent(e) {
+				return false
+			}
+		}
+		return len(err) > 0
+	case errcode.Error:
+		return permanent(err.ErrorCode())
+	case errcode.ErrorCode:
+		status := err.Descriptor().HTTPStatusCode
+		return status >= 400 && status < 500 && status != http.StatusTooManyRequests && status != http.StatusUnauthorized
+	}
+	return err == distribution.ErrBlobUnknown
+}
+
+// replicate copies the manifest of the event, and the content it references,
+// to the target registry.
+func (rs *replicationSink) replicate(ctx context.Context, e Event) error {
+	name, err := reference.WithName(e.Target.Repository)
+	if err != nil {
+		return distribution.ErrRepositoryUnknown{Name: e.Target.Repository}
+	}
+
+	local, err := rs.registry.Repository(ctx, name)
+	if err != nil {
+		return err
+	}
+	remote, err := rs.remoteRepository(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	var options []distribution.ManifestServiceOption
+	if e.Target.Tag != "" {
+		options = append(options, distribution.WithTag(e.Target.Tag))
+	}
+	return rs.replicateManifest(ctx, local, remote, e.Target.Digest, options...)
+}
+
+// replicateManifest copies a manifest and its references, then puts it in
+// the remote repository. The manifests referenced by manifest lists and
+// indexes are replicated first.
+func (rs *replicationSink) replicateManifest(ctx context.Context, local, remote distribution.Repository, dgst digest.Digest, options ...distribution.ManifestServiceOption) error {
+	localManifests, err := local.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	manifest, err := localManifests.Get(ctx, dgst)
+	if err != nil {
+		return err
+	}
+
+	manifestTypes := make(map[string]bool)
+	for _, mediaType := range distribution.ManifestMediaTypes() {
+		manifestTypes[mediaType] = true
+	}
+
+	for _, ref := range manifest.References() {
+		if manifestTypes[ref.MediaType] {
+			err = rs.replicateManifest(ctx, local, remote, ref.Digest)
+		} else {
+			err = rs.replicateBlob(ctx, local, remote, ref)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	remoteManifests, err := remote.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = remoteManifests.Put(ctx, manifest, options...)
+	return err
+}
+
+// replicateBlob copies a blob missing from the remote repository, mounting it
+// from another repository of the target registry when possible.
+func (rs *replicationSink) replicateBlob(ctx context.Context, local, remote distribution.Repository, desc distribution.Descriptor) error {
+	remoteBlobs := remote.Blobs(ctx)
+	if _, err := remoteBlobs.Stat(ctx, desc.Digest); err == nil {
+		rs.addMountSource(desc.Digest, remote.Named())
+		return nil
+	} else if err != distribution.ErrBlobUnknown {
+		return err
+	}
+
+	var options []distribution.BlobCreateOption
+	if from, ok := rs.mountSources[desc.Digest]; ok && from.Name() != remote.Named().Name() {
+		canonical, err := reference.WithDigest(from, desc.Digest)
+		if err != nil {
+			return err
+		}
+		options = append(options, client.WithMountFrom(canonical))
+	}
+
+	writer, err := remoteBlobs.Create(ctx, options...)
+	if _, ok := err.(distribution.ErrBlobMounted); ok {
+		rs.addMountSource(desc.Digest, remote.Named())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	if err := rs.copyBlob(ctx, local, writer, desc); err != nil {
+		writer.Cancel(ctx)
+		return err
+	}
+
+	rs.addMountSource(desc.Digest, remote.Named())
+	return nil
+}
+
+// copyBlob uploads the content of a local blob with writer.
+func (rs *replicationSink) copyBlob(ctx context.Context, local distribution.Repository, writer distribution.BlobWriter, desc distribution.Descriptor) error {
+	localBlobs := local.Blobs(ctx)
+	localDesc, err := localBlobs.Stat(ctx, desc.Digest)
+	if err != nil {
+		return err
+	}
+
+	reader, err := localBlobs.Open(ctx, desc.Digest)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(writer, reader); err != nil {
+		return err
+	}
+	_, err = writer.Commit(ctx, localDesc)
+	return err
+}
+
+// addMountSource records that a blob exists in a repository of the target
+// registry.
+func (rs *replicationSink) addMountSource(dgst digest.Digest, name reference.Named) {
+	if len(rs.mountSources) >= maxMountSources {
+		rs.mountSources = make(map[digest.Digest]reference.Named)
+	}
+	rs.mountSources[dgst] = name
+}
+
+// remoteRepository returns the repository of the target registry, with
+// credentials to push to it and to mount blobs into it.
+func (rs *replicationSink) remoteRepository(ctx context.Context, name reference.Named) (distribution.Repository, error) {
+	if err := rs.establishChallenges(); err != nil {
+		return nil, err
+	}
+
+	scopes := []auth.Scope{
+		auth.RepositoryScope{
+			Repository: name.Name(),
+			Actions:    []string{"pull", "push"},
+		},
+	}
+	sources := make(map[string]bool)
+	for _, from := range rs.mountSources {
+		if from.Name() != name.Name() && !sources[from.Name()] {
+			sources[from.Name()] = true
+		}
+	}
+	for source := range sources {
+		scopes = append(scopes, auth.RepositoryScope{
+			Repository: source,
+			Actions:    []string{"pull"},
+		})
+	}
+
+	creds := replicationCredentials{username: rs.config.Username, password: rs.config.Password}
+	tr := transport.NewTransport(rs.config.Transport,
+		auth.NewAuthorizer(rs.cm,
+			auth.NewTokenHandlerWithOptions(auth.TokenHandlerOptions{
+				Transport:   rs.config.Transport,
+				Credentials: creds,
+				Scopes:      scopes,
+				Logger:      dcontext.GetLogger(ctx),
+			}),
+			auth.NewBasicHandler(creds)))
+
+	return client.NewRepository(name, rs.url, tr)
+}
+
+// establishChallenges pings the target registry for its auth challenges, if
+// they are not known yet.
+func (rs *replicationSink) establishChallenges() error {
+	u, err := url.Parse(rs.url)
+	if err != nil {
+		return err
+	}
+	u.Path = "/v2/"
+
+	challenges, err := rs.cm.GetChallenges(*u)
+	if err != nil {
+		return err
+	}
+	if len(challenges) > 0 {
+		return nil
+	}
+
+	resp, err := (&http.Client{Transport: rs.config.Transport}).Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return rs.cm.AddResponse(resp)
+}
+
+// replicationCredentials answers the challenges of the target registry with
+// the configured username and password.
+type replicationCredentials struct {
+	username string
+	password string
+}
+
+func (c replicationCredentials) Basic(*url.URL) (string, string) {
+	return c.username, c.password
+}
+
+func (c replicationCredentials) RefreshToken(*url.URL, string) string {
+	return ""
+}
+
+func (c replicationCredentials) SetRefreshToken(*url.URL, string, string) {
+}
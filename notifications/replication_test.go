@@ -0,0 +1,82 @@
+package notifications
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	events "github.com/docker/go-events"
+)
+
+type recordingSink struct {
+	events []events.Event
+}
+
+func (s *recordingSink) Write(event events.Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+func TestReplicationFilter(t *testing.T) {
+	sink := &recordingSink{}
+	filter := newReplicationFilter(sink, regexp.MustCompile("^team/"), regexp.MustCompile(`^v\d+$`))
+
+	event := func(action, mediaType, repository, tag string) Event {
+		var e Event
+		e.Action = action
+		e.Target.MediaType = mediaType
+		e.Target.Repository = repository
+		e.Target.Tag = tag
+		return e
+	}
+
+	for _, e := range []Event{
+		event(EventActionPush, schema2.MediaTypeManifest, "team/app", "v1"),
+		event(EventActionPull, schema2.MediaTypeManifest, "team/app", "v1"),
+		event(EventActionPush, schema2.MediaTypeLayer, "team/app", ""),
+		event(EventActionPush, schema2.MediaTypeManifest, "other/app", "v1"),
+		event(EventActionPush, schema2.MediaTypeManifest, "team/app", "latest"),
+		event(EventActionPush, schema2.MediaTypeManifest, "team/app", ""),
+	} {
+		if err := filter.Write(e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(sink.events) != 1 || sink.events[0].(Event).Target.Tag != "v1" {
+		t.Fatalf("expected only the push of team/app:v1 to be replicated, got %v", sink.events)
+	}
+}
+
+func TestReplicationPermanentErrors(t *testing.T) {
+	for _, err := range []error{
+		distribution.ErrBlobUnknown,
+		distribution.ErrManifestUnknownRevision{Name: "foo", Revision: "sha256:abc"},
+		errcode.Errors{v2.ErrorCodeManifestInvalid},
+		errcode.ErrorCodeDenied.WithMessage("denied"),
+	} {
+		if !permanent(err) {
+			t.Errorf("expected %v to be permanent", err)
+		}
+	}
+
+	for _, err := range []error{
+		errors.New("connection refused"),
+		errcode.Errors{errcode.ErrorCodeUnauthorized},
+		errcode.Errors{errcode.ErrorCodeTooManyRequests},
+		errcode.Errors{errcode.ErrorCodeUnavailable},
+		errcode.Errors{},
+	} {
+		if permanent(err) {
+			t.Errorf("expected %v to be retried", err)
+		}
+	}
+}
@@ -49,6 +49,22 @@ type Namespace interface {
 	BlobStatter() BlobStatter
 }
 
+// RepositoryFilter selects the repositories listed by a RepositorySearcher.
+type RepositoryFilter struct {
+	// Prefix selects the repositories whose name starts with it.
+	Prefix string
+
+	// Search selects the repositories whose name contains it.
+	Search string
+}
+
+// RepositorySearcher lists the repositories matching a filter.
+type RepositorySearcher interface {
+	// SearchRepositories fills 'repos' like Namespace.Repositories, with the
+	// repositories matching filter only.
+	SearchRepositories(ctx context.Context, repos []string, last string, filter RepositoryFilter) (n int, err error)
+}
+
 // RepositoryEnumerator describes an operation to enumerate repositories
 type RepositoryEnumerator interface {
 	Enumerate(ctx context.Context, ingester func(string) error) error
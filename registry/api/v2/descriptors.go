@@ -41,6 +41,14 @@ var (
 		Description: `Digest of desired blob.`,
 	}
 
+	subjectDigestPathParameter = ParameterDescriptor{
+		Name:        "digest",
+		Type:        "path",
+		Required:    true,
+		Format:      digest.DigestRegexp.String(),
+		Description: `Digest of the subject manifest.`,
+	}
+
 	hostHeader = ParameterDescriptor{
 		Name:        "Host",
 		Type:        "string",
@@ -147,6 +155,19 @@ var (
 		},
 	}
 
+	invalidFilterResponseDescriptor = ResponseDescriptor{
+		Name:        "Invalid filter",
+		Description: "The received parameter regex or order was invalid in some way, as described by the error code. The client should resolve the issue and retry the request.",
+		StatusCode:  http.StatusBadRequest,
+		Body: BodyDescriptor{
+			ContentType: "application/json",
+			Format:      errorsBody,
+		},
+		ErrorCodes: []errcode.ErrorCode{
+			ErrorCodeFilterInvalid,
+		},
+	}
+
 	repositoryNotFoundResponseDescriptor = ResponseDescriptor{
 		Name:        "No Such Repository Error",
 		StatusCode:  http.StatusNotFound,
@@ -189,6 +210,27 @@ var (
 		},
 	}
 
+	quotaExceededResponseDescriptor = ResponseDescriptor{
+		Name:        "Quota Exceeded",
+		StatusCode:  http.StatusForbidden,
+		Description: "Storing the content would exceed the storage quota of the repository or of one of its namespaces.",
+		Headers: []ParameterDescriptor{
+			{
+				Name:        "Content-Length",
+				Type:        "integer",
+				Description: "Length of the JSON response body.",
+				Format:      "<length>",
+			},
+		},
+		Body: BodyDescriptor{
+			ContentType: "application/json",
+			Format:      errorsBody,
+		},
+		ErrorCodes: []errcode.ErrorCode{
+			ErrorCodeQuotaExceeded,
+		},
+	}
+
 	tooManyRequestsDescriptor = ResponseDescriptor{
 		Name:        "Too Many Requests",
 		StatusCode:  http.StatusTooManyRequests,
@@ -200,6 +242,12 @@ var (
 				Description: "Length of the JSON response body.",
 				Format:      "<length>",
 			},
+			{
+				Name:        "Retry-After",
+				Type:        "integer",
+				Description: "The number of seconds after which the client may retry the request.",
+				Format:      "<seconds>",
+			},
 		},
 		Body: BodyDescriptor{
 			ContentType: "application/json",
@@ -509,6 +557,86 @@ var routeDescriptors = []RouteDescriptor{
 							tooManyRequestsDescriptor,
 						},
 					},
+					{
+						Name:        "Tags Details",
+						Description: "Return the tags for the specified repository matching the filters, with the details of each tag. The details are returned when the `details` parameter is `true`, or when the `Accept` header lists `application/vnd.distribution.tags.details.v1+json`. Otherwise, the filtered tags are returned as a list of names. The filters and the ordering can be combined with the pagination, whose `last` parameter then refers to the last tag of the previous response in the requested order. When ordering by time, `last` is the `lastModified` time of that tag in RFC 3339 format followed by a comma and the tag, as given by the `Link` header, so that the pagination is not affected by the tags deleted or pushed again meanwhile. A tag whose manifest is missing is left out of the details.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							{
+								Name:        "Accept",
+								Type:        "string",
+								Description: "Requests the details of the tags when listing `application/vnd.distribution.tags.details.v1+json`.",
+								Format:      "application/vnd.distribution.tags.details.v1+json",
+							},
+						},
+						PathParameters: []ParameterDescriptor{nameParameterDescriptor},
+						QueryParameters: append([]ParameterDescriptor{
+							{
+								Name:        "details",
+								Type:        "boolean",
+								Description: "Return the digest, the media type, the size and the last modification time of each tag.",
+								Format:      "true",
+							},
+							{
+								Name:        "order",
+								Type:        "string",
+								Description: "Order of the tags: `name`, the default, orders them lexically, and `time` orders them from the most recently pushed to the least recently pushed, and lexically for the same time.",
+								Format:      "name|time",
+							},
+							{
+								Name:        "prefix",
+								Type:        "string",
+								Description: "Return only the tags starting with prefix.",
+								Format:      "<prefix>",
+							},
+							{
+								Name:        "regex",
+								Type:        "string",
+								Description: "Return only the tags matching the regular expression, in the syntax of Go regular expressions.",
+								Format:      "<regex>",
+							},
+						}, paginationParameters...),
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "A list of the tags of the named repository, with their details.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+									linkHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/vnd.distribution.tags.details.v1+json",
+									Format: `{
+    "name": <name>,
+    "tags": [
+        {
+            "tag": <tag>,
+            "digest": <digest>,
+            "mediaType": <media type>,
+            "size": <size>,
+            "lastModified": <RFC 3339 time>
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							invalidFilterResponseDescriptor,
+							invalidPaginationResponseDescriptor,
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
 				},
 			},
 		},
@@ -596,6 +724,12 @@ var routeDescriptors = []RouteDescriptor{
 									},
 									contentLengthZeroHeader,
 									digestHeader,
+									{
+										Name:        "OCI-Subject",
+										Type:        "digest",
+										Description: "Digest of the manifest's subject, present only when the manifest declares a subject and the registry has indexed it as a referrer.",
+										Format:      "<digest>",
+									},
 								},
 							},
 						},
@@ -650,6 +784,7 @@ var routeDescriptors = []RouteDescriptor{
 									errcode.ErrorCodeUnsupported,
 								},
 							},
+							quotaExceededResponseDescriptor,
 						},
 					},
 				},
@@ -718,6 +853,95 @@ var routeDescriptors = []RouteDescriptor{
 		},
 	},
 
+	{
+		Name:        RouteNameReferrers,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/referrers/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Referrers",
+		Description: "List the manifests which declare the manifest identified by `digest` as their subject.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodGet,
+				Description: "Fetch an image index describing the manifests referring to the manifest identified by `name` and `digest`.",
+				Requests: []RequestDescriptor{
+					{
+						Name:        "Referrers",
+						Description: "Return all referrers of the manifest, optionally filtered by artifact type.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							subjectDigestPathParameter,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "artifactType",
+								Type:        "string",
+								Description: "Only return referrers with the given artifact type.",
+								Format:      "<media type>",
+								Required:    false,
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "An image index of the referrers of the manifest. The index is empty if there are no referrers, or the manifest does not exist.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+									{
+										Name:        "OCI-Filters-Applied",
+										Type:        "string",
+										Description: "Set to `artifactType` when the result set was filtered by artifact type.",
+										Format:      "artifactType",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/vnd.oci.image.index.v1+json",
+									Format: `{
+    "schemaVersion": 2,
+    "mediaType": "application/vnd.oci.image.index.v1+json",
+    "manifests": [
+        {
+            "mediaType": <media type>,
+            "digest": <digest>,
+            "size": <size>,
+            "artifactType": <artifact type>,
+            "annotations": { ... }
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The digest was invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+
 	{
 		Name:        RouteNameBlob,
 		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/{digest:" + digest.DigestRegexp.String() + "}",
@@ -1025,6 +1249,7 @@ var routeDescriptors = []RouteDescriptor{
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
+							quotaExceededResponseDescriptor,
 							tooManyRequestsDescriptor,
 						},
 					},
@@ -1072,6 +1297,7 @@ var routeDescriptors = []RouteDescriptor{
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
+							quotaExceededResponseDescriptor,
 							tooManyRequestsDescriptor,
 						},
 					},
@@ -1137,6 +1363,7 @@ var routeDescriptors = []RouteDescriptor{
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
+							quotaExceededResponseDescriptor,
 							tooManyRequestsDescriptor,
 						},
 					},
@@ -1462,6 +1689,7 @@ var routeDescriptors = []RouteDescriptor{
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
+							quotaExceededResponseDescriptor,
 							tooManyRequestsDescriptor,
 						},
 					},
@@ -1595,6 +1823,280 @@ var routeDescriptors = []RouteDescriptor{
 							invalidPaginationResponseDescriptor,
 						},
 					},
+					{
+						Name:        "Catalog Fetch Filtered",
+						Description: "Return the repositories whose name starts with `prefix` and contains `search`. The filters can be combined with the pagination, and are kept in the pagination links.",
+						QueryParameters: append([]ParameterDescriptor{
+							{
+								Name:        "prefix",
+								Type:        "string",
+								Description: "Return only the repositories whose name starts with prefix.",
+								Format:      "<prefix>",
+							},
+							{
+								Name:        "search",
+								Type:        "string",
+								Description: "Return only the repositories whose name contains search.",
+								Format:      "<search>",
+							},
+						}, paginationParameters...),
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"repositories": [
+		<name>,
+		...
+	]
+}`,
+								},
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+									linkHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							invalidPaginationResponseDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+
+	{
+		Name:        RouteNameQuota,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_quota",
+		Entity:      "Quota",
+		Description: "Report the storage used by the repository identified by `name`, along with the quota limits which apply to it.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodGet,
+				Description: "Fetch the storage usage of the repository and of the namespaces it belongs to.",
+				Requests: []RequestDescriptor{
+					{
+						Name:        "Quota",
+						Description: "Return the usage and limits of the repository. Limits are omitted when no limit applies.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "The number of bytes stored by the repository and by each of its namespaces which has a limit.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "name": <name>,
+    "usage": <bytes>,
+    "limit": <bytes>,
+    "namespaces": [
+        {
+            "namespace": <namespace>,
+            "usage": <bytes>,
+            "limit": <bytes>
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Not allowed",
+								Description: "Quotas are not enabled on the registry.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+
+	{
+		Name:        RouteNameRepository,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_repository",
+		Entity:      "Repository",
+		Description: "Manage the repository identified by `name`.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodDelete,
+				Description: "Delete the repository identified by `name`, with all its tags and manifests. The blobs are no longer linked into the repository, and are left to garbage collection. This endpoint requires the `delete` action on the repository.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:       "Invalid Name",
+								StatusCode: http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							{
+								Name:        "Denied",
+								StatusCode:  http.StatusForbidden,
+								Description: "The access controller denied the deletion, or one of the tags of the repository is immutable.",
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeDenied,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Repository delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+
+	{
+		Name:        RouteNameSignedBlob,
+		Path:        "/v2/_blobs/{path:.+}",
+		Entity:      "Signed Blob",
+		Description: "Download the content stored at `path` by the storage driver, through a time-limited URL signed by the registry. The registry redirects blob downloads to such URLs when a storage driver or middleware is configured to issue them.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodGet,
+				Description: "Retrieve the content stored at `path`. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data. No authorization is required, the signature granting access to the content until the URL expires.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Fetch Signed Blob",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							{
+								Name:        "path",
+								Type:        "string",
+								Format:      "<path>",
+								Required:    true,
+								Description: "Path of the content in the storage driver.",
+							},
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "expires",
+								Type:        "integer",
+								Format:      "<unix time>",
+								Required:    true,
+								Description: "Time at which the URL expires.",
+							},
+							{
+								Name:        "signature",
+								Type:        "string",
+								Format:      "<signature>",
+								Required:    true,
+								Description: "Signature of `path` and `expires` with the HTTP secret of the registry.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The content is available in the body of the response.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "The length of the requested content.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/octet-stream",
+									Format:      "<blob binary data>",
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Signature",
+								Description: "The signature is invalid or the URL has expired.",
+								StatusCode:  http.StatusForbidden,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeDenied,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The content is not stored at `path`.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+						},
+					},
 				},
 			},
 		},
@@ -155,4 +155,28 @@ var (
 		the maximum allowed.`,
 		HTTPStatusCode: http.StatusBadRequest,
 	})
+
+	// ErrorCodeQuotaExceeded is returned when storing content would exceed
+	// the quota of the repository or of one of its namespaces.
+	ErrorCodeQuotaExceeded = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "QUOTA_EXCEEDED",
+		Message: "storage quota exceeded",
+		Description: `Returned when a blob upload or a manifest put would
+		exceed the storage quota of the repository or of one of its
+		namespaces. The detail reports the exceeded limit and the current
+		usage.`,
+		HTTPStatusCode: http.StatusForbidden,
+	})
+
+	// ErrorCodeFilterInvalid is returned when the parameters filtering or
+	// ordering a listing are invalid.
+	ErrorCodeFilterInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "FILTER_INVALID",
+		Message: "invalid filter or ordering requested",
+		Description: `Returned when the parameters filtering or ordering
+		the entries of a listing are invalid, such as a regular expression
+		which does not compile or an unknown ordering. The detail reports the
+		invalid parameter.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
 )
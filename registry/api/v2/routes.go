@@ -16,6 +16,10 @@ const (
 	RouteNameBlobUpload      = "blob-upload"
 	RouteNameBlobUploadChunk = "blob-upload-chunk"
 	RouteNameCatalog         = "catalog"
+	RouteNameReferrers       = "referrers"
+	RouteNameQuota           = "quota"
+	RouteNameRepository      = "repository"
+	RouteNameSignedBlob      = "signed-blob"
 )
 
 var (
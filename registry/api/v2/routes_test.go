@@ -96,6 +96,28 @@ func TestRouter(t *testing.T) {
 				"digest": "sha256:abcdef0919234",
 			},
 		},
+		{
+			RouteName:  RouteNameReferrers,
+			RequestURI: "/v2/foo/bar/referrers/sha256:abcdef0919234",
+			Vars: map[string]string{
+				"name":   "foo/bar",
+				"digest": "sha256:abcdef0919234",
+			},
+		},
+		{
+			RouteName:  RouteNameQuota,
+			RequestURI: "/v2/foo/bar/_quota",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameRepository,
+			RequestURI: "/v2/foo/bar/_repository",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
 		{
 			RouteName:  RouteNameBlobUpload,
 			RequestURI: "/v2/foo/bar/blobs/uploads/",
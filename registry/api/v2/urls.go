@@ -162,6 +162,45 @@ func (ub *URLBuilder) BuildManifestURL(ref reference.Named) (string, error) {
 	return manifestURL.String(), nil
 }
 
+// BuildReferrersURL constructs a url to list the manifests referring to the
+// manifest identified by ref.
+func (ub *URLBuilder) BuildReferrersURL(ref reference.Canonical, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameReferrers)
+
+	referrersURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(referrersURL, values...).String(), nil
+}
+
+// BuildQuotaURL constructs a url to report the storage usage of the
+// repository identified by name.
+func (ub *URLBuilder) BuildQuotaURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameQuota)
+
+	quotaURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return quotaURL.String(), nil
+}
+
+// BuildRepositoryURL constructs a url to manage the repository identified by
+// name.
+func (ub *URLBuilder) BuildRepositoryURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameRepository)
+
+	repositoryURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return repositoryURL.String(), nil
+}
+
 // BuildBlobURL constructs the url for the blob identified by name and dgst.
 func (ub *URLBuilder) BuildBlobURL(ref reference.Canonical) (string, error) {
 	route := ub.cloneRoute(RouteNameBlob)
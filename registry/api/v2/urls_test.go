@@ -71,6 +71,33 @@ func makeURLBuilderTestCases(urlBuilder *URLBuilder) []urlBuilderTestCase {
 				return urlBuilder.BuildManifestURL(fooBarRef)
 			},
 		},
+		{
+			description:  "build referrers url",
+			expectedPath: "/v2/foo/bar/referrers/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5?artifactType=application%2Fvnd.example%2Bjson",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				ref, _ := reference.WithDigest(fooBarRef, "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+				return urlBuilder.BuildReferrersURL(ref, url.Values{
+					"artifactType": []string{"application/vnd.example+json"},
+				})
+			},
+		},
+		{
+			description:  "build quota url",
+			expectedPath: "/v2/foo/bar/_quota",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildQuotaURL(fooBarRef)
+			},
+		},
+		{
+			description:  "build repository url",
+			expectedPath: "/v2/foo/bar/_repository",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildRepositoryURL(fooBarRef)
+			},
+		},
 		{
 			description:  "build blob url",
 			expectedPath: "/v2/foo/bar/blobs/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
@@ -0,0 +1,169 @@
+// Package audit writes the audit log of the registry: a trail of JSON
+// records of who pushed, tagged, mounted or deleted what, of the content
+// removed by the background jobs, and of the requests which were denied
+// access. It is separate from the access and
+// application logs, and written to a file or sent to syslog.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/opencontainers/go-digest"
+)
+
+// The actions recorded.
+const (
+	// ActionPush records a blob, or a manifest pushed by digest.
+	ActionPush = "push"
+	// ActionTag records a manifest pushed by tag.
+	ActionTag = "tag"
+	// ActionMount records a blob mounted from another repository.
+	ActionMount = "mount"
+	// ActionDelete records a manifest, blob, tag or repository deleted.
+	ActionDelete = "delete"
+	// ActionDeny records a request denied access.
+	ActionDeny = "deny"
+	// ActionQuarantine records a blob or link moved to the quarantine
+	// directory.
+	ActionQuarantine = "quarantine"
+)
+
+// The types of the targets of the actions.
+const (
+	TargetManifest   = "manifest"
+	TargetBlob       = "blob"
+	TargetTag        = "tag"
+	TargetRepository = "repository"
+	TargetLink       = "link"
+)
+
+// Record is an entry of the audit log.
+type Record struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+
+	// Target is what the action applied to, nil for the denied requests.
+	Target *Target `json:"target,omitempty"`
+
+	// Access is the access which was requested by a denied request, and
+	// Reason why it was denied.
+	Access []Access `json:"access,omitempty"`
+	Reason string   `json:"reason,omitempty"`
+
+	// User is the name of the authenticated user, or the name sent with
+	// the basic credentials of a denied request. Claims are the claims of
+	// the token the user authenticated with.
+	User   string                 `json:"user,omitempty"`
+	Claims map[string]interface{} `json:"claims,omitempty"`
+
+	// Actor is the background job which made the action, such as the
+	// retention policies, for the actions made by no request.
+	Actor string `json:"actor,omitempty"`
+
+	// Request is the request which made the action, nil for the actions of
+	// the background jobs.
+	Request *Request `json:"request,omitempty"`
+}
+
+// Target describes what an action applied to.
+type Target struct {
+	Type       string        `json:"type"`
+	Repository string        `json:"repository"`
+	Digest     digest.Digest `json:"digest,omitempty"`
+	Tag        string        `json:"tag,omitempty"`
+	MediaType  string        `json:"mediaType,omitempty"`
+	Size       int64         `json:"size,omitempty"`
+
+	// From is the repository a blob was mounted from.
+	From string `json:"from,omitempty"`
+}
+
+// Access is an action requested on a resource.
+type Access struct {
+	Type   string `json:"type"`
+	Name   string `json:"name,omitempty"`
+	Action string `json:"action"`
+}
+
+// Request describes the request which caused an action.
+type Request struct {
+	ID        string `json:"id"`
+	IP        string `json:"ip"`
+	Host      string `json:"host"`
+	Method    string `json:"method"`
+	URI       string `json:"uri"`
+	UserAgent string `json:"useragent"`
+}
+
+// sink is where the encoded records are written, one at a time.
+type sink interface {
+	write(line []byte) error
+	close() error
+}
+
+// Logger writes the records of the audit log. It is safe for concurrent use.
+type Logger struct {
+	mu   sync.Mutex
+	sink sink
+}
+
+// New returns the logger configured by config, nil if the audit log is not
+// enabled.
+func New(config configuration.Audit) (*Logger, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	var (
+		s   sink
+		err error
+	)
+	switch config.Output {
+	case "", "file":
+		if config.File.Path == "" {
+			return nil, fmt.Errorf("audit.file.path must be set")
+		}
+		if config.File.MaxSize < 0 || config.File.MaxBackups < 0 {
+			return nil, fmt.Errorf("audit.file.maxsize and audit.file.maxbackups must not be negative")
+		}
+		s, err = openFile(config.File.Path, config.File.MaxSize, config.File.MaxBackups)
+	case "syslog":
+		s, err = dialSyslog(config.Syslog.Network, config.Syslog.Address, config.Syslog.Tag)
+	default:
+		return nil, fmt.Errorf("unknown audit output %q", config.Output)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening the audit log: %v", err)
+	}
+	return &Logger{sink: s}, nil
+}
+
+// Log writes record, setting its time if it is not set. The record is
+// written once Log returns without error.
+func (l *Logger) Log(record Record) error {
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.sink.write(line)
+}
+
+// Close closes the file or the connection the records are written to, once
+// the records written are flushed.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.sink.close()
+}
@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+)
+
+func readRecords(t *testing.T, path string) []Record {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	config := configuration.Audit{Enabled: true}
+	config.File.Path = path
+
+	logger, err := New(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	record := Record{
+		Action: ActionTag,
+		Target: &Target{Type: TargetManifest, Repository: "foo/bar", Digest: "sha256:abc", Tag: "latest"},
+		User:   "alice",
+		Claims: map[string]interface{}{"iss": "issuer"},
+		Request: &Request{
+			ID: "request",
+			IP: "192.0.2.1",
+		},
+	}
+	if err := logger.Log(record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the file is appended to when opened again
+	logger, err = New(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer logger.Close()
+	if err := logger.Log(Record{Action: ActionDeny, Reason: "denied"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	records := readRecords(t, path)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if records[0].Time.IsZero() {
+		t.Error("expected the time of the record to be set")
+	}
+	if records[0].User != "alice" || *records[0].Target != *record.Target || records[0].Claims["iss"] != "issuer" {
+		t.Errorf("unexpected record %+v", records[0])
+	}
+	if records[1].Action != ActionDeny || records[1].Target != nil {
+		t.Errorf("unexpected record %+v", records[1])
+	}
+}
+
+func TestLogFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	config := configuration.Audit{Enabled: true}
+	config.File.Path = path
+	config.File.MaxSize = 1024
+	config.File.MaxBackups = 2
+
+	// an unrelated file is left alone
+	unrelated := path + ".old"
+	if err := os.WriteFile(unrelated, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := New(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer logger.Close()
+
+	record := Record{Action: ActionPush, Reason: strings.Repeat("x", 400)}
+	for i := 0; i < 10; i++ {
+		if err := logger.Log(record); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() > config.File.MaxSize {
+		t.Errorf("expected the file to be rotated before exceeding %d bytes, got %d", config.File.MaxSize, fi.Size())
+	}
+	if len(readRecords(t, path)) == 0 {
+		t.Error("expected the latest records in the file")
+	}
+
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 3 {
+		t.Fatalf("expected 2 backups and the unrelated file, got %v", matches)
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("expected the unrelated file to be kept: %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	logger, err := New(configuration.Audit{})
+	if err != nil || logger != nil {
+		t.Fatalf("expected no logger when disabled, got %v, %v", logger, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for _, config := range []configuration.Audit{
+		{Enabled: true},
+		{Enabled: true, Output: "kafka"},
+		{Enabled: true, File: configuration.AuditFile{Path: path, MaxSize: -1}},
+		{Enabled: true, File: configuration.AuditFile{Path: filepath.Join(path, "missing", "audit.log")}},
+	} {
+		if _, err := New(config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
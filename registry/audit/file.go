@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat is the suffix of the rotated files, sorting in the order
+// they were rotated.
+const backupTimeFormat = "20060102T150405.000000000Z"
+
+// file appends the records to a file, which is rotated once it reaches
+// maxSize bytes: it is renamed with the time of the rotation as suffix, and
+// the oldest rotated files beyond maxBackups are removed.
+type file struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	f    *os.File
+	size int64
+}
+
+func openFile(path string, maxSize int64, maxBackups int) (*file, error) {
+	fl := &file{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := fl.open(); err != nil {
+		return nil, err
+	}
+	return fl, nil
+}
+
+// open opens the file for appending, creating it if needed.
+func (fl *file) open() error {
+	f, err := os.OpenFile(fl.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	fl.f = f
+	fl.size = fi.Size()
+	return nil
+}
+
+func (fl *file) write(line []byte) error {
+	if fl.maxSize > 0 && fl.size > 0 && fl.size+int64(len(line))+1 > fl.maxSize {
+		if err := fl.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := fl.f.Write(append(line, '\n'))
+	fl.size += int64(n)
+	return err
+}
+
+// rotate renames the file, opens a new one and removes the oldest backups.
+func (fl *file) rotate() error {
+	if err := fl.f.Close(); err != nil {
+		return err
+	}
+	backup := fl.path + "." + time.Now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(fl.path, backup); err != nil {
+		// keep appending to the current file rather than losing records
+		if openErr := fl.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := fl.open(); err != nil {
+		return err
+	}
+	if fl.maxBackups > 0 {
+		return fl.removeBackups()
+	}
+	return nil
+}
+
+// removeBackups removes the oldest rotated files beyond maxBackups.
+func (fl *file) removeBackups() error {
+	matches, err := filepath.Glob(fl.path + ".*")
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, match := range matches {
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(match, fl.path+".")); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	if len(backups) <= fl.maxBackups {
+		return nil
+	}
+
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-fl.maxBackups] {
+		if err := os.Remove(backup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fl *file) close() error {
+	if err := fl.f.Sync(); err != nil {
+		fl.f.Close()
+		return err
+	}
+	return fl.f.Close()
+}
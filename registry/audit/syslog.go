@@ -0,0 +1,34 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package audit
+
+import "log/syslog"
+
+// defaultSyslogTag is the tag of the records sent to syslog when none is
+// configured.
+const defaultSyslogTag = "registry"
+
+// syslogWriter sends each record to syslog as a message of the auth facility.
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+func dialSyslog(network, address, tag string) (*syslogWriter, error) {
+	if tag == "" {
+		tag = defaultSyslogTag
+	}
+	w, err := syslog.Dial(network, address, syslog.LOG_AUTH|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogWriter{w: w}, nil
+}
+
+func (s *syslogWriter) write(line []byte) error {
+	return s.w.Info(string(line))
+}
+
+func (s *syslogWriter) close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package audit
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func dialSyslog(network, address, tag string) (sink, error) {
+	return nil, fmt.Errorf("syslog is not supported on %s", runtime.GOOS)
+}
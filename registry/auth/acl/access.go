@@ -0,0 +1,197 @@
+// Package acl provides an authentication scheme which checks the user
+// credentials against an htpasswd file, and authorizes the requested access
+// to repositories according to an access control list read from a policy
+// file. Both files are reloaded whenever they change.
+//
+// This authentication method MUST be used under TLS, as simple token-replay attack is possible.
+package acl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/distribution/registry/auth/htpasswd"
+)
+
+type accessController struct {
+	realm       string
+	credentials *htpasswd.File
+	policy      *File
+}
+
+var _ auth.AccessController = &accessController{}
+
+func newAccessController(options map[string]interface{}) (auth.AccessController, error) {
+	realm, present := options["realm"]
+	if _, ok := realm.(string); !present || !ok {
+		return nil, fmt.Errorf(`"realm" must be set for acl access controller`)
+	}
+
+	htpasswdPath, ok := options["htpasswd"].(string)
+	if !ok || htpasswdPath == "" {
+		return nil, fmt.Errorf(`"htpasswd" must be set for acl access controller`)
+	}
+	if _, err := os.Stat(htpasswdPath); err != nil {
+		return nil, err
+	}
+
+	policyPath, ok := options["policy"].(string)
+	if !ok || policyPath == "" {
+		return nil, fmt.Errorf(`"policy" must be set for acl access controller`)
+	}
+
+	// an invalid policy prevents the registry from starting
+	policy, err := NewFile(policyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accessController{
+		realm:       realm.(string),
+		credentials: htpasswd.NewFile(htpasswdPath),
+		policy:      policy,
+	}, nil
+}
+
+func (ac *accessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
+	req, err := dcontext.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return nil, &challenge{
+			realm: ac.realm,
+			err:   auth.ErrInvalidCredential,
+		}
+	}
+
+	if err := ac.credentials.AuthenticateUser(username, password); err != nil {
+		if err != auth.ErrAuthenticationFailure {
+			return nil, err
+		}
+		dcontext.GetLogger(ctx).Errorf("error authenticating user %q: %v", username, err)
+		return nil, &challenge{
+			realm: ac.realm,
+			err:   auth.ErrAuthenticationFailure,
+		}
+	}
+
+	// the user is authenticated, so a denial is not a challenge: asking for
+	// the credentials again would not help
+	if err := ac.policy.Authorize(ctx, username, accessRecords...); err != nil {
+		return nil, err
+	}
+
+	return auth.WithUser(ctx, auth.UserInfo{Name: username}), nil
+}
+
+// File authorizes the access of the users according to the rules of a policy
+// file, reloading the file whenever it is modified. It can be used by other
+// access controllers as their source of access rules.
+type File struct {
+	path string
+
+	mu      sync.Mutex
+	modtime time.Time
+	policy  *policy
+}
+
+// NewFile loads the policy file at path. It returns an error if the file
+// cannot be loaded.
+func NewFile(path string) (*File, error) {
+	f := &File{path: path}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Authorize returns auth.ErrAccessDenied unless the latest version of the
+// policy grants every access to the user.
+func (f *File) Authorize(ctx context.Context, username string, accessRecords ...auth.Access) error {
+	p := f.current(ctx)
+	for _, access := range accessRecords {
+		if !p.allowed(username, access) {
+			dcontext.GetLogger(ctx).Warnf("user %q denied %s access to %s %s", username, access.Action, access.Type, access.Name)
+			return auth.ErrAccessDenied
+		}
+	}
+	return nil
+}
+
+// current returns the policy, reloading it first if the file was modified.
+// If the modified file cannot be loaded, the previous policy stays in effect.
+func (f *File) current(ctx context.Context) *policy {
+	if err := f.reload(); err != nil {
+		dcontext.GetLogger(ctx).Errorf("error reloading acl policy %s, keeping the previous one: %v", f.path, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.policy
+}
+
+// reload loads the policy file if it was modified since it was last loaded.
+func (f *File) reload() error {
+	fstat, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	lastModified := fstat.ModTime()
+	if f.policy != nil && f.modtime.Equal(lastModified) {
+		return nil
+	}
+	// a policy failing to load is not retried until it is modified again
+	f.modtime = lastModified
+
+	fp, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	p, err := parsePolicy(fp)
+	if err != nil {
+		return err
+	}
+	f.policy = p
+	return nil
+}
+
+// challenge implements the auth.Challenge interface.
+type challenge struct {
+	realm string
+	err   error
+}
+
+var _ auth.Challenge = challenge{}
+
+// SetHeaders sets the basic challenge header on the response.
+func (ch challenge) SetHeaders(r *http.Request, w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", ch.realm))
+}
+
+func (ch challenge) Error() string {
+	return fmt.Sprintf("basic authentication challenge for realm %q: %s", ch.realm, ch.err)
+}
+
+// Unwrap returns the reason of the challenge.
+func (ch challenge) Unwrap() error {
+	return ch.err
+}
+
+func init() {
+	auth.Register("acl", auth.InitFunc(newAccessController))
+}
@@ -0,0 +1,111 @@
+package acl
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+)
+
+func TestAccessController(t *testing.T) {
+	dir := t.TempDir()
+	htpasswdPath := filepath.Join(dir, "htpasswd")
+	policyPath := filepath.Join(dir, "policy.yml")
+
+	if err := os.WriteFile(htpasswdPath, []byte("frodo:$2y$05$926C3y10Quzn/LnqQH86VOEVh/18T6RnLaS.khre96jLNL/7e.K5W\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	writePolicy := func(content string, modtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(policyPath, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		// make sure the change is noticed, whatever the resolution of the
+		// modification times
+		if err := os.Chtimes(policyPath, modtime, modtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	writePolicy(`rules: [{users: [frodo], repositories: ["shire/*"], actions: [pull]}]`, now)
+
+	accessController, err := auth.GetAccessController("acl", map[string]interface{}{
+		"realm":    "middle-earth",
+		"htpasswd": htpasswdPath,
+		"policy":   policyPath,
+	})
+	if err != nil {
+		t.Fatalf("error creating access controller: %v", err)
+	}
+
+	authorized := func(username, password string, access auth.Access) error {
+		req, _ := http.NewRequest(http.MethodGet, "/v2/", nil)
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		ctx, err := accessController.Authorized(context.WithRequest(context.Background(), req), access)
+		if err != nil {
+			return err
+		}
+		if name := ctx.Value(auth.UserKey).(auth.UserInfo).Name; name != username {
+			t.Fatalf("expected user %q, got %q", username, name)
+		}
+		return nil
+	}
+	pull := auth.Access{Resource: auth.Resource{Type: "repository", Name: "shire/hobbiton"}, Action: "pull"}
+	push := auth.Access{Resource: auth.Resource{Type: "repository", Name: "shire/hobbiton"}, Action: "push"}
+
+	for _, tc := range []struct {
+		username, password string
+		access             auth.Access
+		expected           error
+	}{
+		{"", "", pull, auth.ErrInvalidCredential},
+		{"frodo", "sackville", pull, auth.ErrAuthenticationFailure},
+		{"frodo", "baggins", push, auth.ErrAccessDenied},
+		{"frodo", "baggins", pull, nil},
+	} {
+		err := authorized(tc.username, tc.password, tc.access)
+		if tc.expected == nil {
+			if err != nil {
+				t.Fatalf("%s %s: unexpected error: %v", tc.username, tc.access.Action, err)
+			}
+			continue
+		}
+		if tc.expected == auth.ErrAccessDenied {
+			if err != auth.ErrAccessDenied {
+				t.Fatalf("%s %s: expected %v, got %v", tc.username, tc.access.Action, tc.expected, err)
+			}
+			continue
+		}
+		ch, ok := err.(*challenge)
+		if !ok || ch.err != tc.expected {
+			t.Fatalf("%s %s: expected challenge with %v, got %v", tc.username, tc.access.Action, tc.expected, err)
+		}
+	}
+
+	// the policy is reloaded when modified
+	writePolicy(`rules: [{users: [frodo], repositories: ["shire/*"], actions: [pull, push]}]`, now.Add(time.Second))
+	if err := authorized("frodo", "baggins", push); err != nil {
+		t.Fatalf("expected push to be allowed after reloading the policy: %v", err)
+	}
+
+	// and kept when the modified policy is invalid
+	writePolicy(`rules: [{users: [frodo], actions: [fly]}]`, now.Add(2*time.Second))
+	if err := authorized("frodo", "baggins", push); err != nil {
+		t.Fatalf("expected the previous policy to be kept: %v", err)
+	}
+
+	// an invalid policy prevents the creation of the access controller
+	if _, err := newAccessController(map[string]interface{}{
+		"realm":    "middle-earth",
+		"htpasswd": htpasswdPath,
+		"policy":   policyPath,
+	}); err == nil {
+		t.Fatalf("expected error creating access controller with an invalid policy")
+	}
+}
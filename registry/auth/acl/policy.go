@@ -0,0 +1,169 @@
+package acl
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/docker/distribution/registry/auth"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	actionPull   = "pull"
+	actionPush   = "push"
+	actionDelete = "delete"
+	actionAll    = "*"
+
+	// anyUser matches every authenticated user in the users of a rule.
+	anyUser = "*"
+)
+
+// policyFile is the format of the policy file. Being a subset of YAML, JSON
+// documents are accepted too.
+type policyFile struct {
+	// Groups maps group names to their members.
+	Groups map[string][]string `yaml:"groups"`
+
+	// Rules grant access to the users and the members of the groups they
+	// list. Access is denied unless a rule grants it.
+	Rules []ruleFile `yaml:"rules"`
+}
+
+type ruleFile struct {
+	Users        []string `yaml:"users"`
+	Groups       []string `yaml:"groups"`
+	Repositories []string `yaml:"repositories"`
+	Actions      []string `yaml:"actions"`
+	Catalog      bool     `yaml:"catalog"`
+}
+
+// policy is the parsed form of a policy file.
+type policy struct {
+	rules []rule
+}
+
+type rule struct {
+	users        map[string]struct{}
+	repositories []*regexp.Regexp
+	actions      map[string]struct{}
+	catalog      bool
+}
+
+// parsePolicy reads a policy file, resolving the groups of the rules to
+// their members.
+func parsePolicy(rd io.Reader) (*policy, error) {
+	content, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	var pf policyFile
+	if err := yaml.UnmarshalStrict(content, &pf); err != nil {
+		return nil, fmt.Errorf("acl: invalid policy: %v", err)
+	}
+
+	p := &policy{}
+	for i, rf := range pf.Rules {
+		r := rule{
+			users:   make(map[string]struct{}),
+			actions: make(map[string]struct{}),
+			catalog: rf.Catalog,
+		}
+
+		for _, user := range rf.Users {
+			r.users[user] = struct{}{}
+		}
+		for _, group := range rf.Groups {
+			members, ok := pf.Groups[group]
+			if !ok {
+				return nil, fmt.Errorf("acl: rule %d: unknown group %q", i, group)
+			}
+			for _, member := range members {
+				r.users[member] = struct{}{}
+			}
+		}
+
+		for _, pattern := range rf.Repositories {
+			re, err := compileGlob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("acl: rule %d: invalid repository pattern %q: %v", i, pattern, err)
+			}
+			r.repositories = append(r.repositories, re)
+		}
+
+		for _, action := range rf.Actions {
+			switch action {
+			case actionPull, actionPush, actionDelete:
+				r.actions[action] = struct{}{}
+			case actionAll:
+				r.actions[actionPull] = struct{}{}
+				r.actions[actionPush] = struct{}{}
+				r.actions[actionDelete] = struct{}{}
+			default:
+				return nil, fmt.Errorf("acl: rule %d: unknown action %q", i, action)
+			}
+		}
+
+		p.rules = append(p.rules, r)
+	}
+
+	return p, nil
+}
+
+// allowed returns whether a rule of the policy grants the access to the
+// user.
+func (p *policy) allowed(user string, access auth.Access) bool {
+	for _, r := range p.rules {
+		if _, ok := r.users[user]; !ok {
+			if _, ok := r.users[anyUser]; !ok {
+				continue
+			}
+		}
+
+		switch access.Type {
+		case "registry":
+			if access.Name == "catalog" && r.catalog {
+				return true
+			}
+		case "repository":
+			if _, ok := r.actions[access.Action]; !ok {
+				continue
+			}
+			for _, re := range r.repositories {
+				if re.MatchString(access.Name) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// compileGlob compiles a repository name pattern, where "*" matches any
+// sequence of characters within a path component and "**" any sequence of
+// characters across path components.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			expr.WriteString("[^/]*")
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+
+	return regexp.Compile(expr.String())
+}
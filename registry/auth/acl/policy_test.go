@@ -0,0 +1,87 @@
+package acl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/registry/auth"
+)
+
+func TestPolicy(t *testing.T) {
+	p, err := parsePolicy(strings.NewReader(`
+groups:
+  developers: [frodo, sam]
+  admins: [gandalf]
+rules:
+  - groups: [developers]
+    repositories: ["shire/*"]
+    actions: [pull, push]
+  - users: [frodo]
+    repositories: ["mordor/**"]
+    actions: [delete]
+  - users: ["*"]
+    repositories: [library/*]
+    actions: [pull]
+  - groups: [admins]
+    repositories: ["**"]
+    actions: ["*"]
+    catalog: true
+`))
+	if err != nil {
+		t.Fatalf("unexpected error parsing policy: %v", err)
+	}
+
+	repository := func(name, action string) auth.Access {
+		return auth.Access{Resource: auth.Resource{Type: "repository", Name: name}, Action: action}
+	}
+	catalog := auth.Access{Resource: auth.Resource{Type: "registry", Name: "catalog"}, Action: "*"}
+
+	for _, tc := range []struct {
+		user    string
+		access  auth.Access
+		allowed bool
+	}{
+		{"sam", repository("shire/hobbiton", "pull"), true},
+		{"sam", repository("shire/hobbiton", "push"), true},
+		{"sam", repository("shire/hobbiton", "delete"), false},
+		{"sam", repository("shire/hobbiton/bagend", "pull"), false},
+		{"sam", repository("shireling", "pull"), false},
+		{"frodo", repository("mordor/mount/doom", "delete"), true},
+		{"frodo", repository("mordor/mount/doom", "pull"), false},
+		{"sam", repository("mordor/mount/doom", "delete"), false},
+		{"sam", repository("library/ubuntu", "pull"), true},
+		{"sam", repository("library/ubuntu", "push"), false},
+		{"sam", catalog, false},
+		{"gandalf", repository("any/where/at/all", "delete"), true},
+		{"gandalf", catalog, true},
+	} {
+		if allowed := p.allowed(tc.user, tc.access); allowed != tc.allowed {
+			t.Errorf("%s %s %s: expected allowed %v, got %v", tc.user, tc.access.Action, tc.access.Name, tc.allowed, allowed)
+		}
+	}
+}
+
+func TestPolicyJSON(t *testing.T) {
+	p, err := parsePolicy(strings.NewReader(`{"rules": [{"users": ["frodo"], "repositories": ["shire/*"], "actions": ["pull"]}]}`))
+	if err != nil {
+		t.Fatalf("unexpected error parsing policy: %v", err)
+	}
+
+	access := auth.Access{Resource: auth.Resource{Type: "repository", Name: "shire/hobbiton"}, Action: "pull"}
+	if !p.allowed("frodo", access) {
+		t.Fatalf("expected access to be allowed")
+	}
+}
+
+func TestPolicyInvalid(t *testing.T) {
+	for _, content := range []string{
+		`rules: [{groups: [unknown], repositories: ["*"], actions: [pull]}]`,
+		`rules: [{users: [frodo], repositories: ["*"], actions: [fly]}]`,
+		`rules: [{users: [frodo], repositories: [""], actions: [pull]}]`,
+		`rules: [{users: [frodo], repository: ["*"], actions: [pull]}]`,
+	} {
+		if _, err := parsePolicy(strings.NewReader(content)); err == nil {
+			t.Errorf("expected error parsing policy %q", content)
+		}
+	}
+}
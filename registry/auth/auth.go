@@ -54,12 +54,20 @@ var (
 
 	// ErrAuthenticationFailure returned when authentication fails.
 	ErrAuthenticationFailure = errors.New("authentication failure")
+
+	// ErrAccessDenied is returned when the authenticated user is not granted
+	// the access.
+	ErrAccessDenied = errors.New("access denied")
 )
 
 // UserInfo carries information about
 // an autenticated/authorized client.
 type UserInfo struct {
 	Name string
+
+	// Claims are the claims of the token the user authenticated with, nil
+	// if the user did not authenticate with a token.
+	Claims map[string]interface{}
 }
 
 // Resource describes a resource by type and name.
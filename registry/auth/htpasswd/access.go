@@ -23,11 +23,8 @@ import (
 )
 
 type accessController struct {
-	realm    string
-	path     string
-	modtime  time.Time
-	mu       sync.Mutex
-	htpasswd *htpasswd
+	realm string
+	file  *File
 }
 
 var _ auth.AccessController = &accessController{}
@@ -46,7 +43,7 @@ func newAccessController(options map[string]interface{}) (auth.AccessController,
 	if err := createHtpasswdFile(path); err != nil {
 		return nil, err
 	}
-	return &accessController{realm: realm.(string), path: path}, nil
+	return &accessController{realm: realm.(string), file: NewFile(path)}, nil
 }
 
 func (ac *accessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
@@ -63,43 +60,70 @@ func (ac *accessController) Authorized(ctx context.Context, accessRecords ...aut
 		}
 	}
 
+	if err := ac.file.AuthenticateUser(username, password); err != nil {
+		if err != auth.ErrAuthenticationFailure {
+			return nil, err
+		}
+		dcontext.GetLogger(ctx).Errorf("error authenticating user %q: %v", username, err)
+		return nil, &challenge{
+			realm: ac.realm,
+			err:   auth.ErrAuthenticationFailure,
+		}
+	}
+
+	return auth.WithUser(ctx, auth.UserInfo{Name: username}), nil
+}
+
+// File authenticates users against the credentials of an htpasswd file,
+// reloading the file whenever it is modified. It can be used by other access
+// controllers as their source of credentials.
+type File struct {
+	path     string
+	modtime  time.Time
+	mu       sync.Mutex
+	htpasswd *htpasswd
+}
+
+var _ auth.CredentialAuthenticator = &File{}
+
+// NewFile returns a File for the htpasswd file at path.
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// AuthenticateUser checks the credentials against the latest version of the
+// file. It returns auth.ErrAuthenticationFailure if they do not match, or the
+// error reading the file.
+func (f *File) AuthenticateUser(username, password string) error {
 	// Dynamically parsing the latest account list
-	fstat, err := os.Stat(ac.path)
+	fstat, err := os.Stat(f.path)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	lastModified := fstat.ModTime()
-	ac.mu.Lock()
-	if ac.htpasswd == nil || !ac.modtime.Equal(lastModified) {
-		ac.modtime = lastModified
+	f.mu.Lock()
+	if f.htpasswd == nil || !f.modtime.Equal(lastModified) {
+		f.modtime = lastModified
 
-		f, err := os.Open(ac.path)
+		fp, err := os.Open(f.path)
 		if err != nil {
-			ac.mu.Unlock()
-			return nil, err
+			f.mu.Unlock()
+			return err
 		}
-		defer f.Close()
+		defer fp.Close()
 
-		h, err := newHTPasswd(f)
+		h, err := newHTPasswd(fp)
 		if err != nil {
-			ac.mu.Unlock()
-			return nil, err
+			f.mu.Unlock()
+			return err
 		}
-		ac.htpasswd = h
+		f.htpasswd = h
 	}
-	localHTPasswd := ac.htpasswd
-	ac.mu.Unlock()
+	localHTPasswd := f.htpasswd
+	f.mu.Unlock()
 
-	if err := localHTPasswd.authenticateUser(username, password); err != nil {
-		dcontext.GetLogger(ctx).Errorf("error authenticating user %q: %v", username, err)
-		return nil, &challenge{
-			realm: ac.realm,
-			err:   auth.ErrAuthenticationFailure,
-		}
-	}
-
-	return auth.WithUser(ctx, auth.UserInfo{Name: username}), nil
+	return localHTPasswd.authenticateUser(username, password)
 }
 
 // challenge implements the auth.Challenge interface.
@@ -119,6 +143,11 @@ func (ch challenge) Error() string {
 	return fmt.Sprintf("basic authentication challenge for realm %q: %s", ch.realm, ch.err)
 }
 
+// Unwrap returns the reason of the challenge.
+func (ch challenge) Unwrap() error {
+	return ch.err
+}
+
 // createHtpasswdFile creates and populates htpasswd file with a new user in case the file is missing
 func createHtpasswdFile(path string) error {
 	if f, err := os.Open(path); err == nil {
@@ -0,0 +1,140 @@
+// Package mtls provides an authentication scheme which identifies the users
+// by the client certificate verified during the TLS handshake, and authorizes
+// the requested access to repositories according to an acl policy file,
+// reloaded whenever it changes.
+//
+// The registry must be configured to verify the client certificates against
+// the CAs listed in http.tls.clientcas.
+package mtls
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/distribution/registry/auth/acl"
+)
+
+// The identities which can be read from a client certificate.
+const (
+	identityCommonName = "commonname"
+	identityDNS        = "dns"
+	identityEmail      = "email"
+	identityURI        = "uri"
+)
+
+type accessController struct {
+	identity string
+	policy   *acl.File
+}
+
+var _ auth.AccessController = &accessController{}
+
+func newAccessController(options map[string]interface{}) (auth.AccessController, error) {
+	identity := identityCommonName
+	if value, present := options["identity"]; present {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf(`"identity" must be a string for mtls access controller`)
+		}
+		switch s {
+		case identityCommonName, identityDNS, identityEmail, identityURI:
+			identity = s
+		default:
+			return nil, fmt.Errorf("unknown identity %q for mtls access controller, must be one of %q, %q, %q or %q",
+				s, identityCommonName, identityDNS, identityEmail, identityURI)
+		}
+	}
+
+	policyPath, ok := options["policy"].(string)
+	if !ok || policyPath == "" {
+		return nil, fmt.Errorf(`"policy" must be set for mtls access controller`)
+	}
+
+	// an invalid policy prevents the registry from starting
+	policy, err := acl.NewFile(policyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accessController{
+		identity: identity,
+		policy:   policy,
+	}, nil
+}
+
+func (ac *accessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
+	req, err := dcontext.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil, &challenge{err: auth.ErrInvalidCredential}
+	}
+
+	cert := req.TLS.VerifiedChains[0][0]
+	username := ac.username(cert)
+	if username == "" {
+		dcontext.GetLogger(ctx).Errorf("error authenticating client certificate %q: no %s identity", cert.Subject, ac.identity)
+		return nil, &challenge{err: auth.ErrAuthenticationFailure}
+	}
+
+	// the client is authenticated, so a denial is not a challenge: another
+	// certificate would not be sent on the same connection anyway
+	if err := ac.policy.Authorize(ctx, username, accessRecords...); err != nil {
+		return nil, err
+	}
+
+	return auth.WithUser(ctx, auth.UserInfo{Name: username}), nil
+}
+
+// username returns the identity of the client certificate the user is known
+// by in the policy: its subject common name, or its first subject alternative
+// name of the configured type.
+func (ac *accessController) username(cert *x509.Certificate) string {
+	switch ac.identity {
+	case identityDNS:
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	case identityEmail:
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	case identityURI:
+		if len(cert.URIs) > 0 {
+			return cert.URIs[0].String()
+		}
+	default:
+		return cert.Subject.CommonName
+	}
+	return ""
+}
+
+// challenge implements the auth.Challenge interface.
+type challenge struct {
+	err error
+}
+
+var _ auth.Challenge = challenge{}
+
+// SetHeaders sets no header, the client certificate being requested during
+// the TLS handshake.
+func (ch challenge) SetHeaders(r *http.Request, w http.ResponseWriter) {}
+
+func (ch challenge) Error() string {
+	return fmt.Sprintf("client certificate authentication challenge: %s", ch.err)
+}
+
+// Unwrap returns the reason of the challenge.
+func (ch challenge) Unwrap() error {
+	return ch.err
+}
+
+func init() {
+	auth.Register("mtls", auth.InitFunc(newAccessController))
+}
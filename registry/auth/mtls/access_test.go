@@ -0,0 +1,104 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+)
+
+func TestAccessController(t *testing.T) {
+	policyPath := filepath.Join(t.TempDir(), "policy.yml")
+	policy := `rules:
+  - users: [runner, runner.ci.example.com, "spiffe://example.com/ci/runner"]
+    repositories: ["ci/*"]
+    actions: [pull, push]
+`
+	if err := os.WriteFile(policyPath, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	spiffeID, _ := url.Parse("spiffe://example.com/ci/runner")
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "runner"},
+		DNSNames: []string{"runner.ci.example.com"},
+		URIs:     []*url.URL{spiffeID},
+	}
+	pull := auth.Access{Resource: auth.Resource{Type: "repository", Name: "ci/build"}, Action: "pull"}
+	deleteAccess := auth.Access{Resource: auth.Resource{Type: "repository", Name: "ci/build"}, Action: "delete"}
+
+	for _, tc := range []struct {
+		identity string
+		username string
+		err      error
+	}{
+		{"", "runner", nil},
+		{identityCommonName, "runner", nil},
+		{identityDNS, "runner.ci.example.com", nil},
+		{identityURI, "spiffe://example.com/ci/runner", nil},
+		{identityEmail, "", auth.ErrAuthenticationFailure},
+	} {
+		options := map[string]interface{}{"policy": policyPath}
+		if tc.identity != "" {
+			options["identity"] = tc.identity
+		}
+		accessController, err := auth.GetAccessController("mtls", options)
+		if err != nil {
+			t.Fatalf("error creating access controller: %v", err)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, "/v2/", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		ctx, err := accessController.Authorized(context.WithRequest(context.Background(), req), pull)
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("identity %q: expected error %v, got %v", tc.identity, tc.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		if name := ctx.Value(auth.UserKey).(auth.UserInfo).Name; name != tc.username {
+			t.Errorf("identity %q: expected user %q, got %q", tc.identity, tc.username, name)
+		}
+
+		_, err = accessController.Authorized(context.WithRequest(context.Background(), req), deleteAccess)
+		if !errors.Is(err, auth.ErrAccessDenied) {
+			t.Errorf("identity %q: expected access to be denied, got %v", tc.identity, err)
+		}
+		if _, ok := err.(auth.Challenge); ok {
+			t.Errorf("identity %q: expected a denial rather than a challenge, got %v", tc.identity, err)
+		}
+
+		// a certificate which was not verified is not an identity
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		_, err = accessController.Authorized(context.WithRequest(context.Background(), req), pull)
+		if !errors.Is(err, auth.ErrInvalidCredential) {
+			t.Errorf("identity %q: expected invalid credentials, got %v", tc.identity, err)
+		}
+	}
+}
+
+func TestNewAccessControllerOptions(t *testing.T) {
+	policyPath := filepath.Join(t.TempDir(), "policy.yml")
+	if err := os.WriteFile(policyPath, []byte("rules: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, options := range []map[string]interface{}{
+		{},
+		{"policy": filepath.Join(t.TempDir(), "missing.yml")},
+		{"policy": policyPath, "identity": "serial"},
+		{"policy": policyPath, "identity": 1},
+	} {
+		if _, err := newAccessController(options); err == nil {
+			t.Errorf("expected an error for options %v", options)
+		}
+	}
+}
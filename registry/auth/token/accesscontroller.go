@@ -90,6 +90,11 @@ func (ac authChallenge) Error() string {
 	return ac.err.Error()
 }
 
+// Unwrap returns the internal error of this authChallenge.
+func (ac authChallenge) Unwrap() error {
+	return ac.err
+}
+
 // Status returns the HTTP Response Status Code for this authChallenge.
 func (ac authChallenge) Status() int {
 	return http.StatusUnauthorized
@@ -129,10 +134,12 @@ func (ac authChallenge) SetHeaders(r *http.Request, w http.ResponseWriter) {
 type accessController struct {
 	realm        string
 	autoRedirect bool
-	issuer       string
+	issuers      []string
 	service      string
+	audiences    []string
 	rootCerts    *x509.CertPool
 	trustedKeys  map[string]libtrust.PublicKey
+	jwks         *jwksSource
 }
 
 // tokenAccessOptions is a convenience type for handling
@@ -140,9 +147,12 @@ type accessController struct {
 type tokenAccessOptions struct {
 	realm          string
 	autoRedirect   bool
-	issuer         string
+	issuers        []string
 	service        string
+	audiences      []string
 	rootCertBundle string
+	jwks           string
+	jwksURL        string
 }
 
 // checkOptions gathers the necessary options
@@ -150,7 +160,7 @@ type tokenAccessOptions struct {
 func checkOptions(options map[string]interface{}) (tokenAccessOptions, error) {
 	var opts tokenAccessOptions
 
-	keys := []string{"realm", "issuer", "service", "rootcertbundle"}
+	keys := []string{"realm", "service"}
 	vals := make([]string, 0, len(keys))
 	for _, key := range keys {
 		val, ok := options[key].(string)
@@ -160,7 +170,38 @@ func checkOptions(options map[string]interface{}) (tokenAccessOptions, error) {
 		vals = append(vals, val)
 	}
 
-	opts.realm, opts.issuer, opts.service, opts.rootCertBundle = vals[0], vals[1], vals[2], vals[3]
+	opts.realm, opts.service = vals[0], vals[1]
+
+	issuers, err := stringListOption(options, "issuer")
+	if err != nil || len(issuers) == 0 {
+		return opts, fmt.Errorf("token auth requires a valid option string or list of strings: %q", "issuer")
+	}
+	opts.issuers = issuers
+
+	audiences, err := stringListOption(options, "audiences")
+	if err != nil {
+		return opts, err
+	}
+	if len(audiences) == 0 {
+		// tokens are meant for the service by default
+		audiences = []string{opts.service}
+	}
+	opts.audiences = audiences
+
+	for key, val := range map[string]*string{
+		"rootcertbundle": &opts.rootCertBundle,
+		"jwks":           &opts.jwks,
+		"jwksurl":        &opts.jwksURL,
+	} {
+		if v, ok := options[key]; ok {
+			if *val, ok = v.(string); !ok {
+				return opts, fmt.Errorf("token auth requires a valid option string: %q", key)
+			}
+		}
+	}
+	if opts.rootCertBundle == "" && opts.jwks == "" && opts.jwksURL == "" {
+		return opts, fmt.Errorf("token auth requires a valid option string: %q, %q or %q", "rootcertbundle", "jwks", "jwksurl")
+	}
 
 	autoRedirectVal, ok := options["autoredirect"]
 	if ok {
@@ -174,6 +215,31 @@ func checkOptions(options map[string]interface{}) (tokenAccessOptions, error) {
 	return opts, nil
 }
 
+// stringListOption returns an option which may be set to a string or to a
+// list of strings.
+func stringListOption(options map[string]interface{}, key string) ([]string, error) {
+	switch val := options[key].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{val}, nil
+	case []string:
+		return val, nil
+	case []interface{}:
+		list := make([]string, 0, len(val))
+		for _, item := range val {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("token auth requires a valid option string or list of strings: %q", key)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("token auth requires a valid option string or list of strings: %q", key)
+	}
+}
+
 // newAccessController creates an accessController using the given options.
 func newAccessController(options map[string]interface{}) (auth.AccessController, error) {
 	config, err := checkOptions(options)
@@ -181,15 +247,55 @@ func newAccessController(options map[string]interface{}) (auth.AccessController,
 		return nil, err
 	}
 
-	fp, err := os.Open(config.rootCertBundle)
+	rootPool := x509.NewCertPool()
+	trustedKeys := make(map[string]libtrust.PublicKey)
+	if config.rootCertBundle != "" {
+		rootCerts, err := readRootCertBundle(config.rootCertBundle)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rootCert := range rootCerts {
+			rootPool.AddCert(rootCert)
+			pubKey, err := libtrust.FromCryptoPublicKey(crypto.PublicKey(rootCert.PublicKey))
+			if err != nil {
+				return nil, fmt.Errorf("unable to get public key from token auth root certificate: %s", err)
+			}
+			trustedKeys[pubKey.KeyID()] = pubKey
+		}
+	}
+
+	ac := &accessController{
+		realm:        config.realm,
+		autoRedirect: config.autoRedirect,
+		issuers:      config.issuers,
+		service:      config.service,
+		audiences:    config.audiences,
+		rootCerts:    rootPool,
+		trustedKeys:  trustedKeys,
+	}
+
+	if config.jwks != "" || config.jwksURL != "" {
+		ac.jwks, err = newJWKSSource(config.jwksURL, config.jwks, trustedKeys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ac, nil
+}
+
+// readRootCertBundle reads the certificates of the root certificate bundle.
+func readRootCertBundle(path string) ([]*x509.Certificate, error) {
+	fp, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("unable to open token auth root certificate bundle file %q: %s", config.rootCertBundle, err)
+		return nil, fmt.Errorf("unable to open token auth root certificate bundle file %q: %s", path, err)
 	}
 	defer fp.Close()
 
 	rawCertBundle, err := io.ReadAll(fp)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read token auth root certificate bundle file %q: %s", config.rootCertBundle, err)
+		return nil, fmt.Errorf("unable to read token auth root certificate bundle file %q: %s", path, err)
 	}
 
 	var rootCerts []*x509.Certificate
@@ -211,25 +317,7 @@ func newAccessController(options map[string]interface{}) (auth.AccessController,
 		return nil, errors.New("token auth requires at least one token signing root certificate")
 	}
 
-	rootPool := x509.NewCertPool()
-	trustedKeys := make(map[string]libtrust.PublicKey, len(rootCerts))
-	for _, rootCert := range rootCerts {
-		rootPool.AddCert(rootCert)
-		pubKey, err := libtrust.FromCryptoPublicKey(crypto.PublicKey(rootCert.PublicKey))
-		if err != nil {
-			return nil, fmt.Errorf("unable to get public key from token auth root certificate: %s", err)
-		}
-		trustedKeys[pubKey.KeyID()] = pubKey
-	}
-
-	return &accessController{
-		realm:        config.realm,
-		autoRedirect: config.autoRedirect,
-		issuer:       config.issuer,
-		service:      config.service,
-		rootCerts:    rootPool,
-		trustedKeys:  trustedKeys,
-	}, nil
+	return rootCerts, nil
 }
 
 // Authorized handles checking whether the given request is authorized
@@ -259,11 +347,16 @@ func (ac *accessController) Authorized(ctx context.Context, accessItems ...auth.
 		return nil, challenge
 	}
 
+	trustedKeys := ac.trustedKeys
+	if ac.jwks != nil {
+		trustedKeys = ac.jwks.trustedKeys(ctx, token.Header.KeyID)
+	}
+
 	verifyOpts := VerifyOptions{
-		TrustedIssuers:    []string{ac.issuer},
-		AcceptedAudiences: []string{ac.service},
+		TrustedIssuers:    ac.issuers,
+		AcceptedAudiences: ac.audiences,
 		Roots:             ac.rootCerts,
-		TrustedKeys:       ac.trustedKeys,
+		TrustedKeys:       trustedKeys,
 	}
 
 	if err = token.Verify(verifyOpts); err != nil {
@@ -281,7 +374,10 @@ func (ac *accessController) Authorized(ctx context.Context, accessItems ...auth.
 
 	ctx = auth.WithResources(ctx, token.resources())
 
-	return auth.WithUser(ctx, auth.UserInfo{Name: token.Claims.Subject}), nil
+	return auth.WithUser(ctx, auth.UserInfo{
+		Name:   token.Claims.Subject,
+		Claims: token.claimMap(),
+	}), nil
 }
 
 // init handles registering the token auth backend.
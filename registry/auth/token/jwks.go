@@ -0,0 +1,212 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/libtrust"
+)
+
+const (
+	// jwksMinRefresh is the minimum time between two fetches of the JSON Web
+	// Key Set, so that tokens signed by unknown keys cannot make the
+	// registry hammer the identity provider.
+	jwksMinRefresh = time.Minute
+
+	// jwksMaxAge is the time after which the JSON Web Key Set is fetched
+	// again, so that revoked keys stop being trusted.
+	jwksMaxAge = time.Hour
+
+	jwksFetchTimeout = 10 * time.Second
+)
+
+// jwksSource provides the signing keys published in a JSON Web Key Set, read
+// from a file or fetched from a URL. When both are set, the file is used
+// while the URL cannot be fetched.
+type jwksSource struct {
+	url    string
+	path   string
+	client *http.Client
+
+	// static holds the keys trusted regardless of the key set, such as the
+	// keys of the root certificates.
+	static map[string]libtrust.PublicKey
+
+	mu      sync.Mutex
+	keys    map[string]libtrust.PublicKey
+	fetched time.Time
+
+	// now is overridden by tests
+	now func() time.Time
+}
+
+func newJWKSSource(url, path string, static map[string]libtrust.PublicKey) (*jwksSource, error) {
+	s := &jwksSource{
+		url:    url,
+		path:   path,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+		static: static,
+		now:    time.Now,
+	}
+
+	if err := s.load(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// trustedKeys returns the trusted keys, fetching the key set again if it is
+// too old, or if the token was signed by a key it does not contain.
+func (s *jwksSource) trustedKeys(ctx context.Context, keyID string) map[string]libtrust.PublicKey {
+	s.mu.Lock()
+	keys := s.keys
+	var refresh bool
+	if s.url != "" {
+		age := s.now().Sub(s.fetched)
+		_, known := keys[keyID]
+		refresh = age >= jwksMaxAge || (keyID != "" && !known && age >= jwksMinRefresh)
+	}
+	if refresh {
+		// failed attempts count too, so that an unreachable identity
+		// provider is not retried on every request, and concurrent
+		// requests keep using the current keys meanwhile
+		s.fetched = s.now()
+	}
+	s.mu.Unlock()
+
+	if !refresh {
+		return keys
+	}
+
+	fetched, err := s.fetch(ctx)
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("error fetching token auth jwks %s, keeping the previous keys: %v", s.url, err)
+		return keys
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = s.merge(fetched)
+	return s.keys
+}
+
+// load reads the key set, from the URL if it can be fetched or from the
+// file otherwise.
+func (s *jwksSource) load(ctx context.Context) error {
+	var keys map[string]libtrust.PublicKey
+	if s.url != "" {
+		s.fetched = s.now()
+
+		var err error
+		keys, err = s.fetch(ctx)
+		if err != nil {
+			if s.path == "" {
+				return fmt.Errorf("unable to fetch token auth jwks %q: %s", s.url, err)
+			}
+			dcontext.GetLogger(ctx).Warnf("error fetching token auth jwks %s, falling back to %s: %v", s.url, s.path, err)
+		}
+	}
+
+	if keys == nil {
+		content, err := os.ReadFile(s.path)
+		if err != nil {
+			return fmt.Errorf("unable to read token auth jwks file %q: %s", s.path, err)
+		}
+		keys, err = parseJWKS(content)
+		if err != nil {
+			return fmt.Errorf("unable to parse token auth jwks file %q: %s", s.path, err)
+		}
+	}
+
+	s.keys = s.merge(keys)
+	return nil
+}
+
+// fetch gets the key set from the URL.
+func (s *jwksSource) fetch(ctx context.Context) (map[string]libtrust.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseJWKS(content)
+}
+
+func (s *jwksSource) merge(keys map[string]libtrust.PublicKey) map[string]libtrust.PublicKey {
+	merged := make(map[string]libtrust.PublicKey, len(s.static)+len(keys))
+	for keyID, key := range s.static {
+		merged[keyID] = key
+	}
+	for keyID, key := range keys {
+		merged[keyID] = key
+	}
+	return merged
+}
+
+// parseJWKS parses a JSON Web Key Set, indexing its signing keys by their key
+// ID. Identity providers choose their own key IDs, so keys are also indexed
+// by their libtrust fingerprint. Keys meant for encryption only, and keys of
+// types other than EC and RSA, are ignored.
+func parseJWKS(content []byte) (map[string]libtrust.PublicKey, error) {
+	var set struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]libtrust.PublicKey, len(set.Keys))
+	for i, jwk := range set.Keys {
+		if use, ok := jwk["use"]; ok && use != "sig" {
+			continue
+		}
+		// the key types libtrust does not support are of no use either
+		if kty := jwk["kty"]; kty != "EC" && kty != "RSA" {
+			continue
+		}
+
+		keyID, _ := jwk["kid"].(string)
+		// libtrust expects the key ID to be its fingerprint
+		delete(jwk, "kid")
+
+		raw, err := json.Marshal(jwk)
+		if err != nil {
+			return nil, err
+		}
+		key, err := libtrust.UnmarshalPublicKeyJWK(raw)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %s", i, err)
+		}
+
+		if keyID != "" {
+			keys[keyID] = key
+		}
+		keys[key.KeyID()] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no signing key")
+	}
+	return keys, nil
+}
@@ -0,0 +1,252 @@
+package token
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/libtrust"
+)
+
+// makeJWKS returns a JSON Web Key Set publishing the keys under the given
+// key IDs, as an identity provider would.
+func makeJWKS(t *testing.T, keys map[string]libtrust.PrivateKey, extra ...map[string]interface{}) []byte {
+	t.Helper()
+
+	var set struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	for keyID, key := range keys {
+		raw, err := key.PublicKey().MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var jwk map[string]interface{}
+		if err := json.Unmarshal(raw, &jwk); err != nil {
+			t.Fatal(err)
+		}
+		jwk["kid"] = keyID
+		jwk["use"] = "sig"
+		set.Keys = append(set.Keys, jwk)
+	}
+	set.Keys = append(set.Keys, extra...)
+
+	content, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+// makeKeyIDToken returns a token only identifying its signing key by the
+// given key ID.
+func makeKeyIDToken(t *testing.T, issuer, audience string, access []*ResourceActions, key libtrust.PrivateKey, keyID string) string {
+	t.Helper()
+
+	now := time.Now()
+	claimSet := &ClaimSet{
+		Issuer:     issuer,
+		Subject:    "foo",
+		Audience:   []string{audience},
+		Expiration: now.Add(5 * time.Minute).Unix(),
+		NotBefore:  now.Unix(),
+		IssuedAt:   now.Unix(),
+		Access:     access,
+	}
+	claimSetBytes, err := json.Marshal(claimSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the algorithm is only known once signed, and is part of the signed
+	// header, so sign a throwaway payload first
+	_, alg, err := key.Sign(strings.NewReader(""), crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	joseHeaderBytes, err := json.Marshal(&Header{
+		Type:       "JWT",
+		SigningAlg: alg,
+		KeyID:      keyID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encodingToSign := fmt.Sprintf("%s.%s", joseBase64UrlEncode(joseHeaderBytes), joseBase64UrlEncode(claimSetBytes))
+	signatureBytes, _, err := key.Sign(strings.NewReader(encodingToSign), crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fmt.Sprintf("%s.%s", encodingToSign, joseBase64UrlEncode(signatureBytes))
+}
+
+func TestParseJWKS(t *testing.T) {
+	ecKey, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := libtrust.GenerateRSA2048PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := parseJWKS(makeJWKS(t, map[string]libtrust.PrivateKey{
+		"ec-key":  ecKey,
+		"rsa-key": rsaKey,
+	},
+		map[string]interface{}{"kid": "encryption-key", "use": "enc", "kty": "RSA"},
+		map[string]interface{}{"kid": "okp-key", "kty": "OKP", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+	))
+	if err != nil {
+		t.Fatalf("unexpected error parsing jwks: %v", err)
+	}
+
+	for keyID, key := range map[string]libtrust.PrivateKey{
+		"ec-key":         ecKey,
+		ecKey.KeyID():    ecKey,
+		"rsa-key":        rsaKey,
+		rsaKey.KeyID():   rsaKey,
+		"encryption-key": nil,
+		"okp-key":        nil,
+	} {
+		found, ok := keys[keyID]
+		if key == nil {
+			if ok {
+				t.Errorf("unexpected key %q", keyID)
+			}
+			continue
+		}
+		if !ok || found.KeyID() != key.KeyID() {
+			t.Errorf("expected key %q to be %s, got %v", keyID, key.KeyID(), found)
+		}
+	}
+
+	if _, err := parseJWKS([]byte(`{"keys": []}`)); err == nil {
+		t.Fatalf("expected error parsing jwks without signing key")
+	}
+}
+
+func TestAccessControllerJWKS(t *testing.T) {
+	firstKey, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondKey, err := libtrust.GenerateRSA2048PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu          sync.Mutex
+		published   = map[string]libtrust.PrivateKey{"first": firstKey}
+		unreachable bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if unreachable {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(makeJWKS(t, published))
+	}))
+	defer server.Close()
+
+	options := map[string]interface{}{
+		"realm":     "https://auth.example.com/token/",
+		"issuer":    []interface{}{"first-issuer", "second-issuer"},
+		"service":   "registry.example.com",
+		"audiences": []interface{}{"registry.example.com", "registry.example.org"},
+		"jwksurl":   server.URL,
+	}
+	ac, err := newAccessController(options)
+	if err != nil {
+		t.Fatalf("unexpected error creating access controller: %v", err)
+	}
+	now := time.Now()
+	ac.(*accessController).jwks.now = func() time.Time { return now }
+
+	testAccess := auth.Access{
+		Resource: auth.Resource{Type: "repository", Name: "foo/bar"},
+		Action:   "pull",
+	}
+	access := []*ResourceActions{{Type: testAccess.Type, Name: testAccess.Name, Actions: []string{testAccess.Action}}}
+
+	authorized := func(token string) error {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/v2/foo/bar/tags/list", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		_, err := ac.Authorized(context.WithRequest(context.Background(), req), testAccess)
+		return err
+	}
+
+	for _, tc := range []struct {
+		issuer, audience, keyID string
+		key                     libtrust.PrivateKey
+		valid                   bool
+	}{
+		{"first-issuer", "registry.example.com", "first", firstKey, true},
+		{"second-issuer", "registry.example.org", "first", firstKey, true},
+		{"third-issuer", "registry.example.com", "first", firstKey, false},
+		{"first-issuer", "registry.example.net", "first", firstKey, false},
+		{"first-issuer", "registry.example.com", "first", secondKey, false},
+		{"first-issuer", "registry.example.com", "second", secondKey, false},
+	} {
+		err := authorized(makeKeyIDToken(t, tc.issuer, tc.audience, access, tc.key, tc.keyID))
+		if tc.valid && err != nil {
+			t.Errorf("%+v: unexpected error: %v", tc, err)
+		}
+		if !tc.valid && (err == nil || err.Error() != ErrInvalidToken.Error()) {
+			t.Errorf("%+v: expected invalid token, got %v", tc, err)
+		}
+	}
+
+	// the provider rotates its keys; the set is fetched again once the
+	// minimum refresh interval is over
+	mu.Lock()
+	published = map[string]libtrust.PrivateKey{"second": secondKey}
+	mu.Unlock()
+	now = now.Add(jwksMinRefresh)
+
+	if err := authorized(makeKeyIDToken(t, "first-issuer", "registry.example.com", access, secondKey, "second")); err != nil {
+		t.Fatalf("unexpected error with the rotated key: %v", err)
+	}
+
+	// the previous keys are kept while the provider is unreachable
+	mu.Lock()
+	unreachable = true
+	mu.Unlock()
+	now = now.Add(jwksMaxAge)
+
+	if err := authorized(makeKeyIDToken(t, "first-issuer", "registry.example.com", access, secondKey, "second")); err != nil {
+		t.Fatalf("unexpected error with the provider unreachable: %v", err)
+	}
+
+	// at startup, the file is used while the provider is unreachable
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, makeJWKS(t, map[string]libtrust.PrivateKey{"first": firstKey}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newAccessController(options); err == nil {
+		t.Fatalf("expected error creating access controller with the provider unreachable")
+	}
+	options["jwks"] = jwksFile
+	ac, err = newAccessController(options)
+	if err != nil {
+		t.Fatalf("unexpected error creating access controller with a fallback file: %v", err)
+	}
+	if err := authorized(makeKeyIDToken(t, "first-issuer", "registry.example.com", access, firstKey, "first")); err != nil {
+		t.Fatalf("unexpected error with the key of the fallback file: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package token
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/x509"
 	"encoding/base64"
@@ -377,6 +378,28 @@ func (t *Token) resources() []auth.Resource {
 	return resources
 }
 
+// claimMap returns all the claims of the token, including those which are
+// not part of the ClaimSet. It returns nil if they cannot be decoded.
+func (t *Token) claimMap() map[string]interface{} {
+	parts := strings.Split(t.Raw, TokenSeparator)
+	if len(parts) != 2 {
+		return nil
+	}
+	claimsJSON, err := joseBase64UrlDecode(parts[1])
+	if err != nil {
+		return nil
+	}
+
+	var claims map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(claimsJSON))
+	// keep the timestamps as they are, rather than as floats
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
 func (t *Token) compactRaw() string {
 	return fmt.Sprintf("%s.%s", t.Raw, joseBase64UrlEncode(t.Signature))
 }
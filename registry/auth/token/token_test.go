@@ -455,6 +455,10 @@ func TestAccessController(t *testing.T) {
 		t.Fatalf("expected user name %q, got %q", "foo", userInfo.Name)
 	}
 
+	if userInfo.Claims["iss"] != issuer || userInfo.Claims["jti"] != token.Claims.JWTID {
+		t.Fatalf("expected the claims of the token, got %v", userInfo.Claims)
+	}
+
 	// 5. Supply a token with full admin rights, which is represented as "*".
 	token, err = makeTestToken(
 		issuer, service,
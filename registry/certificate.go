@@ -0,0 +1,146 @@
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+)
+
+// certificateCheckInterval is how often the certificate and key files are
+// checked for modifications. It is global to ease unit testing.
+var certificateCheckInterval = 10 * time.Second
+
+// certificate serves the TLS certificate of the registry, which is replaced
+// when the configuration is reloaded or when its files are modified.
+type certificate struct {
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	files keyPair
+}
+
+// keyPair identifies the version of the certificate and key files which was
+// loaded.
+type keyPair struct {
+	certFile, keyFile       string
+	certModTime, keyModTime time.Time
+}
+
+// statKeyPair returns the modification times of the certificate and key
+// files, left zero for the files which cannot be read.
+func statKeyPair(certFile, keyFile string) keyPair {
+	files := keyPair{certFile: certFile, keyFile: keyFile}
+	if fi, err := os.Stat(certFile); err == nil {
+		files.certModTime = fi.ModTime()
+	}
+	if fi, err := os.Stat(keyFile); err == nil {
+		files.keyModTime = fi.ModTime()
+	}
+	return files
+}
+
+// equal reports whether p and other identify the same version of the same
+// files.
+func (p keyPair) equal(other keyPair) bool {
+	return p.certFile == other.certFile && p.keyFile == other.keyFile &&
+		p.certModTime.Equal(other.certModTime) && p.keyModTime.Equal(other.keyModTime)
+}
+
+// loadKeyPair loads the certificate from the PEM encoded certificate and key
+// files.
+func loadKeyPair(certFile, keyFile string) (*tls.Certificate, keyPair, error) {
+	// the files are stat'ed first, so that a modification made while they
+	// are read is noticed on the next check
+	files := statKeyPair(certFile, keyFile)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, keyPair{}, err
+	}
+	return &cert, files, nil
+}
+
+// newCertificate loads the certificate from the PEM encoded certificate and
+// key files.
+func newCertificate(certFile, keyFile string) (*certificate, error) {
+	cert, files, err := loadKeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &certificate{cert: cert, files: files}, nil
+}
+
+// set replaces the certificate by cert, loaded from files.
+func (c *certificate) set(cert *tls.Certificate, files keyPair) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cert = cert
+	c.files = files
+}
+
+// replace replaces the certificate by cert, loaded from files, unless the
+// certificate loaded from previous was already replaced.
+func (c *certificate) replace(previous keyPair, cert *tls.Certificate, files keyPair) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.files.equal(previous) {
+		return false
+	}
+	c.cert = cert
+	c.files = files
+	return true
+}
+
+// keyPair returns the files the current certificate was loaded from.
+func (c *certificate) keyPair() keyPair {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.files
+}
+
+// GetCertificate returns the current certificate, whatever the client hello.
+func (c *certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, nil
+}
+
+// watch reloads the certificate each time its certificate or key file is
+// modified, until done is closed. The current certificate is kept if the
+// modified files cannot be loaded, such as while a renewal is only half
+// written, and they are loaded again once modified.
+func (c *certificate) watch(ctx context.Context, done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var failed keyPair
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+
+		current := c.keyPair()
+		files := statKeyPair(current.certFile, current.keyFile)
+		if files.equal(current) || files.equal(failed) {
+			continue
+		}
+
+		cert, loaded, err := loadKeyPair(current.certFile, current.keyFile)
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("error reloading TLS certificate %s, keeping the previous one: %v", current.certFile, err)
+			failed = files
+			continue
+		}
+		if c.replace(current, cert, loaded) {
+			dcontext.GetLogger(ctx).Infof("TLS certificate %s reloaded", current.certFile)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCertificateWatch(t *testing.T) {
+	initial, err := buildRegistryTLSConfig("registry_test_certificate_watch", "rsa", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := newCertificate(initial.certificatePath, initial.privateKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go c.watch(context.Background(), done, 10*time.Millisecond)
+
+	served := func() []byte {
+		cert, _ := c.GetCertificate(&tls.ClientHelloInfo{})
+		return cert.Certificate[0]
+	}
+	touch := func(offset time.Duration) {
+		mtime := time.Now().Add(offset)
+		for _, name := range []string{initial.certificatePath, initial.privateKeyPath} {
+			if err := os.Chtimes(name, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// a half written renewal keeps the current certificate
+	if err := os.WriteFile(initial.privateKeyPath, []byte("invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	touch(time.Hour)
+	time.Sleep(100 * time.Millisecond)
+	if !bytes.Equal(served(), initial.certificate.Certificate[0]) {
+		t.Fatal("expected the initial certificate to be kept")
+	}
+
+	renewed, err := buildRegistryTLSConfig("registry_test_certificate_watch", "ecdsa", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	touch(2 * time.Hour)
+	deadline := time.Now().Add(5 * time.Second)
+	for !bytes.Equal(served(), renewed.certificate.Certificate[0]) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the renewed certificate to be served once its files are modified")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the certificate reloaded with the configuration is not overridden
+	other, err := buildRegistryTLSConfig("registry_test_certificate_watch_other", "rsa", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, files, err := loadKeyPair(other.certificatePath, other.privateKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.set(cert, files)
+	touch(3 * time.Hour)
+	time.Sleep(100 * time.Millisecond)
+	if !bytes.Equal(served(), other.certificate.Certificate[0]) {
+		t.Fatal("expected the reloaded certificate to be kept")
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/client/auth/challenge"
+	"github.com/opencontainers/go-digest"
 )
 
 // ErrNoErrorsInBody is returned when an HTTP response body parses to an empty
@@ -37,6 +38,34 @@ func (e *UnexpectedHTTPResponseError) Error() string {
 	return fmt.Sprintf("error parsing HTTP %d response body: %s: %q", e.StatusCode, e.ParseErr.Error(), string(e.Response))
 }
 
+// TagDigestMismatchError is returned when tagging a manifest, if the registry
+// reports the tag as pointing to a digest other than the one requested.
+type TagDigestMismatchError struct {
+	Tag      string
+	Expected digest.Digest
+	Actual   digest.Digest
+}
+
+func (e *TagDigestMismatchError) Error() string {
+	return fmt.Sprintf("tag %q was set to digest %s, expected %s", e.Tag, e.Actual, e.Expected)
+}
+
+// TagLookupError is returned when looking up the tags of a digest, if one of
+// the tags cannot be resolved.
+type TagLookupError struct {
+	Tag string
+	Err error
+}
+
+func (e *TagLookupError) Error() string {
+	return fmt.Sprintf("error resolving tag %q: %s", e.Tag, e.Err)
+}
+
+// Unwrap returns the error resolving the tag.
+func (e *TagLookupError) Unwrap() error {
+	return e.Err
+}
+
 func parseHTTPErrorResponse(statusCode int, r io.Reader) error {
 	var errors errcode.Errors
 	body, err := io.ReadAll(r)
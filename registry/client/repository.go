@@ -10,16 +10,20 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
 	v2 "github.com/docker/distribution/registry/api/v2"
 	"github.com/docker/distribution/registry/client/transport"
 	"github.com/docker/distribution/registry/storage/cache"
 	"github.com/docker/distribution/registry/storage/cache/memory"
+	"github.com/docker/distribution/tracing"
 	"github.com/opencontainers/go-digest"
 )
 
@@ -69,7 +73,7 @@ func NewRegistry(baseURL string, transport http.RoundTripper) (Registry, error)
 	}
 
 	client := &http.Client{
-		Transport:     transport,
+		Transport:     tracing.Transport(transport),
 		Timeout:       1 * time.Minute,
 		CheckRedirect: checkHTTPRedirect,
 	}
@@ -141,7 +145,7 @@ func NewRepository(name reference.Named, baseURL string, transport http.RoundTri
 
 	return &repository{
 		client: &http.Client{
-			Transport:     transport,
+			Transport:     tracing.Transport(transport),
 			CheckRedirect: checkHTTPRedirect,
 			// TODO(dmcgowan): create cookie jar
 		},
@@ -191,6 +195,10 @@ func (r *repository) Tags(ctx context.Context) distribution.TagService {
 	}
 }
 
+// lookupConcurrency is the number of tags resolved concurrently by a tag
+// lookup.
+const lookupConcurrency = 8
+
 // tags implements remote tagging operations.
 type tags struct {
 	client *http.Client
@@ -201,56 +209,78 @@ type tags struct {
 // All returns all tags
 func (t *tags) All(ctx context.Context) ([]string, error) {
 	var tags []string
+	err := t.listPages(ctx, func(page []string) error {
+		tags = append(tags, page...)
+		return nil
+	})
+	return tags, err
+}
 
+// listPages calls fn with each page of the tag list, following the links to
+// the next pages, until fn returns an error or there are no more pages.
+func (t *tags) listPages(ctx context.Context, fn func(page []string) error) error {
 	listURLStr, err := t.ub.BuildTagsURL(t.name)
 	if err != nil {
-		return tags, err
+		return err
 	}
 
 	listURL, err := url.Parse(listURLStr)
 	if err != nil {
-		return tags, err
+		return err
 	}
 
 	for {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, listURL.String(), nil)
-		if err != nil {
-			return nil, err
-		}
-		resp, err := t.client.Do(req)
-		if err != nil {
-			return tags, err
+		next, err := t.listPage(ctx, listURL, fn)
+		if err != nil || next == nil {
+			return err
 		}
-		defer resp.Body.Close()
+		listURL = next
+	}
+}
 
-		if SuccessStatus(resp.StatusCode) {
-			b, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return tags, err
-			}
+// listPage fetches a page of the tag list and calls fn with it, returning
+// the URL of the next page if there is one.
+func (t *tags) listPage(ctx context.Context, listURL *url.URL, fn func(page []string) error) (*url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, listURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-			tagsResponse := struct {
-				Tags []string `json:"tags"`
-			}{}
-			if err := json.Unmarshal(b, &tagsResponse); err != nil {
-				return tags, err
-			}
-			tags = append(tags, tagsResponse.Tags...)
-			if link := resp.Header.Get("Link"); link != "" {
-				firsLink, _, _ := strings.Cut(link, ";")
-				linkURL, err := url.Parse(strings.Trim(firsLink, "<>"))
-				if err != nil {
-					return tags, err
-				}
+	if !SuccessStatus(resp.StatusCode) {
+		return nil, HandleErrorResponse(resp)
+	}
 
-				listURL = listURL.ResolveReference(linkURL)
-			} else {
-				return tags, nil
-			}
-		} else {
-			return tags, HandleErrorResponse(resp)
-		}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	tagsResponse := struct {
+		Tags []string `json:"tags"`
+	}{}
+	if err := json.Unmarshal(b, &tagsResponse); err != nil {
+		return nil, err
+	}
+	if err := fn(tagsResponse.Tags); err != nil {
+		return nil, err
+	}
+
+	link := resp.Header.Get("Link")
+	if link == "" {
+		return nil, nil
 	}
+	firsLink, _, _ := strings.Cut(link, ";")
+	linkURL, err := url.Parse(strings.Trim(firsLink, "<>"))
+	if err != nil {
+		return nil, err
+	}
+
+	return listURL.ResolveReference(linkURL), nil
 }
 
 func descriptorFromResponse(response *http.Response) (distribution.Descriptor, error) {
@@ -349,12 +379,115 @@ func (t *tags) Get(ctx context.Context, tag string) (distribution.Descriptor, er
 	}
 }
 
-func (t *tags) Lookup(ctx context.Context, digest distribution.Descriptor) ([]string, error) {
-	panic("not implemented")
+// Lookup returns the tags resolving to the digest of the descriptor. The tag
+// list is read page by page, and the tags of each page are resolved with
+// HEAD requests issued by a bounded number of concurrent workers. Tags
+// deleted while the lookup is in progress are skipped.
+func (t *tags) Lookup(ctx context.Context, desc distribution.Descriptor) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		matched []string
+		lookErr error
+		wg      sync.WaitGroup
+	)
+
+	pending := make(chan string)
+	for i := 0; i < lookupConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tag := range pending {
+				tagDesc, err := t.Get(ctx, tag)
+
+				mu.Lock()
+				switch {
+				case err == nil:
+					if tagDesc.Digest == desc.Digest {
+						matched = append(matched, tag)
+					}
+				case isManifestUnknown(err):
+					// the tag was deleted since it was listed
+				case lookErr == nil:
+					lookErr = &TagLookupError{Tag: tag, Err: err}
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	listErr := t.listPages(ctx, func(page []string) error {
+		for _, tag := range page {
+			select {
+			case pending <- tag:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	close(pending)
+	wg.Wait()
+
+	// the listing is canceled when a tag fails to resolve, so report the
+	// cause rather than the cancellation
+	if lookErr != nil {
+		return nil, lookErr
+	}
+	if listErr != nil {
+		return nil, listErr
+	}
+
+	sort.Strings(matched)
+	return matched, nil
+}
+
+// isManifestUnknown returns whether the registry reported the manifest as
+// unknown.
+func isManifestUnknown(err error) bool {
+	var errs errcode.Errors
+	if !errors.As(err, &errs) {
+		return false
+	}
+	for _, err := range errs {
+		if ec, ok := err.(errcode.ErrorCoder); ok && ec.ErrorCode() == v2.ErrorCodeManifestUnknown {
+			return true
+		}
+	}
+	return false
 }
 
+// Tag tags the manifest described by desc. The registry API has no request
+// to tag an existing manifest, so the manifest is fetched and put again under
+// the tag.
 func (t *tags) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
-	panic("not implemented")
+	ms := &manifests{
+		name:   t.name,
+		ub:     t.ub,
+		client: t.client,
+		etags:  make(map[string]string),
+	}
+
+	var options []distribution.ManifestServiceOption
+	if desc.MediaType != "" {
+		options = append(options, distribution.WithManifestMediaTypes([]string{desc.MediaType}))
+	}
+	m, err := ms.Get(ctx, desc.Digest, options...)
+	if err != nil {
+		return err
+	}
+
+	dgst, err := ms.Put(ctx, m, distribution.WithTag(tag))
+	if err != nil {
+		return err
+	}
+	if dgst != desc.Digest {
+		return &TagDigestMismatchError{Tag: tag, Expected: desc.Digest, Actual: dgst}
+	}
+	return nil
 }
 
 func (t *tags) Untag(ctx context.Context, tag string) error {
@@ -1532,6 +1532,205 @@ func TestObtainsManifestForTagWithoutHeaders(t *testing.T) {
 	}
 }
 
+func TestTagTag(t *testing.T) {
+	repo, _ := reference.WithName("test.example.com/repo/tag")
+	m1, dgst, _ := newRandomSchemaV1Manifest(repo, "latest", 6)
+	_, payload, err := m1.Payload() //nolint:staticcheck // Ignore SA1019: "github.com/docker/distribution/manifest/schema1" is deprecated, as it's used for backward compatibility.
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m testutil.RequestResponseMap
+	for _, putDgst := range []digest.Digest{dgst, digest.FromString("other")} {
+		addTestManifest(repo, dgst.String(), schema1.MediaTypeSignedManifest, payload, &m) //nolint:staticcheck // Ignore SA1019: "github.com/docker/distribution/manifest/schema1" is deprecated, as it's used for backward compatibility.
+		m = append(m, testutil.RequestResponseMapping{
+			Request: testutil.Request{
+				Method: http.MethodPut,
+				Route:  "/v2/" + repo.Name() + "/manifests/newtag",
+				Body:   payload,
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusCreated,
+				Headers: http.Header(map[string][]string{
+					"Content-Length":        {"0"},
+					"Docker-Content-Digest": {putDgst.String()},
+				}),
+			},
+		})
+	}
+
+	e, c := testServer(m)
+	defer c()
+
+	r, err := NewRepository(repo, e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ts := r.Tags(ctx)
+
+	desc := distribution.Descriptor{Digest: dgst, MediaType: schema1.MediaTypeSignedManifest} //nolint:staticcheck // Ignore SA1019: "github.com/docker/distribution/manifest/schema1" is deprecated, as it's used for backward compatibility.
+	if err := ts.Tag(ctx, "newtag", desc); err != nil {
+		t.Fatal(err)
+	}
+
+	err = ts.Tag(ctx, "newtag", desc)
+	if _, ok := err.(*TagDigestMismatchError); !ok {
+		t.Fatalf("expected digest mismatch error, got %v", err)
+	}
+
+	if err := ts.Tag(ctx, "newtag", distribution.Descriptor{Digest: digest.FromString("unknown")}); err == nil {
+		t.Fatal("expected error tagging unknown manifest")
+	}
+}
+
+// addTestTagsPages adds the responses listing the tags in pages, and
+// resolving each tag with a HEAD request to the given digest. Tags without a
+// digest are unknown.
+func addTestTagsPages(repo reference.Named, pages [][]string, digests map[string]digest.Digest, m *testutil.RequestResponseMap) {
+	manifestUnknown, _ := json.Marshal(errcode.Errors{v2.ErrorCodeManifestUnknown})
+
+	for i, page := range pages {
+		body, _ := json.Marshal(map[string]interface{}{
+			"name": repo.Name(),
+			"tags": page,
+		})
+		queryParams := make(map[string][]string)
+		if i > 0 {
+			queryParams["last"] = []string{pages[i-1][len(pages[i-1])-1]}
+		}
+		headers := http.Header{}
+		if i < len(pages)-1 {
+			headers.Set("Link", fmt.Sprintf(`</v2/%s/tags/list?last=%s>; rel="next"`, repo.Name(), page[len(page)-1]))
+		}
+		*m = append(*m, testutil.RequestResponseMapping{
+			Request: testutil.Request{
+				Method:      http.MethodGet,
+				Route:       "/v2/" + repo.Name() + "/tags/list",
+				QueryParams: queryParams,
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       body,
+				Headers:    headers,
+			},
+		})
+
+		for _, tag := range page {
+			dgst, ok := digests[tag]
+			if !ok {
+				*m = append(*m, testutil.RequestResponseMapping{
+					Request: testutil.Request{
+						Method: http.MethodHead,
+						Route:  "/v2/" + repo.Name() + "/manifests/" + tag,
+					},
+					Response: testutil.Response{
+						StatusCode: http.StatusNotFound,
+					},
+				}, testutil.RequestResponseMapping{
+					Request: testutil.Request{
+						Method: http.MethodGet,
+						Route:  "/v2/" + repo.Name() + "/manifests/" + tag,
+					},
+					Response: testutil.Response{
+						StatusCode: http.StatusNotFound,
+						Body:       manifestUnknown,
+						Headers: http.Header(map[string][]string{
+							"Content-Type": {"application/json"},
+						}),
+					},
+				})
+				continue
+			}
+			*m = append(*m, testutil.RequestResponseMapping{
+				Request: testutil.Request{
+					Method: http.MethodHead,
+					Route:  "/v2/" + repo.Name() + "/manifests/" + tag,
+				},
+				Response: testutil.Response{
+					StatusCode: http.StatusOK,
+					Headers: http.Header(map[string][]string{
+						"Content-Length":        {"1024"},
+						"Content-Type":          {schema1.MediaTypeSignedManifest}, //nolint:staticcheck // Ignore SA1019: "github.com/docker/distribution/manifest/schema1" is deprecated, as it's used for backward compatibility.
+						"Docker-Content-Digest": {dgst.String()},
+					}),
+				},
+			})
+		}
+	}
+}
+
+func TestTagLookup(t *testing.T) {
+	repo, _ := reference.WithName("test.example.com/repo/lookup")
+	d1 := digest.FromString("first")
+	d2 := digest.FromString("second")
+
+	var pages [][]string
+	digests := make(map[string]digest.Digest)
+	for i := 0; i < 3; i++ {
+		var page []string
+		for j := 0; j < 2*lookupConcurrency; j++ {
+			tag := fmt.Sprintf("tag%d-%02d", i, j)
+			page = append(page, tag)
+			switch j % 3 {
+			case 0:
+				digests[tag] = d1
+			case 1:
+				digests[tag] = d2
+			}
+		}
+		pages = append(pages, page)
+	}
+
+	var m testutil.RequestResponseMap
+	addTestTagsPages(repo, pages, digests, &m)
+	// the second lookup fails to resolve a tag of the last page, the
+	// failing responses being queued before the ones of the unknown tag
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		m = append(m, testutil.RequestResponseMapping{
+			Request: testutil.Request{
+				Method: method,
+				Route:  "/v2/" + repo.Name() + "/manifests/broken",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusInternalServerError,
+			},
+		})
+	}
+	addTestTagsPages(repo, append(pages[:2:2], []string{"broken"}), digests, &m)
+
+	e, c := testServer(m)
+	defer c()
+
+	r, err := NewRepository(repo, e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ts := r.Tags(ctx)
+
+	tags, err := ts.Lookup(ctx, distribution.Descriptor{Digest: d1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []string
+	for tag, dgst := range digests {
+		if dgst == d1 {
+			expected = append(expected, tag)
+		}
+	}
+	sort.Strings(expected)
+	if !reflect.DeepEqual(tags, expected) {
+		t.Fatalf("unexpected tags: %v, expected %v", tags, expected)
+	}
+
+	_, err = ts.Lookup(ctx, distribution.Descriptor{Digest: d1})
+	lookupErr, ok := err.(*TagLookupError)
+	if !ok || lookupErr.Tag != "broken" {
+		t.Fatalf("expected lookup error for tag broken, got %v", err)
+	}
+}
+
 func TestManifestTagsPaginated(t *testing.T) {
 	s := httptest.NewServer(http.NotFoundHandler())
 	defer s.Close()
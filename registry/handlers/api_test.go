@@ -23,6 +23,7 @@ import (
 	"github.com/docker/distribution/configuration"
 	"github.com/docker/distribution/manifest"
 	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/ocischema"
 	"github.com/docker/distribution/manifest/schema1" //nolint:staticcheck // Ignore SA1019: "github.com/docker/distribution/manifest/schema1" is deprecated, as it's used for backward compatibility.
 	"github.com/docker/distribution/manifest/schema2"
 	"github.com/docker/distribution/reference"
@@ -35,6 +36,7 @@ import (
 	"github.com/docker/libtrust"
 	"github.com/gorilla/handlers"
 	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 var headerConfig = http.Header{
@@ -449,6 +451,70 @@ func TestCatalogAPI(t *testing.T) {
 	}
 }
 
+// TestCatalogAPIFilters tests the prefix and the search filters of the
+// /v2/_catalog endpoint, walking the storage and from a repository index.
+func TestCatalogAPIFilters(t *testing.T) {
+	for _, index := range []string{"", "inmemory"} {
+		config := configuration.Configuration{
+			Storage: configuration.Storage{
+				"inmemory": configuration.Parameters{},
+				"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+					"enabled": false,
+				}},
+			},
+		}
+		if index != "" {
+			config.Storage["cache"] = configuration.Parameters{"repositoryindex": index}
+		}
+		config.Catalog.MaxEntries = 5
+		config.Compatibility.Schema1.Enabled = true //nolint:staticcheck // Ignore SA1019: "github.com/docker/distribution/manifest/schema1" is deprecated, as it's used for backward compatibility.
+		config.HTTP.Headers = headerConfig
+		env := newTestEnvWithConfig(t, &config)
+
+		for _, image := range []string{"foo/aaaa", "foo/bbbb", "foo-bar/aaaa", "bar/aaaa", "bar/bbbb"} {
+			createRepository(env, t, image, "sometag")
+		}
+
+		for _, tc := range []struct {
+			query    url.Values
+			expected []string
+			link     string
+		}{
+			{url.Values{"prefix": []string{"foo"}}, []string{"foo/aaaa", "foo/bbbb", "foo-bar/aaaa"}, ""},
+			{url.Values{"prefix": []string{"foo/"}}, []string{"foo/aaaa", "foo/bbbb"}, ""},
+			{url.Values{"search": []string{"aaaa"}}, []string{"bar/aaaa", "foo/aaaa", "foo-bar/aaaa"}, ""},
+			{url.Values{"prefix": []string{"bar"}, "search": []string{"b"}}, []string{"bar/aaaa", "bar/bbbb"}, ""},
+			{url.Values{"prefix": []string{"baz"}}, []string{}, ""},
+			{url.Values{"search": []string{"aaaa"}, "n": []string{"2"}}, []string{"bar/aaaa", "foo/aaaa"},
+				`</v2/_catalog?last=foo%2Faaaa&n=2&search=aaaa>; rel="next"`},
+			{url.Values{"search": []string{"aaaa"}, "n": []string{"2"}, "last": []string{"foo/aaaa"}}, []string{"foo-bar/aaaa"}, ""},
+		} {
+			catalogURL, err := env.builder.BuildCatalogURL(tc.query)
+			checkErr(t, err, "building catalog url")
+			resp, err := http.Get(catalogURL)
+			checkErr(t, err, "fetching catalog")
+			checkResponse(t, "fetching catalog", resp, http.StatusOK)
+
+			var ctlg struct {
+				Repositories []string `json:"repositories"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&ctlg); err != nil {
+				t.Fatalf("error decoding catalog: %v", err)
+			}
+			resp.Body.Close()
+
+			if !reflect.DeepEqual(ctlg.Repositories, tc.expected) {
+				t.Errorf("index %q, query %v: expected repositories %v, got %v", index, tc.query, tc.expected, ctlg.Repositories)
+			}
+			if link := resp.Header.Get("Link"); link != tc.link {
+				t.Errorf("index %q, query %v: expected Link header %q, got %q", index, tc.query, tc.link, link)
+			}
+		}
+
+		env.Shutdown()
+	}
+}
+
 // TestTagsAPI tests the /v2/<name>/tags/list endpoint
 func TestTagsAPI(t *testing.T) {
 	env := newTestEnv(t, false)
@@ -605,6 +671,124 @@ func TestTagsAPI(t *testing.T) {
 	}
 }
 
+// TestTagsAPIDetails tests the filtering, the ordering and the details of the
+// /v2/<name>/tags/list endpoint
+func TestTagsAPIDetails(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, err := reference.WithName("test")
+	if err != nil {
+		t.Fatalf("unable to parse reference: %v", err)
+	}
+
+	// pushed in this order
+	digests := make(map[string]digest.Digest)
+	for _, tag := range []string{"v1.0", "v1.1", "v2.0", "latest"} {
+		digests[tag] = createRepository(env, t, imageName.Name(), tag)
+	}
+
+	getTags := func(query url.Values, header http.Header) *http.Response {
+		t.Helper()
+		tagsURL, err := env.builder.BuildTagsURL(imageName, query)
+		checkErr(t, err, "building tags url")
+		req, err := http.NewRequest(http.MethodGet, tagsURL, nil)
+		checkErr(t, err, "creating tags request")
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, "fetching tags")
+		return resp
+	}
+	checkTags := func(msg string, query url.Values, expected []string, expectedLink string) {
+		t.Helper()
+		resp := getTags(query, nil)
+		defer resp.Body.Close()
+		checkResponse(t, msg, resp, http.StatusOK)
+
+		var body tagsAPIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("%s: unexpected error decoding response body: %v", msg, err)
+		}
+		if !reflect.DeepEqual(body.Tags, expected) {
+			t.Errorf("%s: expected tags %v, got %v", msg, expected, body.Tags)
+		}
+		if link := resp.Header.Get("Link"); link != expectedLink {
+			t.Errorf("%s: expected Link header %q, got %q", msg, expectedLink, link)
+		}
+	}
+	checkDetails := func(msg string, resp *http.Response, expected []string) {
+		t.Helper()
+		defer resp.Body.Close()
+		checkResponse(t, msg, resp, http.StatusOK)
+		checkHeaders(t, resp, http.Header{"Content-Type": []string{tagListDetailsMediaType}})
+
+		var body tagsDetailsAPIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("%s: unexpected error decoding response body: %v", msg, err)
+		}
+		if len(body.Tags) != len(expected) {
+			t.Fatalf("%s: expected tags %v, got %+v", msg, expected, body.Tags)
+		}
+		for i, details := range body.Tags {
+			if details.Tag != expected[i] || details.Digest != digests[details.Tag] ||
+				details.MediaType != schema1.MediaTypeSignedManifest || details.Size == 0 || details.LastModified.IsZero() { //nolint:staticcheck // Ignore SA1019: "github.com/docker/distribution/manifest/schema1" is deprecated, as it's used for backward compatibility.
+				t.Errorf("%s: unexpected details of tag %s: %+v", msg, expected[i], details)
+			}
+		}
+	}
+
+	checkTags("filtering by prefix", url.Values{"prefix": []string{"v1"}}, []string{"v1.0", "v1.1"}, "")
+	checkTags("filtering by regex", url.Values{"regex": []string{`^v\d\.0$`}}, []string{"v1.0", "v2.0"}, "")
+	checkTags("filtering by prefix and regex", url.Values{"prefix": []string{"v1"}, "regex": []string{`0$`}}, []string{"v1.0"}, "")
+	checkTags("filtering everything", url.Values{"prefix": []string{"nothing"}}, []string{}, "")
+	checkTags("paginating filtered tags", url.Values{"prefix": []string{"v"}, "n": []string{"2"}}, []string{"v1.0", "v1.1"},
+		`</v2/test/tags/list?last=v1.1&n=2&prefix=v>; rel="next"`)
+
+	checkTags("ordering by time", url.Values{"order": []string{"time"}}, []string{"latest", "v2.0", "v1.1", "v1.0"}, "")
+
+	// the pages ordered by time follow a cursor made of the push time and
+	// the tag
+	repository, err := env.app.registry.Repository(env.ctx, imageName)
+	checkErr(t, err, "getting the repository")
+	tagService := repository.Tags(env.ctx)
+	modTime, err := tagService.(distribution.TagDescriber).ModTime(env.ctx, "v2.0")
+	checkErr(t, err, "getting the push time")
+	cursor := timeCursor{modTime, "v2.0"}.String()
+	checkTags("1st page ordered by time", url.Values{"order": []string{"time"}, "n": []string{"2"}}, []string{"latest", "v2.0"},
+		`</v2/test/tags/list?`+url.Values{"last": []string{cursor}, "n": []string{"2"}, "order": []string{"time"}}.Encode()+`>; rel="next"`)
+	checkTags("nth page ordered by time", url.Values{"order": []string{"time"}, "last": []string{cursor}, "n": []string{"2"}}, []string{"v1.1", "v1.0"}, "")
+
+	checkDetails("details", getTags(url.Values{"details": []string{"true"}}, nil), []string{"latest", "v1.0", "v1.1", "v2.0"})
+	checkDetails("details by media type", getTags(nil, http.Header{"Accept": []string{"application/json, " + tagListDetailsMediaType}}), []string{"latest", "v1.0", "v1.1", "v2.0"})
+	checkDetails("details ordered by time", getTags(url.Values{"details": []string{"true"}, "order": []string{"time"}, "n": []string{"1"}}, nil), []string{"latest"})
+
+	// pushing a tag again makes it the most recent one
+	digests["v1.0"] = createRepository(env, t, imageName.Name(), "v1.0")
+	checkDetails("details after a push", getTags(url.Values{"details": []string{"true"}, "order": []string{"time"}}, nil), []string{"v1.0", "latest", "v2.0", "v1.1"})
+	checkTags("nth page after a push", url.Values{"order": []string{"time"}, "last": []string{cursor}}, []string{"v1.1"}, "")
+
+	// the cursor remains valid once its tag is deleted
+	checkErr(t, tagService.Untag(env.ctx, "v2.0"), "deleting the tag")
+	checkTags("nth page after a deletion", url.Values{"order": []string{"time"}, "last": []string{cursor}}, []string{"v1.1"}, "")
+
+	// a tag whose manifest is missing is left out of the details
+	checkErr(t, tagService.Tag(env.ctx, "broken", distribution.Descriptor{Digest: digest.FromString("missing")}), "tagging a missing manifest")
+	checkDetails("details with a missing manifest", getTags(url.Values{"details": []string{"true"}}, nil), []string{"latest", "v1.0", "v1.1"})
+
+	for _, invalid := range []url.Values{
+		{"order": []string{"size"}},
+		{"regex": []string{"("}},
+		{"order": []string{"time"}, "last": []string{"v1.0"}},
+	} {
+		resp := getTags(invalid, nil)
+		checkResponse(t, "invalid filter", resp, http.StatusBadRequest)
+		checkBodyHasErrorCodes(t, "invalid filter", resp, v2.ErrorCodeFilterInvalid)
+		resp.Body.Close()
+	}
+}
+
 func checkLink(t *testing.T, urlStr string, numEntries int, last string) url.Values {
 	re := regexp.MustCompile("<(/v2/_catalog.*)>; rel=\"next\"")
 	matches := re.FindStringSubmatch(urlStr)
@@ -2530,6 +2714,120 @@ func testManifestDelete(t *testing.T, env *testEnv, args manifestArgs) {
 	}
 }
 
+func TestReferrersAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/referrers")
+
+	pushOCIManifest := func(config []byte, configMediaType, artifactType string, subject *distribution.Descriptor) distribution.Descriptor {
+		configDigest := digest.FromBytes(config)
+		uploadURLBase, _ := startPushLayer(t, env, imageName)
+		pushLayer(t, env.builder, imageName, configDigest, uploadURLBase, bytes.NewReader(config))
+
+		m, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned: ocischema.SchemaVersion,
+			Config: distribution.Descriptor{
+				MediaType: configMediaType,
+				Digest:    configDigest,
+				Size:      int64(len(config)),
+			},
+			Layers:       []distribution.Descriptor{},
+			ArtifactType: artifactType,
+			Subject:      subject,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error building manifest: %v", err)
+		}
+		_, payload, _ := m.Payload()
+		dgst := digest.FromBytes(payload)
+
+		digestRef, _ := reference.WithDigest(imageName, dgst)
+		manifestURL, err := env.builder.BuildManifestURL(digestRef)
+		checkErr(t, err, "building manifest url")
+
+		resp := putManifest(t, "putting oci manifest", manifestURL, v1.MediaTypeImageManifest, m)
+		defer resp.Body.Close()
+		checkResponse(t, "putting oci manifest", resp, http.StatusCreated)
+		if subject != nil {
+			checkHeaders(t, resp, http.Header{
+				"OCI-Subject": []string{subject.Digest.String()},
+			})
+		} else if resp.Header.Get("OCI-Subject") != "" {
+			t.Fatalf("unexpected OCI-Subject header on manifest without subject: %q", resp.Header.Get("OCI-Subject"))
+		}
+
+		return distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    dgst,
+			Size:      int64(len(payload)),
+		}
+	}
+
+	getReferrers := func(subject digest.Digest, values ...url.Values) (*http.Response, ocischema.ImageIndex) {
+		subjectRef, _ := reference.WithDigest(imageName, subject)
+		referrersURL, err := env.builder.BuildReferrersURL(subjectRef, values...)
+		checkErr(t, err, "building referrers url")
+
+		resp, err := http.Get(referrersURL)
+		checkErr(t, err, "fetching referrers")
+		defer resp.Body.Close()
+
+		checkResponse(t, "fetching referrers", resp, http.StatusOK)
+		checkHeaders(t, resp, http.Header{
+			"Content-Type": []string{v1.MediaTypeImageIndex},
+		})
+
+		var index ocischema.ImageIndex
+		if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+			t.Fatalf("unexpected error decoding referrers index: %v", err)
+		}
+		if index.SchemaVersion != 2 || index.MediaType != v1.MediaTypeImageIndex {
+			t.Fatalf("unexpected referrers index version: %v", index.Versioned)
+		}
+		return resp, index
+	}
+
+	subject := pushOCIManifest([]byte("{}"), v1.MediaTypeImageConfig, "", nil)
+
+	// A subject without referrers, or one unknown to the registry, has an
+	// empty index rather than an error.
+	for _, dgst := range []digest.Digest{subject.Digest, digest.FromString("unknown subject")} {
+		_, index := getReferrers(dgst)
+		if len(index.Manifests) != 0 {
+			t.Fatalf("expected no referrers of %s, got %v", dgst, index.Manifests)
+		}
+	}
+
+	signature := pushOCIManifest([]byte(`{"signature":true}`), v1.MediaTypeImageConfig, "application/vnd.example.signature", &subject)
+	sbom := pushOCIManifest([]byte(`{"sbom":true}`), "application/vnd.example.sbom", "", &subject)
+
+	resp, index := getReferrers(subject.Digest)
+	if resp.Header.Get("OCI-Filters-Applied") != "" {
+		t.Fatalf("unexpected OCI-Filters-Applied header: %q", resp.Header.Get("OCI-Filters-Applied"))
+	}
+	expected := map[digest.Digest]string{
+		signature.Digest: "application/vnd.example.signature",
+		sbom.Digest:      "application/vnd.example.sbom",
+	}
+	if len(index.Manifests) != len(expected) {
+		t.Fatalf("expected %d referrers, got %v", len(expected), index.Manifests)
+	}
+	for _, referrer := range index.Manifests {
+		if expected[referrer.Digest] != referrer.ArtifactType {
+			t.Fatalf("unexpected referrer %s with artifact type %q", referrer.Digest, referrer.ArtifactType)
+		}
+	}
+
+	resp, index = getReferrers(subject.Digest, url.Values{"artifactType": []string{"application/vnd.example.sbom"}})
+	checkHeaders(t, resp, http.Header{
+		"OCI-Filters-Applied": []string{"artifactType"},
+	})
+	if len(index.Manifests) != 1 || index.Manifests[0].Digest != sbom.Digest {
+		t.Fatalf("expected only %s after filtering, got %v", sbom.Digest, index.Manifests)
+	}
+}
+
 type testEnv struct {
 	pk      libtrust.PrivateKey
 	ctx     context.Context
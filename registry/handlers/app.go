@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"expvar"
 	"fmt"
 	"math"
@@ -15,6 +16,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	events "github.com/docker/go-events"
@@ -22,7 +24,9 @@ import (
 	"github.com/docker/libtrust"
 	"github.com/gomodule/redigo/redis"
 	"github.com/gorilla/mux"
+	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/configuration"
@@ -34,16 +38,20 @@ import (
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/api/errcode"
 	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/audit"
 	"github.com/docker/distribution/registry/auth"
 	registrymiddleware "github.com/docker/distribution/registry/middleware/registry"
 	repositorymiddleware "github.com/docker/distribution/registry/middleware/repository"
 	"github.com/docker/distribution/registry/proxy"
 	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/cache"
 	memorycache "github.com/docker/distribution/registry/storage/cache/memory"
 	rediscache "github.com/docker/distribution/registry/storage/cache/redis"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/registry/storage/driver/factory"
 	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+	"github.com/docker/distribution/registry/storage/driver/signedurl"
+	"github.com/docker/distribution/tracing"
 	"github.com/docker/distribution/version"
 )
 
@@ -54,6 +62,10 @@ const randomSecretSize = 32
 // defaultCheckInterval is the default time in between health checks
 const defaultCheckInterval = 10 * time.Second
 
+// repositoryIndexCheckInterval is the time in between checks that the
+// repository index is complete, to build it again once it expired.
+const repositoryIndexCheckInterval = time.Hour
+
 // context key for storing the Cloudflare True-Client-IP header
 const cfRealIPKey string = "http_request_cf-true-client-ip"
 
@@ -93,6 +105,36 @@ type App struct {
 
 	// readOnly is true if the registry is in a read-only maintenance mode
 	readOnly bool
+
+	// quota enforces the storage quotas of repositories, when enabled.
+	quota *quotaEnforcer
+
+	// rateLimiter enforces the rate limits, when enabled.
+	rateLimiter *rateLimiter
+
+	// trustedProxies are the proxies whose forwarding headers are trusted.
+	trustedProxies trustedProxies
+
+	// immutableTags protects the immutable tags, when configured.
+	immutableTags *immutableTagPolicy
+
+	// tagLocks serializes the pushes of the immutable tags.
+	tagLocks tagLocker
+
+	// audit writes the audit log, when enabled.
+	audit *audit.Logger
+
+	// repositoryLabels returns the repository label of the registry
+	// metrics.
+	repositoryLabels repositoryLabeler
+
+	// manifestURLs validates the URLs of the foreign layers.
+	manifestURLs *storage.ManifestURLs
+
+	// mu protects the access controller, the event sink, the rate limiter
+	// and the immutable tags, which are swapped when the configuration is
+	// reloaded.
+	mu sync.RWMutex
 }
 
 // NewApp takes a configuration and returns a configured app, ready to serve
@@ -103,7 +145,9 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		Config:  config,
 		Context: ctx,
 		router:  v2.RouterWithPrefix(config.HTTP.Prefix),
-		isCache: config.Proxy.RemoteURL != "",
+		isCache: config.Proxy.RemoteURL != "" || len(config.Proxy.Upstreams) > 0,
+
+		repositoryLabels: newRepositoryLabeler(config.HTTP.Debug.Prometheus.Repositories),
 	}
 
 	// Register the handler dispatchers.
@@ -113,16 +157,33 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	app.register(v2.RouteNameManifest, manifestDispatcher)
 	app.register(v2.RouteNameCatalog, catalogDispatcher)
 	app.register(v2.RouteNameTags, tagsDispatcher)
+	app.register(v2.RouteNameReferrers, referrersDispatcher)
+	app.register(v2.RouteNameQuota, quotaDispatcher)
+	app.register(v2.RouteNameRepository, repositoryDispatcher)
 	app.register(v2.RouteNameBlob, blobDispatcher)
 	app.register(v2.RouteNameBlobUpload, blobUploadDispatcher)
 	app.register(v2.RouteNameBlobUploadChunk, blobUploadDispatcher)
 
-	// override the storage driver's UA string for registry outbound HTTP requests
-	storageParams := config.Storage.Parameters()
-	if storageParams == nil {
-		storageParams = make(configuration.Parameters)
+	// the signature of a signed blob URL stands for the authorization of the
+	// request, so it is not dispatched through the access controller
+	app.router.GetRoute(v2.RouteNameSignedBlob).Handler(app.signedBlobHandler())
+
+	// the secret signs the blob URLs issued by the storage
+	app.configureSecret(config)
+	app.configureTrustedProxies(config)
+
+	// override the storage driver's UA string for registry outbound HTTP requests,
+	// leaving the configuration unmodified
+	storageParams := make(configuration.Parameters)
+	for k, v := range config.Storage.Parameters() {
+		storageParams[k] = v
 	}
 	storageParams["useragent"] = fmt.Sprintf("distribution/%s %s", version.Version, runtime.Version())
+	switch config.Storage.Type() {
+	case "filesystem", "inmemory":
+		// only these drivers sign their URLs, the secret is kept from the others
+		storageParams[signedurl.SecretParameter] = config.HTTP.Secret
+	}
 
 	var err error
 	app.driver, err = factory.Create(config.Storage.Type(), storageParams)
@@ -134,6 +195,7 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	}
 
 	purgeConfig := uploadPurgeDefaultConfig()
+	var gcConfig, scrubConfig map[interface{}]interface{}
 	if mc, ok := config.Storage["maintenance"]; ok {
 		if v, ok := mc["uploadpurging"]; ok {
 			purgeConfig, ok = v.(map[interface{}]interface{})
@@ -141,6 +203,18 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 				panic("uploadpurging config key must contain additional keys")
 			}
 		}
+		if v, ok := mc["garbagecollect"]; ok {
+			gcConfig, ok = v.(map[interface{}]interface{})
+			if !ok {
+				panic("garbagecollect config key must contain additional keys")
+			}
+		}
+		if v, ok := mc["scrub"]; ok {
+			scrubConfig, ok = v.(map[interface{}]interface{})
+			if !ok {
+				panic("scrub config key must contain additional keys")
+			}
+		}
 		if v, ok := mc["readonly"]; ok {
 			readOnly, ok := v.(map[interface{}]interface{})
 			if !ok {
@@ -157,15 +231,19 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 
 	startUploadPurger(app, app.driver, dcontext.GetLogger(app), purgeConfig)
 
-	app.driver, err = applyStorageMiddleware(app.driver, config.Middleware["storage"])
+	app.driver, err = applyStorageMiddleware(app.driver, config.Middleware["storage"], config.HTTP.Secret)
 	if err != nil {
 		panic(err)
 	}
 
-	app.configureSecret(config)
 	app.configureEvents(config)
 	app.configureRedis(config)
 	app.configureLogHook(config)
+	app.configureAudit(config)
+
+	if config.Policy.RateLimit.Enabled {
+		app.configureRateLimit(config)
+	}
 
 	options := registrymiddleware.GetRegistryOptions()
 	if config.Compatibility.Schema1.TrustKey != "" {
@@ -200,6 +278,18 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		options = append(options, storage.DisableDigestResumption)
 	}
 
+	// configure quotas
+	if config.Policy.Quota.Enabled {
+		options = append(options, app.configureQuota(config))
+	}
+
+	// configure immutable tags
+	app.immutableTags, err = newImmutableTagPolicy(config.Policy.ImmutableTags)
+	if err != nil {
+		panic(fmt.Sprintf("invalid immutable tags policy: %v", err))
+	}
+	app.tagLocks = newTagLocker(app.redis)
+
 	// configure deletion
 	if d, ok := config.Storage["delete"]; ok {
 		e, ok := d["enabled"]
@@ -232,40 +322,58 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	}
 
 	// configure validation
-	if config.Validation.Enabled {
-		if len(config.Validation.Manifests.URLs.Allow) == 0 && len(config.Validation.Manifests.URLs.Deny) == 0 {
-			// If Allow and Deny are empty, allow nothing.
-			options = append(options, storage.ManifestURLsAllowRegexp(regexp.MustCompile("^$")))
-		} else {
-			if len(config.Validation.Manifests.URLs.Allow) > 0 {
-				for i, s := range config.Validation.Manifests.URLs.Allow {
-					// Validate via compilation.
-					if _, err := regexp.Compile(s); err != nil {
-						panic(fmt.Sprintf("validation.manifests.urls.allow: %s", err))
-					}
-					// Wrap with non-capturing group.
-					config.Validation.Manifests.URLs.Allow[i] = fmt.Sprintf("(?:%s)", s)
-				}
-				re := regexp.MustCompile(strings.Join(config.Validation.Manifests.URLs.Allow, "|"))
-				options = append(options, storage.ManifestURLsAllowRegexp(re))
+	allow, deny, err := manifestURLRegexps(config)
+	if err != nil {
+		panic(err.Error())
+	}
+	app.manifestURLs = storage.NewManifestURLs(allow, deny)
+	options = append(options, storage.ManifestURLsValidation(app.manifestURLs))
+
+	// configure storage caches
+	var repositoryIndex bool
+	if cc, ok := config.Storage["cache"]; ok {
+		switch m := cc["manifest"]; m {
+		case "redis":
+			if app.redis == nil {
+				panic("redis configuration required to use for manifest cache")
+			}
+			if _, ok := cc["manifestsize"]; ok {
+				dcontext.GetLogger(app).Warnf("manifestsize parameter is not supported with redis cache")
 			}
-			if len(config.Validation.Manifests.URLs.Deny) > 0 {
-				for i, s := range config.Validation.Manifests.URLs.Deny {
-					// Validate via compilation.
-					if _, err := regexp.Compile(s); err != nil {
-						panic(fmt.Sprintf("validation.manifests.urls.deny: %s", err))
-					}
-					// Wrap with non-capturing group.
-					config.Validation.Manifests.URLs.Deny[i] = fmt.Sprintf("(?:%s)", s)
+			options = append(options, storage.ManifestCacheProvider(rediscache.NewRedisManifestCacheProvider(app.redis)))
+			dcontext.GetLogger(app).Infof("using redis manifest cache")
+		case "inmemory":
+			manifestSize := memorycache.DefaultSize
+			if configuredSize, ok := cc["manifestsize"]; ok {
+				manifestSize, err = strconv.Atoi(fmt.Sprint(configuredSize))
+				if err != nil {
+					panic(fmt.Sprintf("invalid manifestsize value %s: %s", configuredSize, err))
 				}
-				re := regexp.MustCompile(strings.Join(config.Validation.Manifests.URLs.Deny, "|"))
-				options = append(options, storage.ManifestURLsDenyRegexp(re))
 			}
+			options = append(options, storage.ManifestCacheProvider(memorycache.NewInMemoryManifestCacheProvider(manifestSize)))
+			dcontext.GetLogger(app).Infof("using inmemory manifest cache")
+		case nil:
+		default:
+			dcontext.GetLogger(app).Warnf("unknown manifest cache type %q, manifest caching disabled", m)
+		}
+
+		switch i := cc["repositoryindex"]; i {
+		case "redis":
+			if app.redis == nil {
+				panic("redis configuration required to use for repository index")
+			}
+			options = append(options, storage.RepositoryIndex(rediscache.NewRedisRepositoryIndex(app.redis)))
+			repositoryIndex = true
+			dcontext.GetLogger(app).Infof("using redis repository index")
+		case "inmemory":
+			options = append(options, storage.RepositoryIndex(memorycache.NewInMemoryRepositoryIndex()))
+			repositoryIndex = true
+			dcontext.GetLogger(app).Infof("using inmemory repository index")
+		case nil:
+		default:
+			dcontext.GetLogger(app).Warnf("unknown repository index type %q, repository index disabled", i)
 		}
-	}
 
-	// configure storage caches
-	if cc, ok := config.Storage["cache"]; ok {
 		v, ok := cc["blobdescriptor"]
 		if !ok {
 			// Backwards compatible: "layerinfo" == "blobdescriptor"
@@ -320,31 +428,69 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		}
 	}
 
+	if repositoryIndex {
+		// the catalog walks the storage until the index is built, and again
+		// once it expired until it is built anew
+		go func(registry distribution.Namespace) {
+			for {
+				ctx, span := tracing.StartSpan(app, "registry.BuildRepositoryIndex")
+				err := storage.BuildRepositoryIndex(ctx, registry)
+				tracing.EndSpan(span, err)
+				if err != nil {
+					dcontext.GetLogger(app).Errorf("error building repository index: %v", err)
+				}
+				time.Sleep(repositoryIndexCheckInterval)
+			}
+		}(app.registry)
+	}
+
+	if gcConfig != nil {
+		if app.readOnly {
+			dcontext.GetLogger(app).Warnf("online garbage collection is disabled in read-only mode")
+		} else {
+			var usage *storage.UsageAccounting
+			if app.quota != nil {
+				usage = app.quota.usage
+			}
+			startGarbageCollector(app, app.driver, app.registry, usage, app.auditJob(garbageCollectActor), dcontext.GetLogger(app), gcConfig)
+		}
+	}
+
+	if scrubConfig != nil {
+		startScrubber(app, app.driver, app.registry, app.auditJob(scrubActor), dcontext.GetLogger(app), scrubConfig, app.readOnly)
+	}
+
+	app.configureRetention(config, app.driver, app.registry)
+
 	app.registry, err = applyRegistryMiddleware(app, app.registry, app.driver, config.Middleware["registry"])
 	if err != nil {
 		panic(err)
 	}
 
-	authType := config.Auth.Type()
-
-	if authType != "" && !strings.EqualFold(authType, "none") {
-		accessController, err := auth.GetAccessController(config.Auth.Type(), config.Auth.Parameters())
-		if err != nil {
-			panic(fmt.Sprintf("unable to configure authorization (%s): %v", authType, err))
-		}
-		app.accessController = accessController
-		dcontext.GetLogger(app).Debugf("configured %q access controller", authType)
+	app.accessController, err = newAccessController(config)
+	if err != nil {
+		panic(err.Error())
+	}
+	if app.accessController != nil {
+		dcontext.GetLogger(app).Debugf("configured %q access controller", config.Auth.Type())
 	}
 
 	// configure as a pull through cache
-	if config.Proxy.RemoteURL != "" {
+	if config.Proxy.RemoteURL != "" || len(config.Proxy.Upstreams) > 0 {
 		app.registry, err = proxy.NewRegistryPullThroughCache(ctx, app.registry, app.driver, config.Proxy)
 		if err != nil {
 			panic(err.Error())
 		}
 		app.isCache = true
-		dcontext.GetLogger(app).Info("Registry configured as a proxy cache to ", config.Proxy.RemoteURL)
+		if config.Proxy.RemoteURL != "" {
+			dcontext.GetLogger(app).Info("Registry configured as a proxy cache to ", config.Proxy.RemoteURL)
+		}
+		for _, upstream := range config.Proxy.Upstreams {
+			dcontext.GetLogger(app).Infof("Registry configured as a proxy cache of %s/ to %s", upstream.Prefix, upstream.RemoteURL)
+		}
 	}
+	app.configureReplication(config)
+
 	var ok bool
 	app.repoRemover, ok = app.registry.(distribution.RepositoryRemover)
 	if !ok {
@@ -354,6 +500,65 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	return app
 }
 
+// newAccessController returns the access controller configured, nil if
+// authorization is not enabled.
+func newAccessController(config *configuration.Configuration) (auth.AccessController, error) {
+	authType := config.Auth.Type()
+	if authType == "" || strings.EqualFold(authType, "none") {
+		return nil, nil
+	}
+	if strings.EqualFold(authType, "mtls") && len(config.HTTP.TLS.ClientCAs) == 0 {
+		// without them the client certificates are not even requested
+		return nil, fmt.Errorf("unable to configure authorization (%s): http.tls.clientcas must be set", authType)
+	}
+
+	accessController, err := auth.GetAccessController(authType, config.Auth.Parameters())
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure authorization (%s): %v", authType, err)
+	}
+	return accessController, nil
+}
+
+// manifestURLRegexps compiles the regular expressions validating the URLs of
+// the foreign layers. They are nil if the validation is disabled.
+func manifestURLRegexps(config *configuration.Configuration) (allow, deny *regexp.Regexp, err error) {
+	if !config.Validation.Enabled && config.Validation.Disabled {
+		return nil, nil, nil
+	}
+
+	urls := config.Validation.Manifests.URLs
+	if len(urls.Allow) == 0 && len(urls.Deny) == 0 {
+		// If Allow and Deny are empty, allow nothing.
+		return regexp.MustCompile("^$"), nil, nil
+	}
+	if allow, err = joinRegexps(urls.Allow); err != nil {
+		return nil, nil, fmt.Errorf("validation.manifests.urls.allow: %s", err)
+	}
+	if deny, err = joinRegexps(urls.Deny); err != nil {
+		return nil, nil, fmt.Errorf("validation.manifests.urls.deny: %s", err)
+	}
+	return allow, deny, nil
+}
+
+// joinRegexps compiles a regular expression matching any of expressions, nil
+// if there are none.
+func joinRegexps(expressions []string) (*regexp.Regexp, error) {
+	if len(expressions) == 0 {
+		return nil, nil
+	}
+
+	groups := make([]string, len(expressions))
+	for i, s := range expressions {
+		// Validate via compilation.
+		if _, err := regexp.Compile(s); err != nil {
+			return nil, err
+		}
+		// Wrap with non-capturing group.
+		groups[i] = fmt.Sprintf("(?:%s)", s)
+	}
+	return regexp.Compile(strings.Join(groups, "|"))
+}
+
 // RegisterHealthChecks is an awful hack to defer health check registration
 // control to callers. This should only ever be called once per registry
 // process, typically in a main function. The correct way would be register
@@ -468,7 +673,32 @@ func (app *App) register(routeName string, dispatch dispatchFunc) {
 
 // configureEvents prepares the event sink for action.
 func (app *App) configureEvents(configuration *configuration.Configuration) {
-	// Configure all of the endpoint sinks.
+	// NOTE(stevvooe): Moving to a new queuing implementation is as easy as
+	// replacing broadcaster with a rabbitmq implementation. It's recommended
+	// that the registry instances also act as the workers to keep deployment
+	// simple.
+	app.events.sink = events.NewBroadcaster(app.endpointSinks(configuration)...)
+
+	// Populate registry event source
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = configuration.HTTP.Addr
+	} else {
+		// try to pick the port off the config
+		_, port, err := net.SplitHostPort(configuration.HTTP.Addr)
+		if err == nil {
+			hostname = net.JoinHostPort(hostname, port)
+		}
+	}
+
+	app.events.source = notifications.SourceRecord{
+		Addr:       hostname,
+		InstanceID: dcontext.GetStringValue(app, "instance.id"),
+	}
+}
+
+// endpointSinks returns the sinks of the notification endpoints enabled.
+func (app *App) endpointSinks(configuration *configuration.Configuration) []events.Sink {
 	var sinks []events.Sink
 	for _, endpoint := range configuration.Notifications.Endpoints {
 		if endpoint.Disabled {
@@ -488,29 +718,51 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 
 		sinks = append(sinks, endpoint)
 	}
+	return sinks
+}
 
-	// NOTE(stevvooe): Moving to a new queuing implementation is as easy as
-	// replacing broadcaster with a rabbitmq implementation. It's recommended
-	// that the registry instances also act as the workers to keep deployment
-	// simple.
-	app.events.sink = events.NewBroadcaster(sinks...)
+// configureReplication adds the sinks replicating the pushed manifests to
+// the target registries to the event sink. It must be called once the
+// registry is configured.
+func (app *App) configureReplication(configuration *configuration.Configuration) {
+	if err := app.addReplicators(app.events.sink.(*events.Broadcaster), configuration); err != nil {
+		panic(err.Error())
+	}
+}
 
-	// Populate registry event source
-	hostname, err := os.Hostname()
-	if err != nil {
-		hostname = configuration.HTTP.Addr
-	} else {
-		// try to pick the port off the config
-		_, port, err := net.SplitHostPort(configuration.HTTP.Addr)
-		if err == nil {
-			hostname = net.JoinHostPort(hostname, port)
+// addReplicators adds the sinks replicating the pushed manifests to the
+// target registries to broadcaster.
+func (app *App) addReplicators(broadcaster *events.Broadcaster, configuration *configuration.Configuration) error {
+	for _, target := range configuration.Notifications.Replication {
+		if target.Disabled {
+			dcontext.GetLogger(app).Infof("replication %s disabled, skipping", target.Name)
+			continue
 		}
-	}
 
-	app.events.source = notifications.SourceRecord{
-		Addr:       hostname,
-		InstanceID: dcontext.GetStringValue(app, "instance.id"),
+		config := notifications.ReplicationConfig{
+			Username:  target.Username,
+			Password:  target.Password,
+			Threshold: target.Threshold,
+			Backoff:   target.Backoff,
+		}
+		var err error
+		if target.Repository != "" {
+			if config.Repository, err = regexp.Compile(target.Repository); err != nil {
+				return fmt.Errorf("invalid repository expression of replication %s: %v", target.Name, err)
+			}
+		}
+		if target.Tags != "" {
+			if config.Tags, err = regexp.Compile(target.Tags); err != nil {
+				return fmt.Errorf("invalid tags expression of replication %s: %v", target.Name, err)
+			}
+		}
+
+		dcontext.GetLogger(app).Infof("configuring replication %v (%v)", target.Name, target.URL)
+		if err := broadcaster.Add(notifications.NewReplicator(target.Name, target.URL, app.registry, config)); err != nil {
+			return fmt.Errorf("error configuring replication %s: %v", target.Name, err)
+		}
 	}
+	return nil
 }
 
 type redisStartAtKey struct{}
@@ -521,10 +773,28 @@ func (app *App) configureRedis(configuration *configuration.Configuration) {
 		return
 	}
 
-	pool := &redis.Pool{
+	app.redis = newRedisPool(app, configuration)
+
+	// setup expvar
+	registry := expvar.Get("registry")
+	if registry == nil {
+		registry = expvar.NewMap("registry")
+	}
+
+	registry.(*expvar.Map).Set("redis", expvar.Func(func() interface{} {
+		return map[string]interface{}{
+			"Config": configuration.Redis,
+			"Active": app.redis.ActiveCount(),
+		}
+	}))
+}
+
+// newRedisPool returns a pool of connections to the configured redis server.
+func newRedisPool(ctx context.Context, configuration *configuration.Configuration) *redis.Pool {
+	return &redis.Pool{
 		Dial: func() (redis.Conn, error) {
 			// TODO(stevvooe): Yet another use case for contextual timing.
-			ctx := context.WithValue(app, redisStartAtKey{}, time.Now())
+			ctx := context.WithValue(ctx, redisStartAtKey{}, time.Now())
 
 			done := func(err error) {
 				logger := dcontext.GetLoggerWithField(ctx, "redis.connect.duration",
@@ -543,7 +813,7 @@ func (app *App) configureRedis(configuration *configuration.Configuration) {
 				redis.DialWriteTimeout(configuration.Redis.WriteTimeout),
 				redis.DialUseTLS(configuration.Redis.TLS.Enabled))
 			if err != nil {
-				dcontext.GetLogger(app).Errorf("error connecting to redis instance %s: %v",
+				dcontext.GetLogger(ctx).Errorf("error connecting to redis instance %s: %v",
 					configuration.Redis.Addr, err)
 				done(err)
 				return nil, err
@@ -589,21 +859,18 @@ func (app *App) configureRedis(configuration *configuration.Configuration) {
 		},
 		Wait: false, // if a connection is not available, proceed without cache.
 	}
+}
 
-	app.redis = pool
-
-	// setup expvar
-	registry := expvar.Get("registry")
-	if registry == nil {
-		registry = expvar.NewMap("registry")
+// SharedManifestCacheProvider returns the manifest cache which the registries
+// run with the configuration share through redis, or nil if they share none.
+// Commands removing content from the storage behind the registries, like
+// garbage-collect, clear the content from that cache.
+func SharedManifestCacheProvider(ctx context.Context, config *configuration.Configuration) cache.ManifestCacheProvider {
+	cc, ok := config.Storage["cache"]
+	if !ok || cc["manifest"] != "redis" || config.Redis.Addr == "" {
+		return nil
 	}
-
-	registry.(*expvar.Map).Set("redis", expvar.Func(func() interface{} {
-		return map[string]interface{}{
-			"Config": configuration.Redis,
-			"Active": app.redis.ActiveCount(),
-		}
-	}))
+	return rediscache.NewRedisManifestCacheProvider(newRedisPool(ctx, config))
 }
 
 // configureLogHook prepares logging hook parameters.
@@ -678,6 +945,13 @@ type dispatchFunc func(ctx *Context, r *http.Request) http.Handler
 // handler, using the dispatch factory function.
 func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var routeName string
+		if route := mux.CurrentRoute(r); route != nil {
+			routeName = route.GetName()
+		}
+		ctx, span := tracing.StartServerSpan(r, routeName)
+		r = r.WithContext(ctx)
+
 		for headerName, headerValues := range app.Config.HTTP.Headers {
 			for _, value := range headerValues {
 				w.Header().Add(headerName, value)
@@ -685,6 +959,12 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 		}
 		context := app.context(w, r)
 
+		// the span ends once the errors have been served
+		defer func() {
+			status, _ := context.Value("http.response.status").(int)
+			tracing.EndServerSpan(span, status)
+		}()
+
 		defer func() {
 			// Automated error response handling here. Handlers may return their
 			// own errors if they need different behavior (such as range errors
@@ -697,6 +977,13 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 			}
 		}()
 
+		// the client is limited before authorization, so that failed
+		// attempts to authenticate are limited as well
+		if err := app.getRateLimiter().limitClient(context, w, r, app.trustedProxies.clientIP(r)); err != nil {
+			context.Errors = append(context.Errors, err)
+			return
+		}
+
 		if err := app.authorized(w, r, context); err != nil {
 			dcontext.GetLogger(context).Warnf("error authorizing context: %v", err)
 			return
@@ -704,10 +991,16 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 		// Add username to request logging
 		context.Context = dcontext.WithLogger(context.Context, dcontext.GetLogger(context.Context, auth.UserNameKey))
 
+		if err := app.getRateLimiter().limit(context, w, r, getName(context)); err != nil {
+			context.Errors = append(context.Errors, err)
+			return
+		}
+
 		// sync up context on the request.
 		r = r.WithContext(context)
 
 		if app.nameRequired(r) {
+			span.SetAttributes(attribute.String("registry.repository", getName(context)))
 			nameRef, err := reference.WithName(getName(context))
 			if err != nil {
 				dcontext.GetLogger(context).Errorf("error parsing reference from context: %v", err)
@@ -840,7 +1133,8 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 	dcontext.GetLogger(context).Debug("authorizing request")
 	repo := getName(context)
 
-	if app.accessController == nil {
+	accessController := app.getAccessController()
+	if accessController == nil {
 		return nil // access controller is not enabled.
 	}
 
@@ -870,8 +1164,12 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 		accessRecords = appendCatalogAccessRecord(accessRecords, r)
 	}
 
-	ctx, err := app.accessController.Authorized(context.Context, accessRecords...)
+	ctx, err := accessController.Authorized(context.Context, accessRecords...)
 	if err != nil {
+		reason := authFailureReason(err)
+		authFailures.WithValues(reason).Inc(1)
+		app.auditDenied(context, r, accessRecords, reason)
+
 		switch err := err.(type) {
 		case auth.Challenge:
 			// Add the appropriate WWW-Auth header
@@ -881,6 +1179,14 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 				dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
 			}
 		default:
+			if errors.Is(err, auth.ErrAccessDenied) {
+				// the credentials are valid, but do not grant the access
+				if err := errcode.ServeJSON(w, errcode.ErrorCodeDenied.WithDetail(accessRecords)); err != nil {
+					dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
+				}
+				break
+			}
+
 			// This condition is a potential security problem either in
 			// the configuration or whatever is backing the access
 			// controller. Just return a bad request with no information
@@ -901,14 +1207,19 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 }
 
 // eventBridge returns a bridge for the current request, configured with the
-// correct actor and source.
+// correct actor and source. The actions of the request are recorded in the
+// audit log as well, when enabled.
 func (app *App) eventBridge(ctx *Context, r *http.Request) notifications.Listener {
 	actor := notifications.ActorRecord{
 		Name: getUserName(ctx, r),
 	}
 	request := notifications.NewRequestRecord(dcontext.GetRequestID(ctx), r)
 
-	return notifications.NewBridge(ctx.urlBuilder, app.events.source, actor, request, app.events.sink, app.Config.Notifications.EventConfig.IncludeReferences)
+	listener := notifications.NewBridge(ctx.urlBuilder, app.events.source, actor, request, app.getEventSink(), app.Config.Notifications.EventConfig.IncludeReferences)
+	if app.audit != nil {
+		listener = app.auditListener(ctx, r, listener)
+	}
+	return listener
 }
 
 // nameRequired returns true if the route requires a name.
@@ -1010,10 +1321,19 @@ func applyRepoMiddleware(ctx context.Context, repository distribution.Repository
 	return repository, nil
 }
 
-// applyStorageMiddleware wraps a storage driver with the configured middlewares
-func applyStorageMiddleware(driver storagedriver.StorageDriver, middlewares []configuration.Middleware) (storagedriver.StorageDriver, error) {
+// applyStorageMiddleware wraps a storage driver with the configured middlewares,
+// providing the signedurl middleware the HTTP secret to sign URLs with.
+func applyStorageMiddleware(driver storagedriver.StorageDriver, middlewares []configuration.Middleware, secret string) (storagedriver.StorageDriver, error) {
 	for _, mw := range middlewares {
-		smw, err := storagemiddleware.Get(mw.Name, mw.Options, driver)
+		options := make(map[string]interface{}, len(mw.Options)+1)
+		for k, v := range mw.Options {
+			options[k] = v
+		}
+		if mw.Name == "signedurl" {
+			options[signedurl.SecretParameter] = secret
+		}
+
+		smw, err := storagemiddleware.Get(mw.Name, options, driver)
 		if err != nil {
 			return nil, fmt.Errorf("unable to configure storage middleware (%s): %v", mw.Name, err)
 		}
@@ -1088,6 +1408,17 @@ func startUploadPurger(ctx context.Context, storageDriver storagedriver.StorageD
 		badPurgeUploadConfig("dryrun missing")
 	}
 
+	schedule(log, "upload purge", intervalDuration, func() {
+		ctx, span := tracing.StartSpan(ctx, "registry.PurgeUploads")
+		defer span.End()
+		storage.PurgeUploads(ctx, storageDriver, time.Now().Add(-purgeAgeDuration), !dryRunBool)
+	})
+}
+
+// schedule runs job in a goroutine after a random jitter of up to an hour,
+// which spreads the jobs of the registry instances started together, and then
+// every interval. name names the job in the logs.
+func schedule(log dcontext.Logger, name string, interval time.Duration, job func()) {
 	go func() {
 		randInt, err := rand.Int(rand.Reader, new(big.Int).SetInt64(math.MaxInt64))
 		if err != nil {
@@ -1096,13 +1427,167 @@ func startUploadPurger(ctx context.Context, storageDriver storagedriver.StorageD
 			randInt = big.NewInt(30)
 		}
 		jitter := time.Duration(randInt.Int64()%60) * time.Minute
-		log.Infof("Starting upload purge in %s", jitter)
+		log.Infof("Starting %s in %s", name, jitter)
 		time.Sleep(jitter)
 
 		for {
-			storage.PurgeUploads(ctx, storageDriver, time.Now().Add(-purgeAgeDuration), !dryRunBool)
-			log.Infof("Starting upload purge in %s", intervalDuration)
-			time.Sleep(intervalDuration)
+			job()
+			log.Infof("Starting %s in %s", name, interval)
+			time.Sleep(interval)
 		}
 	}()
 }
+
+func badGarbageCollectConfig(reason string) {
+	panic(fmt.Sprintf("Unable to parse garbage collection configuration: %s", reason))
+}
+
+// startGarbageCollector schedules a goroutine which will periodically
+// remove unreferenced manifests and blobs while the registry continues to
+// accept pushes. Content written within the grace period is never removed.
+// The content removed is released from usage, if set, and recorded with
+// auditLog, if set.
+func startGarbageCollector(ctx context.Context, storageDriver storagedriver.StorageDriver, registry distribution.Namespace, usage *storage.UsageAccounting, auditLog auditFunc, log dcontext.Logger, config map[interface{}]interface{}) {
+	if config["enabled"] != true {
+		return
+	}
+
+	parseDuration := func(key, defaultValue string) time.Duration {
+		v, ok := config[key]
+		if !ok {
+			v = defaultValue
+		}
+		s, ok := v.(string)
+		if !ok {
+			badGarbageCollectConfig(fmt.Sprintf("%s is not a string", key))
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			badGarbageCollectConfig(fmt.Sprintf("Cannot parse %s: %s", key, err.Error()))
+		}
+		if d <= 0 {
+			badGarbageCollectConfig(fmt.Sprintf("%s must be positive", key))
+		}
+		return d
+	}
+
+	parseBool := func(key string) bool {
+		v, ok := config[key]
+		if !ok {
+			return false
+		}
+		b, ok := v.(bool)
+		if !ok {
+			badGarbageCollectConfig(fmt.Sprintf("cannot parse %s", key))
+		}
+		return b
+	}
+
+	intervalDuration := parseDuration("interval", "24h")
+	opts := storage.GCOpts{
+		DryRun:         parseBool("dryrun"),
+		RemoveUntagged: parseBool("removeuntagged"),
+		GracePeriod:    parseDuration("graceperiod", "1h"),
+		Logger:         log,
+		Usage:          usage,
+	}
+	if auditLog != nil {
+		opts.ManifestDeleted = func(repo reference.Named, dgst digest.Digest) {
+			auditLog(audit.ActionDelete, &audit.Target{
+				Type:       audit.TargetManifest,
+				Repository: repo.Name(),
+				Digest:     dgst,
+			})
+		}
+		opts.BlobDeleted = func(dgst digest.Digest) {
+			auditLog(audit.ActionDelete, &audit.Target{
+				Type:   audit.TargetBlob,
+				Digest: dgst,
+			})
+		}
+	}
+
+	schedule(log, "garbage collection", intervalDuration, func() {
+		ctx, span := tracing.StartSpan(ctx, "registry.MarkAndSweep")
+		err := storage.MarkAndSweep(ctx, storageDriver, registry, opts)
+		tracing.EndSpan(span, err)
+		if err != nil {
+			log.Errorf("Garbage collection failed: %v", err)
+		} else {
+			log.Infof("Garbage collection finished")
+		}
+	})
+}
+
+func badScrubConfig(reason string) {
+	panic(fmt.Sprintf("Unable to parse scrub configuration: %s", reason))
+}
+
+// startScrubber schedules a goroutine which will periodically verify the
+// integrity of the stored content, logging the problems found. Corrupt blobs
+// and dangling links are moved to the quarantine directory if configured,
+// unless the registry is read-only, and recorded with auditLog, if set.
+func startScrubber(ctx context.Context, storageDriver storagedriver.StorageDriver, registry distribution.Namespace, auditLog auditFunc, log dcontext.Logger, config map[interface{}]interface{}, readOnly bool) {
+	if config["enabled"] != true {
+		return
+	}
+
+	intervalDuration := 24 * time.Hour
+	if v, ok := config["interval"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			badScrubConfig("interval is not a string")
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			badScrubConfig(fmt.Sprintf("Cannot parse interval: %s", err.Error()))
+		}
+		if d <= 0 {
+			badScrubConfig("interval must be positive")
+		}
+		intervalDuration = d
+	}
+
+	var opts storage.VerifyOpts
+	if v, ok := config["quarantine"]; ok {
+		opts.Quarantine, ok = v.(bool)
+		if !ok {
+			badScrubConfig("cannot parse quarantine")
+		}
+	}
+	if opts.Quarantine && readOnly {
+		log.Warnf("scrub quarantine is disabled in read-only mode")
+		opts.Quarantine = false
+	}
+
+	schedule(log, "scrub", intervalDuration, func() {
+		ctx, span := tracing.StartSpan(ctx, "registry.Verify")
+		report, err := storage.Verify(ctx, storageDriver, registry, opts)
+		tracing.EndSpan(span, err)
+		if err != nil {
+			log.Errorf("Scrub failed: %v", err)
+			return
+		}
+		for _, problem := range report.Problems {
+			dcontext.GetLoggerWithFields(ctx, map[interface{}]interface{}{
+				"scrub.kind":        problem.Kind,
+				"scrub.repository":  problem.Repository,
+				"scrub.digest":      problem.Digest,
+				"scrub.path":        problem.Path,
+				"scrub.quarantined": problem.Quarantined,
+			}).Warnf("Scrub found a problem: %s", problem.Detail)
+			if problem.Quarantined && auditLog != nil {
+				target := &audit.Target{
+					Type:       audit.TargetBlob,
+					Repository: problem.Repository,
+					Digest:     problem.Digest,
+				}
+				if problem.Kind == storage.ProblemDanglingLink {
+					target.Type = audit.TargetLink
+				}
+				auditLog(audit.ActionQuarantine, target)
+			}
+		}
+		log.Infof("Scrub finished: verified %d blobs, %d manifests and %d links, found %d problems", report.Blobs, report.Manifests, report.Links, len(report.Problems))
+	})
+}
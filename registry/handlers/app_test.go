@@ -10,6 +10,7 @@ import (
 
 	"github.com/docker/distribution/configuration"
 	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/api/errcode"
 	v2 "github.com/docker/distribution/registry/api/v2"
 	"github.com/docker/distribution/registry/auth"
@@ -17,6 +18,9 @@ import (
 	"github.com/docker/distribution/registry/storage"
 	memorycache "github.com/docker/distribution/registry/storage/cache/memory"
 	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/tracing/tracingtest"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 // TestAppDispatcher builds an application with a test dispatcher and ensures
@@ -30,16 +34,18 @@ func TestAppDispatcher(t *testing.T) {
 	if err != nil {
 		t.Fatalf("error creating registry: %v", err)
 	}
+	// The routes are bound to the test server below, so the shared router
+	// must not be used.
+	router := v2.RouterWithPrefix("")
 	app := &App{
 		Config:   &configuration.Configuration{},
 		Context:  ctx,
-		router:   v2.Router(),
+		router:   router,
 		driver:   driver,
 		registry: registry,
 	}
 	server := httptest.NewServer(app)
 	defer server.Close()
-	router := v2.Router()
 
 	serverURL, err := url.Parse(server.URL)
 	if err != nil {
@@ -210,6 +216,38 @@ func TestNewApp(t *testing.T) {
 	}
 }
 
+// TestAuthorizedDenied ensures that the requests of users denied access are
+// answered with 403 DENIED, without asking for credentials.
+func TestAuthorizedDenied(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": nil,
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	app := NewApp(context.Background(), &config)
+	app.accessController = denyingAccessController{}
+
+	server := httptest.NewServer(app)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/v2/")
+	if err != nil {
+		t.Fatalf("unexpected error during GET: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("unexpected status code: %d != %d", resp.StatusCode, http.StatusForbidden)
+	}
+	checkBodyHasErrorCodes(t, "denied request", resp, errcode.ErrorCodeDenied)
+	if header := resp.Header.Get("WWW-Authenticate"); header != "" {
+		t.Fatalf("unexpected WWW-Authenticate header: %q", header)
+	}
+}
+
 // Test the access record accumulator
 func TestAppendAccessRecords(t *testing.T) {
 	repo := "testRepo"
@@ -274,3 +312,117 @@ func TestAppendAccessRecords(t *testing.T) {
 		t.Fatalf("Actual access record differs from expected")
 	}
 }
+
+func TestStartGarbageCollectorConfig(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	registry, err := storage.NewRegistry(ctx, driver)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	for _, tc := range []struct {
+		config      map[interface{}]interface{}
+		shouldPanic bool
+	}{
+		{config: map[interface{}]interface{}{}},
+		{config: map[interface{}]interface{}{"enabled": false, "graceperiod": 1}},
+		{config: map[interface{}]interface{}{"enabled": true, "graceperiod": 1}, shouldPanic: true},
+		{config: map[interface{}]interface{}{"enabled": true, "graceperiod": "0s"}, shouldPanic: true},
+		{config: map[interface{}]interface{}{"enabled": true, "interval": "soon"}, shouldPanic: true},
+		{config: map[interface{}]interface{}{"enabled": true, "dryrun": "yes"}, shouldPanic: true},
+		{config: map[interface{}]interface{}{"enabled": true, "interval": "1h", "graceperiod": "30m", "dryrun": true, "removeuntagged": true}},
+	} {
+		func() {
+			defer func() {
+				if r := recover(); (r != nil) != tc.shouldPanic {
+					t.Errorf("config %v: expected panic %t, got %v", tc.config, tc.shouldPanic, r)
+				}
+			}()
+			startGarbageCollector(ctx, driver, registry, nil, nil, context.GetLogger(ctx), tc.config)
+		}()
+	}
+}
+
+func TestStartScrubberConfig(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	registry, err := storage.NewRegistry(ctx, driver)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	for _, tc := range []struct {
+		config      map[interface{}]interface{}
+		shouldPanic bool
+	}{
+		{config: map[interface{}]interface{}{}},
+		{config: map[interface{}]interface{}{"enabled": false, "interval": 1}},
+		{config: map[interface{}]interface{}{"enabled": true, "interval": 1}, shouldPanic: true},
+		{config: map[interface{}]interface{}{"enabled": true, "interval": "0s"}, shouldPanic: true},
+		{config: map[interface{}]interface{}{"enabled": true, "quarantine": "yes"}, shouldPanic: true},
+		{config: map[interface{}]interface{}{"enabled": true, "interval": "1h", "quarantine": true}},
+	} {
+		func() {
+			defer func() {
+				if r := recover(); (r != nil) != tc.shouldPanic {
+					t.Errorf("config %v: expected panic %t, got %v", tc.config, tc.shouldPanic, r)
+				}
+			}()
+			startScrubber(ctx, driver, registry, nil, context.GetLogger(ctx), tc.config, false)
+		}()
+	}
+}
+
+// TestDispatcherTracing ensures that the requests served are traced, as part
+// of the trace propagated by the client, down to the storage driver.
+func TestDispatcherTracing(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	fooBar, _ := reference.WithName("foo/bar")
+	createRepository(env, t, fooBar.Name(), "latest")
+
+	recorder, restore := tracingtest.Record()
+	defer restore()
+
+	latest, _ := reference.WithTag(fooBar, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(latest)
+	checkErr(t, err, "building manifest url")
+	req, err := http.NewRequest(http.MethodGet, manifestURL, nil)
+	checkErr(t, err, "creating request")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching manifest")
+	resp.Body.Close()
+	checkResponse(t, "fetching manifest", resp, http.StatusOK)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		if traceID := span.SpanContext().TraceID().String(); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("span %s: expected the propagated trace, got %s", span.Name(), traceID)
+		}
+		spans[span.Name()] = span
+	}
+
+	server, ok := spans["GET manifest"]
+	if !ok {
+		t.Fatalf("expected a server span, got %v", spans)
+	}
+	if spanID := server.Parent().SpanID().String(); spanID != "00f067aa0ba902b7" {
+		t.Errorf("expected the server span to be a child of the propagated span, got %s", spanID)
+	}
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, attr := range server.Attributes() {
+		attrs[attr.Key] = attr.Value
+	}
+	if attrs["registry.repository"].AsString() != fooBar.Name() || attrs["http.status_code"].AsInt64() != http.StatusOK {
+		t.Errorf("unexpected server span attributes %v", server.Attributes())
+	}
+
+	for _, name := range []string{"(*tagStore).Get", "(*manifestStore).Get", "storage.GetContent"} {
+		if _, ok := spans[name]; !ok {
+			t.Errorf("expected a %s span, got %v", name, spans)
+		}
+	}
+}
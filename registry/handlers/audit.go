@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/audit"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/opencontainers/go-digest"
+)
+
+// configureAudit opens the audit log, when enabled.
+func (app *App) configureAudit(config *configuration.Configuration) {
+	logger, err := audit.New(config.Audit)
+	if err != nil {
+		panic(err)
+	}
+	app.audit = logger
+}
+
+// auditListener records in the audit log the pushes, mounts and deletions
+// made by a request, before passing them on to the next listener. The pulls
+// are not recorded.
+type auditListener struct {
+	notifications.Listener
+
+	ctx     context.Context
+	logger  *audit.Logger
+	user    string
+	claims  map[string]interface{}
+	request *audit.Request
+}
+
+var _ notifications.Listener = &auditListener{}
+
+// auditListener returns a listener recording the actions of the current
+// request, and passing them on to next.
+func (app *App) auditListener(ctx *Context, r *http.Request, next notifications.Listener) notifications.Listener {
+	userInfo, _ := ctx.Value(auth.UserKey).(auth.UserInfo)
+	return &auditListener{
+		Listener: next,
+		ctx:      ctx,
+		logger:   app.audit,
+		user:     getUserName(ctx, r),
+		claims:   userInfo.Claims,
+		request:  app.auditRequest(ctx, r),
+	}
+}
+
+func (l *auditListener) ManifestPushed(repo reference.Named, sm distribution.Manifest, options ...distribution.ManifestServiceOption) error {
+	target := &audit.Target{
+		Type:       audit.TargetManifest,
+		Repository: repo.Name(),
+	}
+	if mediaType, payload, err := sm.Payload(); err == nil {
+		// the canonical descriptor, as in the notification events
+		if _, desc, err := distribution.UnmarshalManifest(mediaType, payload); err == nil {
+			target.Digest = desc.Digest
+			target.Size = desc.Size
+		}
+		target.MediaType = mediaType
+	}
+
+	action := audit.ActionPush
+	for _, option := range options {
+		if opt, ok := option.(distribution.WithTagOption); ok {
+			action = audit.ActionTag
+			target.Tag = opt.Tag
+			break
+		}
+	}
+	l.log(action, target)
+	return l.Listener.ManifestPushed(repo, sm, options...)
+}
+
+func (l *auditListener) ManifestDeleted(repo reference.Named, dgst digest.Digest) error {
+	l.log(audit.ActionDelete, &audit.Target{
+		Type:       audit.TargetManifest,
+		Repository: repo.Name(),
+		Digest:     dgst,
+	})
+	return l.Listener.ManifestDeleted(repo, dgst)
+}
+
+func (l *auditListener) BlobPushed(repo reference.Named, desc distribution.Descriptor) error {
+	l.log(audit.ActionPush, &audit.Target{
+		Type:       audit.TargetBlob,
+		Repository: repo.Name(),
+		Digest:     desc.Digest,
+		MediaType:  desc.MediaType,
+		Size:       desc.Size,
+	})
+	return l.Listener.BlobPushed(repo, desc)
+}
+
+func (l *auditListener) BlobMounted(repo reference.Named, desc distribution.Descriptor, fromRepo reference.Named) error {
+	l.log(audit.ActionMount, &audit.Target{
+		Type:       audit.TargetBlob,
+		Repository: repo.Name(),
+		Digest:     desc.Digest,
+		MediaType:  desc.MediaType,
+		Size:       desc.Size,
+		From:       fromRepo.Name(),
+	})
+	return l.Listener.BlobMounted(repo, desc, fromRepo)
+}
+
+func (l *auditListener) BlobDeleted(repo reference.Named, dgst digest.Digest) error {
+	l.log(audit.ActionDelete, &audit.Target{
+		Type:       audit.TargetBlob,
+		Repository: repo.Name(),
+		Digest:     dgst,
+	})
+	return l.Listener.BlobDeleted(repo, dgst)
+}
+
+func (l *auditListener) TagDeleted(repo reference.Named, tag string) error {
+	l.log(audit.ActionDelete, &audit.Target{
+		Type:       audit.TargetTag,
+		Repository: repo.Name(),
+		Tag:        tag,
+	})
+	return l.Listener.TagDeleted(repo, tag)
+}
+
+func (l *auditListener) RepoDeleted(repo reference.Named) error {
+	l.log(audit.ActionDelete, &audit.Target{
+		Type:       audit.TargetRepository,
+		Repository: repo.Name(),
+	})
+	return l.Listener.RepoDeleted(repo)
+}
+
+// log records the action on target. The action being already done, a
+// record which cannot be written is only logged.
+func (l *auditListener) log(action string, target *audit.Target) {
+	err := l.logger.Log(audit.Record{
+		Action:  action,
+		Target:  target,
+		User:    l.user,
+		Claims:  l.claims,
+		Request: l.request,
+	})
+	if err != nil {
+		dcontext.GetLogger(l.ctx).Errorf("error writing audit record of %s %s %s: %v", action, target.Type, target.Repository, err)
+	}
+}
+
+// auditDenied records in the audit log the request denied the access
+// requested, for reason. The requests sent without credentials are not
+// recorded, as they are part of the normal authentication flow.
+func (app *App) auditDenied(ctx *Context, r *http.Request, accessRecords []auth.Access, reason string) {
+	if app.audit == nil || reason == authMissingCredentials {
+		return
+	}
+
+	access := make([]audit.Access, 0, len(accessRecords))
+	for _, record := range accessRecords {
+		access = append(access, audit.Access{
+			Type:   record.Type,
+			Name:   record.Name,
+			Action: record.Action,
+		})
+	}
+	err := app.audit.Log(audit.Record{
+		Action:  audit.ActionDeny,
+		Access:  access,
+		Reason:  reason,
+		User:    getUserName(ctx, r),
+		Request: app.auditRequest(ctx, r),
+	})
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("error writing audit record of denied request: %v", err)
+	}
+}
+
+// auditRequest describes the request in the audit records. The client IP is
+// only read from the forwarding headers set by the trusted proxies, as the
+// clients could set them to anything.
+func (app *App) auditRequest(ctx context.Context, r *http.Request) *audit.Request {
+	return &audit.Request{
+		ID:        dcontext.GetRequestID(ctx),
+		IP:        app.trustedProxies.clientIP(r),
+		Host:      r.Host,
+		Method:    r.Method,
+		URI:       r.URL.RequestURI(),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// The actors of the actions of the background jobs recorded in the audit log,
+// along with retentionActor.
+const (
+	garbageCollectActor = "garbage-collect"
+	scrubActor          = "scrub"
+)
+
+// auditFunc records in the audit log an action of a background job on target.
+type auditFunc func(action string, target *audit.Target)
+
+// auditJob returns the function recording the actions of the background job
+// named actor, nil if the audit log is not enabled.
+func (app *App) auditJob(actor string) auditFunc {
+	if app.audit == nil {
+		return nil
+	}
+	return func(action string, target *audit.Target) {
+		err := app.audit.Log(audit.Record{
+			Action: action,
+			Target: target,
+			Actor:  actor,
+		})
+		if err != nil {
+			dcontext.GetLogger(app).Errorf("error writing audit record of %s %s %s: %v", action, target.Type, target.Repository, err)
+		}
+	}
+}
+
+// Shutdown closes the audit log, if enabled, once the requests are drained,
+// so that the records written are not lost.
+func (app *App) Shutdown() error {
+	if app.audit == nil {
+		return nil
+	}
+	return app.audit.Close()
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/audit"
+)
+
+func readAuditRecords(t *testing.T, path string) []audit.Record {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []audit.Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record audit.Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid audit record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func newAuditConfig(path string) *configuration.Configuration {
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.Compatibility.Schema1.Enabled = true //nolint:staticcheck // Ignore SA1019: "github.com/docker/distribution/manifest/schema1" is deprecated, as it's used for backward compatibility.
+	config.HTTP.Headers = headerConfig
+	config.Audit.Enabled = true
+	config.Audit.File.Path = path
+	return config
+}
+
+// TestAuditPushAndDelete ensures that the pushes, tags and deletions are
+// recorded in the audit log, and the pulls are not.
+func TestAuditPushAndDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	env := newTestEnvWithConfig(t, newAuditConfig(path))
+	defer env.Shutdown()
+
+	dgst := createRepository(env, t, "foo/bar", "latest")
+
+	named, _ := reference.WithName("foo/bar")
+	ref, _ := reference.WithTag(named, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	resp, err := http.Get(manifestURL)
+	checkErr(t, err, "fetching manifest")
+	resp.Body.Close()
+	checkResponse(t, "fetching manifest", resp, http.StatusOK)
+
+	canonical, _ := reference.WithDigest(named, dgst)
+	manifestURL, err = env.builder.BuildManifestURL(canonical)
+	checkErr(t, err, "building manifest url")
+	resp, err = httpDelete(manifestURL)
+	checkErr(t, err, "deleting manifest")
+	resp.Body.Close()
+	checkResponse(t, "deleting manifest", resp, http.StatusAccepted)
+
+	var blobs, tags, deletes, untags int
+	for _, record := range readAuditRecords(t, path) {
+		if record.Target == nil || record.Target.Repository != "foo/bar" {
+			t.Fatalf("unexpected record %+v", record)
+		}
+		if record.Request == nil || record.Request.IP != "127.0.0.1" || record.Request.ID == "" {
+			t.Errorf("expected the request to be recorded, got %+v", record.Request)
+		}
+		switch record.Action {
+		case audit.ActionPush:
+			if record.Target.Type != audit.TargetBlob {
+				t.Errorf("unexpected push %+v", record.Target)
+			}
+			blobs++
+		case audit.ActionTag:
+			if record.Target.Tag != "latest" || record.Target.Digest != dgst || record.Request.Method != http.MethodPut {
+				t.Errorf("unexpected tag %+v", record)
+			}
+			tags++
+		case audit.ActionDelete:
+			switch record.Target.Type {
+			case audit.TargetManifest:
+				if record.Target.Digest != dgst {
+					t.Errorf("unexpected delete %+v", record.Target)
+				}
+				deletes++
+			case audit.TargetTag:
+				// the tags of the manifest are deleted along with it
+				if record.Target.Tag != "latest" {
+					t.Errorf("unexpected delete %+v", record.Target)
+				}
+				untags++
+			default:
+				t.Errorf("unexpected delete %+v", record.Target)
+			}
+		default:
+			t.Errorf("unexpected action %q", record.Action)
+		}
+	}
+	if blobs == 0 || tags != 1 || deletes != 1 || untags != 1 {
+		t.Errorf("expected blob pushes, a tag, and the deletion of the manifest and its tag, got %d, %d, %d and %d", blobs, tags, deletes, untags)
+	}
+}
+
+// TestAuditDenied ensures that the requests denied access are recorded in
+// the audit log.
+func TestAuditDenied(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	config := newAuditConfig(path)
+	config.Auth = configuration.Auth{
+		"silly": {
+			"realm":   "realm-test",
+			"service": "service-test",
+		},
+	}
+	env := newTestEnvWithConfig(t, config)
+	defer env.Shutdown()
+
+	named, _ := reference.WithName("foo/bar")
+	ref, _ := reference.WithTag(named, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	resp, err := http.Get(manifestURL)
+	checkErr(t, err, "fetching manifest")
+	resp.Body.Close()
+	checkResponse(t, "fetching manifest", resp, http.StatusUnauthorized)
+
+	records := readAuditRecords(t, path)
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	record := records[0]
+	if record.Action != audit.ActionDeny || record.Reason != authChallenge || record.Target != nil {
+		t.Errorf("unexpected record %+v", record)
+	}
+	expected := audit.Access{Type: "repository", Name: "foo/bar", Action: "pull"}
+	if len(record.Access) != 1 || record.Access[0] != expected {
+		t.Errorf("expected access %+v, got %+v", expected, record.Access)
+	}
+	if record.Request.Method != http.MethodGet || record.Request.URI != "/v2/foo/bar/manifests/latest" {
+		t.Errorf("unexpected request %+v", record.Request)
+	}
+}
+
+// TestAuditRequestIP ensures that the client IP recorded is read from the
+// forwarding headers only when set by a trusted proxy.
+func TestAuditRequestIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v2/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	app := &App{}
+	if ip := app.auditRequest(context.Background(), r).IP; ip != "192.0.2.1" {
+		t.Errorf("expected the forwarding headers of the client to be ignored, got %s", ip)
+	}
+
+	proxies, err := parseTrustedProxies([]string{"192.0.2.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.trustedProxies = proxies
+	if ip := app.auditRequest(context.Background(), r).IP; ip != "198.51.100.1" {
+		t.Errorf("expected the client IP forwarded by the trusted proxy, got %s", ip)
+	}
+}
+
+// TestAuditJob ensures that the actions of the background jobs are recorded
+// with their actor and no request.
+func TestAuditJob(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	logger, err := audit.New(newAuditConfig(path).Audit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{Context: context.Background(), audit: logger}
+
+	if (&App{}).auditJob(scrubActor) != nil {
+		t.Fatal("expected no audit without an audit log")
+	}
+	app.auditJob(scrubActor)(audit.ActionQuarantine, &audit.Target{Type: audit.TargetBlob, Digest: "sha256:abc"})
+	if err := app.Shutdown(); err != nil {
+		t.Fatalf("unexpected error closing the audit log: %v", err)
+	}
+
+	records := readAuditRecords(t, path)
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	record := records[0]
+	if record.Action != audit.ActionQuarantine || record.Actor != scrubActor || record.Request != nil || record.Target.Digest != "sha256:abc" {
+		t.Errorf("unexpected record %+v", record)
+	}
+}
@@ -77,6 +77,9 @@ func (bh *blobHandler) GetBlob(w http.ResponseWriter, r *http.Request) {
 		bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
 	}
+	if r.Method == http.MethodGet {
+		observeBlobPull(bh.Context, desc, bh.App.repositoryLabels.label(bh.Repository.Named().Name()))
+	}
 }
 
 // DeleteBlob deletes a layer blob
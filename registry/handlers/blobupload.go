@@ -79,13 +79,26 @@ func (buh *blobUploadHandler) StartBlobUpload(w http.ResponseWriter, r *http.Req
 		}
 	}
 
+	if buh.App.quota != nil {
+		var size int64
+		if len(options) > 0 {
+			size = buh.mountedBlobSize(fromRepo, mountDigest)
+		}
+		if err := buh.App.quota.check(buh, buh.Repository.Named().Name(), size); err != nil {
+			buh.Errors = append(buh.Errors, err)
+			return
+		}
+	}
+
 	blobs := buh.Repository.Blobs(buh)
 	upload, err := blobs.Create(buh, options...)
 	if err != nil {
 		if ebm, ok := err.(distribution.ErrBlobMounted); ok {
 			if err := buh.writeBlobCreatedHeaders(w, ebm.Descriptor); err != nil {
 				buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+				return
 			}
+			blobPushes.WithValues(pushMount, buh.App.repositoryLabels.label(buh.Repository.Named().Name())).Inc(1)
 		} else if _, ok := err.(storagedriver.QuotaExceededError); ok {
 			buh.Errors = append(buh.Errors, errcode.ErrorCodeDenied.WithMessage("quota exceeded"))
 		} else if err == distribution.ErrUnsupported {
@@ -171,6 +184,13 @@ func (buh *blobUploadHandler) PatchBlobData(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
+	if r.ContentLength > 0 {
+		if err := buh.App.quota.check(buh, buh.Repository.Named().Name(), buh.Upload.Size()+r.ContentLength); err != nil {
+			buh.Errors = append(buh.Errors, err)
+			return
+		}
+	}
+
 	if err := copyFullPayload(buh, w, r, buh.Upload, -1, "blob PATCH"); err != nil {
 		switch err := err.(type) {
 		case storagedriver.QuotaExceededError:
@@ -250,6 +270,8 @@ func (buh *blobUploadHandler) BlobUploadComplete(w http.ResponseWriter, r *http.
 		switch err := err.(type) {
 		case distribution.ErrBlobInvalidDigest:
 			buh.Errors = append(buh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		case storage.ErrQuotaExceeded:
+			buh.Errors = append(buh.Errors, quotaExceeded(buh, err))
 		case storagedriver.QuotaExceededError:
 			buh.Errors = append(buh.Errors, errcode.ErrorCodeDenied.WithMessage("quota exceeded"))
 		case errcode.Error:
@@ -281,6 +303,7 @@ func (buh *blobUploadHandler) BlobUploadComplete(w http.ResponseWriter, r *http.
 		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
 	}
+	observeBlobUpload(desc, buh.Upload.StartedAt(), buh.App.repositoryLabels.label(buh.Repository.Named().Name()))
 }
 
 // CancelBlobUpload cancels an in-progress upload of a blob.
@@ -412,6 +435,33 @@ func (buh *blobUploadHandler) createBlobMountOption(fromRepo, mountDigest string
 	return storage.WithMountFrom(canonical), nil
 }
 
+// mountedBlobSize returns the number of bytes which mounting a blob from
+// another repository would add to the repository. It returns zero if the blob
+// cannot be found, in which case the mount falls back to an upload.
+func (buh *blobUploadHandler) mountedBlobSize(fromRepo, mountDigest string) int64 {
+	dgst, err := digest.Parse(mountDigest)
+	if err != nil {
+		return 0
+	}
+	if _, err := buh.Repository.Blobs(buh).Stat(buh, dgst); err == nil {
+		return 0
+	}
+
+	ref, err := reference.WithName(fromRepo)
+	if err != nil {
+		return 0
+	}
+	repo, err := buh.App.registry.Repository(buh, ref)
+	if err != nil {
+		return 0
+	}
+	desc, err := repo.Blobs(buh).Stat(buh, dgst)
+	if err != nil {
+		return 0
+	}
+	return desc.Size
+}
+
 // writeBlobCreatedHeaders writes the standard headers describing a newly
 // created blob. A 201 Created is written as well as the canonical URL and
 // blob digest.
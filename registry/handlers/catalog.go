@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"strconv"
 
+	"github.com/docker/distribution"
 	"github.com/docker/distribution/registry/api/errcode"
 	v2 "github.com/docker/distribution/registry/api/v2"
 	"github.com/docker/distribution/registry/storage/driver"
@@ -39,6 +40,10 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 
 	q := r.URL.Query()
 	lastEntry := q.Get("last")
+	filter := distribution.RepositoryFilter{
+		Prefix: q.Get("prefix"),
+		Search: q.Get("search"),
+	}
 
 	entries := defaultReturnedEntries
 	maximumConfiguredEntries := ch.App.Config.Catalog.MaxEntries
@@ -72,8 +77,12 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 	if entries == 0 {
 		moreEntries = false
 	} else {
-		returnedRepositories, err := ch.App.registry.Repositories(ch.Context, repos, lastEntry)
+		returnedRepositories, err := ch.repositories(repos, lastEntry, filter)
 		if err != nil {
+			if err == distribution.ErrUnsupported {
+				ch.Errors = append(ch.Errors, errcode.ErrorCodeUnsupported.WithMessage("catalog filters are not supported"))
+				return
+			}
 			_, pathNotFound := err.(driver.PathNotFoundError)
 			if err != io.EOF && !pathNotFound {
 				ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
@@ -107,6 +116,20 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// repositories fills repos with the repositories of the registry matching
+// filter, and sorting after last.
+func (ch *catalogHandler) repositories(repos []string, last string, filter distribution.RepositoryFilter) (int, error) {
+	if filter == (distribution.RepositoryFilter{}) {
+		return ch.App.registry.Repositories(ch.Context, repos, last)
+	}
+
+	searcher, ok := ch.App.registry.(distribution.RepositorySearcher)
+	if !ok {
+		return 0, distribution.ErrUnsupported
+	}
+	return searcher.SearchRepositories(ch.Context, repos, last, filter)
+}
+
 // Use the original URL from the request to create a new URL for
 // the link header
 func createLinkEntry(origURL string, maxEntries int, lastEntry string) (string, error) {
@@ -115,9 +138,10 @@ func createLinkEntry(origURL string, maxEntries int, lastEntry string) (string,
 		return "", err
 	}
 
-	v := url.Values{}
-	v.Add("n", strconv.Itoa(maxEntries))
-	v.Add("last", lastEntry)
+	// keep the other parameters, such as filters
+	v := calledURL.Query()
+	v.Set("n", strconv.Itoa(maxEntries))
+	v.Set("last", lastEntry)
 
 	calledURL.RawQuery = v.Encode()
 
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/docker/distribution/configuration"
+)
+
+// trustedProxies are the networks of the proxies in front of the registry,
+// whose forwarding headers name the clients of their requests.
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses the addresses and CIDR networks of the proxies.
+func parseTrustedProxies(proxies []string) (trustedProxies, error) {
+	var networks trustedProxies
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy address %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy network %q: %v", proxy, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (tp trustedProxies) trusts(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range tp {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP of the client of the request. The X-Forwarded-For
+// and X-Real-Ip headers can be set by any client, so they are only read from
+// the requests of trusted proxies: the client is the last address forwarded
+// which is not a trusted proxy itself.
+func (tp trustedProxies) clientIP(r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if !tp.trusts(ip) {
+		return ip
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		addrs := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(addrs[i])
+			if net.ParseIP(addr) == nil {
+				break
+			}
+			ip = addr
+			if !tp.trusts(ip) {
+				break
+			}
+		}
+		return ip
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-Ip")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return ip
+}
+
+// configureTrustedProxies parses the trusted proxies of the configuration.
+func (app *App) configureTrustedProxies(config *configuration.Configuration) {
+	proxies, err := parseTrustedProxies(config.HTTP.TrustedProxies)
+	if err != nil {
+		panic(err.Error())
+	}
+	app.trustedProxies = proxies
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	if _, err := parseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Fatal("expected an error parsing an invalid network")
+	}
+	if _, err := parseTrustedProxies([]string{"proxy.example.com"}); err == nil {
+		t.Fatal("expected an error parsing a host name")
+	}
+
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "::1"})
+	if err != nil {
+		t.Fatalf("unexpected error parsing trusted proxies: %v", err)
+	}
+
+	for _, tc := range []struct {
+		remoteAddr string
+		headers    http.Header
+		expected   string
+	}{
+		{"203.0.113.7:1234", nil, "203.0.113.7"},
+		// the headers of untrusted clients are ignored
+		{"203.0.113.7:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "203.0.113.7"},
+		{"203.0.113.7:1234", http.Header{"X-Real-Ip": {"198.51.100.1"}}, "203.0.113.7"},
+		// the client is the last address which is not a trusted proxy
+		{"10.1.2.3:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		{"192.168.1.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.9, 10.0.0.1"}}, "203.0.113.9"},
+		{"[::1]:1234", http.Header{"X-Forwarded-For": {"198.51.100.1", "10.0.0.1"}}, "198.51.100.1"},
+		{"10.1.2.3:1234", http.Header{"X-Forwarded-For": {"garbage, 10.0.0.1"}}, "10.0.0.1"},
+		{"10.1.2.3:1234", http.Header{"X-Real-Ip": {"198.51.100.1"}}, "198.51.100.1"},
+		{"10.1.2.3:1234", nil, "10.1.2.3"},
+		{"192.168.1.2:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "192.168.1.2"},
+	} {
+		r := &http.Request{RemoteAddr: tc.remoteAddr, Header: tc.headers}
+		if r.Header == nil {
+			r.Header = http.Header{}
+		}
+		if ip := proxies.clientIP(r); ip != tc.expected {
+			t.Errorf("client of %s with %v: expected %s, got %s", tc.remoteAddr, tc.headers, tc.expected, ip)
+		}
+	}
+}
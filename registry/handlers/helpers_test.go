@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/auth"
 )
 
 func createCancelledRequest(shouldCancel bool) (*http.Request, error) {
@@ -99,3 +100,10 @@ func TestHandleNonDisconnectionEvent(t *testing.T) {
 		t.Fatalf("unexpected context errors received %v", ctx.Errors)
 	}
 }
+
+// denyingAccessController denies every access to authenticated users.
+type denyingAccessController struct{}
+
+func (denyingAccessController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	return nil, auth.ErrAccessDenied
+}
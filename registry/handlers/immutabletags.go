@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/uuid"
+	"github.com/gomodule/redigo/redis"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// tagLockTTL bounds the time for which a tag stays locked, should the
+	// registry instance holding the lock die.
+	tagLockTTL = 30 * time.Second
+
+	// tagLockRetry is the time between two attempts to take a tag lock held
+	// by another registry instance.
+	tagLockRetry = 20 * time.Millisecond
+)
+
+// immutableTagPolicy refuses to move the immutable tags to another manifest,
+// and to delete them.
+type immutableTagPolicy struct {
+	rules []immutableTagRule
+}
+
+// immutableTagRule makes the tags matching one of the expressions immutable
+// in the repositories whose name starts with prefix.
+type immutableTagRule struct {
+	prefix string
+	tags   []*regexp.Regexp
+}
+
+// newImmutableTagPolicy compiles the configured immutable tags. It returns
+// nil if no tag is immutable.
+func newImmutableTagPolicy(config configuration.ImmutableTags) (*immutableTagPolicy, error) {
+	rules := append([]configuration.ImmutableTagsRule{{Tags: config.Tags}}, config.Repositories...)
+
+	p := &immutableTagPolicy{}
+	for i, r := range rules {
+		if i > 0 && r.Prefix == "" {
+			return nil, fmt.Errorf("repositories %d: prefix must be set", i-1)
+		}
+
+		rule := immutableTagRule{prefix: r.Prefix}
+		for _, tags := range r.Tags {
+			re, err := regexp.Compile(tags)
+			if err != nil {
+				if i == 0 {
+					return nil, fmt.Errorf("tags: %v", err)
+				}
+				return nil, fmt.Errorf("repositories %d: tags: %v", i-1, err)
+			}
+			rule.tags = append(rule.tags, re)
+		}
+		if len(rule.tags) > 0 {
+			p.rules = append(p.rules, rule)
+		}
+	}
+
+	if len(p.rules) == 0 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// immutable returns whether the tag of the repository is immutable. No tag
+// is immutable under a nil policy.
+func (p *immutableTagPolicy) immutable(repo, tag string) bool {
+	if p == nil {
+		return false
+	}
+	for _, rule := range p.rules {
+		if !strings.HasPrefix(repo, rule.prefix) {
+			continue
+		}
+		for _, re := range rule.tags {
+			if re.MatchString(tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lockImmutableTag checks that the tag of the repository can be pushed with
+// dgst, holding a lock on the tag until the returned function is called, once
+// the tag is written, so that concurrent pushes cannot both pass the check.
+// Only immutable tags are locked.
+func (app *App) lockImmutableTag(ctx context.Context, repository distribution.Repository, tag string, dgst digest.Digest) (func(), error) {
+	p := app.getImmutableTags()
+	name := repository.Named().Name()
+	if !p.immutable(name, tag) {
+		return func() {}, nil
+	}
+
+	unlock, err := app.tagLocks.lock(ctx, name+":"+tag)
+	if err != nil {
+		return nil, errcode.ErrorCodeUnknown.WithDetail(err)
+	}
+	if err := p.checkTag(ctx, repository, tag, dgst); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// checkTag returns an error if the tag of the repository is immutable and
+// already points to a manifest other than dgst. Pushing the same manifest
+// again is accepted.
+func (p *immutableTagPolicy) checkTag(ctx context.Context, repository distribution.Repository, tag string, dgst digest.Digest) error {
+	name := repository.Named().Name()
+	if !p.immutable(name, tag) {
+		return nil
+	}
+
+	desc, err := repository.Tags(ctx).Get(ctx, tag)
+	switch err.(type) {
+	case nil:
+	case distribution.ErrTagUnknown:
+		return nil
+	default:
+		return errcode.ErrorCodeUnknown.WithDetail(err)
+	}
+
+	if desc.Digest == dgst {
+		return nil
+	}
+	dcontext.GetLogger(ctx).Infof("refusing to move immutable tag %s:%s from %s to %s", name, tag, desc.Digest, dgst)
+	return errcode.ErrorCodeDenied.WithMessage(fmt.Sprintf("tag %s is immutable", tag))
+}
+
+// checkUntag returns an error if one of the tags of the repository is
+// immutable.
+func (p *immutableTagPolicy) checkUntag(ctx context.Context, repository distribution.Repository, tags ...string) error {
+	name := repository.Named().Name()
+	for _, tag := range tags {
+		if p.immutable(name, tag) {
+			dcontext.GetLogger(ctx).Infof("refusing to delete immutable tag %s:%s", name, tag)
+			return errcode.ErrorCodeDenied.WithMessage(fmt.Sprintf("tag %s is immutable", tag))
+		}
+	}
+	return nil
+}
+
+// retentionRules returns retention rules protecting the immutable tags from
+// the retention policies.
+func (p *immutableTagPolicy) retentionRules() []storage.RetentionRule {
+	if p == nil {
+		return nil
+	}
+
+	var rules []storage.RetentionRule
+	for _, rule := range p.rules {
+		repository := regexp.MustCompile("^" + regexp.QuoteMeta(rule.prefix))
+		for _, re := range rule.tags {
+			rules = append(rules, storage.RetentionRule{
+				Repository: repository,
+				Tags:       re,
+				Protect:    true,
+			})
+		}
+	}
+	return rules
+}
+
+// tagLocker serializes the pushes of a tag.
+type tagLocker interface {
+	// lock waits for the lock of the tag, and returns the function releasing
+	// it.
+	lock(ctx context.Context, tag string) (func(), error)
+}
+
+// newTagLocker returns a locker shared by the registry instances using the
+// same redis, or local to this instance without redis.
+func newTagLocker(pool *redis.Pool) tagLocker {
+	if pool != nil {
+		return &redisTagLocker{pool: pool}
+	}
+	return &inMemoryTagLocker{locks: make(map[string]*tagLock)}
+}
+
+// inMemoryTagLocker locks the tags within this registry instance.
+type inMemoryTagLocker struct {
+	mu    sync.Mutex
+	locks map[string]*tagLock
+}
+
+type tagLock struct {
+	mu      sync.Mutex
+	waiters int
+}
+
+func (l *inMemoryTagLocker) lock(ctx context.Context, tag string) (func(), error) {
+	l.mu.Lock()
+	lock, ok := l.locks[tag]
+	if !ok {
+		lock = &tagLock{}
+		l.locks[tag] = lock
+	}
+	lock.waiters++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		lock.waiters--
+		if lock.waiters == 0 {
+			delete(l.locks, tag)
+		}
+	}, nil
+}
+
+// redisTagLocker locks the tags with redis keys expiring after tagLockTTL.
+type redisTagLocker struct {
+	pool *redis.Pool
+}
+
+// unlockTagScript deletes the lock only if it is still held with the token
+// of the caller, rather than by the next holder once it expired.
+var unlockTagScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (l *redisTagLocker) lock(ctx context.Context, tag string) (func(), error) {
+	key := "lock::tag::" + tag
+	token := uuid.Generate().String()
+
+	ctx, cancel := context.WithTimeout(ctx, tagLockTTL)
+	defer cancel()
+	for {
+		conn := l.pool.Get()
+		_, err := redis.String(conn.Do("SET", key, token, "NX", "PX", tagLockTTL.Milliseconds()))
+		conn.Close()
+		switch err {
+		case nil:
+			return func() {
+				conn := l.pool.Get()
+				defer conn.Close()
+				if _, err := unlockTagScript.Do(conn, key, token); err != nil {
+					dcontext.GetLogger(ctx).Errorf("error releasing the lock of tag %s: %v", tag, err)
+				}
+			}, nil
+		case redis.ErrNil:
+			// held by another push
+		default:
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for the lock of tag %s: %v", tag, ctx.Err())
+		case <-time.After(tagLockRetry):
+		}
+	}
+}
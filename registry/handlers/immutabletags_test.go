@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestNewImmutableTagPolicy(t *testing.T) {
+	for _, invalid := range []configuration.ImmutableTags{
+		{Tags: []string{"("}},
+		{Repositories: []configuration.ImmutableTagsRule{{Prefix: "foo/", Tags: []string{"("}}}},
+		{Repositories: []configuration.ImmutableTagsRule{{Tags: []string{"^v"}}}},
+	} {
+		if _, err := newImmutableTagPolicy(invalid); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+
+	p, err := newImmutableTagPolicy(configuration.ImmutableTags{})
+	if err != nil || p != nil {
+		t.Fatalf("expected no policy without immutable tags, got %v, %v", p, err)
+	}
+
+	p, err = newImmutableTagPolicy(configuration.ImmutableTags{
+		Tags: []string{`^v\d+\.\d+\.\d+$`},
+		Repositories: []configuration.ImmutableTagsRule{
+			{Prefix: "team-a/", Tags: []string{"^stable$", "^release-"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tc := range []struct {
+		repo, tag string
+		immutable bool
+	}{
+		{"foo", "v1.2.3", true},
+		{"team-a/app", "v1.2.3", true},
+		{"foo", "v1.2", false},
+		{"foo", "stable", false},
+		{"team-a/app", "stable", true},
+		{"team-a/app", "release-2024", true},
+		{"team-a/app", "latest", false},
+		{"team-b/app", "stable", false},
+	} {
+		if immutable := p.immutable(tc.repo, tc.tag); immutable != tc.immutable {
+			t.Errorf("%s:%s: expected immutable to be %t, got %t", tc.repo, tc.tag, tc.immutable, immutable)
+		}
+	}
+}
+
+func TestImmutableTags(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.Compatibility.Schema1.Enabled = true //nolint:staticcheck // Ignore SA1019: "github.com/docker/distribution/manifest/schema1" is deprecated, as it's used for backward compatibility.
+	config.HTTP.Headers = headerConfig
+	config.Policy.ImmutableTags = configuration.ImmutableTags{
+		Tags: []string{`^v\d+$`},
+		Repositories: []configuration.ImmutableTagsRule{
+			{Prefix: "team-a/", Tags: []string{"^stable$"}},
+		},
+	}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	manifestURL := func(name, tag string) string {
+		named, _ := reference.WithName(name)
+		ref, _ := reference.WithTag(named, tag)
+		u, err := env.builder.BuildManifestURL(ref)
+		checkErr(t, err, "building manifest url")
+		return u
+	}
+	// retag puts the manifest of a tag under another tag
+	retag := func(name, from, to string) *http.Response {
+		resp, err := http.Get(manifestURL(name, from))
+		checkErr(t, err, "fetching manifest")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching manifest", resp, http.StatusOK)
+		body, err := io.ReadAll(resp.Body)
+		checkErr(t, err, "reading manifest")
+
+		req, err := http.NewRequest(http.MethodPut, manifestURL(name, to), bytes.NewReader(body))
+		checkErr(t, err, "creating manifest put request")
+		req.Header.Set("Content-Type", resp.Header.Get("Content-Type"))
+		resp, err = http.DefaultClient.Do(req)
+		checkErr(t, err, "putting manifest")
+		return resp
+	}
+	checkDenied := func(msg string, resp *http.Response) {
+		t.Helper()
+		defer resp.Body.Close()
+		checkResponse(t, msg, resp, http.StatusForbidden)
+		checkBodyHasErrorCodes(t, msg, resp, errcode.ErrorCodeDenied)
+	}
+	checkStatus := func(msg string, resp *http.Response, status int) {
+		t.Helper()
+		resp.Body.Close()
+		checkResponse(t, msg, resp, status)
+	}
+
+	dgst := createRepository(env, t, "foo", "v1")
+	createRepository(env, t, "foo", "latest")
+
+	// an immutable tag cannot point to another manifest
+	checkDenied("moving immutable tag", retag("foo", "latest", "v1"))
+	// but the same manifest can be pushed again
+	checkStatus("pushing immutable tag again", retag("foo", "v1", "v1"), http.StatusCreated)
+	// and other tags are mutable
+	createRepository(env, t, "foo", "latest")
+	checkStatus("moving mutable tag", retag("foo", "v1", "latest"), http.StatusCreated)
+
+	// an immutable tag cannot be deleted, nor can its manifest
+	resp, err := httpDelete(manifestURL("foo", "v1"))
+	checkErr(t, err, "deleting tag")
+	checkDenied("deleting immutable tag", resp)
+
+	named, _ := reference.WithName("foo")
+	digestRef, _ := reference.WithDigest(named, dgst)
+	digestURL, err := env.builder.BuildManifestURL(digestRef)
+	checkErr(t, err, "building manifest url")
+	resp, err = httpDelete(digestURL)
+	checkErr(t, err, "deleting manifest")
+	checkDenied("deleting manifest of immutable tag", resp)
+
+	resp, err = httpDelete(manifestURL("foo", "latest"))
+	checkErr(t, err, "deleting tag")
+	checkStatus("deleting mutable tag", resp, http.StatusAccepted)
+
+	// the tags of the repositories under the prefix only are immutable
+	createRepository(env, t, "team-a/app", "stable")
+	createRepository(env, t, "team-a/app", "latest")
+	checkDenied("moving immutable tag under prefix", retag("team-a/app", "latest", "stable"))
+
+	createRepository(env, t, "team-b/app", "stable")
+	createRepository(env, t, "team-b/app", "latest")
+	checkStatus("moving tag outside of prefix", retag("team-b/app", "latest", "stable"), http.StatusCreated)
+}
+
+// TestLockImmutableTag ensures that two concurrent pushes of an immutable tag
+// cannot both pass the check.
+func TestLockImmutableTag(t *testing.T) {
+	ctx := context.Background()
+	policy, err := newImmutableTagPolicy(configuration.ImmutableTags{Tags: []string{"^v1$"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{immutableTags: policy, tagLocks: newTagLocker(nil)}
+
+	registry, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	named, _ := reference.WithName("foo/bar")
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := digest.FromString("first"), digest.FromString("second")
+
+	unlock, err := app.lockImmutableTag(ctx, repository, "v1", first)
+	if err != nil {
+		t.Fatalf("unexpected error locking the tag: %v", err)
+	}
+
+	// mutable tags are not locked
+	unlockLatest, err := app.lockImmutableTag(ctx, repository, "latest", second)
+	if err != nil {
+		t.Fatalf("unexpected error locking a mutable tag: %v", err)
+	}
+	unlockLatest()
+
+	done := make(chan error)
+	go func() {
+		unlock, err := app.lockImmutableTag(ctx, repository, "v1", second)
+		if err == nil {
+			unlock()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("concurrent push of the immutable tag was not blocked: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the second push sees the tag written by the first one
+	if err := repository.Tags(ctx).Tag(ctx, "v1", distribution.Descriptor{Digest: first}); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	if err := <-done; err == nil {
+		t.Fatal("expected the concurrent push moving the immutable tag to be denied")
+	}
+}
@@ -22,6 +22,8 @@ import (
 	"github.com/docker/distribution/registry/api/errcode"
 	v2 "github.com/docker/distribution/registry/api/v2"
 	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/distribution/registry/proxy"
+	"github.com/docker/distribution/registry/storage"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
 )
 
@@ -32,6 +34,10 @@ const (
 	defaultOS           = "linux"
 	maxManifestBodySize = 4 << 20
 	imageClass          = "image"
+
+	// staleWarning is set on the responses of a pull through cache which
+	// resolved tags from the cache because the remote could not be reached.
+	staleWarning = `110 - "Response is Stale"`
 )
 
 type storageType int
@@ -124,7 +130,11 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 
 	if imh.Tag != "" {
 		tags := imh.Repository.Tags(imh)
-		desc, err := tags.Get(imh, imh.Tag)
+		ctx := proxy.WithStaleTracking(imh)
+		desc, err := tags.Get(ctx, imh.Tag)
+		if proxy.IsStale(ctx) {
+			w.Header().Set("Warning", staleWarning)
+		}
 		if err != nil {
 			if _, ok := err.(distribution.ErrTagUnknown); ok {
 				imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
@@ -257,6 +267,10 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Docker-Content-Digest", imh.Digest.String())
 	w.Header().Set("Etag", fmt.Sprintf(`"%s"`, imh.Digest))
 	w.Write(p)
+
+	if r.Method == http.MethodGet {
+		manifestPulls.WithValues(ct, imh.App.repositoryLabels.label(imh.Repository.Named().Name())).Inc(1)
+	}
 }
 
 func (imh *manifestHandler) convertSchema2Manifest(schema2Manifest *schema2.DeserializedManifest) (distribution.Manifest, error) {
@@ -362,6 +376,27 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if imh.App.quota != nil {
+		size := desc.Size
+		if exists, err := manifests.Exists(imh, desc.Digest); err == nil && exists {
+			// tagging a manifest which is already stored uses no space
+			size = 0
+		}
+		if err := imh.App.quota.check(imh, imh.Repository.Named().Name(), size); err != nil {
+			imh.Errors = append(imh.Errors, err)
+			return
+		}
+	}
+
+	if imh.Tag != "" {
+		unlock, err := imh.App.lockImmutableTag(imh, imh.Repository, imh.Tag, desc.Digest)
+		if err != nil {
+			imh.Errors = append(imh.Errors, err)
+			return
+		}
+		defer unlock()
+	}
+
 	_, err = manifests.Put(imh, manifest, options...)
 	if err != nil {
 		// TODO(stevvooe): These error handling switches really need to be
@@ -392,6 +427,8 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 					}
 				}
 			}
+		case storage.ErrQuotaExceeded:
+			imh.Errors = append(imh.Errors, quotaExceeded(imh, err))
 		case storagedriver.QuotaExceededError:
 			imh.Errors = append(imh.Errors, errcode.ErrorCodeDenied.WithMessage("quota exceeded"))
 		case errcode.Error:
@@ -430,7 +467,22 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 
 	w.Header().Set("Location", location)
 	w.Header().Set("Docker-Content-Digest", imh.Digest.String())
+
+	// Let clients know the subject has been indexed, so they don't fall back
+	// to the referrers tag schema.
+	var subject *distribution.Descriptor
+	switch m := manifest.(type) {
+	case *ocischema.DeserializedManifest:
+		subject = m.Subject
+	case *ocischema.DeserializedImageIndex:
+		subject = m.Subject
+	}
+	if subject != nil {
+		w.Header().Set("OCI-Subject", subject.Digest.String())
+	}
+
 	w.WriteHeader(http.StatusCreated)
+	manifestPushes.WithValues(desc.MediaType, imh.App.repositoryLabels.label(imh.Repository.Named().Name())).Inc(1)
 
 	dcontext.GetLogger(imh).Debug("Succeeded in putting manifest!")
 }
@@ -516,6 +568,10 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 
 	if imh.Tag != "" {
 		dcontext.GetLogger(imh).Debug("DeleteImageTag")
+		if err := imh.App.getImmutableTags().checkUntag(imh, imh.Repository, imh.Tag); err != nil {
+			imh.Errors = append(imh.Errors, err)
+			return
+		}
 		tagService := imh.Repository.Tags(imh.Context)
 		if err := tagService.Untag(imh.Context, imh.Tag); err != nil {
 			switch err.(type) {
@@ -530,6 +586,20 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	tagService := imh.Repository.Tags(imh)
+	if immutableTags := imh.App.getImmutableTags(); immutableTags != nil {
+		// deleting the manifest deletes its tags
+		referencedTags, err := tagService.Lookup(imh, distribution.Descriptor{Digest: imh.Digest})
+		if err != nil {
+			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		if err := immutableTags.checkUntag(imh, imh.Repository, referencedTags...); err != nil {
+			imh.Errors = append(imh.Errors, err)
+			return
+		}
+	}
+
 	manifests, err := imh.Repository.Manifests(imh)
 	if err != nil {
 		imh.Errors = append(imh.Errors, err)
@@ -555,7 +625,6 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	tagService := imh.Repository.Tags(imh)
 	referencedTags, err := tagService.Lookup(imh, distribution.Descriptor{Digest: imh.Digest})
 	if err != nil {
 		imh.Errors = append(imh.Errors, err)
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	prometheus "github.com/docker/distribution/metrics"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/distribution/registry/auth/token"
+	"github.com/docker/go-metrics"
+	promclient "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// manifestPulls counts the manifests pulled, by media type
+	manifestPulls = prometheus.ManifestsNamespace.NewLabeledCounter("pulls", "The number of manifests pulled", "media_type", "repository")
+
+	// manifestPushes counts the manifests pushed, by media type
+	manifestPushes = prometheus.ManifestsNamespace.NewLabeledCounter("pushes", "The number of manifests pushed", "media_type", "repository")
+
+	// blobPulls counts the blobs pulled, served by the registry or redirected
+	// to the storage
+	blobPulls = prometheus.BlobsNamespace.NewLabeledCounter("pulls", "The number of blobs pulled", "delivery", "repository")
+
+	// blobPulledBytes counts the bytes of the blobs pulled, served by the
+	// registry or redirected to the storage
+	blobPulledBytes = prometheus.BlobsNamespace.NewLabeledCounter("pulled_bytes", "The number of bytes of the blobs pulled", "delivery", "repository")
+
+	// blobPushes counts the blobs pushed, uploaded or mounted from another
+	// repository
+	blobPushes = prometheus.BlobsNamespace.NewLabeledCounter("pushes", "The number of blobs pushed", "method", "repository")
+
+	// blobUploadDuration measures the time from the start to the completion
+	// of the uploads
+	blobUploadDuration = prometheus.BlobsNamespace.NewLabeledTimer("upload_duration", "The number of seconds the blob uploads take", "repository")
+
+	// blobUploadSize measures the size of the blobs uploaded, from 1KiB to
+	// 256GiB
+	blobUploadSize = promclient.NewHistogramVec(promclient.HistogramOpts{
+		Namespace: prometheus.NamespacePrefix,
+		Subsystem: "blobs",
+		Name:      "upload_size_bytes",
+		Help:      "The size of the blobs uploaded",
+		Buckets:   promclient.ExponentialBuckets(1024, 4, 15),
+	}, []string{"repository"})
+
+	// authFailures counts the requests denied by the access controller, by
+	// reason
+	authFailures = prometheus.AuthNamespace.NewLabeledCounter("failures", "The number of requests denied by the access controller", "reason")
+)
+
+// The delivery label of the blobs pulled.
+const (
+	deliveryServed     = "served"
+	deliveryRedirected = "redirected"
+)
+
+// The method label of the blobs pushed.
+const (
+	pushUpload = "upload"
+	pushMount  = "mount"
+)
+
+func init() {
+	prometheus.BlobsNamespace.Add(blobUploadSize)
+
+	metrics.Register(prometheus.ManifestsNamespace)
+	metrics.Register(prometheus.BlobsNamespace)
+	metrics.Register(prometheus.AuthNamespace)
+}
+
+// repositoryLabeler returns the repository label of the registry metrics,
+// which is empty unless enabled for the repository.
+type repositoryLabeler struct {
+	enabled  bool
+	prefixes []string
+}
+
+func newRepositoryLabeler(config configuration.MetricsRepositories) repositoryLabeler {
+	return repositoryLabeler{
+		enabled:  config.Enabled,
+		prefixes: config.Prefixes,
+	}
+}
+
+func (rl repositoryLabeler) label(name string) string {
+	if !rl.enabled {
+		return ""
+	}
+	if len(rl.prefixes) == 0 {
+		return name
+	}
+	for _, prefix := range rl.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return name
+		}
+	}
+	return ""
+}
+
+// observeBlobPull records the blob pulled, whose response has been written
+// to ctx.
+func observeBlobPull(ctx *Context, desc distribution.Descriptor, repository string) {
+	status, _ := ctx.Value("http.response.status").(int)
+	switch {
+	case status >= 300 && status < 400:
+		// the client fetches the content from the storage
+		blobPulls.WithValues(deliveryRedirected, repository).Inc(1)
+		blobPulledBytes.WithValues(deliveryRedirected, repository).Inc(float64(desc.Size))
+	case status == http.StatusOK || status == http.StatusPartialContent:
+		written, _ := ctx.Value("http.response.written").(int64)
+		blobPulls.WithValues(deliveryServed, repository).Inc(1)
+		blobPulledBytes.WithValues(deliveryServed, repository).Inc(float64(written))
+	}
+}
+
+// observeBlobUpload records the blob uploaded, started at startedAt.
+func observeBlobUpload(desc distribution.Descriptor, startedAt time.Time, repository string) {
+	blobPushes.WithValues(pushUpload, repository).Inc(1)
+	blobUploadDuration.WithValues(repository).UpdateSince(startedAt)
+	blobUploadSize.WithLabelValues(repository).Observe(float64(desc.Size))
+}
+
+// The reason label of the authorization failures.
+const (
+	authMissingCredentials = "missing_credentials"
+	authInvalidCredentials = "invalid_credentials"
+	authDenied             = "denied"
+	authChallenge          = "challenge"
+	authError              = "error"
+)
+
+// authFailureReason returns the reason of the authorization failure reported
+// by the access controller.
+func authFailureReason(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredential), errors.Is(err, token.ErrTokenRequired):
+		return authMissingCredentials
+	case errors.Is(err, auth.ErrAuthenticationFailure), errors.Is(err, token.ErrInvalidToken), errors.Is(err, token.ErrMalformedToken):
+		return authInvalidCredentials
+	case errors.Is(err, auth.ErrAccessDenied), errors.Is(err, token.ErrInsufficientScope):
+		return authDenied
+	}
+	if _, ok := err.(auth.Challenge); ok {
+		return authChallenge
+	}
+	return authError
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/distribution/registry/auth/token"
+	"github.com/docker/distribution/testutil"
+	"github.com/docker/go-metrics"
+)
+
+func TestRepositoryLabeler(t *testing.T) {
+	for _, tc := range []struct {
+		config   configuration.MetricsRepositories
+		name     string
+		expected string
+	}{
+		{config: configuration.MetricsRepositories{}, name: "library/ubuntu", expected: ""},
+		{config: configuration.MetricsRepositories{Enabled: true}, name: "library/ubuntu", expected: "library/ubuntu"},
+		{config: configuration.MetricsRepositories{Enabled: true, Prefixes: []string{"team/", "library/"}}, name: "library/ubuntu", expected: "library/ubuntu"},
+		{config: configuration.MetricsRepositories{Enabled: true, Prefixes: []string{"team/"}}, name: "library/ubuntu", expected: ""},
+		{config: configuration.MetricsRepositories{Prefixes: []string{"library/"}}, name: "library/ubuntu", expected: ""},
+	} {
+		if label := newRepositoryLabeler(tc.config).label(tc.name); label != tc.expected {
+			t.Errorf("%+v: expected label %q for %s, got %q", tc.config, tc.expected, tc.name, label)
+		}
+	}
+}
+
+type testChallenge struct {
+	err error
+}
+
+func (ch testChallenge) SetHeaders(r *http.Request, w http.ResponseWriter) {}
+
+func (ch testChallenge) Error() string {
+	return ch.err.Error()
+}
+
+func (ch testChallenge) Unwrap() error {
+	return ch.err
+}
+
+func TestAuthFailureReason(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected string
+	}{
+		{testChallenge{auth.ErrInvalidCredential}, authMissingCredentials},
+		{testChallenge{token.ErrTokenRequired}, authMissingCredentials},
+		{testChallenge{auth.ErrAuthenticationFailure}, authInvalidCredentials},
+		{testChallenge{token.ErrInvalidToken}, authInvalidCredentials},
+		{testChallenge{auth.ErrAccessDenied}, authDenied},
+		{testChallenge{token.ErrInsufficientScope}, authDenied},
+		{testChallenge{errors.New("unexpected")}, authChallenge},
+		{errors.New("unable to read the policy"), authError},
+	} {
+		if reason := authFailureReason(tc.err); reason != tc.expected {
+			t.Errorf("%v: expected reason %q, got %q", tc.err, tc.expected, reason)
+		}
+	}
+}
+
+// TestRegistryMetrics ensures that the pushes and the pulls are counted, with
+// the repository label of the configured repositories only.
+func TestRegistryMetrics(t *testing.T) {
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.Compatibility.Schema1.Enabled = true //nolint:staticcheck // Ignore SA1019: "github.com/docker/distribution/manifest/schema1" is deprecated, as it's used for backward compatibility.
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Debug.Prometheus.Repositories = configuration.MetricsRepositories{
+		Enabled:  true,
+		Prefixes: []string{"metrics/"},
+	}
+	env := newTestEnvWithConfig(t, config)
+	defer env.Shutdown()
+
+	labeled, _ := reference.WithName("metrics/labeled")
+	createRepository(env, t, labeled.Name(), "latest")
+	createRepository(env, t, "unlabeled/repository", "latest")
+
+	latest, _ := reference.WithTag(labeled, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(latest)
+	checkErr(t, err, "building manifest url")
+	resp, err := http.Get(manifestURL)
+	checkErr(t, err, "fetching manifest")
+	resp.Body.Close()
+	checkResponse(t, "fetching manifest", resp, http.StatusOK)
+
+	rs, dgst, err := testutil.CreateRandomTarFile()
+	checkErr(t, err, "creating random layer")
+	uploadURLBase, _ := startPushLayer(t, env, labeled)
+	pushLayer(t, env.builder, labeled, dgst, uploadURLBase, rs)
+	size, err := rs.Seek(0, io.SeekEnd)
+	checkErr(t, err, "measuring layer")
+
+	ref, _ := reference.WithDigest(labeled, dgst)
+	layerURL, err := env.builder.BuildBlobURL(ref)
+	checkErr(t, err, "building layer url")
+	resp, err = http.Get(layerURL)
+	checkErr(t, err, "fetching layer")
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	checkResponse(t, "fetching layer", resp, http.StatusOK)
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		`registry_manifests_pushes_total{media_type="application/vnd.docker.distribution.manifest.v1+prettyjws",repository="metrics/labeled"} 1`,
+		`registry_manifests_pulls_total{media_type="application/vnd.docker.distribution.manifest.v1+prettyjws",repository="metrics/labeled"} 1`,
+		`registry_blobs_pushes_total{method="upload",repository="metrics/labeled"} 2`,
+		`registry_blobs_upload_size_bytes_count{repository="metrics/labeled"} 2`,
+		`registry_blobs_pulls_total{delivery="served",repository="metrics/labeled"} 1`,
+		fmt.Sprintf(`registry_blobs_pulled_bytes_total{delivery="served",repository="metrics/labeled"} %s`, strconv.FormatFloat(float64(size), 'g', -1, 64)),
+	} {
+		if !strings.Contains(body, expected+"\n") {
+			t.Errorf("expected metric %s", expected)
+		}
+	}
+	if strings.Contains(body, "unlabeled/repository") {
+		t.Errorf("expected the unconfigured repository not to be labeled")
+	}
+}
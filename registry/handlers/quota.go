@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gorilla/handlers"
+)
+
+// quotaEnforcer rejects content which would make a repository, or one of
+// its namespaces, exceed its quota.
+type quotaEnforcer struct {
+	usage *storage.UsageAccounting
+
+	// repositoryLimit applies to repositories without a limit of their own.
+	repositoryLimit int64
+	repositories    map[string]int64
+	namespaces      map[string]int64
+}
+
+// quotaUsage is the usage of a repository or namespace along with its
+// limit. A zero limit means no limit.
+type quotaUsage struct {
+	Namespace string `json:"namespace,omitempty"`
+	Usage     int64  `json:"usage"`
+	Limit     int64  `json:"limit,omitempty"`
+}
+
+// newQuotaEnforcer validates the quota configuration and returns an enforcer
+// which accounts usage in store.
+func newQuotaEnforcer(config configuration.Quota, store storage.UsageStore) (*quotaEnforcer, error) {
+	if config.Repository < 0 {
+		return nil, fmt.Errorf("repository limit must not be negative")
+	}
+
+	q := &quotaEnforcer{
+		repositoryLimit: config.Repository,
+		repositories:    make(map[string]int64),
+		namespaces:      make(map[string]int64),
+	}
+	for i, limit := range config.Limits {
+		if limit.Limit <= 0 {
+			return nil, fmt.Errorf("limit %d: limit must be positive", i)
+		}
+
+		switch {
+		case limit.Repository != "" && limit.Namespace == "":
+			if _, err := reference.WithName(limit.Repository); err != nil {
+				return nil, fmt.Errorf("limit %d: invalid repository: %v", i, err)
+			}
+			if _, ok := q.repositories[limit.Repository]; ok {
+				return nil, fmt.Errorf("limit %d: duplicate limit for repository %s", i, limit.Repository)
+			}
+			q.repositories[limit.Repository] = limit.Limit
+		case limit.Namespace != "" && limit.Repository == "":
+			if _, err := reference.WithName(limit.Namespace); err != nil {
+				return nil, fmt.Errorf("limit %d: invalid namespace: %v", i, err)
+			}
+			if _, ok := q.namespaces[limit.Namespace]; ok {
+				return nil, fmt.Errorf("limit %d: duplicate limit for namespace %s", i, limit.Namespace)
+			}
+			q.namespaces[limit.Namespace] = limit.Limit
+		default:
+			return nil, fmt.Errorf("limit %d: exactly one of repository and namespace must be set", i)
+		}
+	}
+
+	q.usage = storage.NewUsageAccounting(store, storage.UsageLimits{
+		Repository:   q.repositoryLimit,
+		Repositories: q.repositories,
+		Namespaces:   q.namespaces,
+	})
+
+	return q, nil
+}
+
+// usages returns the usage and limit of the repository, and of each of its
+// namespaces which has a limit.
+func (q *quotaEnforcer) usages(ctx context.Context, name string) (quotaUsage, []quotaUsage, error) {
+	usage, err := q.usage.RepositoryUsage(ctx, name)
+	if err != nil {
+		return quotaUsage{}, nil, err
+	}
+	repository := quotaUsage{Usage: usage, Limit: q.repositoryLimit}
+	if limit, ok := q.repositories[name]; ok {
+		repository.Limit = limit
+	}
+
+	var namespaces []quotaUsage
+	for namespace, limit := range q.namespaces {
+		if !strings.HasPrefix(name, namespace+"/") {
+			continue
+		}
+		usage, err := q.usage.NamespaceUsage(ctx, namespace)
+		if err != nil {
+			return quotaUsage{}, nil, err
+		}
+		namespaces = append(namespaces, quotaUsage{Namespace: namespace, Usage: usage, Limit: limit})
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Namespace < namespaces[j].Namespace
+	})
+
+	return repository, namespaces, nil
+}
+
+// check returns an error if storing size more bytes in the repository would
+// exceed its quota, or the quota of one of its namespaces. A nil enforcer
+// accepts everything. The check only rejects content early: the quota is
+// enforced by the storage when the content is linked into the repository.
+func (q *quotaEnforcer) check(ctx context.Context, name string, size int64) error {
+	if q == nil {
+		return nil
+	}
+
+	repository, namespaces, err := q.usages(ctx, name)
+	if err != nil {
+		return errcode.ErrorCodeUnknown.WithDetail(err)
+	}
+
+	for _, u := range append([]quotaUsage{repository}, namespaces...) {
+		if u.Limit > 0 && u.Usage+size > u.Limit {
+			return quotaExceeded(ctx, storage.ErrQuotaExceeded{
+				Name:      name,
+				Namespace: u.Namespace,
+				Usage:     u.Usage,
+				Limit:     u.Limit,
+				Size:      size,
+			})
+		}
+	}
+	return nil
+}
+
+// quotaExceeded returns the error reported to the client for content
+// rejected because of a quota.
+func quotaExceeded(ctx context.Context, err storage.ErrQuotaExceeded) errcode.Error {
+	detail := map[string]interface{}{
+		"limit": err.Limit,
+		"usage": err.Usage,
+		"size":  err.Size,
+	}
+	if err.Namespace != "" {
+		detail["namespace"] = err.Namespace
+	} else {
+		detail["name"] = err.Name
+	}
+	dcontext.GetLogger(ctx).Infof("quota exceeded: %v", err)
+	return v2.ErrorCodeQuotaExceeded.WithDetail(detail)
+}
+
+// configureQuota sets up the enforcement of the quota limits, returning the
+// option which enables usage accounting on the registry.
+func (app *App) configureQuota(config *configuration.Configuration) storage.RegistryOption {
+	var store storage.UsageStore
+	switch config.Policy.Quota.Usage {
+	case "", "storage":
+		store = storage.NewStorageUsageStore(app.driver)
+	case "redis":
+		if app.redis == nil {
+			panic("redis configuration required to account quota usage in redis")
+		}
+		store = &redisUsageStore{pool: app.redis}
+	default:
+		panic(fmt.Sprintf("unknown quota usage store %q", config.Policy.Quota.Usage))
+	}
+
+	q, err := newQuotaEnforcer(config.Policy.Quota, store)
+	if err != nil {
+		panic(fmt.Sprintf("invalid quota configuration: %v", err))
+	}
+	app.quota = q
+
+	return storage.EnableUsageAccounting(q.usage)
+}
+
+// redisUsageStore keeps quota usage counters in redis, where they are shared
+// by all the registry instances using the same redis.
+type redisUsageStore struct {
+	pool *redis.Pool
+}
+
+// addUsageScript increments a counter only if it exists, so that a missing
+// counter is computed from the storage rather than started from zero.
+var addUsageScript = redis.NewScript(1, `
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("INCRBY", KEYS[1], ARGV[1])
+end
+return nil
+`)
+
+// addUsageWithinScript increments the counters which exist, unless one of
+// them would exceed its limit, returning the index of that counter from 1,
+// or 0 once the counters are incremented.
+var addUsageWithinScript = redis.NewScript(-1, `
+local delta = tonumber(ARGV[1])
+for i, key in ipairs(KEYS) do
+	local usage = redis.call("GET", key)
+	local limit = tonumber(ARGV[i + 1])
+	if usage and limit > 0 and tonumber(usage) + delta > limit then
+		return i
+	end
+end
+for _, key in ipairs(KEYS) do
+	if redis.call("EXISTS", key) == 1 then
+		redis.call("INCRBY", key, delta)
+	end
+end
+return 0
+`)
+
+func (s *redisUsageStore) key(key string) string {
+	return "usage::" + key
+}
+
+func (s *redisUsageStore) Usage(ctx context.Context, key string) (int64, bool, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	usage, err := redis.Int64(conn.Do("GET", s.key(key)))
+	if err == redis.ErrNil {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return usage, true, nil
+}
+
+func (s *redisUsageStore) SetUsage(ctx context.Context, key string, usage int64) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", s.key(key), usage)
+	return err
+}
+
+func (s *redisUsageStore) AddUsage(ctx context.Context, key string, delta int64) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := addUsageScript.Do(conn, s.key(key), delta)
+	return err
+}
+
+func (s *redisUsageStore) AddUsageWithin(ctx context.Context, keys []string, limits []int64, delta int64) (int, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	args := make([]interface{}, 0, 1+2*len(keys))
+	args = append(args, len(keys))
+	for _, key := range keys {
+		args = append(args, s.key(key))
+	}
+	args = append(args, delta)
+	for _, limit := range limits {
+		args = append(args, limit)
+	}
+	exceeded, err := redis.Int(addUsageWithinScript.Do(conn, args...))
+	if err != nil {
+		return 0, err
+	}
+	return exceeded - 1, nil
+}
+
+// quotaDispatcher constructs the quota handler api endpoint.
+func quotaDispatcher(ctx *Context, r *http.Request) http.Handler {
+	quotaHandler := &quotaHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		http.MethodGet: http.HandlerFunc(quotaHandler.GetQuota),
+	}
+}
+
+// quotaHandler reports the storage usage of a repository.
+type quotaHandler struct {
+	*Context
+}
+
+type quotaAPIResponse struct {
+	Name       string       `json:"name"`
+	Usage      int64        `json:"usage"`
+	Limit      int64        `json:"limit,omitempty"`
+	Namespaces []quotaUsage `json:"namespaces,omitempty"`
+}
+
+// GetQuota returns the usage and limits of a repository.
+func (qh *quotaHandler) GetQuota(w http.ResponseWriter, r *http.Request) {
+	if qh.App.quota == nil {
+		qh.Errors = append(qh.Errors, errcode.ErrorCodeUnsupported.WithMessage("quotas are not enabled"))
+		return
+	}
+
+	name := qh.Repository.Named().Name()
+	repository, namespaces, err := qh.App.quota.usages(qh, name)
+	if err != nil {
+		qh.Errors = append(qh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(quotaAPIResponse{
+		Name:       name,
+		Usage:      repository.Usage,
+		Limit:      repository.Limit,
+		Namespaces: namespaces,
+	}); err != nil {
+		qh.Errors = append(qh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestNewQuotaEnforcer(t *testing.T) {
+	for _, invalid := range []configuration.Quota{
+		{Repository: -1},
+		{Limits: []configuration.QuotaLimit{{Repository: "foo", Limit: 0}}},
+		{Limits: []configuration.QuotaLimit{{Limit: 1}}},
+		{Limits: []configuration.QuotaLimit{{Repository: "foo", Namespace: "bar", Limit: 1}}},
+		{Limits: []configuration.QuotaLimit{{Namespace: "Invalid", Limit: 1}}},
+		{Limits: []configuration.QuotaLimit{{Repository: "foo", Limit: 1}, {Repository: "foo", Limit: 2}}},
+	} {
+		if _, err := newQuotaEnforcer(invalid, nil); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+}
+
+func TestQuotaAPI(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Policy.Quota = configuration.Quota{
+		Enabled:    true,
+		Repository: 100,
+		Limits: []configuration.QuotaLimit{
+			{Namespace: "team", Limit: 150},
+			{Repository: "team/large", Limit: 1000},
+		},
+	}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	push := func(name reference.Named, content []byte) *http.Response {
+		uploadURLBase, _ := startPushLayer(t, env, name)
+		resp, err := doPushLayer(t, env.builder, name, digest.FromBytes(content), uploadURLBase, bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("unexpected error pushing layer: %v", err)
+		}
+		return resp
+	}
+	checkQuotaExceeded := func(msg string, resp *http.Response) {
+		t.Helper()
+		defer resp.Body.Close()
+		checkResponse(t, msg, resp, http.StatusForbidden)
+		checkBodyHasErrorCodes(t, msg, resp, v2.ErrorCodeQuotaExceeded)
+	}
+	checkUsage := func(name reference.Named, expected quotaAPIResponse) {
+		t.Helper()
+		quotaURL, err := env.builder.BuildQuotaURL(name)
+		checkErr(t, err, "building quota url")
+
+		resp, err := http.Get(quotaURL)
+		checkErr(t, err, "fetching quota")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching quota", resp, http.StatusOK)
+
+		var usage quotaAPIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&usage); err != nil {
+			t.Fatalf("error decoding quota response: %v", err)
+		}
+		if !reflect.DeepEqual(usage, expected) {
+			t.Fatalf("expected quota %+v, got %+v", expected, usage)
+		}
+	}
+
+	first, _ := reference.WithName("team/first")
+	second, _ := reference.WithName("team/second")
+	large, _ := reference.WithName("team/large")
+	solo, _ := reference.WithName("solo")
+
+	layer := bytes.Repeat([]byte("a"), 60)
+	resp := push(first, layer)
+	resp.Body.Close()
+	checkResponse(t, "pushing layer", resp, http.StatusCreated)
+	checkUsage(first, quotaAPIResponse{
+		Name:       "team/first",
+		Usage:      60,
+		Limit:      100,
+		Namespaces: []quotaUsage{{Namespace: "team", Usage: 60, Limit: 150}},
+	})
+
+	// pushing the same layer again takes no space
+	resp = push(first, layer)
+	resp.Body.Close()
+	checkResponse(t, "pushing layer again", resp, http.StatusCreated)
+
+	// the repository limit is exceeded
+	checkQuotaExceeded("pushing layer over repository limit", push(first, bytes.Repeat([]byte("b"), 60)))
+
+	// the namespace limit is exceeded, even though the repository has
+	// room left
+	resp = push(large, bytes.Repeat([]byte("c"), 60))
+	resp.Body.Close()
+	checkResponse(t, "pushing layer", resp, http.StatusCreated)
+	checkQuotaExceeded("pushing layer over namespace limit", push(second, bytes.Repeat([]byte("d"), 40)))
+	checkUsage(second, quotaAPIResponse{
+		Name:       "team/second",
+		Usage:      0,
+		Limit:      100,
+		Namespaces: []quotaUsage{{Namespace: "team", Usage: 120, Limit: 150}},
+	})
+
+	// a manifest which does not fit is rejected
+	config1 := bytes.Repeat([]byte("e"), 90)
+	resp = push(solo, config1)
+	resp.Body.Close()
+	checkResponse(t, "pushing config", resp, http.StatusCreated)
+
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config: distribution.Descriptor{
+			MediaType: v1.MediaTypeImageConfig,
+			Digest:    digest.FromBytes(config1),
+			Size:      int64(len(config1)),
+		},
+		Layers: []distribution.Descriptor{},
+	})
+	checkErr(t, err, "building manifest")
+	tagRef, _ := reference.WithTag(solo, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	checkQuotaExceeded("putting manifest over quota", putManifest(t, "putting manifest", manifestURL, v1.MediaTypeImageManifest, m))
+	checkUsage(solo, quotaAPIResponse{Name: "solo", Usage: 90, Limit: 100})
+
+	// an upload sent without Content-Length is rejected when it is committed
+	content := bytes.Repeat([]byte("f"), 20)
+	uploadURLBase, _ := startPushLayer(t, env, solo)
+	uploadURLBase, dgst := pushChunk(t, env.builder, solo, uploadURLBase, bytes.NewReader(content), int64(len(content)))
+	resp, err = doPushLayer(t, env.builder, solo, dgst, uploadURLBase, nil)
+	checkErr(t, err, "completing upload")
+	checkQuotaExceeded("completing upload over quota", resp)
+	checkUsage(solo, quotaAPIResponse{Name: "solo", Usage: 90, Limit: 100})
+}
+
+func TestQuotaAPIDisabled(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/bar")
+	quotaURL, err := env.builder.BuildQuotaURL(name)
+	checkErr(t, err, "building quota url")
+
+	resp, err := http.Get(quotaURL)
+	checkErr(t, err, "fetching quota")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching quota", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "fetching quota", resp, errcode.ErrorCodeUnsupported)
+}
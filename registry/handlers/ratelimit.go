@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gorilla/mux"
+)
+
+// rateLimitSweepInterval is the minimum time between two removals of the
+// full buckets kept in memory.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter rejects the requests made once the bucket of their user, of
+// their remote IP or of their repository is empty.
+type rateLimiter struct {
+	store rateLimitStore
+
+	pull    configuration.RateLimits
+	push    configuration.RateLimits
+	catalog configuration.RateLimits
+
+	// now is overridden by tests
+	now func() time.Time
+}
+
+// rateLimitStore keeps the token buckets.
+type rateLimitStore interface {
+	// take takes a token from the bucket of key, returning how long to
+	// wait for a token if the bucket is empty.
+	take(ctx context.Context, key string, bucket configuration.RateLimitBucket, now time.Time) (time.Duration, error)
+}
+
+// newRateLimiter validates the rate limit configuration and returns a limiter
+// keeping its buckets in store.
+func newRateLimiter(config configuration.RateLimit, store rateLimitStore) (*rateLimiter, error) {
+	rl := &rateLimiter{
+		store: store,
+		now:   time.Now,
+	}
+	for _, limits := range []struct {
+		name   string
+		config configuration.RateLimits
+		limits *configuration.RateLimits
+	}{
+		{"pull", config.Pull, &rl.pull},
+		{"push", config.Push, &rl.push},
+		{"catalog", config.Catalog, &rl.catalog},
+	} {
+		var err error
+		for _, bucket := range []struct {
+			name   string
+			config configuration.RateLimitBucket
+			bucket *configuration.RateLimitBucket
+		}{
+			{"user", limits.config.User, &limits.limits.User},
+			{"ip", limits.config.IP, &limits.limits.IP},
+			{"repository", limits.config.Repository, &limits.limits.Repository},
+		} {
+			*bucket.bucket, err = normalizeRateLimitBucket(bucket.config)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %v", limits.name, bucket.name, err)
+			}
+		}
+	}
+	if rl.catalog.Repository.Rate > 0 {
+		return nil, fmt.Errorf("catalog repository: the catalog has no repository limit")
+	}
+
+	return rl, nil
+}
+
+// normalizeRateLimitBucket validates a bucket and sets its default burst.
+func normalizeRateLimitBucket(bucket configuration.RateLimitBucket) (configuration.RateLimitBucket, error) {
+	if bucket.Rate < 0 || math.IsNaN(bucket.Rate) || math.IsInf(bucket.Rate, 0) {
+		return bucket, fmt.Errorf("rate must not be negative")
+	}
+	if bucket.Burst < 0 {
+		return bucket, fmt.Errorf("burst must not be negative")
+	}
+	if bucket.Rate > 0 && bucket.Burst == 0 {
+		bucket.Burst = int(math.Ceil(bucket.Rate))
+	}
+	return bucket, nil
+}
+
+// rateLimitKey is the key of a bucket a request takes a token from.
+type rateLimitKey struct {
+	name   string
+	key    string
+	bucket configuration.RateLimitBucket
+}
+
+// limits returns the kind of the request and its limits, and false if the
+// request is not limited.
+func (rl *rateLimiter) limits(r *http.Request) (string, configuration.RateLimits, bool) {
+	route := mux.CurrentRoute(r)
+	switch {
+	case route == nil || route.GetName() == v2.RouteNameBase:
+		return "", configuration.RateLimits{}, false
+	case route.GetName() == v2.RouteNameCatalog:
+		return "catalog", rl.catalog, true
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return "pull", rl.pull, true
+	default:
+		return "push", rl.push, true
+	}
+}
+
+// limitClient takes a token from the bucket of the client IP of the request.
+// It is called before the request is authorized, so that the attempts to
+// authenticate are limited too. A nil limiter accepts everything.
+func (rl *rateLimiter) limitClient(ctx context.Context, w http.ResponseWriter, r *http.Request, ip string) error {
+	if rl == nil {
+		return nil
+	}
+	kind, limits, ok := rl.limits(r)
+	if !ok {
+		return nil
+	}
+	return rl.take(ctx, w, kind, rateLimitKey{"ip", ip, limits.IP})
+}
+
+// limit takes a token from the bucket of the user and from the bucket of the
+// repository of the authorized request. A nil limiter accepts everything.
+func (rl *rateLimiter) limit(ctx context.Context, w http.ResponseWriter, r *http.Request, repo string) error {
+	if rl == nil {
+		return nil
+	}
+	kind, limits, ok := rl.limits(r)
+	if !ok {
+		return nil
+	}
+	return rl.take(ctx, w, kind,
+		rateLimitKey{"user", dcontext.GetStringValue(ctx, auth.UserNameKey), limits.User},
+		rateLimitKey{"repository", repo, limits.Repository})
+}
+
+// take takes a token from each bucket. If one of them is empty, it returns
+// an error and sets the Retry-After header to the time after which a token is
+// available. The tokens taken before reaching the empty bucket are not given
+// back, so a client retrying too early keeps being limited.
+func (rl *rateLimiter) take(ctx context.Context, w http.ResponseWriter, kind string, keys ...rateLimitKey) error {
+	now := rl.now()
+	for _, bucket := range keys {
+		if bucket.bucket.Rate == 0 || bucket.key == "" {
+			continue
+		}
+
+		wait, err := rl.store.take(ctx, kind+"::"+bucket.name+"::"+bucket.key, bucket.bucket, now)
+		if err != nil {
+			// the limits must not make the registry unavailable
+			dcontext.GetLogger(ctx).Errorf("error taking rate limit token, accepting the request: %v", err)
+			return nil
+		}
+		if wait > 0 {
+			retryAfter := int64(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+			dcontext.GetLogger(ctx).Infof("rate limit exceeded: %s %s bucket of %s is empty for %v", kind, bucket.name, bucket.key, wait)
+			return errcode.ErrorCodeTooManyRequests.WithDetail(map[string]interface{}{
+				"limit":      kind + " " + bucket.name,
+				"retryAfter": retryAfter,
+			})
+		}
+	}
+	return nil
+}
+
+// configureRateLimit sets up the enforcement of the rate limits.
+func (app *App) configureRateLimit(config *configuration.Configuration) {
+	store, err := app.newRateLimitStore(config)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	rl, err := newRateLimiter(config.Policy.RateLimit, store)
+	if err != nil {
+		panic(fmt.Sprintf("invalid rate limit configuration: %v", err))
+	}
+	app.rateLimiter = rl
+}
+
+// newRateLimitStore returns the store of the token buckets configured.
+func (app *App) newRateLimitStore(config *configuration.Configuration) (rateLimitStore, error) {
+	switch config.Policy.RateLimit.Store {
+	case "", "inmemory":
+		return newInMemoryRateLimitStore(), nil
+	case "redis":
+		if app.redis == nil {
+			return nil, fmt.Errorf("redis configuration required to keep rate limits in redis")
+		}
+		return &redisRateLimitStore{pool: app.redis}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", config.Policy.RateLimit.Store)
+	}
+}
+
+// inMemoryRateLimitStore keeps the buckets in memory, limiting the requests
+// served by this registry instance only.
+type inMemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+
+	// full is the time at which the bucket is full again, and can be
+	// forgotten.
+	full time.Time
+}
+
+func newInMemoryRateLimitStore() *inMemoryRateLimitStore {
+	return &inMemoryRateLimitStore{
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (s *inMemoryRateLimitStore) take(ctx context.Context, key string, bucket configuration.RateLimitBucket, now time.Time) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.swept) >= rateLimitSweepInterval {
+		for k, b := range s.buckets {
+			if !now.Before(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+		s.swept = now
+	}
+
+	burst := float64(bucket.Burst)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, updated: now}
+		s.buckets[key] = b
+	}
+	if now.After(b.updated) {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*bucket.Rate)
+		b.updated = now
+	}
+
+	var wait time.Duration
+	if b.tokens >= 1 {
+		b.tokens--
+	} else {
+		wait = time.Duration((1 - b.tokens) / bucket.Rate * float64(time.Second))
+	}
+	b.full = b.updated.Add(time.Duration((burst - b.tokens) / bucket.Rate * float64(time.Second)))
+	return wait, nil
+}
+
+// redisRateLimitStore keeps the buckets in redis, where they are shared by
+// all the registry instances using the same redis.
+type redisRateLimitStore struct {
+	pool *redis.Pool
+}
+
+// takeTokenScript refills the bucket for the time elapsed since it was last
+// updated, and takes a token from it. It returns 0 if a token was taken, or
+// the number of milliseconds until a token is available. The bucket expires
+// once it is full again, as a missing bucket is a full one.
+var takeTokenScript = redis.NewScript(1, `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1])
+local updated = tonumber(bucket[2])
+if tokens == nil or updated == nil then
+	tokens = burst
+	updated = now
+end
+if now > updated then
+	tokens = math.min(burst, tokens + (now - updated) * rate / 1000)
+	updated = now
+end
+
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "updated", updated)
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1)
+return wait
+`)
+
+func (s *redisRateLimitStore) take(ctx context.Context, key string, bucket configuration.RateLimitBucket, now time.Time) (time.Duration, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	wait, err := redis.Int64(takeTokenScript.Do(conn, "ratelimit::"+key, bucket.Rate, bucket.Burst, now.UnixMilli()))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	for _, invalid := range []configuration.RateLimit{
+		{Pull: configuration.RateLimits{User: configuration.RateLimitBucket{Rate: -1}}},
+		{Push: configuration.RateLimits{IP: configuration.RateLimitBucket{Rate: 1, Burst: -1}}},
+		{Catalog: configuration.RateLimits{Repository: configuration.RateLimitBucket{Rate: 1}}},
+	} {
+		if _, err := newRateLimiter(invalid, nil); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+
+	rl, err := newRateLimiter(configuration.RateLimit{
+		Pull: configuration.RateLimits{IP: configuration.RateLimitBucket{Rate: 0.5}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rl.pull.IP.Burst != 1 {
+		t.Errorf("expected the burst to default to the rounded up rate, got %d", rl.pull.IP.Burst)
+	}
+}
+
+// checkRateLimitStore takes tokens from a bucket refilled with a token per
+// second, holding up to two tokens.
+func checkRateLimitStore(t *testing.T, store rateLimitStore) {
+	ctx := context.Background()
+	bucket := configuration.RateLimitBucket{Rate: 1, Burst: 2}
+	start := time.Now()
+
+	for _, step := range []struct {
+		key   string
+		at    time.Duration
+		wait  time.Duration
+		label string
+	}{
+		{"foo", 0, 0, "first token"},
+		{"foo", 0, 0, "second token"},
+		{"foo", 0, time.Second, "empty bucket"},
+		{"bar", 0, 0, "other bucket"},
+		{"foo", 500 * time.Millisecond, 500 * time.Millisecond, "half refilled bucket"},
+		{"foo", time.Second, 0, "refilled token"},
+		{"foo", time.Second, time.Second, "empty bucket again"},
+		{"foo", time.Hour, 0, "full bucket"},
+		{"foo", time.Hour, 0, "full bucket"},
+		{"foo", time.Hour, time.Second, "full bucket emptied"},
+	} {
+		wait, err := store.take(ctx, step.key, bucket, start.Add(step.at))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.label, err)
+		}
+		if wait != step.wait {
+			t.Errorf("%s: expected to wait %v, got %v", step.label, step.wait, wait)
+		}
+	}
+}
+
+func TestInMemoryRateLimitStore(t *testing.T) {
+	store := newInMemoryRateLimitStore()
+	checkRateLimitStore(t, store)
+
+	// the full buckets are forgotten
+	later := time.Now().Add(2 * time.Hour)
+	if _, err := store.take(context.Background(), "baz", configuration.RateLimitBucket{Rate: 1, Burst: 2}, later); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.buckets) != 1 {
+		t.Errorf("expected the full buckets to be removed, got %d buckets", len(store.buckets))
+	}
+}
+
+func TestRedisRateLimitStore(t *testing.T) {
+	redisAddr := os.Getenv("TEST_REGISTRY_STORAGE_CACHE_REDIS_ADDR")
+	if redisAddr == "" {
+		t.Skip("please set TEST_REGISTRY_STORAGE_CACHE_REDIS_ADDR to test rate limits against redis")
+	}
+
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", redisAddr)
+		},
+		MaxIdle:   1,
+		MaxActive: 2,
+	}
+	defer pool.Close()
+
+	conn := pool.Get()
+	if _, err := conn.Do("FLUSHDB"); err != nil {
+		t.Fatalf("unexpected error flushing redis db: %v", err)
+	}
+	conn.Close()
+
+	checkRateLimitStore(t, &redisRateLimitStore{pool: pool})
+}
+
+func TestRateLimit(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Policy.RateLimit = configuration.RateLimit{
+		Enabled: true,
+		Pull: configuration.RateLimits{
+			IP: configuration.RateLimitBucket{Rate: 0.001, Burst: 3},
+		},
+		Push: configuration.RateLimits{
+			Repository: configuration.RateLimitBucket{Rate: 0.001, Burst: 1},
+		},
+		Catalog: configuration.RateLimits{
+			IP: configuration.RateLimitBucket{Rate: 0.001, Burst: 1},
+		},
+	}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	checkTooManyRequests := func(msg string, resp *http.Response) {
+		t.Helper()
+		defer resp.Body.Close()
+		checkResponse(t, msg, resp, http.StatusTooManyRequests)
+		checkBodyHasErrorCodes(t, msg, resp, errcode.ErrorCodeTooManyRequests)
+		checkHeaders(t, resp, http.Header{"Retry-After": []string{"1000"}})
+	}
+
+	// the catalog has a bucket of its own
+	catalogURL, err := env.builder.BuildCatalogURL()
+	checkErr(t, err, "building catalog url")
+	resp, err := http.Get(catalogURL)
+	checkErr(t, err, "fetching catalog")
+	resp.Body.Close()
+	checkResponse(t, "fetching catalog", resp, http.StatusOK)
+	resp, err = http.Get(catalogURL)
+	checkErr(t, err, "fetching catalog")
+	checkTooManyRequests("fetching catalog again", resp)
+
+	// the push is limited in its repository only
+	foo, _ := reference.WithName("foo/bar")
+	startPushLayer(t, env, foo)
+	uploadURL, err := env.builder.BuildBlobUploadURL(foo)
+	checkErr(t, err, "building upload url")
+	resp, err = http.Post(uploadURL, "", nil)
+	checkErr(t, err, "starting second upload")
+	checkTooManyRequests("starting second upload", resp)
+
+	other, _ := reference.WithName("foo/other")
+	startPushLayer(t, env, other)
+
+	// the pulls share the bucket of the client
+	for i := 0; i < 3; i++ {
+		tagsURL, err := env.builder.BuildTagsURL(foo)
+		checkErr(t, err, "building tags url")
+		resp, err := http.Get(tagsURL)
+		checkErr(t, err, "fetching tags")
+		resp.Body.Close()
+		checkResponse(t, "fetching tags", resp, http.StatusNotFound)
+	}
+	tagsURL, err := env.builder.BuildTagsURL(other)
+	checkErr(t, err, "building tags url")
+	resp, err = http.Get(tagsURL)
+	checkErr(t, err, "fetching tags")
+	checkTooManyRequests("fetching tags of another repository", resp)
+
+	// forwarding headers from clients other than the trusted proxies are
+	// ignored
+	req, _ := http.NewRequest(http.MethodGet, tagsURL, nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	req.Header.Set("X-Real-Ip", "198.51.100.1")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching tags with forwarding headers")
+	checkTooManyRequests("fetching tags with forwarding headers", resp)
+
+	// the base route is not limited
+	baseURL, err := env.builder.BuildBaseURL()
+	checkErr(t, err, "building base url")
+	resp, err = http.Get(baseURL)
+	checkErr(t, err, "fetching base url")
+	resp.Body.Close()
+	checkResponse(t, "fetching base url", resp, http.StatusOK)
+}
+
+// TestRateLimitBeforeAuth ensures that the requests failing authorization are
+// limited by the bucket of their IP.
+func TestRateLimitBeforeAuth(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Auth: configuration.Auth{
+			"silly": {
+				"realm":   "realm-test",
+				"service": "service-test",
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Policy.RateLimit = configuration.RateLimit{
+		Enabled: true,
+		Pull: configuration.RateLimits{
+			IP: configuration.RateLimitBucket{Rate: 0.001, Burst: 1},
+		},
+	}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	foo, _ := reference.WithName("foo/bar")
+	tagsURL, err := env.builder.BuildTagsURL(foo)
+	checkErr(t, err, "building tags url")
+
+	resp, err := http.Get(tagsURL)
+	checkErr(t, err, "fetching tags")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unexpected status fetching tags without credentials: %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(tagsURL)
+	checkErr(t, err, "fetching tags again")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching tags again", resp, http.StatusTooManyRequests)
+	checkBodyHasErrorCodes(t, "fetching tags again", resp, errcode.ErrorCodeTooManyRequests)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+)
+
+// referrersDispatcher constructs the referrers handler api endpoint.
+func referrersDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	referrersHandler := &referrersHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	return handlers.MethodHandler{
+		http.MethodGet: http.HandlerFunc(referrersHandler.GetReferrers),
+	}
+}
+
+// referrersHandler handles requests for the manifests referring to a subject
+// manifest.
+type referrersHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+// GetReferrers returns an image index listing the manifests which declare
+// the requested digest as their subject.
+func (rh *referrersHandler) GetReferrers(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(rh).Debug("GetReferrers")
+
+	manifests, err := rh.Repository.Manifests(rh)
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	referrersProvider, ok := manifests.(distribution.ReferrersProvider)
+	if !ok {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+
+	referrers, err := referrersProvider.Referrers(rh, rh.Digest)
+	if err != nil {
+		switch err := err.(type) {
+		case errcode.Error:
+			rh.Errors = append(rh.Errors, err)
+		default:
+			if err == distribution.ErrUnsupported {
+				rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported)
+				return
+			}
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	if artifactType := r.URL.Query().Get("artifactType"); artifactType != "" {
+		filtered := referrers[:0]
+		for _, referrer := range referrers {
+			if referrer.ArtifactType == artifactType {
+				filtered = append(filtered, referrer)
+			}
+		}
+		referrers = filtered
+		w.Header().Set("OCI-Filters-Applied", "artifactType")
+	}
+
+	index, err := ocischema.FromDescriptors(referrers, nil)
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	mediaType, p, err := index.Payload()
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", fmt.Sprint(len(p)))
+	w.Write(p)
+}
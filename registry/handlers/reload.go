@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+	events "github.com/docker/go-events"
+)
+
+// Reload swaps the access controller, the notification endpoints and
+// replications, the validation of the manifest URLs, the rate limits and the
+// immutable tags for the ones of config, which are applied to the requests
+// served from then on, and to the next evaluations of the retention policies.
+// Nothing is swapped if one of them is invalid. The other sections of config
+// are ignored.
+func (app *App) Reload(config *configuration.Configuration) error {
+	accessController, err := newAccessController(config)
+	if err != nil {
+		return err
+	}
+
+	allow, deny, err := manifestURLRegexps(config)
+	if err != nil {
+		return err
+	}
+
+	immutableTags, err := newImmutableTagPolicy(config.Policy.ImmutableTags)
+	if err != nil {
+		return fmt.Errorf("invalid immutable tags policy: %v", err)
+	}
+
+	var rl *rateLimiter
+	if config.Policy.RateLimit.Enabled {
+		var store rateLimitStore
+		if current := app.getRateLimiter(); current != nil {
+			// the buckets are kept, only the limits change
+			store = current.store
+		} else if store, err = app.newRateLimitStore(config); err != nil {
+			return err
+		}
+		if rl, err = newRateLimiter(config.Policy.RateLimit, store); err != nil {
+			return fmt.Errorf("invalid rate limit configuration: %v", err)
+		}
+	}
+
+	broadcaster := events.NewBroadcaster(app.endpointSinks(config)...)
+	if err := app.addReplicators(broadcaster, config); err != nil {
+		broadcaster.Close()
+		return err
+	}
+
+	app.mu.Lock()
+	previous := app.events.sink
+	app.accessController = accessController
+	app.events.sink = broadcaster
+	app.rateLimiter = rl
+	app.immutableTags = immutableTags
+	app.mu.Unlock()
+
+	app.manifestURLs.Set(allow, deny)
+
+	// the events queued by the previous sinks are still delivered, without
+	// holding up the requests
+	go func() {
+		if err := previous.Close(); err != nil {
+			dcontext.GetLogger(app).Errorf("error closing the previous notification sinks: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// getAccessController returns the access controller, nil if authorization is
+// not enabled.
+func (app *App) getAccessController() auth.AccessController {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+
+	return app.accessController
+}
+
+// getEventSink returns the sink of the notification events.
+func (app *App) getEventSink() events.Sink {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+
+	return app.events.sink
+}
+
+// getRateLimiter returns the rate limiter, nil if rate limiting is not
+// enabled.
+func (app *App) getRateLimiter() *rateLimiter {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+
+	return app.rateLimiter
+}
+
+// getImmutableTags returns the immutable tags policy, nil if no tag is
+// immutable.
+func (app *App) getImmutableTags() *immutableTagPolicy {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+
+	return app.immutableTags
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+)
+
+// TestAppReload ensures that the access controller, the policies and the
+// notification endpoints reloaded apply to the requests served afterwards.
+func TestAppReload(t *testing.T) {
+	newConfig := func() *configuration.Configuration {
+		config := &configuration.Configuration{
+			Storage: configuration.Storage{
+				"inmemory": configuration.Parameters{},
+				"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+					"enabled": false,
+				}},
+			},
+		}
+		config.Compatibility.Schema1.Enabled = true //nolint:staticcheck // Ignore SA1019: "github.com/docker/distribution/manifest/schema1" is deprecated, as it's used for backward compatibility.
+		config.HTTP.Headers = headerConfig
+		return config
+	}
+	env := newTestEnvWithConfig(t, newConfig())
+	defer env.Shutdown()
+
+	baseURL, err := env.builder.BuildBaseURL()
+	checkErr(t, err, "building base url")
+	checkStatus := func(msg string, status int) {
+		t.Helper()
+		resp, err := http.Get(baseURL)
+		checkErr(t, err, msg)
+		resp.Body.Close()
+		checkResponse(t, msg, resp, status)
+	}
+	checkStatus("fetching base url", http.StatusOK)
+
+	delivered := make(chan struct{}, 10)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer endpoint.Close()
+
+	config := newConfig()
+	config.Auth = configuration.Auth{
+		"silly": {
+			"realm":   "realm-test",
+			"service": "service-test",
+		},
+	}
+	if err := env.app.Reload(config); err != nil {
+		t.Fatalf("unexpected error reloading: %v", err)
+	}
+	checkStatus("fetching base url with authorization", http.StatusUnauthorized)
+
+	// nothing is swapped if the configuration is invalid
+	config = newConfig()
+	config.Policy.ImmutableTags.Tags = []string{"("}
+	if err := env.app.Reload(config); err == nil {
+		t.Fatal("expected an error reloading an invalid configuration")
+	}
+	checkStatus("fetching base url after invalid reload", http.StatusUnauthorized)
+
+	config = newConfig()
+	config.Policy.ImmutableTags.Tags = []string{`^v\d+$`}
+	config.Notifications.Endpoints = []configuration.Endpoint{{
+		Name:    "reloaded",
+		URL:     endpoint.URL,
+		Timeout: time.Second,
+		Backoff: time.Second,
+	}}
+	if err := env.app.Reload(config); err != nil {
+		t.Fatalf("unexpected error reloading: %v", err)
+	}
+	checkStatus("fetching base url without authorization", http.StatusOK)
+
+	createRepository(env, t, "foo", "v1")
+	select {
+	case <-delivered:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the events to be delivered to the reloaded endpoint")
+	}
+
+	named, _ := reference.WithName("foo")
+	ref, _ := reference.WithTag(named, "v1")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	resp, err := httpDelete(manifestURL)
+	checkErr(t, err, "deleting tag")
+	defer resp.Body.Close()
+	checkResponse(t, "deleting immutable tag", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "deleting immutable tag", resp, errcode.ErrorCodeDenied)
+}
+
+func TestManifestURLRegexps(t *testing.T) {
+	var config configuration.Configuration
+	config.Validation.Disabled = true
+	if allow, deny, err := manifestURLRegexps(&config); err != nil || allow != nil || deny != nil {
+		t.Fatalf("expected no validation when disabled, got %v, %v, %v", allow, deny, err)
+	}
+
+	config.Validation.Disabled = false
+	allow, deny, err := manifestURLRegexps(&config)
+	if err != nil || deny != nil || allow.MatchString("https://foo/layer") {
+		t.Fatalf("expected no URL to be allowed, got %v, %v, %v", allow, deny, err)
+	}
+
+	config.Validation.Manifests.URLs.Allow = []string{"^https://foo/", "^https://bar/"}
+	config.Validation.Manifests.URLs.Deny = []string{"^https://foo/private/"}
+	allow, deny, err = manifestURLRegexps(&config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tc := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://foo/layer", true},
+		{"https://bar/layer", true},
+		{"https://baz/layer", false},
+		{"https://foo/private/layer", false},
+	} {
+		if allowed := allow.MatchString(tc.url) && !deny.MatchString(tc.url); allowed != tc.allowed {
+			t.Errorf("%s: expected allowed to be %t, got %t", tc.url, tc.allowed, allowed)
+		}
+	}
+	if config.Validation.Manifests.URLs.Allow[0] != "^https://foo/" {
+		t.Errorf("expected the configuration to be left unmodified, got %q", config.Validation.Manifests.URLs.Allow[0])
+	}
+
+	config.Validation.Manifests.URLs.Deny = []string{"("}
+	if _, _, err := manifestURLRegexps(&config); err == nil {
+		t.Error("expected an error for an invalid expression")
+	}
+}
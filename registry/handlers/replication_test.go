@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestReplication(t *testing.T) {
+	target := newTestEnv(t, false)
+	defer target.Shutdown()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Notifications: configuration.Notifications{
+			Replication: []configuration.ReplicationTarget{{
+				Name:       "target",
+				URL:        target.server.URL,
+				Repository: "^team/",
+				Tags:       "^v",
+				Threshold:  1,
+				Backoff:    10 * time.Millisecond,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	source := newTestEnvWithConfig(t, &config)
+	defer source.Shutdown()
+
+	layer := bytes.Repeat([]byte("layer"), 100)
+	push := func(name reference.Named, tag string) digest.Digest {
+		t.Helper()
+		content := [][]byte{[]byte(`{"architecture":"amd64","os":"linux"}`), layer}
+		for _, c := range content {
+			uploadURLBase, _ := startPushLayer(t, source, name)
+			pushLayer(t, source.builder, name, digest.FromBytes(c), uploadURLBase, bytes.NewReader(c))
+		}
+
+		m, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned: ocischema.SchemaVersion,
+			Config: distribution.Descriptor{
+				MediaType: v1.MediaTypeImageConfig,
+				Digest:    digest.FromBytes(content[0]),
+				Size:      int64(len(content[0])),
+			},
+			Layers: []distribution.Descriptor{{
+				MediaType: v1.MediaTypeImageLayer,
+				Digest:    digest.FromBytes(layer),
+				Size:      int64(len(layer)),
+			}},
+		})
+		checkErr(t, err, "building manifest")
+		tagRef, _ := reference.WithTag(name, tag)
+		manifestURL, err := source.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+		resp := putManifest(t, "putting manifest", manifestURL, v1.MediaTypeImageManifest, m)
+		defer resp.Body.Close()
+		checkResponse(t, "putting manifest", resp, http.StatusCreated)
+
+		_, payload, _ := m.Payload()
+		return digest.FromBytes(payload)
+	}
+	replicated := func(name reference.Named, tag string) (digest.Digest, bool) {
+		t.Helper()
+		tagRef, _ := reference.WithTag(name, tag)
+		manifestURL, err := target.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+		req, _ := http.NewRequest(http.MethodHead, manifestURL, nil)
+		req.Header.Set("Accept", v1.MediaTypeImageManifest)
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, "checking manifest")
+		resp.Body.Close()
+		return digest.Digest(resp.Header.Get("Docker-Content-Digest")), resp.StatusCode == http.StatusOK
+	}
+	waitReplicated := func(name reference.Named, tag string, expected digest.Digest) {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if dgst, ok := replicated(name, tag); ok {
+				if dgst != expected {
+					t.Fatalf("expected %s:%s to be replicated as %s, got %s", name, tag, expected, dgst)
+				}
+				return
+			}
+		}
+		t.Fatalf("%s:%s was not replicated", name, tag)
+	}
+
+	first, _ := reference.WithName("team/first")
+	second, _ := reference.WithName("team/second")
+	other, _ := reference.WithName("other")
+
+	// the pushes which are not selected are not replicated, the others
+	// are replicated in order
+	push(other, "v1")
+	push(first, "latest")
+	waitReplicated(first, "v1", push(first, "v1"))
+	for _, ref := range []struct {
+		name reference.Named
+		tag  string
+	}{{other, "v1"}, {first, "latest"}} {
+		if _, ok := replicated(ref.name, ref.tag); ok {
+			t.Fatalf("%s:%s should not be replicated", ref.name, ref.tag)
+		}
+	}
+
+	// the layer already in the target registry is mounted into the other
+	// repository
+	waitReplicated(second, "v2", push(second, "v2"))
+	layerURL, err := target.builder.BuildBlobURL(mustDigestRef(t, second, digest.FromBytes(layer)))
+	checkErr(t, err, "building blob url")
+	resp, err := http.Head(layerURL)
+	checkErr(t, err, "checking layer")
+	resp.Body.Close()
+	checkResponse(t, "checking replicated layer", resp, http.StatusOK)
+}
+
+func mustDigestRef(t *testing.T, name reference.Named, dgst digest.Digest) reference.Canonical {
+	t.Helper()
+	ref, err := reference.WithDigest(name, dgst)
+	if err != nil {
+		t.Fatalf("error building reference: %v", err)
+	}
+	return ref
+}
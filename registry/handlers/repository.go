@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/gorilla/handlers"
+)
+
+// repositoryDispatcher constructs the repository handler api endpoint.
+func repositoryDispatcher(ctx *Context, r *http.Request) http.Handler {
+	repositoryHandler := &repositoryHandler{
+		Context: ctx,
+	}
+
+	mhandler := handlers.MethodHandler{}
+	if !ctx.readOnly {
+		mhandler[http.MethodDelete] = http.HandlerFunc(repositoryHandler.DeleteRepository)
+	}
+
+	return mhandler
+}
+
+// repositoryHandler handles requests for a whole repository.
+type repositoryHandler struct {
+	*Context
+}
+
+// DeleteRepository removes the repository with all its tags and manifests.
+// The blobs are left to garbage collection.
+func (rh *repositoryHandler) DeleteRepository(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(rh).Debug("DeleteRepository")
+
+	if rh.App.isCache || rh.App.repoRemover == nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+
+	name := rh.Repository.Named()
+	if immutableTags := rh.App.getImmutableTags(); immutableTags != nil {
+		tags, err := rh.Repository.Tags(rh).All(rh)
+		switch err.(type) {
+		case nil:
+		case distribution.ErrRepositoryUnknown:
+			rh.Errors = append(rh.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": name.Name()}))
+			return
+		default:
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		if err := immutableTags.checkUntag(rh, rh.Repository, tags...); err != nil {
+			rh.Errors = append(rh.Errors, err)
+			return
+		}
+	}
+
+	if err := rh.RepositoryRemover.Remove(rh, name); err != nil {
+		switch err.(type) {
+		case driver.PathNotFoundError:
+			rh.Errors = append(rh.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": name.Name()}))
+		default:
+			if err == distribution.ErrUnsupported {
+				rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported)
+				return
+			}
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+)
+
+// repositoryTestConfig returns the configuration of a registry caching the
+// manifests and the blob descriptors, and indexing the repositories.
+func repositoryTestConfig(deleteEnabled bool) *configuration.Configuration {
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": deleteEnabled},
+			"cache": configuration.Parameters{
+				"blobdescriptor":  "inmemory",
+				"manifest":        "inmemory",
+				"repositoryindex": "inmemory",
+			},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.Catalog.MaxEntries = 5
+	config.Compatibility.Schema1.Enabled = true //nolint:staticcheck // Ignore SA1019: "github.com/docker/distribution/manifest/schema1" is deprecated, as it's used for backward compatibility.
+	config.HTTP.Headers = headerConfig
+	return config
+}
+
+func TestDeleteRepository(t *testing.T) {
+	env := newTestEnvWithConfig(t, repositoryTestConfig(true))
+	defer env.Shutdown()
+
+	fooBar, _ := reference.WithName("foo/bar")
+	other, _ := reference.WithName("foo/other")
+	createRepository(env, t, fooBar.Name(), "latest")
+	createRepository(env, t, other.Name(), "latest")
+
+	// pulling the manifest caches it
+	latest, _ := reference.WithTag(fooBar, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(latest)
+	checkErr(t, err, "building manifest url")
+	resp, err := http.Get(manifestURL)
+	checkErr(t, err, "fetching manifest")
+	resp.Body.Close()
+	checkResponse(t, "fetching manifest", resp, http.StatusOK)
+
+	repositoryURL, err := env.builder.BuildRepositoryURL(fooBar)
+	checkErr(t, err, "building repository url")
+	resp, err = httpDelete(repositoryURL)
+	checkErr(t, err, "deleting repository")
+	resp.Body.Close()
+	checkResponse(t, "deleting repository", resp, http.StatusAccepted)
+
+	// the manifest is gone, from the storage and from the cache
+	resp, err = http.Get(manifestURL)
+	checkErr(t, err, "fetching manifest")
+	checkResponse(t, "fetching manifest of deleted repository", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching manifest of deleted repository", resp, v2.ErrorCodeManifestUnknown)
+	resp.Body.Close()
+
+	tagsURL, err := env.builder.BuildTagsURL(fooBar)
+	checkErr(t, err, "building tags url")
+	resp, err = http.Get(tagsURL)
+	checkErr(t, err, "fetching tags")
+	checkResponse(t, "fetching tags of deleted repository", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching tags of deleted repository", resp, v2.ErrorCodeNameUnknown)
+	resp.Body.Close()
+
+	// and from the catalog
+	catalogURL, err := env.builder.BuildCatalogURL()
+	checkErr(t, err, "building catalog url")
+	resp, err = http.Get(catalogURL)
+	checkErr(t, err, "fetching catalog")
+	var ctlg catalogAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ctlg); err != nil {
+		t.Fatalf("error decoding catalog: %v", err)
+	}
+	resp.Body.Close()
+	if len(ctlg.Repositories) != 1 || ctlg.Repositories[0] != other.Name() {
+		t.Errorf("expected the catalog to list %s only, got %v", other.Name(), ctlg.Repositories)
+	}
+
+	resp, err = httpDelete(repositoryURL)
+	checkErr(t, err, "deleting repository again")
+	checkResponse(t, "deleting repository again", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "deleting repository again", resp, v2.ErrorCodeNameUnknown)
+	resp.Body.Close()
+}
+
+func TestDeleteRepositoryDisabled(t *testing.T) {
+	env := newTestEnvWithConfig(t, repositoryTestConfig(false))
+	defer env.Shutdown()
+
+	fooBar, _ := reference.WithName("foo/bar")
+	createRepository(env, t, fooBar.Name(), "latest")
+
+	repositoryURL, err := env.builder.BuildRepositoryURL(fooBar)
+	checkErr(t, err, "building repository url")
+	resp, err := httpDelete(repositoryURL)
+	checkErr(t, err, "deleting repository")
+	checkResponse(t, "deleting repository", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "deleting repository", resp, errcode.ErrorCodeUnsupported)
+	resp.Body.Close()
+
+	// the repository is untouched
+	tagsURL, err := env.builder.BuildTagsURL(fooBar)
+	checkErr(t, err, "building tags url")
+	resp, err = http.Get(tagsURL)
+	checkErr(t, err, "fetching tags")
+	resp.Body.Close()
+	checkResponse(t, "fetching tags", resp, http.StatusOK)
+}
+
+func TestDeleteRepositoryReadOnly(t *testing.T) {
+	config := repositoryTestConfig(true)
+	config.Storage["maintenance"]["readonly"] = map[interface{}]interface{}{"enabled": true}
+	env := newTestEnvWithConfig(t, config)
+	defer env.Shutdown()
+
+	fooBar, _ := reference.WithName("foo/bar")
+	repositoryURL, err := env.builder.BuildRepositoryURL(fooBar)
+	checkErr(t, err, "building repository url")
+	resp, err := httpDelete(repositoryURL)
+	checkErr(t, err, "deleting repository")
+	resp.Body.Close()
+	checkResponse(t, "deleting repository in read-only mode", resp, http.StatusMethodNotAllowed)
+}
+
+func TestDeleteRepositoryImmutableTags(t *testing.T) {
+	config := repositoryTestConfig(true)
+	config.Policy.ImmutableTags = configuration.ImmutableTags{Tags: []string{`^v\d+$`}}
+	env := newTestEnvWithConfig(t, config)
+	defer env.Shutdown()
+
+	fooBar, _ := reference.WithName("foo/bar")
+	createRepository(env, t, fooBar.Name(), "v1")
+
+	repositoryURL, err := env.builder.BuildRepositoryURL(fooBar)
+	checkErr(t, err, "building repository url")
+	resp, err := httpDelete(repositoryURL)
+	checkErr(t, err, "deleting repository")
+	checkResponse(t, "deleting repository with an immutable tag", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "deleting repository with an immutable tag", resp, errcode.ErrorCodeDenied)
+	resp.Body.Close()
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/audit"
+	"github.com/docker/distribution/registry/storage"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/tracing"
+	"github.com/docker/distribution/uuid"
+	"github.com/opencontainers/go-digest"
+)
+
+// retentionActor is the actor recorded in the events of content removed by
+// the retention policies.
+const retentionActor = "retention"
+
+// defaultRetentionInterval is the default time between evaluations of the
+// retention policies.
+const defaultRetentionInterval = 24 * time.Hour
+
+// retentionRules compiles the configured retention rules.
+func retentionRules(config configuration.Retention) ([]storage.RetentionRule, error) {
+	rules := make([]storage.RetentionRule, 0, len(config.Rules))
+	for i, r := range config.Rules {
+		rule := storage.RetentionRule{
+			Protect:           r.Protect,
+			KeepLast:          r.KeepLast,
+			UntaggedOlderThan: r.UntaggedOlderThan,
+		}
+
+		if r.KeepLast < 0 {
+			return nil, fmt.Errorf("rule %d: keeplast must not be negative", i)
+		}
+		if r.UntaggedOlderThan < 0 {
+			return nil, fmt.Errorf("rule %d: untaggedolderthan must not be negative", i)
+		}
+
+		if r.Repository != "" {
+			re, err := regexp.Compile(r.Repository)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: repository: %v", i, err)
+			}
+			rule.Repository = re
+		}
+		if r.Tags != "" {
+			re, err := regexp.Compile(r.Tags)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: tags: %v", i, err)
+			}
+			rule.Tags = re
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// configureRetention schedules a goroutine which periodically evaluates the
+// retention policies against the repositories of registry. Expired content
+// is logged and reported to the notification endpoints, and the content
+// removed is recorded in the audit log.
+func (app *App) configureRetention(config *configuration.Configuration, storageDriver storagedriver.StorageDriver, registry distribution.Namespace) {
+	retention := config.Policy.Retention
+	if !retention.Enabled {
+		return
+	}
+
+	rules, err := retentionRules(retention)
+	if err != nil {
+		panic(fmt.Sprintf("invalid retention policy: %v", err))
+	}
+
+	if app.readOnly && !retention.DryRun {
+		dcontext.GetLogger(app).Warnf("retention policies are not enforced in read-only mode")
+		return
+	}
+
+	interval := retention.Interval
+	if interval <= 0 {
+		interval = defaultRetentionInterval
+	}
+
+	log := dcontext.GetLogger(app)
+	action := notifications.EventActionDelete
+	if retention.DryRun {
+		action = notifications.EventActionExpire
+	}
+
+	var auditLog auditFunc
+	if !retention.DryRun {
+		auditLog = app.auditJob(retentionActor)
+	}
+
+	opts := storage.RetentionOpts{
+		DryRun: retention.DryRun,
+		TagExpired: func(repo reference.Named, tag string, desc distribution.Descriptor) {
+			log.Infof("retention: tag %s:%s (%s) expired, dryrun=%t", repo.Name(), tag, desc.Digest, retention.DryRun)
+			app.writeRetentionEvent(action, repo, tag, desc.Digest)
+			if auditLog != nil {
+				auditLog(audit.ActionDelete, &audit.Target{
+					Type:       audit.TargetTag,
+					Repository: repo.Name(),
+					Tag:        tag,
+					Digest:     desc.Digest,
+				})
+			}
+		},
+		ManifestExpired: func(repo reference.Named, dgst digest.Digest) {
+			log.Infof("retention: manifest %s@%s expired, dryrun=%t", repo.Name(), dgst, retention.DryRun)
+			app.writeRetentionEvent(action, repo, "", dgst)
+			if auditLog != nil {
+				auditLog(audit.ActionDelete, &audit.Target{
+					Type:       audit.TargetManifest,
+					Repository: repo.Name(),
+					Digest:     dgst,
+				})
+			}
+		},
+	}
+	if app.quota != nil {
+		opts.Usage = app.quota.usage
+	}
+
+	go func() {
+		for {
+			log.Infof("Starting retention policy evaluation")
+			ctx, span := tracing.StartSpan(app, "registry.ApplyRetention")
+			err := storage.ApplyRetention(ctx, storageDriver, registry, app.protectImmutableTags(rules), opts)
+			tracing.EndSpan(span, err)
+			if err != nil {
+				log.Errorf("Retention policy evaluation failed: %v", err)
+			}
+			log.Infof("Starting retention policy evaluation in %s", interval)
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// protectImmutableTags returns the retention rules along with rules
+// protecting the immutable tags, so that the retention policies never remove
+// them. The immutable tags are the current ones, which a reload may change.
+func (app *App) protectImmutableTags(rules []storage.RetentionRule) []storage.RetentionRule {
+	return append(rules[:len(rules):len(rules)], app.getImmutableTags().retentionRules()...)
+}
+
+// writeRetentionEvent reports a tag or manifest expired by the retention
+// policies to the notification endpoints.
+func (app *App) writeRetentionEvent(action string, repo reference.Named, tag string, dgst digest.Digest) {
+	event := notifications.Event{
+		ID:        uuid.Generate().String(),
+		Timestamp: time.Now(),
+		Action:    action,
+		Actor:     notifications.ActorRecord{Name: retentionActor},
+		Source:    app.events.source,
+	}
+	event.Target.Repository = repo.Name()
+	event.Target.Tag = tag
+	event.Target.Digest = dgst
+
+	if err := app.getEventSink().Write(event); err != nil {
+		dcontext.GetLogger(app).Errorf("retention: error writing event: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/reference"
+	events "github.com/docker/go-events"
+	"github.com/opencontainers/go-digest"
+)
+
+type recordingSink struct {
+	events []events.Event
+}
+
+func (s *recordingSink) Write(event events.Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+func TestRetentionRules(t *testing.T) {
+	rules, err := retentionRules(configuration.Retention{
+		Rules: []configuration.RetentionRule{
+			{Tags: `^v\d+`, Protect: true},
+			{Repository: "^library/", KeepLast: 3},
+			{UntaggedOlderThan: time.Hour},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error compiling rules: %v", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("expected 3 rules, got %d", len(rules))
+	}
+	if rules[0].Repository != nil || !rules[0].Tags.MatchString("v12") || !rules[0].Protect {
+		t.Errorf("unexpected first rule: %+v", rules[0])
+	}
+	if !rules[1].Repository.MatchString("library/ubuntu") || rules[1].Tags != nil || rules[1].KeepLast != 3 {
+		t.Errorf("unexpected second rule: %+v", rules[1])
+	}
+	if rules[2].UntaggedOlderThan != time.Hour {
+		t.Errorf("unexpected third rule: %+v", rules[2])
+	}
+
+	for _, invalid := range []configuration.RetentionRule{
+		{Repository: "("},
+		{Tags: "["},
+		{KeepLast: -1},
+		{UntaggedOlderThan: -time.Hour},
+	} {
+		if _, err := retentionRules(configuration.Retention{Rules: []configuration.RetentionRule{invalid}}); err == nil {
+			t.Errorf("expected an error compiling %+v", invalid)
+		}
+	}
+}
+
+// TestProtectImmutableTags ensures that the retention policies protect the
+// immutable tags of the latest reload.
+func TestProtectImmutableTags(t *testing.T) {
+	rules, err := retentionRules(configuration.Retention{
+		Rules: []configuration.RetentionRule{{KeepLast: 3}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error compiling rules: %v", err)
+	}
+	app := &App{Context: context.Background()}
+	if protected := app.protectImmutableTags(rules); len(protected) != 1 {
+		t.Fatalf("expected no protection without immutable tags, got %+v", protected)
+	}
+
+	app.immutableTags, err = newImmutableTagPolicy(configuration.ImmutableTags{Tags: []string{`^v\d+$`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := app.protectImmutableTags(rules)
+	if len(protected) != 2 || !protected[1].Protect || !protected[1].Tags.MatchString("v1") {
+		t.Fatalf("expected the reloaded immutable tags to be protected, got %+v", protected)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("expected the configured rules to be left unchanged, got %+v", rules)
+	}
+}
+
+func TestWriteRetentionEvent(t *testing.T) {
+	sink := &recordingSink{}
+	app := &App{Context: context.Background()}
+	app.events.sink = sink
+
+	repo, _ := reference.WithName("foo/bar")
+	dgst := digest.FromString("manifest")
+	app.writeRetentionEvent(notifications.EventActionExpire, repo, "old", dgst)
+
+	if len(sink.events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(sink.events))
+	}
+	event := sink.events[0].(notifications.Event)
+	if event.Action != notifications.EventActionExpire || event.Actor.Name != retentionActor {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+	if event.Target.Repository != "foo/bar" || event.Target.Tag != "old" || event.Target.Digest != dgst {
+		t.Fatalf("unexpected event target: %+v", event.Target)
+	}
+}
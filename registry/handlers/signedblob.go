@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/signedurl"
+)
+
+// signedBlobHandler returns the handler serving the content of the storage
+// through the URLs signed by the storage drivers and middlewares.
+func (app *App) signedBlobHandler() http.Handler {
+	return handlers.MethodHandler{
+		http.MethodGet:  http.HandlerFunc(app.serveSignedBlob),
+		http.MethodHead: http.HandlerFunc(app.serveSignedBlob),
+	}
+}
+
+// serveSignedBlob verifies the signature of the URL with the HTTP secret,
+// and serves the content stored at its path.
+func (app *App) serveSignedBlob(w http.ResponseWriter, r *http.Request) {
+	for headerName, headerValues := range app.Config.HTTP.Headers {
+		for _, value := range headerValues {
+			w.Header().Add(headerName, value)
+		}
+	}
+
+	ctx := r.Context()
+	driverPath := "/" + mux.Vars(r)["path"]
+
+	if err := signedurl.Verify(app.Config.HTTP.Secret, driverPath, r.URL.Query(), time.Now()); err != nil {
+		dcontext.GetLogger(ctx).Warnf("rejecting signed blob url for %s: %v", driverPath, err)
+		if err := errcode.ServeJSON(w, errcode.ErrorCodeDenied.WithDetail(err.Error())); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error serving error json: %v", err)
+		}
+		return
+	}
+
+	if err := storage.ServeDriverContent(ctx, w, r, app.driver, driverPath); err != nil {
+		switch err.(type) {
+		case storagedriver.PathNotFoundError:
+			err = v2.ErrorCodeBlobUnknown
+		default:
+			dcontext.GetLogger(ctx).Errorf("error serving signed blob %s: %v", driverPath, err)
+			err = errcode.ErrorCodeUnknown.WithDetail(err)
+		}
+		if err := errcode.ServeJSON(w, err); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error serving error json: %v", err)
+		}
+	}
+}
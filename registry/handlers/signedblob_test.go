@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/signedurl"
+	"github.com/docker/distribution/registry/storage/driver/signedurl"
+	"github.com/docker/distribution/testutil"
+)
+
+func TestSignedBlobURLs(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		params     configuration.Parameters
+		middleware []configuration.Middleware
+	}{
+		{
+			name: "driver",
+			params: configuration.Parameters{
+				"signedurl": map[interface{}]interface{}{"baseurl": "/v2/_blobs"},
+			},
+		},
+		{
+			name:   "middleware",
+			params: configuration.Parameters{},
+			middleware: []configuration.Middleware{{
+				Name:    "signedurl",
+				Options: configuration.Parameters{"baseurl": "/v2/_blobs", "duration": "5m"},
+			}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := configuration.Configuration{
+				Storage: configuration.Storage{
+					"inmemory": tc.params,
+					"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+						"enabled": false,
+					}},
+				},
+				Middleware: map[string][]configuration.Middleware{"storage": tc.middleware},
+			}
+			config.HTTP.Headers = headerConfig
+			config.HTTP.Secret = "secret"
+
+			env := newTestEnvWithConfig(t, &config)
+			defer env.Shutdown()
+
+			testSignedBlobURLs(t, env)
+		})
+	}
+}
+
+func testSignedBlobURLs(t *testing.T, env *testEnv) {
+	imageName, _ := reference.WithName("foo/bar")
+	layerFile, layerDigest, err := testutil.CreateRandomTarFile()
+	if err != nil {
+		t.Fatalf("error creating random layer file: %v", err)
+	}
+	content, err := io.ReadAll(layerFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, bytes.NewReader(content))
+
+	ref, _ := reference.WithDigest(imageName, layerDigest)
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(blobURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	checkResponse(t, "fetching blob", resp, http.StatusTemporaryRedirect)
+
+	signedURL, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signedURL.Query().Get("signature") == "" || signedURL.Query().Get("expires") == "" {
+		t.Fatalf("expected a signed url, got %s", signedURL)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		req, _ := http.NewRequest(method, signedURL.String(), nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		checkResponse(t, method+" signed blob", resp, http.StatusOK)
+		checkHeaders(t, resp, http.Header{
+			"Content-Length": []string{fmt.Sprint(len(content))},
+		})
+		if method == http.MethodGet && !bytes.Equal(body, content) {
+			t.Fatalf("unexpected content of signed blob")
+		}
+	}
+
+	// the signature covers the path and the expiration time
+	tampered := *signedURL
+	tampered.Path += "x"
+	resp, err = http.Get(tampered.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, "fetching tampered path", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "fetching tampered path", resp, errcode.ErrorCodeDenied)
+
+	tampered = *signedURL
+	query := tampered.Query()
+	query.Set("expires", query.Get("expires")+"0")
+	tampered.RawQuery = query.Encode()
+	resp, err = http.Get(tampered.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, "fetching tampered expiration", resp, http.StatusForbidden)
+
+	unsigned := *signedURL
+	unsigned.RawQuery = url.Values{}.Encode()
+	resp, err = http.Get(unsigned.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, "fetching unsigned url", resp, http.StatusForbidden)
+
+	// only the data of blobs is served, even with a valid signature
+	signer, err := signedurl.New(env.server.URL+"/v2/_blobs", env.config.HTTP.Secret, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linkURL, err := signer.URLFor("/docker/registry/v2/repositories/foo/bar/_layers/"+layerDigest.Algorithm().String()+"/"+layerDigest.Encoded()+"/link", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Get(linkURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, "fetching signed link", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching signed link", resp, v2.ErrorCodeBlobUnknown)
+}
@@ -2,17 +2,30 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"mime"
 	"net/http"
+	"regexp"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/handlers"
 
 	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
 	"github.com/docker/distribution/registry/api/errcode"
 	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/proxy"
+	"github.com/opencontainers/go-digest"
 )
 
+// tagListDetailsMediaType is the media type of the tag list giving the
+// details of each tag. Clients select it with the Accept header, or with the
+// "details" query parameter.
+const tagListDetailsMediaType = "application/vnd.distribution.tags.details.v1+json"
+
 // tagsDispatcher constructs the tags handler api endpoint.
 func tagsDispatcher(ctx *Context, r *http.Request) http.Handler {
 	tagsHandler := &tagsHandler{
@@ -34,12 +47,47 @@ type tagsAPIResponse struct {
 	Tags []string `json:"tags"`
 }
 
+type tagDetails struct {
+	Tag          string        `json:"tag"`
+	Digest       digest.Digest `json:"digest"`
+	MediaType    string        `json:"mediaType"`
+	Size         int64         `json:"size"`
+	LastModified time.Time     `json:"lastModified"`
+}
+
+type tagsDetailsAPIResponse struct {
+	Name string       `json:"name"`
+	Tags []tagDetails `json:"tags"`
+}
+
 // GetTags returns a json list of tags for a specific image name.
 func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
+	q := r.URL.Query()
+	details := q.Get("details") == "true" || acceptsTagListDetails(r)
+
+	order := q.Get("order")
+	if order != "" && order != "name" && order != "time" {
+		th.Errors = append(th.Errors, v2.ErrorCodeFilterInvalid.WithDetail(map[string]string{"order": order}))
+		return
+	}
+	var re *regexp.Regexp
+	if regex := q.Get("regex"); regex != "" {
+		var err error
+		re, err = regexp.Compile(regex)
+		if err != nil {
+			th.Errors = append(th.Errors, v2.ErrorCodeFilterInvalid.WithDetail(map[string]string{"regex": regex}))
+			return
+		}
+	}
+
 	tagService := th.Repository.Tags(th)
-	tags, err := tagService.All(th)
+	ctx := proxy.WithStaleTracking(th)
+	tags, err := tagService.All(ctx)
+	if proxy.IsStale(ctx) {
+		w.Header().Set("Warning", staleWarning)
+	}
 	if err != nil {
 		switch err := err.(type) {
 		case distribution.ErrRepositoryUnknown:
@@ -58,20 +106,79 @@ func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// filter the tags, if requested
+	if prefix := q.Get("prefix"); prefix != "" || re != nil {
+		filtered := tags[:0]
+		for _, tag := range tags {
+			if strings.HasPrefix(tag, prefix) && (re == nil || re.MatchString(tag)) {
+				filtered = append(filtered, tag)
+			}
+		}
+		tags = filtered
+	}
+
+	var describer distribution.TagDescriber
+	if details || order == "time" {
+		var ok bool
+		describer, ok = tagService.(distribution.TagDescriber)
+		if !ok {
+			th.Errors = append(th.Errors, errcode.ErrorCodeUnsupported.WithMessage("tag details are not supported"))
+			return
+		}
+	}
+
+	// order the tags by push time, if requested, reading only the time of
+	// each tag: the manifests are read for the returned page only
+	modTimes := make(map[string]time.Time)
+	if order == "time" {
+		pushed := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			modTime, err := describer.ModTime(th, tag)
+			if err != nil {
+				if _, ok := err.(distribution.ErrTagUnknown); ok {
+					// untagged since it was listed
+					continue
+				}
+				th.appendDescribeError(err)
+				return
+			}
+			modTimes[tag] = modTime
+			pushed = append(pushed, tag)
+		}
+		tags = pushed
+
+		// most recently pushed first, and by name for the same time
+		sort.Slice(tags, func(i, j int) bool {
+			return timeCursor{modTimes[tags[i]], tags[i]}.before(timeCursor{modTimes[tags[j]], tags[j]})
+		})
+	}
+
 	// do pagination if requested
-	q := r.URL.Query()
 	// get entries after latest, if any specified
 	if lastEntry := q.Get("last"); lastEntry != "" {
-		lastEntryIndex := sort.SearchStrings(tags, lastEntry)
-
-		// as`sort.SearchStrings` can return len(tags), if the
-		// specified `lastEntry` is not found, we need to
-		// ensure it does not panic when slicing.
-		if lastEntryIndex == len(tags) {
-			tags = []string{}
+		var lastEntryIndex int
+		if order == "time" {
+			// the last entry is a position in the ordering rather than a
+			// tag, which may have been deleted or pushed again since
+			cursor, err := parseTimeCursor(lastEntry)
+			if err != nil {
+				th.Errors = append(th.Errors, v2.ErrorCodeFilterInvalid.WithDetail(map[string]string{"last": lastEntry}))
+				return
+			}
+			lastEntryIndex = sort.Search(len(tags), func(i int) bool {
+				return cursor.before(timeCursor{modTimes[tags[i]], tags[i]})
+			})
 		} else {
-			tags = tags[lastEntryIndex+1:]
+			lastEntryIndex = sort.SearchStrings(tags, lastEntry)
+
+			// as`sort.SearchStrings` can return len(tags), if the
+			// specified `lastEntry` is not found, we need to
+			// ensure it does not panic when slicing.
+			if lastEntryIndex < len(tags) {
+				lastEntryIndex++
+			}
 		}
+		tags = tags[lastEntryIndex:]
 	}
 
 	// if no error, means that the user requested `n` entries
@@ -92,7 +199,11 @@ func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 			maxEntries = len(tags)
 		} else if maxEntries > 0 {
 			// defined in `catalog.go`
-			urlStr, err := createLinkEntry(r.URL.String(), maxEntries, tags[maxEntries-1])
+			lastEntry := tags[maxEntries-1]
+			if order == "time" {
+				lastEntry = timeCursor{modTimes[lastEntry], lastEntry}.String()
+			}
+			urlStr, err := createLinkEntry(r.URL.String(), maxEntries, lastEntry)
 			if err != nil {
 				th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 				return
@@ -103,14 +214,116 @@ func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 		tags = tags[:maxEntries]
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	var response interface{}
+	if details {
+		detailed := make([]tagDetails, 0, len(tags))
+		for _, tag := range tags {
+			description, err := describer.Describe(th, tag)
+			if err != nil {
+				if skipTagDescription(err) {
+					dcontext.GetLogger(th).Warnf("skipping tag %s from the tag details: %v", tag, err)
+					continue
+				}
+				th.appendDescribeError(err)
+				return
+			}
+			detailed = append(detailed, tagDetails{
+				Tag:          tag,
+				Digest:       description.Digest,
+				MediaType:    description.MediaType,
+				Size:         description.Size,
+				LastModified: description.ModTime.UTC(),
+			})
+		}
+		w.Header().Set("Content-Type", tagListDetailsMediaType)
+		response = tagsDetailsAPIResponse{
+			Name: th.Repository.Named().Name(),
+			Tags: detailed,
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		response = tagsAPIResponse{
+			Name: th.Repository.Named().Name(),
+			Tags: tags,
+		}
+	}
 
 	enc := json.NewEncoder(w)
-	if err := enc.Encode(tagsAPIResponse{
-		Name: th.Repository.Named().Name(),
-		Tags: tags,
-	}); err != nil {
+	if err := enc.Encode(response); err != nil {
 		th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
 	}
 }
+
+// skipTagDescription returns whether the error describing a tag only
+// concerns this tag, which is then left out of the tag details rather than
+// failing the whole listing: the tag was untagged since it was listed, or the
+// manifest it points to is missing.
+func skipTagDescription(err error) bool {
+	switch err.(type) {
+	case distribution.ErrTagUnknown, distribution.ErrManifestUnknown, distribution.ErrManifestUnknownRevision:
+		return true
+	}
+	return err == distribution.ErrBlobUnknown
+}
+
+// timeCursor is the position of a tag in the tags ordered by push time, the
+// most recent first, and by name for the same time.
+type timeCursor struct {
+	modTime time.Time
+	tag     string
+}
+
+// parseTimeCursor parses a cursor formatted by timeCursor.String.
+func parseTimeCursor(s string) (timeCursor, error) {
+	i := strings.LastIndex(s, ",")
+	if i < 0 {
+		return timeCursor{}, fmt.Errorf("invalid cursor %q", s)
+	}
+	modTime, err := time.Parse(time.RFC3339Nano, s[:i])
+	if err != nil {
+		return timeCursor{}, err
+	}
+	return timeCursor{modTime: modTime, tag: s[i+1:]}, nil
+}
+
+// String returns the cursor as the RFC 3339 time and the tag, separated by a
+// comma, which tags cannot contain.
+func (c timeCursor) String() string {
+	return c.modTime.UTC().Format(time.RFC3339Nano) + "," + c.tag
+}
+
+// before returns whether the position c comes before o.
+func (c timeCursor) before(o timeCursor) bool {
+	if !c.modTime.Equal(o.modTime) {
+		return c.modTime.After(o.modTime)
+	}
+	return c.tag < o.tag
+}
+
+// appendDescribeError reports an error describing the tags.
+func (th *tagsHandler) appendDescribeError(err error) {
+	switch err := err.(type) {
+	case errcode.Error:
+		th.Errors = append(th.Errors, err)
+	default:
+		if err == distribution.ErrUnsupported {
+			th.Errors = append(th.Errors, errcode.ErrorCodeUnsupported.WithMessage("tag details are not supported"))
+			return
+		}
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+	}
+}
+
+// acceptsTagListDetails returns whether the request accepts the tag list
+// giving the details of each tag.
+func acceptsTagListDetails(r *http.Request) bool {
+	for _, acceptHeader := range r.Header["Accept"] {
+		for _, mediaType := range strings.Split(acceptHeader, ",") {
+			if mediaType, _, err := mime.ParseMediaType(mediaType); err == nil && mediaType == tagListDetailsMediaType {
+				return true
+			}
+		}
+	}
+	return false
+}
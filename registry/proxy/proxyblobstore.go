@@ -76,6 +76,7 @@ func (pbs *proxyBlobStore) serveLocal(ctx context.Context, w http.ResponseWriter
 	}
 
 	proxyMetrics.BlobPush(uint64(localDesc.Size))
+	proxyMetrics.BlobRequest(true)
 	return true, pbs.localStore.ServeBlob(ctx, w, r, dgst)
 }
 
@@ -105,6 +106,7 @@ func (pbs *proxyBlobStore) storeLocal(ctx context.Context, dgst digest.Digest) e
 		return err
 	}
 
+	proxyMetrics.BlobPull(uint64(desc.Size))
 	return nil
 }
 
@@ -118,6 +120,7 @@ func (pbs *proxyBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter,
 	if served {
 		return nil
 	}
+	proxyMetrics.BlobRequest(false)
 
 	if err := pbs.authChallenger.tryEstablishChallenges(ctx); err != nil {
 		return err
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerFailures   = 3
+	defaultBreakerRetryAfter = 30 * time.Second
+)
+
+// errUpstreamUnavailable is returned instead of contacting a remote registry
+// while its circuit is open.
+var errUpstreamUnavailable = errors.New("proxy: upstream unavailable")
+
+// circuitBreaker stops requests to a remote registry after a number of
+// consecutive failures, for a period during which the remote is considered
+// unreachable. The first request after that period probes the remote, while
+// the others keep failing: the circuit closes again if the probe succeeds, and
+// reopens if it fails.
+type circuitBreaker struct {
+	failures   int
+	retryAfter time.Duration
+
+	mu          sync.Mutex
+	consecutive int
+	openUntil   time.Time
+	probing     bool
+
+	// now is overridden by tests
+	now func() time.Time
+}
+
+func newCircuitBreaker(failures int, retryAfter time.Duration) *circuitBreaker {
+	if failures <= 0 {
+		failures = defaultBreakerFailures
+	}
+	if retryAfter <= 0 {
+		retryAfter = defaultBreakerRetryAfter
+	}
+	return &circuitBreaker{
+		failures:   failures,
+		retryAfter: retryAfter,
+		now:        time.Now,
+	}
+}
+
+// allow returns whether the remote may be contacted.
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.openUntil.IsZero() {
+		return true
+	}
+	if cb.probing || cb.now().Before(cb.openUntil) {
+		return false
+	}
+	cb.probing = true
+	return true
+}
+
+// success closes the circuit.
+func (cb *circuitBreaker) success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.consecutive = 0
+	cb.openUntil = time.Time{}
+	cb.probing = false
+}
+
+// failure opens the circuit once enough consecutive requests have failed, or
+// reopens it when the probe failed.
+func (cb *circuitBreaker) failure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.consecutive++
+	if cb.probing || cb.consecutive >= cb.failures {
+		cb.openUntil = cb.now().Add(cb.retryAfter)
+		cb.probing = false
+	}
+}
+
+// abort lets another request probe the remote when the probe was canceled
+// without an answer.
+func (cb *circuitBreaker) abort() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probing = false
+}
+
+// breakerTransport is an http.RoundTripper which accounts the outcome of the
+// requests to the remote in a circuitBreaker, failing them without contacting
+// the remote while the circuit is open. Server errors count as failures.
+type breakerTransport struct {
+	base    http.RoundTripper
+	breaker *circuitBreaker
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.breaker.allow() {
+		return nil, errUpstreamUnavailable
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		// requests canceled by the client say nothing about the remote
+		if req.Context().Err() == nil {
+			t.breaker.failure()
+		} else {
+			t.breaker.abort()
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		t.breaker.failure()
+	} else {
+		t.breaker.success()
+	}
+	return resp, nil
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	cb := newCircuitBreaker(2, time.Minute)
+	cb.now = func() time.Time { return now }
+
+	cb.failure()
+	if !cb.allow() {
+		t.Fatal("circuit opened before reaching the failure threshold")
+	}
+	cb.success()
+	cb.failure()
+	if !cb.allow() {
+		t.Fatal("success did not reset the consecutive failures")
+	}
+
+	cb.failure()
+	if cb.allow() {
+		t.Fatal("circuit not opened after reaching the failure threshold")
+	}
+
+	// only the first request after the window probes the remote again
+	now = now.Add(time.Minute)
+	if !cb.allow() {
+		t.Fatal("circuit still open after the retry window")
+	}
+	if cb.allow() {
+		t.Fatal("a second request probed the remote while the circuit is half-open")
+	}
+	cb.failure()
+	if cb.allow() {
+		t.Fatal("circuit not reopened after a failed probe")
+	}
+
+	// a canceled probe lets the next request probe the remote
+	now = now.Add(time.Minute)
+	if !cb.allow() {
+		t.Fatal("circuit still open after the retry window")
+	}
+	cb.abort()
+	if !cb.allow() {
+		t.Fatal("no request probed the remote after a canceled probe")
+	}
+	cb.success()
+	if !cb.allow() || !cb.allow() {
+		t.Fatal("circuit not closed after a successful probe")
+	}
+}
+
+func TestBreakerTransport(t *testing.T) {
+	var requests, status int32 = 0, http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	breaker := newCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+	client := &http.Client{Transport: &breakerTransport{base: http.DefaultTransport, breaker: breaker}}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// the remote is no longer contacted
+	if _, err := client.Get(server.URL); err == nil {
+		t.Fatal("expected the request to fail while the circuit is open")
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("expected 2 requests to reach the remote, got %d", n)
+	}
+
+	// the remote recovers
+	atomic.StoreInt32(&status, http.StatusOK)
+	now = now.Add(time.Minute)
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error after the retry window: %v", err)
+	}
+	resp.Body.Close()
+	if !breaker.allow() {
+		t.Fatal("circuit not closed after the remote recovered")
+	}
+}
@@ -61,6 +61,7 @@ func (pms proxyManifestStore) Get(ctx context.Context, dgst digest.Digest, optio
 	}
 
 	proxyMetrics.ManifestPush(uint64(len(payload)))
+	proxyMetrics.ManifestRequest(!fromRemote)
 	if fromRemote {
 		proxyMetrics.ManifestPull(uint64(len(payload)))
 
@@ -3,6 +3,9 @@ package proxy
 import (
 	"expvar"
 	"sync/atomic"
+
+	prometheus "github.com/docker/distribution/metrics"
+	"github.com/docker/go-metrics"
 )
 
 // Metrics is used to hold metric counters
@@ -15,15 +18,50 @@ type Metrics struct {
 	BytesPushed uint64
 }
 
+// TagMetrics is used to hold metric counters related to the resolution of
+// tags by the proxy
+type TagMetrics struct {
+	Requests uint64
+	Stale    uint64
+}
+
+// staleCounter counts the tags resolved from the cache because the remote
+// registry could not be reached
+var staleCounter = prometheus.ProxyNamespace.NewCounter("stale_tags", "The number of tag resolutions served stale from the cache")
+
+// requestCounter counts the blobs and manifests requested, by whether they
+// were served from the cache
+var requestCounter = prometheus.ProxyNamespace.NewLabeledCounter("requests", "The number of blob and manifest requests, served from the cache or not", "type", "result")
+
+// pulledBytesCounter counts the bytes of the blobs and manifests pulled into
+// the cache
+var pulledBytesCounter = prometheus.ProxyNamespace.NewLabeledCounter("pulled_bytes", "The number of bytes pulled into the cache from the remote registry", "type")
+
 type proxyMetricsCollector struct {
 	blobMetrics     Metrics
 	manifestMetrics Metrics
+	tagMetrics      TagMetrics
+}
+
+// requestResult returns the result label of a request served from the cache
+// or not.
+func requestResult(hit bool) string {
+	if hit {
+		return "hit"
+	}
+	return "miss"
+}
+
+// BlobRequest tracks the blob requests, served from the cache or not
+func (pmc *proxyMetricsCollector) BlobRequest(hit bool) {
+	requestCounter.WithValues("blob", requestResult(hit)).Inc(1)
 }
 
 // BlobPull tracks metrics about blobs pulled into the cache
 func (pmc *proxyMetricsCollector) BlobPull(bytesPulled uint64) {
 	atomic.AddUint64(&pmc.blobMetrics.Misses, 1)
 	atomic.AddUint64(&pmc.blobMetrics.BytesPulled, bytesPulled)
+	pulledBytesCounter.WithValues("blob").Inc(float64(bytesPulled))
 }
 
 // BlobPush tracks metrics about blobs pushed to clients
@@ -33,10 +71,16 @@ func (pmc *proxyMetricsCollector) BlobPush(bytesPushed uint64) {
 	atomic.AddUint64(&pmc.blobMetrics.BytesPushed, bytesPushed)
 }
 
+// ManifestRequest tracks the manifest requests, served from the cache or not
+func (pmc *proxyMetricsCollector) ManifestRequest(hit bool) {
+	requestCounter.WithValues("manifest", requestResult(hit)).Inc(1)
+}
+
 // ManifestPull tracks metrics related to Manifests pulled into the cache
 func (pmc *proxyMetricsCollector) ManifestPull(bytesPulled uint64) {
 	atomic.AddUint64(&pmc.manifestMetrics.Misses, 1)
 	atomic.AddUint64(&pmc.manifestMetrics.BytesPulled, bytesPulled)
+	pulledBytesCounter.WithValues("manifest").Inc(float64(bytesPulled))
 }
 
 // ManifestPush tracks metrics about manifests pushed to clients
@@ -46,6 +90,17 @@ func (pmc *proxyMetricsCollector) ManifestPush(bytesPushed uint64) {
 	atomic.AddUint64(&pmc.manifestMetrics.BytesPushed, bytesPushed)
 }
 
+// TagRequest tracks the resolutions of tags
+func (pmc *proxyMetricsCollector) TagRequest() {
+	atomic.AddUint64(&pmc.tagMetrics.Requests, 1)
+}
+
+// TagStale tracks the resolutions of tags served stale from the cache
+func (pmc *proxyMetricsCollector) TagStale() {
+	atomic.AddUint64(&pmc.tagMetrics.Stale, 1)
+	staleCounter.Inc(1)
+}
+
 // proxyMetrics tracks metrics about the proxy cache.  This is
 // kept globally and made available via expvar.
 var proxyMetrics = &proxyMetricsCollector{}
@@ -70,4 +125,11 @@ func init() {
 	pm.(*expvar.Map).Set("manifests", expvar.Func(func() interface{} {
 		return proxyMetrics.manifestMetrics
 	}))
+
+	pm.(*expvar.Map).Set("tags", expvar.Func(func() interface{} {
+		return proxyMetrics.tagMetrics
+	}))
+
+	// register prometheus metrics
+	metrics.Register(prometheus.ProxyNamespace)
 }
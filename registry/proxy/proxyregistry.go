@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,6 +21,7 @@ import (
 	"github.com/docker/distribution/registry/proxy/scheduler"
 	"github.com/docker/distribution/registry/storage"
 	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/tracing"
 )
 
 var repositoryTTL = 24 * 7 * time.Hour
@@ -30,106 +33,186 @@ type proxyingRegistry struct {
 	ttl            *time.Duration
 	remoteURL      url.URL
 	authChallenger authChallenger
+
+	// transport is used for the requests to the remote registry
+	transport http.RoundTripper
+
+	// prefix is stripped from the names of the local repositories to get
+	// the names of the remote ones
+	prefix string
 }
 
 // NewRegistryPullThroughCache creates a registry acting as a pull through cache
+// of the remote registry, or of each of the upstreams configured, in which
+// case the repositories are proxied from the upstream matching their prefix.
+// The content of all the upstreams is cached in the same storage.
 func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Namespace, driver driver.StorageDriver, config configuration.Proxy) (distribution.Namespace, error) {
-	remoteURL, err := url.Parse(config.RemoteURL)
-	if err != nil {
-		return nil, err
+	upstreams := config.Upstreams
+	if len(upstreams) == 0 {
+		upstreams = []configuration.ProxyUpstream{{
+			RemoteURL: config.RemoteURL,
+			Username:  config.Username,
+			Password:  config.Password,
+			TTL:       config.TTL,
+		}}
+	} else if config.RemoteURL != "" {
+		return nil, fmt.Errorf("proxy remoteurl and upstreams cannot be configured together")
 	}
-
-	v := storage.NewVacuum(ctx, driver)
-
-	var s *scheduler.TTLExpirationScheduler
-	var ttl *time.Duration
-	if config.TTL == nil {
-		// Default TTL is 7 days
-		ttl = &repositoryTTL
-	} else if *config.TTL > 0 {
-		ttl = config.TTL
-	} else {
-		// TTL is disabled, never expire
-		ttl = nil
+	if config.Offline.Failures < 0 || config.Offline.RetryAfter < 0 {
+		return nil, fmt.Errorf("proxy offline failures and retryafter must not be negative")
 	}
 
-	if ttl != nil {
-		s = scheduler.New(ctx, driver, "/scheduler-state.json")
-		s.OnBlobExpire(func(ref reference.Reference) error {
-			var r reference.Canonical
-			var ok bool
-			if r, ok = ref.(reference.Canonical); !ok {
-				return fmt.Errorf("unexpected reference type : %T", ref)
+	var s *scheduler.TTLExpirationScheduler
+	proxies := make([]*proxyingRegistry, 0, len(upstreams))
+	prefixes := make(map[string]struct{})
+	for _, upstream := range upstreams {
+		if len(config.Upstreams) > 0 {
+			if _, err := reference.WithName(upstream.Prefix); err != nil {
+				return nil, fmt.Errorf("invalid proxy upstream prefix %q: %v", upstream.Prefix, err)
 			}
-
-			repo, err := registry.Repository(ctx, r)
-			if err != nil {
-				return err
-			}
-
-			blobs := repo.Blobs(ctx)
-
-			// Clear the repository reference and descriptor caches
-			err = blobs.Delete(ctx, r.Digest())
-			if err != nil {
-				return err
+			if _, ok := prefixes[upstream.Prefix]; ok {
+				return nil, fmt.Errorf("duplicate proxy upstream prefix %q", upstream.Prefix)
 			}
+			prefixes[upstream.Prefix] = struct{}{}
+		}
 
-			err = v.RemoveBlob(r.Digest().String())
-			if err != nil {
-				return err
-			}
+		remoteURL, err := url.Parse(upstream.RemoteURL)
+		if err != nil {
+			return nil, err
+		}
 
-			return nil
-		})
+		var ttl *time.Duration
+		if upstream.TTL == nil {
+			// Default TTL is 7 days
+			ttl = &repositoryTTL
+		} else if *upstream.TTL > 0 {
+			ttl = upstream.TTL
+		} else {
+			// TTL is disabled, never expire
+			ttl = nil
+		}
 
-		s.OnManifestExpire(func(ref reference.Reference) error {
-			var r reference.Canonical
-			var ok bool
-			if r, ok = ref.(reference.Canonical); !ok {
-				return fmt.Errorf("unexpected reference type : %T", ref)
-			}
+		// A single scheduler expires the content of all the upstreams,
+		// each entry carrying the TTL of its upstream.
+		if ttl != nil && s == nil {
+			s = newScheduler(ctx, registry, driver)
+		}
 
-			repo, err := registry.Repository(ctx, r)
-			if err != nil {
-				return err
-			}
+		cs, err := configureAuth(upstream.Username, upstream.Password, upstream.RemoteURL)
+		if err != nil {
+			return nil, err
+		}
 
-			manifests, err := repo.Manifests(ctx)
-			if err != nil {
-				return err
-			}
-			err = manifests.Delete(ctx, r.Digest())
-			if err != nil {
-				return err
+		// Each upstream has its own circuit, so that one unreachable
+		// upstream does not affect the others.
+		var rt http.RoundTripper = http.DefaultTransport
+		if config.Offline.Enabled {
+			rt = &breakerTransport{
+				base:    http.DefaultTransport,
+				breaker: newCircuitBreaker(config.Offline.Failures, config.Offline.RetryAfter),
 			}
-			return nil
+		}
+		// the requests to the upstream are traced as part of the pulls
+		// causing them
+		rt = tracing.Transport(rt)
+
+		proxies = append(proxies, &proxyingRegistry{
+			embedded:  registry,
+			scheduler: s,
+			ttl:       ttl,
+			remoteURL: *remoteURL,
+			authChallenger: &remoteAuthChallenger{
+				remoteURL: *remoteURL,
+				cm:        challenge.NewSimpleManager(),
+				cs:        cs,
+				transport: rt,
+			},
+			transport: rt,
+			prefix:    upstream.Prefix,
 		})
+	}
 
-		err = s.Start()
-		if err != nil {
+	if s != nil {
+		if err := s.Start(); err != nil {
 			return nil, err
 		}
 	}
 
-	cs, err := configureAuth(config.Username, config.Password, config.RemoteURL)
-	if err != nil {
-		return nil, err
+	if len(config.Upstreams) == 0 {
+		return proxies[0], nil
 	}
 
-	return &proxyingRegistry{
-		embedded:  registry,
-		scheduler: s,
-		ttl:       ttl,
-		remoteURL: *remoteURL,
-		authChallenger: &remoteAuthChallenger{
-			remoteURL: *remoteURL,
-			cm:        challenge.NewSimpleManager(),
-			cs:        cs,
-		},
+	// Match the longest prefixes first, so that nested prefixes such as
+	// "ghcr" and "ghcr/org" select the most specific upstream.
+	sort.Slice(proxies, func(i, j int) bool {
+		return len(proxies[i].prefix) > len(proxies[j].prefix)
+	})
+	return &upstreamsRegistry{
+		embedded: registry,
+		proxies:  proxies,
 	}, nil
 }
 
+// newScheduler creates the scheduler removing the cached content from the
+// local registry when it expires.
+func newScheduler(ctx context.Context, registry distribution.Namespace, driver driver.StorageDriver) *scheduler.TTLExpirationScheduler {
+	v := storage.NewVacuum(ctx, driver)
+
+	s := scheduler.New(ctx, driver, "/scheduler-state.json")
+	s.OnBlobExpire(func(ref reference.Reference) error {
+		var r reference.Canonical
+		var ok bool
+		if r, ok = ref.(reference.Canonical); !ok {
+			return fmt.Errorf("unexpected reference type : %T", ref)
+		}
+
+		repo, err := registry.Repository(ctx, r)
+		if err != nil {
+			return err
+		}
+
+		blobs := repo.Blobs(ctx)
+
+		// Clear the repository reference and descriptor caches
+		err = blobs.Delete(ctx, r.Digest())
+		if err != nil {
+			return err
+		}
+
+		err = v.RemoveBlob(r.Digest().String())
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	s.OnManifestExpire(func(ref reference.Reference) error {
+		var r reference.Canonical
+		var ok bool
+		if r, ok = ref.(reference.Canonical); !ok {
+			return fmt.Errorf("unexpected reference type : %T", ref)
+		}
+
+		repo, err := registry.Repository(ctx, r)
+		if err != nil {
+			return err
+		}
+
+		manifests, err := repo.Manifests(ctx)
+		if err != nil {
+			return err
+		}
+		err = manifests.Delete(ctx, r.Digest())
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+
+	return s
+}
+
 func (pr *proxyingRegistry) Scope() distribution.Scope {
 	return distribution.GlobalScope
 }
@@ -138,22 +221,54 @@ func (pr *proxyingRegistry) Repositories(ctx context.Context, repos []string, la
 	return pr.embedded.Repositories(ctx, repos, last)
 }
 
+// SearchRepositories lists the cached repositories matching filter, if the
+// embedded registry can search them.
+func (pr *proxyingRegistry) SearchRepositories(ctx context.Context, repos []string, last string, filter distribution.RepositoryFilter) (n int, err error) {
+	return searchRepositories(ctx, pr.embedded, repos, last, filter)
+}
+
+// Enumerate calls ingester for each cached repository, if the embedded
+// registry can enumerate them.
+func (pr *proxyingRegistry) Enumerate(ctx context.Context, ingester func(string) error) error {
+	return enumerateRepositories(ctx, pr.embedded, ingester)
+}
+
+// Remove removes a cached repository, if the embedded registry can remove
+// them.
+func (pr *proxyingRegistry) Remove(ctx context.Context, name reference.Named) error {
+	return removeRepository(ctx, pr.embedded, name)
+}
+
+// remoteName returns the name of the remote repository proxied as the local
+// repository name.
+func (pr *proxyingRegistry) remoteName(name reference.Named) (reference.Named, error) {
+	if pr.prefix == "" {
+		return name, nil
+	}
+	return reference.WithName(strings.TrimPrefix(name.Name(), pr.prefix+"/"))
+}
+
 func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named) (distribution.Repository, error) {
 	c := pr.authChallenger
 
+	remoteName, err := pr.remoteName(name)
+	if err != nil {
+		return nil, err
+	}
+
 	tkopts := auth.TokenHandlerOptions{
-		Transport:   http.DefaultTransport,
+		Transport:   pr.transport,
 		Credentials: c.credentialStore(),
 		Scopes: []auth.Scope{
 			auth.RepositoryScope{
-				Repository: name.Name(),
+				Repository: remoteName.Name(),
 				Actions:    []string{"pull"},
 			},
 		},
 		Logger: dcontext.GetLogger(ctx),
 	}
 
-	tr := transport.NewTransport(http.DefaultTransport,
+	tr := transport.NewTransport(pr.transport,
 		auth.NewAuthorizer(c.challengeManager(),
 			auth.NewTokenHandlerWithOptions(tkopts)))
 
@@ -166,7 +281,7 @@ func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named
 		return nil, err
 	}
 
-	remoteRepo, err := client.NewRepository(name, pr.remoteURL.String(), tr)
+	remoteRepo, err := client.NewRepository(remoteName, pr.remoteURL.String(), tr)
 	if err != nil {
 		return nil, err
 	}
@@ -196,6 +311,7 @@ func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named
 		},
 		name: name,
 		tags: &proxyTagService{
+			repositoryName: name,
 			localTags:      localRepo.Tags(ctx),
 			remoteTags:     remoteRepo.Tags(ctx),
 			authChallenger: pr.authChallenger,
@@ -211,6 +327,99 @@ func (pr *proxyingRegistry) BlobStatter() distribution.BlobStatter {
 	return pr.embedded.BlobStatter()
 }
 
+// upstreamsRegistry proxies each repository from the upstream registry
+// matching the prefix of its name. It implements the same optional
+// interfaces as proxyingRegistry.
+type upstreamsRegistry struct {
+	embedded distribution.Namespace // provides local registry functionality
+
+	// proxies are ordered from the longest prefix to the shortest
+	proxies []*proxyingRegistry
+}
+
+var (
+	_ distribution.RepositoryEnumerator = &proxyingRegistry{}
+	_ distribution.RepositoryRemover    = &proxyingRegistry{}
+	_ distribution.RepositorySearcher   = &proxyingRegistry{}
+	_ distribution.RepositoryEnumerator = &upstreamsRegistry{}
+	_ distribution.RepositoryRemover    = &upstreamsRegistry{}
+	_ distribution.RepositorySearcher   = &upstreamsRegistry{}
+)
+
+func (ur *upstreamsRegistry) Scope() distribution.Scope {
+	return distribution.GlobalScope
+}
+
+func (ur *upstreamsRegistry) Repositories(ctx context.Context, repos []string, last string) (n int, err error) {
+	return ur.embedded.Repositories(ctx, repos, last)
+}
+
+// Repository returns the repository proxied from the upstream matching the
+// prefix of its name. Repositories outside of the prefixes are unknown.
+func (ur *upstreamsRegistry) Repository(ctx context.Context, name reference.Named) (distribution.Repository, error) {
+	for _, pr := range ur.proxies {
+		if strings.HasPrefix(name.Name(), pr.prefix+"/") {
+			return pr.Repository(ctx, name)
+		}
+	}
+	return nil, distribution.ErrRepositoryUnknown{Name: name.Name()}
+}
+
+func (ur *upstreamsRegistry) Blobs() distribution.BlobEnumerator {
+	return ur.embedded.Blobs()
+}
+
+func (ur *upstreamsRegistry) BlobStatter() distribution.BlobStatter {
+	return ur.embedded.BlobStatter()
+}
+
+// SearchRepositories lists the cached repositories matching filter, if the
+// embedded registry can search them.
+func (ur *upstreamsRegistry) SearchRepositories(ctx context.Context, repos []string, last string, filter distribution.RepositoryFilter) (n int, err error) {
+	return searchRepositories(ctx, ur.embedded, repos, last, filter)
+}
+
+// Enumerate calls ingester for each cached repository, if the embedded
+// registry can enumerate them.
+func (ur *upstreamsRegistry) Enumerate(ctx context.Context, ingester func(string) error) error {
+	return enumerateRepositories(ctx, ur.embedded, ingester)
+}
+
+// Remove removes a cached repository, if the embedded registry can remove
+// them.
+func (ur *upstreamsRegistry) Remove(ctx context.Context, name reference.Named) error {
+	return removeRepository(ctx, ur.embedded, name)
+}
+
+// enumerateRepositories calls ingester for each repository of the embedded
+// registry.
+func enumerateRepositories(ctx context.Context, embedded distribution.Namespace, ingester func(string) error) error {
+	enumerator, ok := embedded.(distribution.RepositoryEnumerator)
+	if !ok {
+		return distribution.ErrUnsupported
+	}
+	return enumerator.Enumerate(ctx, ingester)
+}
+
+// searchRepositories lists the repositories of the embedded registry matching
+// filter.
+func searchRepositories(ctx context.Context, embedded distribution.Namespace, repos []string, last string, filter distribution.RepositoryFilter) (int, error) {
+	searcher, ok := embedded.(distribution.RepositorySearcher)
+	if !ok {
+		return 0, distribution.ErrUnsupported
+	}
+	return searcher.SearchRepositories(ctx, repos, last, filter)
+}
+
+// removeRepository removes a repository of the embedded registry.
+func removeRepository(ctx context.Context, embedded distribution.Namespace, name reference.Named) error {
+	remover, ok := embedded.(distribution.RepositoryRemover)
+	if !ok {
+		return distribution.ErrUnsupported
+	}
+	return remover.Remove(ctx, name)
+}
+
 // authChallenger encapsulates a request to the upstream to establish credential challenges
 type authChallenger interface {
 	tryEstablishChallenges(context.Context) error
@@ -221,8 +430,9 @@ type authChallenger interface {
 type remoteAuthChallenger struct {
 	remoteURL url.URL
 	sync.Mutex
-	cm challenge.Manager
-	cs auth.CredentialStore
+	cm        challenge.Manager
+	cs        auth.CredentialStore
+	transport http.RoundTripper
 }
 
 func (r *remoteAuthChallenger) credentialStore() auth.CredentialStore {
@@ -250,7 +460,7 @@ func (r *remoteAuthChallenger) tryEstablishChallenges(ctx context.Context) error
 	}
 
 	// establish challenge type with upstream
-	if err := ping(r.cm, remoteURL.String(), challengeHeader); err != nil {
+	if err := ping(&http.Client{Transport: r.transport}, r.cm, remoteURL.String(), challengeHeader); err != nil {
 		return err
 	}
 
@@ -0,0 +1,217 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/proxy/scheduler"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/cache/memory"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// newUpstream returns a remote registry serving the tags of the given
+// repositories.
+func newUpstream(t *testing.T, tags map[string][]string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2/"), "/tags/list")
+		repoTags, ok := tags[name]
+		if !ok || !strings.HasSuffix(r.URL.Path, "/tags/list") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{"name": name, "tags": repoTags}); err != nil {
+			t.Errorf("error encoding tags: %v", err)
+		}
+	}))
+}
+
+func TestPullThroughCacheUpstreams(t *testing.T) {
+	ctx := context.Background()
+
+	dockerhub := newUpstream(t, map[string][]string{"library/ubuntu": {"22.04", "24.04"}})
+	defer dockerhub.Close()
+	ghcr := newUpstream(t, map[string][]string{"app": {"v1"}})
+	defer ghcr.Close()
+	ghcrOrg := newUpstream(t, map[string][]string{"app": {"v2"}})
+	defer ghcrOrg.Close()
+
+	inmemoryDriver := inmemory.New()
+	localRegistry, err := storage.NewRegistry(ctx, inmemoryDriver, storage.BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider(memory.UnlimitedSize)), storage.EnableRedirect, storage.DisableDigestResumption)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	noTTL := time.Duration(0)
+	hour := time.Hour
+	registry, err := NewRegistryPullThroughCache(ctx, localRegistry, inmemoryDriver, configuration.Proxy{
+		Upstreams: []configuration.ProxyUpstream{
+			{Prefix: "dockerhub", RemoteURL: dockerhub.URL, TTL: &noTTL},
+			{Prefix: "ghcr", RemoteURL: ghcr.URL, TTL: &hour},
+			{Prefix: "ghcr/org", RemoteURL: ghcrOrg.URL},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creating pull through cache: %v", err)
+	}
+
+	// the upstreams expiring their content share a single scheduler
+	var shared *scheduler.TTLExpirationScheduler
+	for _, pr := range registry.(*upstreamsRegistry).proxies {
+		if pr.ttl == nil {
+			continue
+		}
+		if pr.scheduler == nil || (shared != nil && pr.scheduler != shared) {
+			t.Errorf("upstream %s does not use the shared scheduler", pr.prefix)
+		}
+		shared = pr.scheduler
+	}
+
+	for _, tc := range []struct {
+		name string
+		tags []string
+	}{
+		{name: "dockerhub/library/ubuntu", tags: []string{"22.04", "24.04"}},
+		{name: "ghcr/app", tags: []string{"v1"}},
+		{name: "ghcr/org/app", tags: []string{"v2"}},
+	} {
+		name, _ := reference.WithName(tc.name)
+		repo, err := registry.Repository(ctx, name)
+		if err != nil {
+			t.Fatalf("error getting repository %s: %v", tc.name, err)
+		}
+		if repo.Named().Name() != tc.name {
+			t.Errorf("expected repository %s, got %s", tc.name, repo.Named().Name())
+		}
+		tags, err := repo.Tags(ctx).All(ctx)
+		if err != nil {
+			t.Fatalf("error listing tags of %s: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(tags, tc.tags) {
+			t.Errorf("expected tags %v for %s, got %v", tc.tags, tc.name, tags)
+		}
+	}
+
+	for _, unknown := range []string{"quay/app", "dockerhub", "dockerhubmirror/app"} {
+		name, _ := reference.WithName(unknown)
+		_, err := registry.Repository(ctx, name)
+		if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+			t.Errorf("expected %s to be unknown, got %v", unknown, err)
+		}
+	}
+}
+
+func TestPullThroughCacheUpstreamsRemove(t *testing.T) {
+	ctx := context.Background()
+
+	upstream := newUpstream(t, nil)
+	defer upstream.Close()
+
+	inmemoryDriver := inmemory.New()
+	localRegistry, err := storage.NewRegistry(ctx, inmemoryDriver, storage.EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	name, _ := reference.WithName("ghcr/app")
+	localRepo, err := localRegistry.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := localRepo.Blobs(ctx).Put(ctx, "application/octet-stream", []byte("cached"))
+	if err != nil {
+		t.Fatalf("error caching blob: %v", err)
+	}
+	if err := localRepo.Tags(ctx).Tag(ctx, "latest", desc); err != nil {
+		t.Fatalf("error caching tag: %v", err)
+	}
+
+	noTTL := time.Duration(0)
+	registry, err := NewRegistryPullThroughCache(ctx, localRegistry, inmemoryDriver, configuration.Proxy{
+		Upstreams: []configuration.ProxyUpstream{
+			{Prefix: "dockerhub", RemoteURL: upstream.URL, TTL: &noTTL},
+			{Prefix: "ghcr", RemoteURL: upstream.URL, TTL: &noTTL},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creating pull through cache: %v", err)
+	}
+
+	enumerated := func() []string {
+		var repos []string
+		err := registry.(distribution.RepositoryEnumerator).Enumerate(ctx, func(repo string) error {
+			repos = append(repos, repo)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("error enumerating repositories: %v", err)
+		}
+		return repos
+	}
+	if repos := enumerated(); !reflect.DeepEqual(repos, []string{"ghcr/app"}) {
+		t.Fatalf("expected the cached repository to be enumerated, got %v", repos)
+	}
+	repos := make([]string, 10)
+	n, err := registry.(distribution.RepositorySearcher).SearchRepositories(ctx, repos, "", distribution.RepositoryFilter{Prefix: "ghcr/"})
+	if err != io.EOF || !reflect.DeepEqual(repos[:n], []string{"ghcr/app"}) {
+		t.Fatalf("expected the cached repository to be found, got %v, %v", repos[:n], err)
+	}
+	if err := registry.(distribution.RepositoryRemover).Remove(ctx, name); err != nil {
+		t.Fatalf("error removing repository: %v", err)
+	}
+	if repos := enumerated(); len(repos) != 0 {
+		t.Fatalf("expected no repository to be left, got %v", repos)
+	}
+}
+
+func TestPullThroughCacheUpstreamsInvalid(t *testing.T) {
+	ctx := context.Background()
+
+	upstream := newUpstream(t, nil)
+	defer upstream.Close()
+
+	for _, config := range []configuration.Proxy{
+		{
+			RemoteURL: upstream.URL,
+			Upstreams: []configuration.ProxyUpstream{{Prefix: "dockerhub", RemoteURL: upstream.URL}},
+		},
+		{
+			Upstreams: []configuration.ProxyUpstream{{RemoteURL: upstream.URL}},
+		},
+		{
+			Upstreams: []configuration.ProxyUpstream{{Prefix: "Invalid", RemoteURL: upstream.URL}},
+		},
+		{
+			Upstreams: []configuration.ProxyUpstream{
+				{Prefix: "dockerhub", RemoteURL: upstream.URL},
+				{Prefix: "dockerhub", RemoteURL: upstream.URL},
+			},
+		},
+	} {
+		inmemoryDriver := inmemory.New()
+		localRegistry, err := storage.NewRegistry(ctx, inmemoryDriver)
+		if err != nil {
+			t.Fatalf("error creating registry: %v", err)
+		}
+		if _, err := NewRegistryPullThroughCache(ctx, localRegistry, inmemoryDriver, config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
@@ -2,12 +2,20 @@ package proxy
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
 
 	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/client"
 )
 
 // proxyTagService supports local and remote lookup of tags.
 type proxyTagService struct {
+	repositoryName reference.Named
 	localTags      distribution.TagService
 	remoteTags     distribution.TagService
 	authChallenger authChallenger
@@ -15,26 +23,87 @@ type proxyTagService struct {
 
 var _ distribution.TagService = proxyTagService{}
 
+type staleKey struct{}
+
+// WithStaleTracking returns a context recording whether tags are resolved from
+// the cache, rather than from the remote registry, when it is used with the
+// tag service of a proxied repository. See IsStale.
+func WithStaleTracking(ctx context.Context) context.Context {
+	return context.WithValue(ctx, staleKey{}, new(int32))
+}
+
+// IsStale returns whether tags were resolved from the cache with the context
+// returned by WithStaleTracking, because the remote registry could not be
+// reached. Such tags may no longer match the remote registry.
+func IsStale(ctx context.Context) bool {
+	stale, ok := ctx.Value(staleKey{}).(*int32)
+	return ok && atomic.LoadInt32(stale) != 0
+}
+
+// servedStale records that tags were resolved from the cache.
+func servedStale(ctx context.Context, err error) {
+	dcontext.GetLogger(ctx).Warnf("serving stale tags from the cache: %v", err)
+	proxyMetrics.TagStale()
+	if stale, ok := ctx.Value(staleKey{}).(*int32); ok {
+		atomic.StoreInt32(stale, 1)
+	}
+}
+
+// remoteNotFound returns whether err is the answer of a remote registry which
+// does not know the tag or the repository, rather than a failure to reach it.
+func remoteNotFound(err error) bool {
+	var (
+		tagUnknown  distribution.ErrTagUnknown
+		repoUnknown distribution.ErrRepositoryUnknown
+		codeErr     errcode.Error
+		responseErr *client.UnexpectedHTTPResponseError
+	)
+	switch {
+	case errors.As(err, &tagUnknown), errors.As(err, &repoUnknown):
+		return true
+	case errors.As(err, &responseErr):
+		return responseErr.StatusCode == http.StatusNotFound
+	case errors.As(err, &codeErr):
+		return codeErr.Code.Descriptor().HTTPStatusCode == http.StatusNotFound
+	}
+	if errs, ok := err.(errcode.Errors); ok && len(errs) > 0 {
+		for _, err := range errs {
+			if !remoteNotFound(err) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 // Get attempts to get the most recent digest for the tag by checking the remote
 // tag service first and then caching it locally.  If the remote is unavailable
-// the local association is returned
+// the local association is returned, but a tag unknown to the remote is
+// reported as unknown.
 func (pt proxyTagService) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
-	err := pt.authChallenger.tryEstablishChallenges(ctx)
-	if err == nil {
-		desc, err := pt.remoteTags.Get(ctx, tag)
-		if err == nil {
+	proxyMetrics.TagRequest()
+	remoteErr := pt.authChallenger.tryEstablishChallenges(ctx)
+	if remoteErr == nil {
+		var desc distribution.Descriptor
+		desc, remoteErr = pt.remoteTags.Get(ctx, tag)
+		if remoteErr == nil {
 			err := pt.localTags.Tag(ctx, tag, desc)
 			if err != nil {
 				return distribution.Descriptor{}, err
 			}
 			return desc, nil
 		}
+		if remoteNotFound(remoteErr) {
+			return distribution.Descriptor{}, distribution.ErrTagUnknown{Tag: tag}
+		}
 	}
 
 	desc, err := pt.localTags.Get(ctx, tag)
 	if err != nil {
 		return distribution.Descriptor{}, err
 	}
+	servedStale(ctx, remoteErr)
 	return desc, nil
 }
 
@@ -51,14 +120,25 @@ func (pt proxyTagService) Untag(ctx context.Context, tag string) error {
 }
 
 func (pt proxyTagService) All(ctx context.Context) ([]string, error) {
-	err := pt.authChallenger.tryEstablishChallenges(ctx)
-	if err == nil {
-		tags, err := pt.remoteTags.All(ctx)
-		if err == nil {
-			return tags, err
+	proxyMetrics.TagRequest()
+	remoteErr := pt.authChallenger.tryEstablishChallenges(ctx)
+	if remoteErr == nil {
+		var tags []string
+		tags, remoteErr = pt.remoteTags.All(ctx)
+		if remoteErr == nil {
+			return tags, nil
 		}
+		if remoteNotFound(remoteErr) {
+			return nil, distribution.ErrRepositoryUnknown{Name: pt.repositoryName.Name()}
+		}
+	}
+
+	tags, err := pt.localTags.All(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return pt.localTags.All(ctx)
+	servedStale(ctx, remoteErr)
+	return tags, nil
 }
 
 func (pt proxyTagService) Lookup(ctx context.Context, digest distribution.Descriptor) ([]string, error) {
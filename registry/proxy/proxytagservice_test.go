@@ -2,12 +2,16 @@ package proxy
 
 import (
 	"context"
+	"net/http"
 	"reflect"
 	"sort"
 	"sync"
 	"testing"
 
 	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/client"
 )
 
 type mockTagStore struct {
@@ -74,7 +78,7 @@ func testProxyTagService(local, remote map[string]distribution.Descriptor) *prox
 func TestGet(t *testing.T) {
 	remoteDesc := distribution.Descriptor{Size: 42}
 	remoteTag := "remote"
-	proxyTags := testProxyTagService(map[string]distribution.Descriptor{remoteTag: remoteDesc}, nil)
+	proxyTags := testProxyTagService(map[string]distribution.Descriptor{remoteTag: remoteDesc}, map[string]distribution.Descriptor{remoteTag: remoteDesc})
 
 	ctx := context.Background()
 
@@ -175,3 +179,95 @@ func TestGet(t *testing.T) {
 		t.Fatalf("Expected 4 auth challenge calls, got %#v", proxyTags.authChallenger)
 	}
 }
+
+type unreachableChallenger struct {
+	mockChallenger
+}
+
+func (m *unreachableChallenger) tryEstablishChallenges(context.Context) error {
+	return errUpstreamUnavailable
+}
+
+func TestGetStale(t *testing.T) {
+	cachedDesc := distribution.Descriptor{Size: 42}
+	proxyTags := testProxyTagService(map[string]distribution.Descriptor{"cached": cachedDesc}, nil)
+	proxyTags.authChallenger = &unreachableChallenger{}
+
+	stale := proxyMetrics.tagMetrics.Stale
+
+	ctx := WithStaleTracking(context.Background())
+	if IsStale(ctx) {
+		t.Fatal("context is stale before resolving tags")
+	}
+
+	d, err := proxyTags.Get(ctx, "cached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d, cachedDesc) {
+		t.Fatalf("unexpected descriptor: %v", d)
+	}
+	if !IsStale(ctx) {
+		t.Fatal("tag resolved from the cache is not stale")
+	}
+	if proxyMetrics.tagMetrics.Stale != stale+1 {
+		t.Fatalf("expected %d stale tags, got %d", stale+1, proxyMetrics.tagMetrics.Stale)
+	}
+
+	// tags unknown to the cache are not served
+	ctx = WithStaleTracking(context.Background())
+	if _, err := proxyTags.Get(ctx, "uncached"); err == nil {
+		t.Fatal("expected an error getting a tag which is not cached")
+	}
+	if IsStale(ctx) {
+		t.Fatal("failed resolution marked as stale")
+	}
+
+	ctx = WithStaleTracking(context.Background())
+	all, err := proxyTags.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all, []string{"cached"}) || !IsStale(ctx) {
+		t.Fatalf("expected stale tags from the cache, got %v", all)
+	}
+
+	// tags from the remote are not stale
+	proxyTags = testProxyTagService(nil, map[string]distribution.Descriptor{"remote": cachedDesc})
+	ctx = WithStaleTracking(context.Background())
+	if _, err := proxyTags.Get(ctx, "remote"); err != nil {
+		t.Fatal(err)
+	}
+	if IsStale(ctx) {
+		t.Fatal("tag resolved from the remote is stale")
+	}
+}
+
+func TestGetRemoteNotFound(t *testing.T) {
+	proxyTags := testProxyTagService(map[string]distribution.Descriptor{"deleted": {Size: 42}}, nil)
+
+	ctx := WithStaleTracking(context.Background())
+	_, err := proxyTags.Get(ctx, "deleted")
+	if _, ok := err.(distribution.ErrTagUnknown); !ok {
+		t.Fatalf("expected the tag deleted from the remote to be unknown, got %v", err)
+	}
+	if IsStale(ctx) {
+		t.Fatal("tag unknown to the remote served from the cache")
+	}
+
+	// not-found answers from a remote registry are recognized, other errors are not
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{errcode.Errors{v2.ErrorCodeManifestUnknown.WithDetail(nil)}, true},
+		{errcode.Errors{v2.ErrorCodeManifestUnknown.WithDetail(nil), errcode.ErrorCodeUnknown.WithDetail(nil)}, false},
+		{&client.UnexpectedHTTPResponseError{ParseErr: client.ErrNoErrorsInBody, StatusCode: http.StatusNotFound}, true},
+		{&client.UnexpectedHTTPStatusError{Status: "502 Bad Gateway"}, false},
+		{errUpstreamUnavailable, false},
+	} {
+		if got := remoteNotFound(tc.err); got != tc.want {
+			t.Errorf("remoteNotFound(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/docker/distribution/health"
 	"github.com/docker/distribution/registry/handlers"
 	"github.com/docker/distribution/registry/listener"
+	"github.com/docker/distribution/tracing"
 	"github.com/docker/distribution/uuid"
 	"github.com/docker/distribution/version"
 )
@@ -84,6 +85,10 @@ var tlsVersions = map[string]uint16{
 // this channel gets notified when process receives signal. It is global to ease unit testing
 var quit = make(chan os.Signal, 1)
 
+// this channel gets notified when the process receives SIGHUP, to reload the
+// configuration. It is global to ease unit testing
+var reload = make(chan os.Signal, 1)
+
 // HandlerFunc defines an http middleware
 type HandlerFunc func(config *configuration.Configuration, handler http.Handler) http.Handler
 
@@ -113,6 +118,9 @@ var ServeCmd = &cobra.Command{
 		if err != nil {
 			logrus.Fatalln(err)
 		}
+		registry.readConfiguration = func() (*configuration.Configuration, error) {
+			return resolveConfiguration(args)
+		}
 
 		configureDebugServer(config)
 
@@ -129,10 +137,26 @@ type Registry struct {
 	config *configuration.Configuration
 	app    *handlers.App
 	server *http.Server
+
+	// shutdownTracing flushes the spans not exported yet
+	shutdownTracing func(context.Context) error
+
+	// running is the configuration the registry started with, before
+	// defaults are filled in.
+	running configuration.Configuration
+
+	// readConfiguration reads the configuration again when it is reloaded.
+	readConfiguration func() (*configuration.Configuration, error)
+
+	// certificate is the TLS certificate served, unless it is issued by
+	// Let's Encrypt. It is reloaded when its files are modified.
+	certificate *certificate
 }
 
 // NewRegistry creates a new registry from a context and configuration struct.
 func NewRegistry(ctx context.Context, config *configuration.Configuration) (*Registry, error) {
+	running := *config
+
 	var err error
 	ctx, err = configureLogging(ctx, config)
 	if err != nil {
@@ -145,6 +169,11 @@ func NewRegistry(ctx context.Context, config *configuration.Configuration) (*Reg
 	// with uuid generation under low entropy.
 	uuid.Loggerf = dcontext.GetLogger(ctx).Warnf
 
+	shutdownTracing, err := tracing.Configure(ctx, config.Tracing)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring tracing: %v", err)
+	}
+
 	app := handlers.NewApp(ctx, config)
 	// TODO(aaronl): The global scope of the health checks means NewRegistry
 	// can only be called once per process.
@@ -167,9 +196,11 @@ func NewRegistry(ctx context.Context, config *configuration.Configuration) (*Reg
 	}
 
 	return &Registry{
-		app:    app,
-		config: config,
-		server: server,
+		app:             app,
+		config:          config,
+		server:          server,
+		shutdownTracing: shutdownTracing,
+		running:         running,
 	}, nil
 }
 
@@ -263,11 +294,11 @@ func (registry *Registry) ListenAndServe() error {
 			tlsConf.GetCertificate = m.GetCertificate
 			tlsConf.NextProtos = append(tlsConf.NextProtos, acme.ALPNProto)
 		} else {
-			tlsConf.Certificates = make([]tls.Certificate, 1)
-			tlsConf.Certificates[0], err = tls.LoadX509KeyPair(config.HTTP.TLS.Certificate, config.HTTP.TLS.Key)
+			registry.certificate, err = newCertificate(config.HTTP.TLS.Certificate, config.HTTP.TLS.Key)
 			if err != nil {
 				return err
 			}
+			tlsConf.GetCertificate = registry.certificate.GetCertificate
 		}
 
 		if len(config.HTTP.TLS.ClientCAs) != 0 {
@@ -298,6 +329,16 @@ func (registry *Registry) ListenAndServe() error {
 		dcontext.GetLogger(registry.app).Infof("listening on %v", ln.Addr())
 	}
 
+	// setup channel to get notified on SIGHUP signal
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+	stopReloading := make(chan struct{})
+	defer close(stopReloading)
+	go registry.reloadOnSignal(stopReloading)
+	if registry.certificate != nil {
+		go registry.certificate.watch(registry.app, stopReloading, certificateCheckInterval)
+	}
+
 	if config.HTTP.DrainTimeout == 0 {
 		return registry.server.Serve(ln)
 	}
@@ -319,7 +360,14 @@ func (registry *Registry) ListenAndServe() error {
 		// shutdown the server with a grace period of configured timeout
 		c, cancel := context.WithTimeout(context.Background(), config.HTTP.DrainTimeout)
 		defer cancel()
-		return registry.server.Shutdown(c)
+		err := registry.server.Shutdown(c)
+		if appErr := registry.app.Shutdown(); appErr != nil {
+			dcontext.GetLogger(registry.app).Errorf("error closing the audit log: %v", appErr)
+		}
+		if tracingErr := registry.shutdownTracing(c); tracingErr != nil {
+			dcontext.GetLogger(registry.app).Errorf("error flushing traces: %v", tracingErr)
+		}
+		return err
 	}
 }
 
@@ -0,0 +1,124 @@
+package registry
+
+import (
+	"crypto/tls"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+)
+
+// Reload applies the parts of config which can be changed while the registry
+// is running: the access controller along with its htpasswd and ACL files,
+// the notification endpoints and replications, the log level, the TLS
+// certificate, the validation of the manifest URLs, and the rate limit and
+// immutable tags policies. Nothing is applied if config is invalid.
+//
+// The changes of the other sections are only applied when the registry
+// restarts. Reload returns the names of the sections changed since the
+// registry started which are in that case.
+func (registry *Registry) Reload(config *configuration.Configuration) ([]string, error) {
+	// the certificate is loaded first, so that nothing is applied if it is
+	// invalid
+	var (
+		cert  *tls.Certificate
+		files keyPair
+	)
+	if registry.certificate != nil && config.HTTP.TLS.Certificate != "" {
+		var err error
+		cert, files, err = loadKeyPair(config.HTTP.TLS.Certificate, config.HTTP.TLS.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading TLS certificate: %v", err)
+		}
+	}
+
+	if err := registry.app.Reload(config); err != nil {
+		return nil, err
+	}
+	logrus.SetLevel(logLevel(config.Log.Level))
+	if cert != nil {
+		registry.certificate.set(cert, files)
+	}
+
+	return restartRequired(&registry.running, config), nil
+}
+
+// reloadOnSignal reloads the configuration each time the process receives
+// SIGHUP, until done is closed.
+func (registry *Registry) reloadOnSignal(done <-chan struct{}) {
+	for {
+		select {
+		case <-reload:
+		case <-done:
+			return
+		}
+
+		logger := dcontext.GetLogger(registry.app)
+		if registry.readConfiguration == nil {
+			logger.Warn("ignoring SIGHUP: the configuration cannot be read again")
+			continue
+		}
+		config, err := registry.readConfiguration()
+		if err != nil {
+			logger.Errorf("error reloading configuration: %v", err)
+			continue
+		}
+		restart, err := registry.Reload(config)
+		if err != nil {
+			logger.Errorf("error reloading configuration: %v", err)
+			continue
+		}
+		logger.Info("configuration reloaded")
+		if len(restart) > 0 {
+			logger.Warnf("the changes of the following configuration sections require a restart: %s", strings.Join(restart, ", "))
+		}
+	}
+}
+
+// restartRequired returns the names of the sections of config which differ
+// from the running configuration, and which Reload does not apply.
+func restartRequired(running, config *configuration.Configuration) []string {
+	runningHTTP, configHTTP := running.HTTP, config.HTTP
+	if runningHTTP.TLS.Certificate != "" && configHTTP.TLS.Certificate != "" {
+		// the certificate is reloaded, as long as TLS is enabled
+		runningHTTP.TLS.Certificate, runningHTTP.TLS.Key = "", ""
+		configHTTP.TLS.Certificate, configHTTP.TLS.Key = "", ""
+	}
+
+	var sections []string
+	for _, section := range []struct {
+		name            string
+		running, config interface{}
+	}{
+		{"log.accesslog", running.Log.AccessLog, config.Log.AccessLog},
+		{"log.formatter", running.Log.Formatter, config.Log.Formatter},
+		{"log.fields", running.Log.Fields, config.Log.Fields},
+		{"log.hooks", running.Log.Hooks, config.Log.Hooks},
+		{"log.reportcaller", running.Log.ReportCaller, config.Log.ReportCaller},
+		{"storage", running.Storage, config.Storage},
+		{"middleware", running.Middleware, config.Middleware},
+		{"reporting", running.Reporting, config.Reporting},
+		{"tracing", running.Tracing, config.Tracing},
+		{"audit", running.Audit, config.Audit},
+		{"http", runningHTTP, configHTTP},
+		{"notifications.events", running.Notifications.EventConfig, config.Notifications.EventConfig},
+		{"redis", running.Redis, config.Redis},
+		{"health", running.Health, config.Health},
+		{"catalog", running.Catalog, config.Catalog},
+		{"proxy", running.Proxy, config.Proxy},
+		{"compatibility", running.Compatibility, config.Compatibility},
+		{"policy.repository", running.Policy.Repository, config.Policy.Repository},
+		{"policy.retention", running.Policy.Retention, config.Policy.Retention},
+		{"policy.quota", running.Policy.Quota, config.Policy.Quota},
+		{"policy.ratelimit.store", running.Policy.RateLimit.Store, config.Policy.RateLimit.Store},
+	} {
+		if !reflect.DeepEqual(section.running, section.config) {
+			sections = append(sections, section.name)
+		}
+	}
+	return sections
+}
@@ -0,0 +1,138 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRestartRequired(t *testing.T) {
+	newConfig := func() *configuration.Configuration {
+		config := &configuration.Configuration{
+			Storage: configuration.Storage{"inmemory": configuration.Parameters{}},
+		}
+		config.HTTP.Addr = ":5000"
+		config.HTTP.TLS.Certificate = "/etc/registry/cert.pem"
+		config.HTTP.TLS.Key = "/etc/registry/key.pem"
+		return config
+	}
+	running := newConfig()
+
+	// the sections reloaded need no restart
+	config := newConfig()
+	config.Log.Level = "debug"
+	config.HTTP.TLS.Certificate = "/etc/registry/renewed.pem"
+	config.HTTP.TLS.Key = "/etc/registry/renewed.key"
+	config.Auth = configuration.Auth{"htpasswd": configuration.Parameters{"path": "/etc/registry/htpasswd"}}
+	config.Notifications.Endpoints = []configuration.Endpoint{{Name: "endpoint", URL: "http://localhost/events"}}
+	config.Policy.ImmutableTags.Tags = []string{"^v"}
+	config.Policy.RateLimit.Enabled = true
+	config.Validation.Manifests.URLs.Allow = []string{"^https://foo/"}
+	if sections := restartRequired(running, config); len(sections) != 0 {
+		t.Errorf("expected no restart, got %v", sections)
+	}
+
+	config.HTTP.Addr = ":5001"
+	config.Storage = configuration.Storage{"filesystem": configuration.Parameters{"rootdirectory": "/var/lib/registry"}}
+	config.Policy.Quota.Enabled = true
+	config.Audit.Enabled = true
+	expected := []string{"storage", "audit", "http", "policy.quota"}
+	if sections := restartRequired(running, config); !reflect.DeepEqual(sections, expected) {
+		t.Errorf("expected restart for %v, got %v", expected, sections)
+	}
+
+	// disabling TLS is not reloaded
+	config = newConfig()
+	config.HTTP.TLS.Certificate, config.HTTP.TLS.Key = "", ""
+	if sections := restartRequired(running, config); !reflect.DeepEqual(sections, []string{"http"}) {
+		t.Errorf("expected restart for http, got %v", sections)
+	}
+}
+
+func TestRegistryReload(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+
+	initial, err := buildRegistryTLSConfig("registry_test_server_reload", "rsa", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := buildRegistryTLSConfig("registry_test_server_reload_renewed", "ecdsa", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := setupRegistry(initial, ":5003")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := make(chan struct{}, 1)
+	registry.readConfiguration = func() (*configuration.Configuration, error) {
+		config := registry.running
+		config.Log.Level = "error"
+		config.HTTP.TLS.Certificate = renewed.certificatePath
+		config.HTTP.TLS.Key = renewed.privateKeyPath
+		reloaded <- struct{}{}
+		return &config, nil
+	}
+
+	// the stop signal of a registry which failed to start would stop this one
+	select {
+	case <-quit:
+	default:
+	}
+
+	// run registry server
+	var errchan chan error
+	go func() {
+		errchan <- registry.ListenAndServe()
+	}()
+	select {
+	case err = <-errchan:
+		t.Fatalf("Error listening: %v", err)
+	default:
+	}
+	defer func() {
+		// send stop signal
+		quit <- os.Interrupt
+		time.Sleep(100 * time.Millisecond)
+	}()
+
+	// Wait for some unknown random time for server to start listening
+	time.Sleep(3 * time.Second)
+
+	served := func() []byte {
+		dialer := net.Dialer{
+			Timeout: time.Second * 5,
+		}
+		conn, err := tls.DialWithDialer(&dialer, "tcp", "127.0.0.1:5003", &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Raw
+	}
+	if !bytes.Equal(served(), initial.certificate.Certificate[0]) {
+		t.Fatal("expected the initial certificate to be served")
+	}
+
+	reload <- syscall.SIGHUP
+	<-reloaded
+	deadline := time.Now().Add(5 * time.Second)
+	for !bytes.Equal(served(), renewed.certificate.Certificate[0]) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the renewed certificate to be served once reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if logrus.IsLevelEnabled(logrus.WarnLevel) {
+		t.Error("expected the log level to be reloaded")
+	}
+}
@@ -1,10 +1,17 @@
 package registry
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"text/tabwriter"
+	"time"
 
+	"github.com/docker/distribution"
 	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/handlers"
 	"github.com/docker/distribution/registry/storage"
 	"github.com/docker/distribution/registry/storage/driver/factory"
 	"github.com/docker/distribution/version"
@@ -17,8 +24,18 @@ var showVersion bool
 func init() {
 	RootCmd.AddCommand(ServeCmd)
 	RootCmd.AddCommand(GCCmd)
+	RootCmd.AddCommand(DUCmd)
+	RootCmd.AddCommand(VerifyCmd)
+	RootCmd.AddCommand(UploadsCmd)
+	UploadsCmd.AddCommand(UploadsListCmd)
+	UploadsCmd.AddCommand(UploadsCancelCmd)
 	GCCmd.Flags().BoolVarP(&dryRun, "dry-run", "d", false, "do everything except remove the blobs")
 	GCCmd.Flags().BoolVarP(&removeUntagged, "delete-untagged", "m", false, "delete manifests that are not currently referenced via tag")
+	DUCmd.Flags().StringVarP(&duFormat, "format", "f", "table", "output format, table or json")
+	VerifyCmd.Flags().BoolVarP(&quarantine, "quarantine", "q", false, "move the corrupt blobs and the dangling links to the quarantine directory")
+	VerifyCmd.Flags().StringVarP(&verifyFormat, "format", "f", "table", "output format, table or json")
+	UploadsListCmd.Flags().StringVarP(&uploadsRepository, "repository", "r", "", "list the uploads to this repository only")
+	UploadsListCmd.Flags().StringVarP(&uploadsFormat, "format", "f", "table", "output format, table or json")
 	RootCmd.Flags().BoolVarP(&showVersion, "version", "v", false, "show the version and exit")
 }
 
@@ -73,7 +90,13 @@ var GCCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		registry, err := storage.NewRegistry(ctx, driver, storage.Schema1SigningKey(k))
+		options := []storage.RegistryOption{storage.Schema1SigningKey(k)}
+		// the manifests removed are cleared from the cache of the registries
+		if manifestCache := handlers.SharedManifestCacheProvider(ctx, config); manifestCache != nil {
+			options = append(options, storage.ManifestCacheProvider(manifestCache))
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver, options...)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
 			os.Exit(1)
@@ -89,3 +112,297 @@ var GCCmd = &cobra.Command{
 		}
 	},
 }
+
+var duFormat string
+
+// DUCmd is the cobra command that corresponds to the du subcommand
+var DUCmd = &cobra.Command{
+	Use:   "du <config>",
+	Short: "`du` reports the storage used by each repository",
+	Long:  "`du` reports the bytes of the blobs referenced by the manifests of each repository, split between blobs exclusive to the repository and blobs shared with others, along with the deduplication ratio of the registry",
+	Run: func(cmd *cobra.Command, args []string) {
+		if duFormat != "table" && duFormat != "json" {
+			fmt.Fprintf(os.Stderr, "unknown output format %q\n", duFormat)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+
+		du, err := storage.ComputeDiskUsage(ctx, registry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to compute disk usage: %v", err)
+			os.Exit(1)
+		}
+
+		if duFormat == "json" {
+			err = json.NewEncoder(os.Stdout).Encode(du)
+		} else {
+			err = writeDiskUsageTable(os.Stdout, du)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write disk usage: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// writeDiskUsageTable writes the disk usage as a table of the repositories,
+// sizes being in bytes, followed by the totals of the registry.
+func writeDiskUsageTable(w io.Writer, du *storage.DiskUsage) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "REPOSITORY\tEXCLUSIVE\tSHARED\tTOTAL\t")
+	for _, repo := range du.Repositories {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t\n", repo.Name, repo.Exclusive, repo.Shared, repo.Total)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\nreferenced: %d bytes, stored: %d bytes, dedup ratio: %.2f\n", du.Referenced, du.Stored, du.DedupRatio)
+	return err
+}
+
+var (
+	quarantine   bool
+	verifyFormat string
+)
+
+// VerifyCmd is the cobra command that corresponds to the verify subcommand
+var VerifyCmd = &cobra.Command{
+	Use:   "verify <config>",
+	Short: "`verify` checks the integrity of the stored content",
+	Long:  "`verify` hashes every blob again and checks it against its digest, then checks that the manifest revision and layer links of the repositories and the references of the manifests point to existing blobs. It exits with status 1 when problems are found.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if verifyFormat != "table" && verifyFormat != "json" {
+			fmt.Fprintf(os.Stderr, "unknown output format %q\n", verifyFormat)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+
+		report, err := storage.Verify(ctx, driver, registry, storage.VerifyOpts{
+			Quarantine: quarantine,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to verify: %v", err)
+			os.Exit(1)
+		}
+
+		if verifyFormat == "json" {
+			err = json.NewEncoder(os.Stdout).Encode(report)
+		} else {
+			err = writeVerifyReportTable(os.Stdout, report)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write verify report: %v", err)
+			os.Exit(1)
+		}
+
+		if len(report.Problems) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// writeVerifyReportTable writes the problems found as a table, followed by
+// the counts of the content verified.
+func writeVerifyReportTable(w io.Writer, report *storage.VerifyReport) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tREPOSITORY\tDIGEST\tQUARANTINED\tDETAIL\tPATH")
+	for _, problem := range report.Problems {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\t%s\n", problem.Kind, problem.Repository, problem.Digest, problem.Quarantined, problem.Detail, problem.Path)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\nverified: %d blobs, %d manifests, %d links, problems: %d\n", report.Blobs, report.Manifests, report.Links, len(report.Problems))
+	return err
+}
+
+var (
+	uploadsRepository string
+	uploadsFormat     string
+)
+
+// UploadsCmd is the cobra command that corresponds to the uploads subcommand
+var UploadsCmd = &cobra.Command{
+	Use:   "uploads",
+	Short: "`uploads` manages the blob upload sessions in progress",
+	Long:  "`uploads` lists the blob upload sessions in progress, and cancels them",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+// UploadsListCmd is the cobra command that corresponds to the uploads list
+// subcommand
+var UploadsListCmd = &cobra.Command{
+	Use:   "list <config>",
+	Short: "`list` lists the blob upload sessions in progress",
+	Long:  "`list` lists the blob upload sessions in progress, with their start time, the bytes uploaded so far and the offset of the latest hash state saved",
+	Run: func(cmd *cobra.Command, args []string) {
+		if uploadsFormat != "table" && uploadsFormat != "json" {
+			fmt.Fprintf(os.Stderr, "unknown output format %q\n", uploadsFormat)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		uploads, errs := storage.ListUploads(ctx, driver, uploadsRepository)
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "error listing uploads: %v\n", err)
+		}
+
+		if uploadsFormat == "json" {
+			err = json.NewEncoder(os.Stdout).Encode(uploads)
+		} else {
+			err = writeUploadsTable(os.Stdout, uploads)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write uploads: %v", err)
+			os.Exit(1)
+		}
+
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// UploadsCancelCmd is the cobra command that corresponds to the uploads
+// cancel subcommand
+var UploadsCancelCmd = &cobra.Command{
+	Use:   "cancel <config> <repository> <id>",
+	Short: "`cancel` cancels a blob upload session",
+	Long:  "`cancel` cancels a blob upload session in progress, removing the content uploaded so far. The client gets an error on its next request for the upload.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 3 {
+			fmt.Fprintln(os.Stderr, "the configuration, the repository and the upload id must be given")
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		name, err := reference.WithName(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid repository name %q: %v\n", args[1], err)
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+
+		err = storage.CancelUpload(ctx, registry, name, args[2])
+		if err == distribution.ErrBlobUploadUnknown {
+			fmt.Fprintf(os.Stderr, "no upload %s to %s\n", args[2], name.Name())
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to cancel upload: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// writeUploadsTable writes the uploads as a table, sizes and offsets being in
+// bytes.
+func writeUploadsTable(w io.Writer, uploads []storage.Upload) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tID\tSTARTED AT\tSIZE\tHASH STATE OFFSET")
+	for _, upload := range uploads {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\n", upload.Repository, upload.ID, upload.StartedAt.Format(time.RFC3339), upload.Size, upload.HashStateOffset)
+	}
+	return tw.Flush()
+}
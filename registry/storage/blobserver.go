@@ -76,3 +76,32 @@ func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *h
 	http.ServeContent(w, r, desc.Digest.String(), time.Time{}, br)
 	return nil
 }
+
+// ServeDriverContent serves the data of the blob stored at path by the
+// driver, for the requests to the URLs signed for it. Any other path is
+// reported as not found.
+func ServeDriverContent(ctx context.Context, w http.ResponseWriter, r *http.Request, d driver.StorageDriver, path string) error {
+	if !isBlobDataPath(path) {
+		return driver.PathNotFoundError{Path: path}
+	}
+
+	fi, err := d.Stat(ctx, path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return driver.PathNotFoundError{Path: path}
+	}
+
+	br, err := newFileReader(ctx, d, path, fi.Size())
+	if err != nil {
+		return err
+	}
+	defer br.Close()
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%.f", blobCacheControlMaxAge.Seconds()))
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	http.ServeContent(w, r, path, fi.ModTime(), br)
+	return nil
+}
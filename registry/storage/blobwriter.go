@@ -11,8 +11,10 @@ import (
 	"github.com/docker/distribution"
 	dcontext "github.com/docker/distribution/context"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/tracing"
 	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var errResumableDigestNotAvailable = errors.New("resumable digest not available")
@@ -54,8 +56,10 @@ func (bw *blobWriter) StartedAt() time.Time {
 
 // Commit marks the upload as completed, returning a valid descriptor. The
 // final size and digest are checked against the first descriptor provided.
-func (bw *blobWriter) Commit(ctx context.Context, desc distribution.Descriptor) (distribution.Descriptor, error) {
+func (bw *blobWriter) Commit(ctx context.Context, desc distribution.Descriptor) (_ distribution.Descriptor, err error) {
 	dcontext.GetLogger(ctx).Debug("(*blobWriter).Commit")
+	ctx, span := tracing.StartSpan(ctx, "(*blobWriter).Commit", attribute.String("registry.digest", desc.Digest.String()))
+	defer func() { tracing.EndSpan(span, err) }()
 
 	if err := bw.fileWriter.Commit(); err != nil {
 		return distribution.Descriptor{}, err
@@ -92,8 +96,10 @@ func (bw *blobWriter) Commit(ctx context.Context, desc distribution.Descriptor)
 
 // Cancel the blob upload process, releasing any resources associated with
 // the writer and canceling the operation.
-func (bw *blobWriter) Cancel(ctx context.Context) error {
+func (bw *blobWriter) Cancel(ctx context.Context) (err error) {
 	dcontext.GetLogger(ctx).Debug("(*blobWriter).Cancel")
+	ctx, span := tracing.StartSpan(ctx, "(*blobWriter).Cancel")
+	defer func() { tracing.EndSpan(span, err) }()
 	if err := bw.fileWriter.Cancel(ctx); err != nil {
 		return err
 	}
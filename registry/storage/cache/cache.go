@@ -3,9 +3,11 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/docker/distribution"
+	"github.com/opencontainers/go-digest"
 )
 
 // BlobDescriptorCacheProvider provides repository scoped
@@ -16,6 +18,70 @@ type BlobDescriptorCacheProvider interface {
 	RepositoryScoped(repo string) (distribution.BlobDescriptorService, error)
 }
 
+// ManifestCacheProvider provides repository scoped ManifestCache instances.
+type ManifestCacheProvider interface {
+	RepositoryScoped(repo string) (ManifestCache, error)
+}
+
+// TagVersion changes whenever a tag is cleared from a ManifestCache, so that a
+// tag read from the storage backend concurrently is not cached.
+type TagVersion int64
+
+// ManifestCache caches the resolution of tags to manifest digests and the
+// payloads of manifests of a repository, saving the reads of the tag links
+// and the manifest revisions from the storage backend.
+type ManifestCache interface {
+	// GetTag returns the digest of the manifest the tag was cached for. If
+	// the tag is not cached, it returns distribution.ErrTagUnknown along
+	// with the version of the tag to pass to SetTag.
+	GetTag(ctx context.Context, tag string) (digest.Digest, TagVersion, error)
+
+	// SetTag caches the digest of the manifest the tag points to, read after
+	// GetTag returned the version. Nothing is cached if the tag was cleared
+	// since, as the digest may then be outdated.
+	SetTag(ctx context.Context, tag string, dgst digest.Digest, version TagVersion) error
+
+	// ClearTag removes the tag from the cache, and changes its version.
+	ClearTag(ctx context.Context, tag string) error
+
+	// GetManifest returns the cached payload of the manifest, or
+	// distribution.ErrBlobUnknown if it is not cached.
+	GetManifest(ctx context.Context, dgst digest.Digest) ([]byte, error)
+
+	// SetManifest caches the payload of the manifest.
+	SetManifest(ctx context.Context, dgst digest.Digest, payload []byte) error
+
+	// ClearManifest removes the payload of the manifest from the cache,
+	// along with the tags cached for it.
+	ClearManifest(ctx context.Context, dgst digest.Digest) error
+}
+
+// RepositoryIndex keeps the names of the repositories of the registry, so
+// the catalog can be listed without walking the storage backend. The names
+// are listed in catalog order, where the path separator sorts before any
+// other character.
+type RepositoryIndex interface {
+	// Add records the repository. Adding a repository again is a no-op.
+	Add(ctx context.Context, name string) error
+
+	// Remove forgets the repository.
+	Remove(ctx context.Context, name string) error
+
+	// Repositories fills repos with the names of the indexed repositories
+	// starting with prefix and sorting after last. It returns io.EOF once
+	// there are no more repositories.
+	Repositories(ctx context.Context, repos []string, last, prefix string) (int, error)
+
+	// Complete returns whether all the repositories of the storage were
+	// added to the index. An index may stop being complete after a while,
+	// to be built again.
+	Complete(ctx context.Context) (bool, error)
+
+	// SetComplete records that all the repositories of the storage were
+	// added to the index.
+	SetComplete(ctx context.Context) error
+}
+
 // ValidateDescriptor provides a helper function to ensure that caches have
 // common criteria for admitting descriptors.
 func ValidateDescriptor(desc distribution.Descriptor) error {
@@ -2,6 +2,7 @@ package cachecheck
 
 import (
 	"context"
+	"io"
 	"reflect"
 	"testing"
 
@@ -185,3 +186,262 @@ func checkBlobDescriptorCacheClear(ctx context.Context, t *testing.T, provider c
 		t.Fatalf("expected error statting deleted blob: %v", err)
 	}
 }
+
+// CheckManifestCache takes a manifest cache implementation through a common
+// set of operations.
+func CheckManifestCache(t *testing.T, provider cache.ManifestCacheProvider) {
+	ctx := context.Background()
+
+	checkManifestCacheEmptyRepository(ctx, t, provider)
+	checkManifestCacheSetAndRead(ctx, t, provider)
+	checkManifestCacheClear(ctx, t, provider)
+	checkManifestCacheConcurrentClear(ctx, t, provider)
+}
+
+// fillTag caches the tag the way the tag store does, with the version read
+// before the tag.
+func fillTag(ctx context.Context, c cache.ManifestCache, tag string, dgst digest.Digest) error {
+	_, version, _ := c.GetTag(ctx, tag)
+	return c.SetTag(ctx, tag, dgst, version)
+}
+
+func checkManifestCacheEmptyRepository(ctx context.Context, t *testing.T, provider cache.ManifestCacheProvider) {
+	if _, err := provider.RepositoryScoped(""); err == nil {
+		t.Fatalf("expected an error when asking for invalid repo")
+	}
+
+	cache, err := provider.RepositoryScoped("foo/empty")
+	if err != nil {
+		t.Fatalf("unexpected error getting repository: %v", err)
+	}
+
+	if _, _, err := cache.GetTag(ctx, "latest"); err != (distribution.ErrTagUnknown{Tag: "latest"}) {
+		t.Fatalf("expected unknown tag error with empty repo: %v", err)
+	}
+
+	if _, err := cache.GetManifest(ctx, ""); err != digest.ErrDigestInvalidFormat {
+		t.Fatalf("expected error getting manifest with empty digest: %v", err)
+	}
+
+	if _, err := cache.GetManifest(ctx, "sha256:abc1111111111111111111111111111111111111111111111111111111111111"); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected unknown blob error with empty repo: %v", err)
+	}
+
+	if err := cache.SetTag(ctx, "latest", "", 0); err != digest.ErrDigestInvalidFormat {
+		t.Fatalf("expected error setting tag with empty digest: %v", err)
+	}
+}
+
+func checkManifestCacheSetAndRead(ctx context.Context, t *testing.T, provider cache.ManifestCacheProvider) {
+	dgst := digest.Digest("sha256:abc1111111111111111111111111111111111111111111111111111111111111")
+	payload := []byte(`{"schemaVersion":2}`)
+
+	cache, err := provider.RepositoryScoped("foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped cache: %v", err)
+	}
+
+	if err := fillTag(ctx, cache, "latest", dgst); err != nil {
+		t.Fatalf("error setting tag: %v", err)
+	}
+
+	if err := cache.SetManifest(ctx, dgst, payload); err != nil {
+		t.Fatalf("error setting manifest: %v", err)
+	}
+
+	cached, _, err := cache.GetTag(ctx, "latest")
+	if err != nil {
+		t.Fatalf("unexpected error getting tag: %v", err)
+	}
+
+	if cached != dgst {
+		t.Fatalf("unexpected digest: %s != %s", cached, dgst)
+	}
+
+	content, err := cache.GetManifest(ctx, dgst)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest: %v", err)
+	}
+
+	if !reflect.DeepEqual(content, payload) {
+		t.Fatalf("unexpected payload: %q != %q", content, payload)
+	}
+
+	// the cache is scoped to the repository
+	other, err := provider.RepositoryScoped("foo/other")
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped cache: %v", err)
+	}
+
+	if _, _, err := other.GetTag(ctx, "latest"); err == nil {
+		t.Fatalf("expected tag not to be cached in another repository")
+	}
+
+	if _, err := other.GetManifest(ctx, dgst); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected manifest not to be cached in another repository: %v", err)
+	}
+}
+
+func checkManifestCacheClear(ctx context.Context, t *testing.T, provider cache.ManifestCacheProvider) {
+	dgst := digest.Digest("sha256:def1111111111111111111111111111111111111111111111111111111111111")
+	moved := digest.Digest("sha256:fed1111111111111111111111111111111111111111111111111111111111111")
+
+	cache, err := provider.RepositoryScoped("foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped cache: %v", err)
+	}
+
+	for _, tag := range []string{"a", "b", "c", "d"} {
+		if err := fillTag(ctx, cache, tag, dgst); err != nil {
+			t.Fatalf("error setting tag: %v", err)
+		}
+	}
+
+	if err := cache.SetManifest(ctx, dgst, []byte(`{}`)); err != nil {
+		t.Fatalf("error setting manifest: %v", err)
+	}
+
+	if err := cache.ClearTag(ctx, "a"); err != nil {
+		t.Fatalf("error clearing tag: %v", err)
+	}
+
+	if _, _, err := cache.GetTag(ctx, "a"); err == nil {
+		t.Fatalf("expected error getting cleared tag")
+	}
+
+	// a tag moved to another manifest survives the deletion of the manifest
+	if err := fillTag(ctx, cache, "d", moved); err != nil {
+		t.Fatalf("error setting tag: %v", err)
+	}
+
+	if err := cache.ClearManifest(ctx, dgst); err != nil {
+		t.Fatalf("error clearing manifest: %v", err)
+	}
+
+	if _, err := cache.GetManifest(ctx, dgst); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected error getting cleared manifest: %v", err)
+	}
+
+	for _, tag := range []string{"b", "c"} {
+		if _, _, err := cache.GetTag(ctx, tag); err == nil {
+			t.Fatalf("expected tag %s of the cleared manifest to be cleared", tag)
+		}
+	}
+
+	if cached, _, err := cache.GetTag(ctx, "d"); err != nil || cached != moved {
+		t.Fatalf("expected moved tag to be kept: %v, %v", cached, err)
+	}
+}
+
+func checkManifestCacheConcurrentClear(ctx context.Context, t *testing.T, provider cache.ManifestCacheProvider) {
+	dgst := digest.Digest("sha256:cab1111111111111111111111111111111111111111111111111111111111111")
+
+	cache, err := provider.RepositoryScoped("foo/concurrent")
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped cache: %v", err)
+	}
+
+	// a tag cleared while it is read from the storage is not cached
+	for _, invalidate := range []func() error{
+		func() error { return cache.ClearTag(ctx, "latest") },
+		func() error { return cache.ClearManifest(ctx, dgst) },
+	} {
+		if err := fillTag(ctx, cache, "latest", dgst); err != nil {
+			t.Fatalf("error setting tag: %v", err)
+		}
+		if err := cache.ClearTag(ctx, "latest"); err != nil {
+			t.Fatalf("error clearing tag: %v", err)
+		}
+
+		_, version, err := cache.GetTag(ctx, "latest")
+		if err != (distribution.ErrTagUnknown{Tag: "latest"}) {
+			t.Fatalf("expected unknown tag error: %v", err)
+		}
+		if err := fillTag(ctx, cache, "latest", dgst); err != nil {
+			t.Fatalf("error setting tag: %v", err)
+		}
+		if err := invalidate(); err != nil {
+			t.Fatalf("error clearing: %v", err)
+		}
+		if err := cache.SetTag(ctx, "latest", dgst, version); err != nil {
+			t.Fatalf("error setting tag: %v", err)
+		}
+		if _, _, err := cache.GetTag(ctx, "latest"); err == nil {
+			t.Fatalf("expected tag cleared concurrently not to be cached")
+		}
+	}
+
+	// a tag which was not cleared meanwhile is cached
+	_, version, _ := cache.GetTag(ctx, "latest")
+	if err := cache.SetTag(ctx, "latest", dgst, version); err != nil {
+		t.Fatalf("error setting tag: %v", err)
+	}
+	if cached, _, err := cache.GetTag(ctx, "latest"); err != nil || cached != dgst {
+		t.Fatalf("expected tag to be cached: %v, %v", cached, err)
+	}
+}
+
+// CheckRepositoryIndex takes a repository index implementation through a
+// common set of operations.
+func CheckRepositoryIndex(t *testing.T, index cache.RepositoryIndex) {
+	ctx := context.Background()
+
+	if complete, err := index.Complete(ctx); err != nil || complete {
+		t.Fatalf("expected a new index not to be complete: %v, %v", complete, err)
+	}
+	repos := make([]string, 10)
+	if n, err := index.Repositories(ctx, repos, "", ""); n != 0 || err != io.EOF {
+		t.Fatalf("expected an empty index: %d, %v", n, err)
+	}
+
+	for _, name := range []string{"foo", "foo/bar", "foo-bar", "foo/bar/baz", "bar", "foo"} {
+		if err := index.Add(ctx, name); err != nil {
+			t.Fatalf("unexpected error adding %s: %v", name, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		last, prefix string
+		size         int
+		expected     []string
+		eof          bool
+	}{
+		{"", "", 10, []string{"bar", "foo", "foo/bar", "foo/bar/baz", "foo-bar"}, true},
+		{"", "", 2, []string{"bar", "foo"}, false},
+		{"foo", "", 2, []string{"foo/bar", "foo/bar/baz"}, false},
+		{"foo/bar/baz", "", 2, []string{"foo-bar"}, true},
+		{"", "foo/", 10, []string{"foo/bar", "foo/bar/baz"}, true},
+		{"", "foo", 10, []string{"foo", "foo/bar", "foo/bar/baz", "foo-bar"}, true},
+		{"foo/bar", "foo", 10, []string{"foo/bar/baz", "foo-bar"}, true},
+		{"bar", "foo-", 10, []string{"foo-bar"}, true},
+		{"zzz", "foo", 10, []string{}, true},
+		{"", "baz", 10, []string{}, true},
+	} {
+		repos := make([]string, tc.size)
+		n, err := index.Repositories(ctx, repos, tc.last, tc.prefix)
+		if tc.eof && err != io.EOF || !tc.eof && err != nil {
+			t.Fatalf("last %q, prefix %q: unexpected error: %v", tc.last, tc.prefix, err)
+		}
+		if !reflect.DeepEqual(repos[:n], tc.expected) {
+			t.Fatalf("last %q, prefix %q: expected %v, got %v", tc.last, tc.prefix, tc.expected, repos[:n])
+		}
+	}
+
+	if err := index.Remove(ctx, "foo/bar"); err != nil {
+		t.Fatalf("unexpected error removing repository: %v", err)
+	}
+	if err := index.Remove(ctx, "unknown"); err != nil {
+		t.Fatalf("unexpected error removing unknown repository: %v", err)
+	}
+	n, err := index.Repositories(ctx, repos, "", "")
+	if err != io.EOF || !reflect.DeepEqual(repos[:n], []string{"bar", "foo", "foo/bar/baz", "foo-bar"}) {
+		t.Fatalf("unexpected repositories after removal: %v, %v", repos[:n], err)
+	}
+
+	if err := index.SetComplete(ctx); err != nil {
+		t.Fatalf("unexpected error completing index: %v", err)
+	}
+	if complete, err := index.Complete(ctx); err != nil || !complete {
+		t.Fatalf("expected the index to be complete: %v, %v", complete, err)
+	}
+}
@@ -0,0 +1,148 @@
+package memory
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/cache"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/opencontainers/go-digest"
+)
+
+type tagCacheKey struct {
+	repo string
+	tag  string
+}
+
+type manifestCacheKey struct {
+	repo   string
+	digest digest.Digest
+}
+
+type inMemoryManifestCacheProvider struct {
+	lru *lru.ARCCache
+
+	// version is shared by all the tags, rather than kept per tag where the
+	// LRU could evict it. Clearing any tag only skips some concurrent fills.
+	mu      sync.Mutex
+	version cache.TagVersion
+}
+
+// NewInMemoryManifestCacheProvider returns a new LRU-based cache for storing
+// tag resolutions and manifest payloads. The size is the number of tags and
+// manifests kept.
+func NewInMemoryManifestCacheProvider(size int) cache.ManifestCacheProvider {
+	if size <= 0 {
+		size = math.MaxInt
+	}
+	lruCache, err := lru.NewARC(size)
+	if err != nil {
+		// NewARC can only fail if size is <= 0, so this unreachable
+		panic(err)
+	}
+	return &inMemoryManifestCacheProvider{
+		lru: lruCache,
+	}
+}
+
+func (immcp *inMemoryManifestCacheProvider) RepositoryScoped(repo string) (cache.ManifestCache, error) {
+	if _, err := reference.ParseNormalizedNamed(repo); err != nil {
+		return nil, err
+	}
+
+	return &repositoryScopedInMemoryManifestCache{
+		repo:   repo,
+		parent: immcp,
+	}, nil
+}
+
+// repositoryScopedInMemoryManifestCache provides the request scoped
+// repository cache. Instances are not thread-safe but the delegated
+// operations are.
+type repositoryScopedInMemoryManifestCache struct {
+	repo   string
+	parent *inMemoryManifestCacheProvider
+}
+
+func (rsimmc *repositoryScopedInMemoryManifestCache) GetTag(ctx context.Context, tag string) (digest.Digest, cache.TagVersion, error) {
+	rsimmc.parent.mu.Lock()
+	version := rsimmc.parent.version
+	rsimmc.parent.mu.Unlock()
+
+	if dgst, ok := rsimmc.parent.lru.Get(tagCacheKey{repo: rsimmc.repo, tag: tag}); ok {
+		if dgst, ok := dgst.(digest.Digest); ok {
+			return dgst, version, nil
+		}
+	}
+	return "", version, distribution.ErrTagUnknown{Tag: tag}
+}
+
+func (rsimmc *repositoryScopedInMemoryManifestCache) SetTag(ctx context.Context, tag string, dgst digest.Digest, version cache.TagVersion) error {
+	if err := dgst.Validate(); err != nil {
+		return err
+	}
+
+	rsimmc.parent.mu.Lock()
+	defer rsimmc.parent.mu.Unlock()
+	if version == rsimmc.parent.version {
+		rsimmc.parent.lru.Add(tagCacheKey{repo: rsimmc.repo, tag: tag}, dgst)
+	}
+	return nil
+}
+
+func (rsimmc *repositoryScopedInMemoryManifestCache) ClearTag(ctx context.Context, tag string) error {
+	rsimmc.parent.mu.Lock()
+	defer rsimmc.parent.mu.Unlock()
+	rsimmc.parent.lru.Remove(tagCacheKey{repo: rsimmc.repo, tag: tag})
+	rsimmc.parent.version++
+	return nil
+}
+
+func (rsimmc *repositoryScopedInMemoryManifestCache) GetManifest(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	if err := dgst.Validate(); err != nil {
+		return nil, err
+	}
+
+	if payload, ok := rsimmc.parent.lru.Get(manifestCacheKey{repo: rsimmc.repo, digest: dgst}); ok {
+		if payload, ok := payload.([]byte); ok {
+			return payload, nil
+		}
+	}
+	return nil, distribution.ErrBlobUnknown
+}
+
+func (rsimmc *repositoryScopedInMemoryManifestCache) SetManifest(ctx context.Context, dgst digest.Digest, payload []byte) error {
+	if err := dgst.Validate(); err != nil {
+		return err
+	}
+
+	rsimmc.parent.lru.Add(manifestCacheKey{repo: rsimmc.repo, digest: dgst}, payload)
+	return nil
+}
+
+func (rsimmc *repositoryScopedInMemoryManifestCache) ClearManifest(ctx context.Context, dgst digest.Digest) error {
+	if err := dgst.Validate(); err != nil {
+		return err
+	}
+
+	rsimmc.parent.lru.Remove(manifestCacheKey{repo: rsimmc.repo, digest: dgst})
+
+	// Manifests are deleted rarely enough for a scan of the cached tags to
+	// be cheaper than maintaining an index of the tags per manifest.
+	rsimmc.parent.mu.Lock()
+	defer rsimmc.parent.mu.Unlock()
+	rsimmc.parent.version++
+	for _, key := range rsimmc.parent.lru.Keys() {
+		key, ok := key.(tagCacheKey)
+		if !ok || key.repo != rsimmc.repo {
+			continue
+		}
+		if cached, ok := rsimmc.parent.lru.Peek(key); ok && cached == dgst {
+			rsimmc.parent.lru.Remove(key)
+		}
+	}
+	return nil
+}
@@ -11,3 +11,15 @@ import (
 func TestInMemoryBlobInfoCache(t *testing.T) {
 	cachecheck.CheckBlobDescriptorCache(t, NewInMemoryBlobDescriptorCacheProvider(UnlimitedSize))
 }
+
+// TestInMemoryManifestCache checks the in memory manifest cache is working
+// correctly.
+func TestInMemoryManifestCache(t *testing.T) {
+	cachecheck.CheckManifestCache(t, NewInMemoryManifestCacheProvider(UnlimitedSize))
+}
+
+// TestInMemoryRepositoryIndex checks the in memory repository index is
+// working correctly.
+func TestInMemoryRepositoryIndex(t *testing.T) {
+	cachecheck.CheckRepositoryIndex(t, NewInMemoryRepositoryIndex())
+}
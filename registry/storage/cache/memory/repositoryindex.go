@@ -0,0 +1,97 @@
+package memory
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/distribution/registry/storage/cache"
+)
+
+type inMemoryRepositoryIndex struct {
+	mu sync.RWMutex
+
+	// keys are the sorted index keys of the repositories
+	keys     []string
+	complete bool
+}
+
+// NewInMemoryRepositoryIndex returns a new repository index kept in memory.
+// It is lost when the registry stops, and is built again from the storage.
+func NewInMemoryRepositoryIndex() cache.RepositoryIndex {
+	return &inMemoryRepositoryIndex{}
+}
+
+// indexKey replaces the path separators of the name so that the keys sort
+// in catalog order.
+func indexKey(name string) string {
+	return strings.ReplaceAll(name, "/", "\x00")
+}
+
+func (imri *inMemoryRepositoryIndex) Add(ctx context.Context, name string) error {
+	key := indexKey(name)
+
+	imri.mu.Lock()
+	defer imri.mu.Unlock()
+
+	i := sort.SearchStrings(imri.keys, key)
+	if i < len(imri.keys) && imri.keys[i] == key {
+		return nil
+	}
+	imri.keys = append(imri.keys, "")
+	copy(imri.keys[i+1:], imri.keys[i:])
+	imri.keys[i] = key
+	return nil
+}
+
+func (imri *inMemoryRepositoryIndex) Remove(ctx context.Context, name string) error {
+	key := indexKey(name)
+
+	imri.mu.Lock()
+	defer imri.mu.Unlock()
+
+	i := sort.SearchStrings(imri.keys, key)
+	if i < len(imri.keys) && imri.keys[i] == key {
+		imri.keys = append(imri.keys[:i], imri.keys[i+1:]...)
+	}
+	return nil
+}
+
+func (imri *inMemoryRepositoryIndex) Repositories(ctx context.Context, repos []string, last, prefix string) (int, error) {
+	last, prefix = indexKey(last), indexKey(prefix)
+
+	imri.mu.RLock()
+	defer imri.mu.RUnlock()
+
+	i := sort.SearchStrings(imri.keys, prefix)
+	if last >= prefix {
+		i = sort.Search(len(imri.keys), func(i int) bool { return imri.keys[i] > last })
+	}
+
+	n := 0
+	for ; n < len(repos); i++ {
+		if i == len(imri.keys) || !strings.HasPrefix(imri.keys[i], prefix) {
+			return n, io.EOF
+		}
+		repos[n] = strings.ReplaceAll(imri.keys[i], "\x00", "/")
+		n++
+	}
+	return n, nil
+}
+
+func (imri *inMemoryRepositoryIndex) Complete(ctx context.Context) (bool, error) {
+	imri.mu.RLock()
+	defer imri.mu.RUnlock()
+
+	return imri.complete, nil
+}
+
+func (imri *inMemoryRepositoryIndex) SetComplete(ctx context.Context) error {
+	imri.mu.Lock()
+	defer imri.mu.Unlock()
+
+	imri.complete = true
+	return nil
+}
@@ -67,3 +67,73 @@ func (p *prometheusCacheProvider) RepositoryScoped(repo string) (distribution.Bl
 		p.latencyTimer,
 	}, nil
 }
+
+type prometheusManifestCacheProvider struct {
+	cache.ManifestCacheProvider
+	latencyTimer metrics.LabeledTimer
+}
+
+func NewPrometheusManifestCacheProvider(wrap cache.ManifestCacheProvider, name, help string) cache.ManifestCacheProvider {
+	return &prometheusManifestCacheProvider{
+		wrap,
+		prometheus.StorageNamespace.NewLabeledTimer(name, help, "operation"),
+	}
+}
+
+func (p *prometheusManifestCacheProvider) RepositoryScoped(repo string) (cache.ManifestCache, error) {
+	c, err := p.ManifestCacheProvider.RepositoryScoped(repo)
+	if err != nil {
+		return nil, err
+	}
+	return &prometheusManifestCache{
+		c,
+		p.latencyTimer,
+	}, nil
+}
+
+type prometheusManifestCache struct {
+	cache.ManifestCache
+	latencyTimer metrics.LabeledTimer
+}
+
+func (p *prometheusManifestCache) GetTag(ctx context.Context, tag string) (digest.Digest, cache.TagVersion, error) {
+	start := time.Now()
+	d, v, e := p.ManifestCache.GetTag(ctx, tag)
+	p.latencyTimer.WithValues("GetTag").UpdateSince(start)
+	return d, v, e
+}
+
+func (p *prometheusManifestCache) SetTag(ctx context.Context, tag string, dgst digest.Digest, version cache.TagVersion) error {
+	start := time.Now()
+	e := p.ManifestCache.SetTag(ctx, tag, dgst, version)
+	p.latencyTimer.WithValues("SetTag").UpdateSince(start)
+	return e
+}
+
+func (p *prometheusManifestCache) ClearTag(ctx context.Context, tag string) error {
+	start := time.Now()
+	e := p.ManifestCache.ClearTag(ctx, tag)
+	p.latencyTimer.WithValues("ClearTag").UpdateSince(start)
+	return e
+}
+
+func (p *prometheusManifestCache) GetManifest(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	start := time.Now()
+	b, e := p.ManifestCache.GetManifest(ctx, dgst)
+	p.latencyTimer.WithValues("GetManifest").UpdateSince(start)
+	return b, e
+}
+
+func (p *prometheusManifestCache) SetManifest(ctx context.Context, dgst digest.Digest, payload []byte) error {
+	start := time.Now()
+	e := p.ManifestCache.SetManifest(ctx, dgst, payload)
+	p.latencyTimer.WithValues("SetManifest").UpdateSince(start)
+	return e
+}
+
+func (p *prometheusManifestCache) ClearManifest(ctx context.Context, dgst digest.Digest) error {
+	start := time.Now()
+	e := p.ManifestCache.ClearManifest(ctx, dgst)
+	p.latencyTimer.WithValues("ClearManifest").UpdateSince(start)
+	return e
+}
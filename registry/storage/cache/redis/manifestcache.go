@@ -0,0 +1,207 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/cache"
+	"github.com/docker/distribution/registry/storage/cache/metrics"
+	"github.com/gomodule/redigo/redis"
+	"github.com/opencontainers/go-digest"
+)
+
+// redisManifestCacheProvider provides an implementation of
+// ManifestCacheProvider based on redis. The tags of a repository are stored in
+// a redis hash mapping each tag to the digest of its manifest, and the
+// payloads of the manifests in a key per manifest. A redis set per manifest
+// records the tags cached for it, so they can be cleared when the manifest is
+// deleted. A second hash counts the times each tag was cleared, the version
+// compared when the tag is cached.
+type redisManifestCacheProvider struct {
+	pool *redis.Pool
+}
+
+// NewRedisManifestCacheProvider returns a new redis-based
+// ManifestCacheProvider using the provided redis connection pool.
+func NewRedisManifestCacheProvider(pool *redis.Pool) cache.ManifestCacheProvider {
+	return metrics.NewPrometheusManifestCacheProvider(
+		&redisManifestCacheProvider{
+			pool: pool,
+		},
+		"manifest_cache_redis",
+		"Number of seconds taken by redis for the manifest cache",
+	)
+}
+
+// RepositoryScoped returns the scoped cache.
+func (rmcp *redisManifestCacheProvider) RepositoryScoped(repo string) (cache.ManifestCache, error) {
+	if _, err := reference.ParseNormalizedNamed(repo); err != nil {
+		return nil, err
+	}
+
+	return &repositoryScopedRedisManifestCache{
+		repo: repo,
+		pool: rmcp.pool,
+	}, nil
+}
+
+type repositoryScopedRedisManifestCache struct {
+	repo string
+	pool *redis.Pool
+}
+
+var _ cache.ManifestCache = &repositoryScopedRedisManifestCache{}
+
+// GetTag looks the tag and its version up in the hashes of the repository.
+func (rsrmc *repositoryScopedRedisManifestCache) GetTag(ctx context.Context, tag string) (digest.Digest, cache.TagVersion, error) {
+	conn := rsrmc.pool.Get()
+	defer conn.Close()
+
+	conn.Send("MULTI")
+	conn.Send("HGET", rsrmc.tagsHashKey(), tag)
+	conn.Send("HGET", rsrmc.tagVersionsHashKey(), tag)
+	reply, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return "", 0, err
+	}
+
+	version, err := redis.Int64(reply[1], nil)
+	if err != nil && err != redis.ErrNil {
+		return "", 0, err
+	}
+
+	dgst, err := redis.String(reply[0], nil)
+	if err != nil {
+		if err == redis.ErrNil {
+			return "", cache.TagVersion(version), distribution.ErrTagUnknown{Tag: tag}
+		}
+		return "", 0, err
+	}
+
+	return digest.Digest(dgst), cache.TagVersion(version), nil
+}
+
+// setTagScript caches the tag only if its version did not change, as the
+// version is incremented whenever the tag is cleared.
+var setTagScript = redis.NewScript(3, `
+if (redis.call("HGET", KEYS[2], ARGV[1]) or "0") ~= ARGV[3] then
+	return 0
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+redis.call("SADD", KEYS[3], ARGV[1])
+return 1
+`)
+
+func (rsrmc *repositoryScopedRedisManifestCache) SetTag(ctx context.Context, tag string, dgst digest.Digest, version cache.TagVersion) error {
+	if err := dgst.Validate(); err != nil {
+		return err
+	}
+
+	conn := rsrmc.pool.Get()
+	defer conn.Close()
+
+	_, err := setTagScript.Do(conn, rsrmc.tagsHashKey(), rsrmc.tagVersionsHashKey(), rsrmc.manifestTagSetKey(dgst), tag, dgst.String(), strconv.FormatInt(int64(version), 10))
+	return err
+}
+
+func (rsrmc *repositoryScopedRedisManifestCache) ClearTag(ctx context.Context, tag string) error {
+	conn := rsrmc.pool.Get()
+	defer conn.Close()
+
+	return rsrmc.clearTag(conn, tag)
+}
+
+// clearTag removes the tag from the tags hash and increments its version.
+func (rsrmc *repositoryScopedRedisManifestCache) clearTag(conn redis.Conn, tag string) error {
+	conn.Send("MULTI")
+	conn.Send("HDEL", rsrmc.tagsHashKey(), tag)
+	conn.Send("HINCRBY", rsrmc.tagVersionsHashKey(), tag, 1)
+	_, err := conn.Do("EXEC")
+	return err
+}
+
+func (rsrmc *repositoryScopedRedisManifestCache) GetManifest(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	if err := dgst.Validate(); err != nil {
+		return nil, err
+	}
+
+	conn := rsrmc.pool.Get()
+	defer conn.Close()
+
+	payload, err := redis.Bytes(conn.Do("GET", rsrmc.manifestKey(dgst)))
+	if err != nil {
+		if err == redis.ErrNil {
+			return nil, distribution.ErrBlobUnknown
+		}
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+func (rsrmc *repositoryScopedRedisManifestCache) SetManifest(ctx context.Context, dgst digest.Digest, payload []byte) error {
+	if err := dgst.Validate(); err != nil {
+		return err
+	}
+
+	conn := rsrmc.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", rsrmc.manifestKey(dgst), payload)
+	return err
+}
+
+// ClearManifest removes the payload of the manifest and the tags recorded
+// for it which still point to it.
+func (rsrmc *repositoryScopedRedisManifestCache) ClearManifest(ctx context.Context, dgst digest.Digest) error {
+	if err := dgst.Validate(); err != nil {
+		return err
+	}
+
+	conn := rsrmc.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("DEL", rsrmc.manifestKey(dgst)); err != nil {
+		return err
+	}
+
+	tags, err := redis.Strings(conn.Do("SMEMBERS", rsrmc.manifestTagSetKey(dgst)))
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		// the tag may have been moved to another manifest since
+		current, err := redis.String(conn.Do("HGET", rsrmc.tagsHashKey(), tag))
+		if err != nil && err != redis.ErrNil {
+			return err
+		}
+		if current != dgst.String() {
+			continue
+		}
+		if err := rsrmc.clearTag(conn, tag); err != nil {
+			return err
+		}
+	}
+
+	_, err = conn.Do("DEL", rsrmc.manifestTagSetKey(dgst))
+	return err
+}
+
+func (rsrmc *repositoryScopedRedisManifestCache) tagsHashKey() string {
+	return "repository::" + rsrmc.repo + "::tags"
+}
+
+func (rsrmc *repositoryScopedRedisManifestCache) tagVersionsHashKey() string {
+	return "repository::" + rsrmc.repo + "::tags::versions"
+}
+
+func (rsrmc *repositoryScopedRedisManifestCache) manifestKey(dgst digest.Digest) string {
+	return "repository::" + rsrmc.repo + "::manifests::" + dgst.String()
+}
+
+func (rsrmc *repositoryScopedRedisManifestCache) manifestTagSetKey(dgst digest.Digest) string {
+	return "repository::" + rsrmc.repo + "::manifests::" + dgst.String() + "::tags"
+}
@@ -19,6 +19,24 @@ func init() {
 // TestRedisLayerInfoCache exercises a live redis instance using the cache
 // implementation.
 func TestRedisBlobDescriptorCacheProvider(t *testing.T) {
+	cachecheck.CheckBlobDescriptorCache(t, NewRedisBlobDescriptorCacheProvider(newTestPool(t)))
+}
+
+// TestRedisManifestCacheProvider exercises a live redis instance using the
+// manifest cache implementation.
+func TestRedisManifestCacheProvider(t *testing.T) {
+	cachecheck.CheckManifestCache(t, NewRedisManifestCacheProvider(newTestPool(t)))
+}
+
+// TestRedisRepositoryIndex exercises a live redis instance using the
+// repository index implementation.
+func TestRedisRepositoryIndex(t *testing.T) {
+	cachecheck.CheckRepositoryIndex(t, NewRedisRepositoryIndex(newTestPool(t)))
+}
+
+// newTestPool returns a pool for the test instance of redis, after clearing
+// its database.
+func newTestPool(t *testing.T) *redis.Pool {
 	if redisAddr == "" {
 		// fallback to an environement variable
 		redisAddr = os.Getenv("TEST_REGISTRY_STORAGE_CACHE_REDIS_ADDR")
@@ -49,5 +67,5 @@ func TestRedisBlobDescriptorCacheProvider(t *testing.T) {
 	}
 	conn.Close()
 
-	cachecheck.CheckBlobDescriptorCache(t, NewRedisBlobDescriptorCacheProvider(pool))
+	return pool
 }
@@ -0,0 +1,109 @@
+package redis
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/registry/storage/cache"
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	repositoryIndexKey         = "catalog::repositories"
+	repositoryIndexCompleteKey = "catalog::complete"
+
+	// repositoryIndexTTL is the time after which the index is no longer
+	// complete, to be built again from the storage, which catches up with
+	// the repositories added or removed by other means than the registry.
+	repositoryIndexTTL = 24 * time.Hour
+)
+
+// redisRepositoryIndex provides an implementation of RepositoryIndex based on
+// redis. The repositories are the members of a sorted set whose scores are
+// all zero, so that they are sorted lexically and can be paged through with
+// ZRANGEBYLEX. The path separators of the names are replaced with the null
+// character, which sorts first, to keep the catalog order.
+type redisRepositoryIndex struct {
+	pool *redis.Pool
+}
+
+// NewRedisRepositoryIndex returns a new redis-based RepositoryIndex using the
+// provided redis connection pool. The index persists across restarts and is
+// shared by the registry instances using the same redis. It stays complete
+// for repositoryIndexTTL.
+func NewRedisRepositoryIndex(pool *redis.Pool) cache.RepositoryIndex {
+	return &redisRepositoryIndex{
+		pool: pool,
+	}
+}
+
+// indexMember returns the member of the sorted set of the repository.
+func indexMember(name string) string {
+	return strings.ReplaceAll(name, "/", "\x00")
+}
+
+func (rri *redisRepositoryIndex) Add(ctx context.Context, name string) error {
+	conn := rri.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("ZADD", repositoryIndexKey, 0, indexMember(name))
+	return err
+}
+
+func (rri *redisRepositoryIndex) Remove(ctx context.Context, name string) error {
+	conn := rri.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("ZREM", repositoryIndexKey, indexMember(name))
+	return err
+}
+
+func (rri *redisRepositoryIndex) Repositories(ctx context.Context, repos []string, last, prefix string) (int, error) {
+	last, prefix = indexMember(last), indexMember(prefix)
+
+	min := "-"
+	switch {
+	case last != "" && last >= prefix:
+		min = "(" + last
+	case prefix != "":
+		min = "[" + prefix
+	}
+	max := "+"
+	if prefix != "" {
+		// repository names are ASCII, and sort before \xff
+		max = "[" + prefix + "\xff"
+	}
+
+	conn := rri.pool.Get()
+	defer conn.Close()
+
+	members, err := redis.Strings(conn.Do("ZRANGEBYLEX", repositoryIndexKey, min, max, "LIMIT", 0, len(repos)))
+	if err != nil {
+		return 0, err
+	}
+
+	for i, member := range members {
+		repos[i] = strings.ReplaceAll(member, "\x00", "/")
+	}
+	if len(members) < len(repos) {
+		return len(members), io.EOF
+	}
+	return len(members), nil
+}
+
+func (rri *redisRepositoryIndex) Complete(ctx context.Context) (bool, error) {
+	conn := rri.pool.Get()
+	defer conn.Close()
+
+	return redis.Bool(conn.Do("EXISTS", repositoryIndexCompleteKey))
+}
+
+func (rri *redisRepositoryIndex) SetComplete(ctx context.Context) error {
+	conn := rri.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", repositoryIndexCompleteKey, 1, "EX", int64(repositoryIndexTTL.Seconds()))
+	return err
+}
@@ -7,14 +7,25 @@ import (
 	"path"
 	"strings"
 
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
 )
 
 // Returns a list, or partial list, of repositories in the registry.
 // Because it's a quite expensive operation, it should only be used when building up
 // an initial set of repositories.
 func (reg *registry) Repositories(ctx context.Context, repos []string, last string) (n int, err error) {
+	return reg.SearchRepositories(ctx, repos, last, distribution.RepositoryFilter{})
+}
+
+// SearchRepositories returns a list, or partial list, of the repositories
+// matching filter. The repositories are listed from the repository index once
+// it is complete, and by walking the storage otherwise, where the directories
+// which cannot hold repositories starting with the prefix are skipped.
+func (reg *registry) SearchRepositories(ctx context.Context, repos []string, last string, filter distribution.RepositoryFilter) (n int, err error) {
 	var finishedWalk bool
 	var foundRepos []string
 
@@ -22,14 +33,29 @@ func (reg *registry) Repositories(ctx context.Context, repos []string, last stri
 		return 0, errors.New("no space in slice")
 	}
 
+	if reg.repositoryIndex != nil {
+		complete, err := reg.repositoryIndex.Complete(ctx)
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("error checking the repository index, walking the storage: %v", err)
+		} else if complete {
+			return reg.searchRepositoryIndex(ctx, repos, last, filter)
+		}
+	}
+
 	root, err := pathFor(repositoriesRootPathSpec{})
 	if err != nil {
 		return 0, err
 	}
 
 	err = reg.blobStore.driver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() && !mayHoldPrefix(fileInfo.Path()[len(root)+1:], filter.Prefix) {
+			return driver.ErrSkipDir
+		}
+
 		err := handleRepository(fileInfo, root, last, func(repoPath string) error {
-			foundRepos = append(foundRepos, repoPath)
+			if matchesRepositoryFilter(repoPath, filter) {
+				foundRepos = append(foundRepos, repoPath)
+			}
 			return nil
 		})
 		if err != nil {
@@ -57,6 +83,121 @@ func (reg *registry) Repositories(ctx context.Context, repos []string, last stri
 	return n, err
 }
 
+// searchRepositoryIndex lists the repositories matching filter from the
+// repository index, which selects those starting with the prefix.
+func (reg *registry) searchRepositoryIndex(ctx context.Context, repos []string, last string, filter distribution.RepositoryFilter) (n int, err error) {
+	if filter.Search == "" {
+		return reg.repositoryIndex.Repositories(ctx, repos, last, filter.Prefix)
+	}
+
+	page := make([]string, len(repos))
+	for {
+		found, err := reg.repositoryIndex.Repositories(ctx, page, last, filter.Prefix)
+		for _, repo := range page[:found] {
+			if !matchesRepositoryFilter(repo, filter) {
+				continue
+			}
+			repos[n] = repo
+			n++
+			if n == len(repos) {
+				return n, nil
+			}
+		}
+		if err != nil {
+			return n, err
+		}
+		last = page[found-1]
+	}
+}
+
+// mayHoldPrefix returns whether the directory, relative to the repositories
+// root, may hold repositories whose name starts with prefix.
+func mayHoldPrefix(dir, prefix string) bool {
+	return strings.HasPrefix(dir, prefix) || strings.HasPrefix(prefix, dir+"/")
+}
+
+// matchesRepositoryFilter returns whether the repository is selected by
+// filter.
+func matchesRepositoryFilter(repo string, filter distribution.RepositoryFilter) bool {
+	return strings.HasPrefix(repo, filter.Prefix) && strings.Contains(repo, filter.Search)
+}
+
+// BuildRepositoryIndex adds the repositories of the storage to the repository
+// index of the registry, and records that the index is complete, so that the
+// catalog is listed from it. The indexed repositories missing from the
+// storage are removed. It does nothing if the registry has no repository
+// index, or if it is complete already. A repository removed while the index is
+// built may be listed until it is removed again.
+func BuildRepositoryIndex(ctx context.Context, ns distribution.Namespace) error {
+	reg, ok := ns.(*registry)
+	if !ok || reg.repositoryIndex == nil {
+		return nil
+	}
+
+	complete, err := reg.repositoryIndex.Complete(ctx)
+	if err != nil || complete {
+		return err
+	}
+
+	found := make(map[string]struct{})
+	err = reg.Enumerate(ctx, func(repo string) error {
+		found[repo] = struct{}{}
+		return reg.repositoryIndex.Add(ctx, repo)
+	})
+	if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+		return err
+	}
+	if err := reg.pruneRepositoryIndex(ctx, found); err != nil {
+		return err
+	}
+
+	dcontext.GetLogger(ctx).Infof("repository index built")
+	return reg.repositoryIndex.SetComplete(ctx)
+}
+
+// pruneRepositoryIndex removes from the repository index the repositories
+// which were not found in the storage, and which are still missing, rather
+// than created since they were looked for.
+func (reg *registry) pruneRepositoryIndex(ctx context.Context, found map[string]struct{}) error {
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	page := make([]string, 100)
+	last := ""
+	for {
+		n, err := reg.repositoryIndex.Repositories(ctx, page, last, "")
+		for _, repo := range page[:n] {
+			if _, ok := found[repo]; !ok {
+				missing = append(missing, repo)
+			}
+		}
+		if err == io.EOF || n == 0 {
+			break
+		} else if err != nil {
+			return err
+		}
+		last = page[n-1]
+	}
+
+	for _, repo := range missing {
+		_, err := reg.driver.Stat(ctx, path.Join(root, repo, "_manifests"))
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		dcontext.GetLogger(ctx).Infof("removing missing repository %s from the repository index", repo)
+		if err := reg.repositoryIndex.Remove(ctx, repo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Enumerate applies ingester to each repository
 func (reg *registry) Enumerate(ctx context.Context, ingester func(string) error) error {
 	root, err := pathFor(repositoriesRootPathSpec{})
@@ -71,14 +212,130 @@ func (reg *registry) Enumerate(ctx context.Context, ingester func(string) error)
 	return err
 }
 
-// Remove removes a repository from storage
+// Remove removes a repository from storage, along with its entries in the
+// caches, in the repository index and in the usage accounting. The blobs of
+// the repository are left to garbage collection.
 func (reg *registry) Remove(ctx context.Context, name reference.Named) error {
+	if !reg.deleteEnabled {
+		return distribution.ErrUnsupported
+	}
+
 	root, err := pathFor(repositoriesRootPathSpec{})
 	if err != nil {
 		return err
 	}
+
+	// the content is looked up before it goes away, to forget it afterwards
+	repo, err := reg.Repository(ctx, name)
+	if err != nil {
+		return err
+	}
+	content, err := repo.(*repository).removedContent(ctx)
+	if err != nil {
+		return err
+	}
+
 	repoDir := path.Join(root, name.Name())
-	return reg.driver.Delete(ctx, repoDir)
+	err = reg.driver.Delete(ctx, repoDir)
+
+	// the repository may be cached and indexed even when it is already gone
+	// from the storage
+	if forgetErr := repo.(*repository).forget(ctx, content); forgetErr != nil && err == nil {
+		err = forgetErr
+	}
+	return err
+}
+
+// removedRepository is the content of a repository being removed.
+type removedRepository struct {
+	tags      []string
+	manifests []digest.Digest
+	layers    []digest.Digest
+	usage     int64
+}
+
+// removedContent looks up the content of the repository which is cached or
+// accounted for.
+func (repo *repository) removedContent(ctx context.Context) (removedRepository, error) {
+	var content removedRepository
+	name := repo.Named().Name()
+
+	if repo.manifestCache != nil {
+		tags, err := repo.Tags(ctx).All(ctx)
+		if _, ok := err.(distribution.ErrRepositoryUnknown); err != nil && !ok {
+			return content, err
+		}
+		content.tags = tags
+	}
+
+	if repo.manifestCache != nil || repo.descriptorCache != nil {
+		manifests, err := repo.Manifests(ctx)
+		if err != nil {
+			return content, err
+		}
+		for _, enumerator := range []struct {
+			enumerator distribution.BlobEnumerator
+			digests    *[]digest.Digest
+		}{
+			{manifests.(distribution.ManifestEnumerator), &content.manifests},
+			{repo.Blobs(ctx).(distribution.BlobEnumerator), &content.layers},
+		} {
+			err := enumerator.enumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+				*enumerator.digests = append(*enumerator.digests, dgst)
+				return nil
+			})
+			if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+				return content, err
+			}
+		}
+	}
+
+	if repo.usage != nil {
+		usage, err := repo.usage.RepositoryUsage(ctx, name)
+		if err != nil {
+			return content, err
+		}
+		content.usage = usage
+	}
+
+	return content, nil
+}
+
+// forget removes the content of the removed repository from the caches, the
+// repository from the repository index, and its usage from the usage of its
+// namespaces. It returns the first error met, after trying everything.
+func (repo *repository) forget(ctx context.Context, content removedRepository) error {
+	var errs []error
+	name := repo.Named().Name()
+
+	if repo.manifestCache != nil {
+		for _, tag := range content.tags {
+			errs = append(errs, repo.manifestCache.ClearTag(ctx, tag))
+		}
+		for _, dgst := range content.manifests {
+			errs = append(errs, repo.manifestCache.ClearManifest(ctx, dgst))
+		}
+	}
+	if repo.descriptorCache != nil {
+		for _, dgst := range append(content.manifests, content.layers...) {
+			if err := repo.descriptorCache.Clear(ctx, dgst); err != distribution.ErrBlobUnknown {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if repo.registry.repositoryIndex != nil {
+		errs = append(errs, repo.registry.repositoryIndex.Remove(ctx, name))
+	}
+	if repo.usage != nil && content.usage != 0 {
+		errs = append(errs, repo.usage.add(ctx, name, -content.usage))
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // lessPath returns true if one path a is less than path b.
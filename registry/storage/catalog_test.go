@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"reflect"
 	"testing"
 
 	"github.com/docker/distribution"
@@ -194,6 +195,135 @@ func TestCatalogEnumerate(t *testing.T) {
 	}
 }
 
+// checkCatalogSearch lists the repositories of setupFS matching filters.
+func checkCatalogSearch(t *testing.T, ctx context.Context, registry distribution.Namespace) {
+	searcher := registry.(distribution.RepositorySearcher)
+
+	for _, tc := range []struct {
+		filter   distribution.RepositoryFilter
+		last     string
+		expected []string
+	}{
+		{distribution.RepositoryFilter{Prefix: "foo"}, "", []string{"foo/a", "foo/b", "foo/d/in", "foo-bar/a", "foo-bar/b"}},
+		{distribution.RepositoryFilter{Prefix: "foo/"}, "", []string{"foo/a", "foo/b", "foo/d/in"}},
+		{distribution.RepositoryFilter{Prefix: "foo/d/"}, "", []string{"foo/d/in"}},
+		{distribution.RepositoryFilter{Prefix: "foo"}, "foo/b", []string{"foo/d/in", "foo-bar/a", "foo-bar/b"}},
+		{distribution.RepositoryFilter{Search: "b"}, "", []string{"bar/c", "bar/d", "bar/e", "foo/b", "foo-bar/a", "foo-bar/b"}},
+		{distribution.RepositoryFilter{Search: "/b"}, "foo/a", []string{"foo/b", "foo-bar/b"}},
+		{distribution.RepositoryFilter{Prefix: "foo", Search: "in"}, "", []string{"foo/d/in"}},
+		{distribution.RepositoryFilter{Prefix: "baz"}, "", []string{}},
+	} {
+		p := make([]string, 50)
+		n, err := searcher.SearchRepositories(ctx, p, tc.last, tc.filter)
+		if err != io.EOF {
+			t.Errorf("%+v after %q: expected the end of the catalog, got %v", tc.filter, tc.last, err)
+		}
+		if !reflect.DeepEqual(p[:n], tc.expected) {
+			t.Errorf("%+v after %q: expected %v, got %v", tc.filter, tc.last, tc.expected, p[:n])
+		}
+	}
+
+	// paging through the matching repositories
+	p := make([]string, 2)
+	n, err := searcher.SearchRepositories(ctx, p, "", distribution.RepositoryFilter{Search: "b"})
+	if err != nil || !reflect.DeepEqual(p[:n], []string{"bar/c", "bar/d"}) {
+		t.Errorf("unexpected first page: %v, %v", p[:n], err)
+	}
+	n, err = searcher.SearchRepositories(ctx, p, "bar/e", distribution.RepositoryFilter{Search: "b"})
+	if err != nil || !reflect.DeepEqual(p[:n], []string{"foo/b", "foo-bar/a"}) {
+		t.Errorf("unexpected second page: %v, %v", p[:n], err)
+	}
+}
+
+func TestCatalogSearch(t *testing.T) {
+	env := setupFS(t)
+	checkCatalogSearch(t, env.ctx, env.registry)
+}
+
+func TestCatalogRepositoryIndex(t *testing.T) {
+	env := setupFS(t)
+	index := memory.NewInMemoryRepositoryIndex()
+	registry, err := NewRegistry(env.ctx, env.driver, RepositoryIndex(index), EnableDelete, EnableSchema1)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	// the repositories pushed before the index is built are added to it
+	makeRepo(env.ctx, t, "new", registry)
+	if err := BuildRepositoryIndex(env.ctx, registry); err != nil {
+		t.Fatalf("unexpected error building repository index: %v", err)
+	}
+	if complete, err := index.Complete(env.ctx); err != nil || !complete {
+		t.Fatalf("expected the repository index to be complete: %v, %v", complete, err)
+	}
+	if err := registry.(distribution.RepositoryRemover).Remove(env.ctx, mustNamed(t, "new")); err != nil {
+		t.Fatalf("unexpected error removing repository: %v", err)
+	}
+
+	// the catalog is listed from the index, whatever the storage holds
+	if err := env.driver.Delete(env.ctx, "/docker/registry/v2/repositories/test"); err != nil {
+		t.Fatalf("unexpected error deleting repository: %v", err)
+	}
+	p := make([]string, 50)
+	n, err := registry.Repositories(env.ctx, p, "")
+	if err != io.EOF || !reflect.DeepEqual(p[:n], env.expected) {
+		t.Fatalf("expected the indexed repositories %v, got %v, %v", env.expected, p[:n], err)
+	}
+	checkCatalogSearch(t, env.ctx, registry)
+
+	// the repositories pushed after the index is built are added to it
+	makeRepo(env.ctx, t, "foo/c", registry)
+	n, err = registry.(distribution.RepositorySearcher).SearchRepositories(env.ctx, p, "", distribution.RepositoryFilter{Prefix: "foo/"})
+	if err != io.EOF || !reflect.DeepEqual(p[:n], []string{"foo/a", "foo/b", "foo/c", "foo/d/in"}) {
+		t.Fatalf("expected the pushed repository to be indexed, got %v, %v", p[:n], err)
+	}
+}
+
+// TestCatalogRepositoryIndexPrune ensures that building the repository index
+// removes the repositories missing from the storage.
+func TestCatalogRepositoryIndexPrune(t *testing.T) {
+	env := setupFS(t)
+	index := memory.NewInMemoryRepositoryIndex()
+	registry, err := NewRegistry(env.ctx, env.driver, RepositoryIndex(index), EnableSchema1)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	// removed from the storage without the registry
+	if err := index.Add(env.ctx, "gone"); err != nil {
+		t.Fatal(err)
+	}
+	if err := BuildRepositoryIndex(env.ctx, registry); err != nil {
+		t.Fatalf("unexpected error building repository index: %v", err)
+	}
+	p := make([]string, 50)
+	n, err := registry.Repositories(env.ctx, p, "")
+	if err != io.EOF || !reflect.DeepEqual(p[:n], env.expected) {
+		t.Fatalf("expected the stored repositories %v, got %v, %v", env.expected, p[:n], err)
+	}
+}
+
+func TestCatalogRemoveDisabled(t *testing.T) {
+	env := setupFS(t)
+
+	err := env.registry.(distribution.RepositoryRemover).Remove(env.ctx, mustNamed(t, "test"))
+	if err != distribution.ErrUnsupported {
+		t.Fatalf("expected the removal to be unsupported without delete, got %v", err)
+	}
+	p := make([]string, 50)
+	if n, _ := env.registry.Repositories(env.ctx, p, ""); !reflect.DeepEqual(p[:n], env.expected) {
+		t.Fatalf("expected the repositories to be kept, got %v", p[:n])
+	}
+}
+
+func mustNamed(t *testing.T, name string) reference.Named {
+	named, err := reference.WithName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return named
+}
+
 func testEq(a, b []string, size int) bool {
 	for cnt := 0; cnt < size-1; cnt++ {
 		if a[cnt] != b[cnt] {
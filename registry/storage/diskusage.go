@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// RepositoryDiskUsage reports the number of bytes of the blobs referenced by
+// the manifests of a repository, including the manifests themselves.
+type RepositoryDiskUsage struct {
+	Name string `json:"name"`
+
+	// Exclusive is the number of bytes of the blobs which no other
+	// repository references, and which deleting the repository would free.
+	Exclusive int64 `json:"exclusive"`
+
+	// Shared is the number of bytes of the blobs which other repositories
+	// reference too.
+	Shared int64 `json:"shared"`
+
+	// Total is the sum of Exclusive and Shared.
+	Total int64 `json:"total"`
+}
+
+// DiskUsage reports the storage used by the repositories of a registry.
+type DiskUsage struct {
+	Repositories []RepositoryDiskUsage `json:"repositories"`
+
+	// Referenced is the sum of the totals of the repositories, the number of
+	// bytes the registry would store without sharing blobs.
+	Referenced int64 `json:"referenced"`
+
+	// Stored is the number of bytes of the distinct blobs referenced.
+	Stored int64 `json:"stored"`
+
+	// DedupRatio is Referenced divided by Stored, or 1 if nothing is stored.
+	DedupRatio float64 `json:"dedupRatio"`
+}
+
+// ComputeDiskUsage walks the manifests of the repositories of the registry
+// and reports the storage used by each repository, telling apart the blobs
+// only it references from those shared with other repositories. Blobs which
+// no manifest references, such as the layers left behind by interrupted
+// pushes, are not accounted for until garbage collection removes them.
+func ComputeDiskUsage(ctx context.Context, registry distribution.Namespace) (*DiskUsage, error) {
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+	statter := registry.BlobStatter()
+
+	var (
+		// referenced holds the blobs referenced by each repository
+		referenced = make(map[string]map[digest.Digest]struct{})
+		// refcounts counts the repositories referencing each blob
+		refcounts = make(map[digest.Digest]int)
+		sizes     = make(map[digest.Digest]int64)
+	)
+
+	// addBlob records a blob referenced by the repository, unless the
+	// registry does not store it, as is the case for foreign layers.
+	addBlob := func(repoName string, dgst digest.Digest) error {
+		blobs := referenced[repoName]
+		if _, ok := blobs[dgst]; ok {
+			return nil
+		}
+
+		if _, ok := sizes[dgst]; !ok {
+			desc, err := statter.Stat(ctx, dgst)
+			if err == distribution.ErrBlobUnknown {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to stat blob %s: %v", dgst, err)
+			}
+			sizes[dgst] = desc.Size
+		}
+
+		blobs[dgst] = struct{}{}
+		refcounts[dgst]++
+		return nil
+	}
+
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		referenced[repoName] = make(map[digest.Digest]struct{})
+
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+		}
+		repository, err := registry.Repository(ctx, named)
+		if err != nil {
+			return fmt.Errorf("failed to construct repository: %v", err)
+		}
+
+		manifestService, err := repository.Manifests(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to construct manifest service: %v", err)
+		}
+		manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+		if !ok {
+			return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+		}
+
+		err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+			manifest, err := manifestService.Get(ctx, dgst)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
+			}
+
+			if err := addBlob(repoName, dgst); err != nil {
+				return err
+			}
+			for _, descriptor := range manifest.References() {
+				if err := addBlob(repoName, descriptor.Digest); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		// a repository without manifests, as for the mark phase of
+		// garbage collection
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil
+		}
+		return err
+	})
+	// a registry without repositories
+	if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+		return nil, err
+	}
+
+	du := &DiskUsage{Repositories: make([]RepositoryDiskUsage, 0, len(referenced))}
+	for repoName, blobs := range referenced {
+		usage := RepositoryDiskUsage{Name: repoName}
+		for dgst := range blobs {
+			if refcounts[dgst] > 1 {
+				usage.Shared += sizes[dgst]
+			} else {
+				usage.Exclusive += sizes[dgst]
+			}
+		}
+		usage.Total = usage.Exclusive + usage.Shared
+
+		du.Repositories = append(du.Repositories, usage)
+		du.Referenced += usage.Total
+	}
+	sort.Slice(du.Repositories, func(i, j int) bool {
+		return du.Repositories[i].Name < du.Repositories[j].Name
+	})
+
+	for _, size := range sizes {
+		du.Stored += size
+	}
+	du.DedupRatio = 1
+	if du.Stored > 0 {
+		du.DedupRatio = float64(du.Referenced) / float64(du.Stored)
+	}
+
+	return du, nil
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestComputeDiskUsage(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New())
+
+	size := func(dgst digest.Digest) int64 {
+		desc, err := registry.BlobStatter().Stat(ctx, dgst)
+		if err != nil {
+			t.Fatalf("failed to stat blob %s: %v", dgst, err)
+		}
+		return desc.Size
+	}
+	imageSize := func(im image) int64 {
+		total := size(im.manifestDigest)
+		for _, descriptor := range im.manifest.References() {
+			total += size(descriptor.Digest)
+		}
+		return total
+	}
+
+	// the same image is pushed to two repositories
+	shared := uploadRandomSchema2Image(t, makeRepository(t, registry, "shared/first"))
+	for _, rs := range shared.layers {
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+	}
+	second := makeRepository(t, registry, "shared/second")
+	// push the empty config, which is not one of the layers
+	if _, err := testutil.MakeSchema2Manifest(second, nil); err != nil {
+		t.Fatalf("failed to make manifest: %v", err)
+	}
+	if dgst := uploadImage(t, second, image{manifest: shared.manifest, layers: shared.layers}); dgst != shared.manifestDigest {
+		t.Fatalf("expected the same manifest %s to be pushed, got %s", shared.manifestDigest, dgst)
+	}
+
+	// both images of this repository share the empty config of the others
+	exclusiveRepo := makeRepository(t, registry, "exclusive")
+	exclusive := []image{
+		uploadRandomSchema2Image(t, exclusiveRepo),
+		uploadRandomSchema2Image(t, exclusiveRepo),
+	}
+	exclusiveSize := imageSize(exclusive[0]) + imageSize(exclusive[1]) - size(exclusive[0].manifest.References()[0].Digest)
+
+	du, err := ComputeDiskUsage(ctx, registry)
+	if err != nil {
+		t.Fatalf("failed to compute disk usage: %v", err)
+	}
+
+	expected := []RepositoryDiskUsage{
+		{Name: "exclusive", Exclusive: exclusiveSize, Total: exclusiveSize},
+		{Name: "shared/first", Shared: imageSize(shared), Total: imageSize(shared)},
+		{Name: "shared/second", Shared: imageSize(shared), Total: imageSize(shared)},
+	}
+	if len(du.Repositories) != len(expected) {
+		t.Fatalf("expected %d repositories, got %+v", len(expected), du.Repositories)
+	}
+	for i, usage := range du.Repositories {
+		if usage != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], usage)
+		}
+	}
+
+	if expectedReferenced := exclusiveSize + 2*imageSize(shared); du.Referenced != expectedReferenced {
+		t.Errorf("expected %d bytes referenced, got %d", expectedReferenced, du.Referenced)
+	}
+	if expectedStored := exclusiveSize + imageSize(shared); du.Stored != expectedStored {
+		t.Errorf("expected %d bytes stored, got %d", expectedStored, du.Stored)
+	}
+	if expectedRatio := float64(du.Referenced) / float64(du.Stored); du.DedupRatio != expectedRatio || du.DedupRatio <= 1 {
+		t.Errorf("expected a dedup ratio of %f, got %f", expectedRatio, du.DedupRatio)
+	}
+}
+
+func TestComputeDiskUsageEmpty(t *testing.T) {
+	registry := createRegistry(t, inmemory.New())
+
+	du, err := ComputeDiskUsage(context.Background(), registry)
+	if err != nil {
+		t.Fatalf("failed to compute disk usage: %v", err)
+	}
+	if du.Stored != 0 || du.Referenced != 0 || du.DedupRatio != 1 {
+		t.Errorf("unexpected disk usage of an empty registry: %+v", du)
+	}
+}
@@ -45,7 +45,10 @@ import (
 	dcontext "github.com/docker/distribution/context"
 	prometheus "github.com/docker/distribution/metrics"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/tracing"
 	"github.com/docker/go-metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // storageAction is the metrics of blob related operations
@@ -91,10 +94,33 @@ func (base *Base) setDriverName(e error) error {
 	}
 }
 
+// startSpan starts the span of a storage action on path, as a child of the
+// span of ctx. The actions outside of a traced operation are not traced,
+// rather than each starting its own trace.
+func (base *Base) startSpan(ctx context.Context, action, path string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return tracing.StartSpan(ctx, "storage."+action,
+		attribute.String("storage.driver", base.Name()),
+		attribute.String("storage.path", path))
+}
+
+// traceError records the error on the span of the storage action and returns
+// it. Missing paths are expected by the callers, and are not recorded.
+func traceError(span trace.Span, err error) error {
+	if _, ok := err.(storagedriver.PathNotFoundError); ok {
+		return err
+	}
+	return tracing.RecordError(span, err)
+}
+
 // GetContent wraps GetContent of underlying storage driver.
 func (base *Base) GetContent(ctx context.Context, path string) ([]byte, error) {
 	ctx, done := dcontext.WithTrace(ctx)
 	defer done("%s.GetContent(%q)", base.Name(), path)
+	ctx, span := base.startSpan(ctx, "GetContent", path)
+	defer span.End()
 
 	if !storagedriver.PathRegexp.MatchString(path) {
 		return nil, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
@@ -103,20 +129,22 @@ func (base *Base) GetContent(ctx context.Context, path string) ([]byte, error) {
 	start := time.Now()
 	b, e := base.StorageDriver.GetContent(ctx, path)
 	storageAction.WithValues(base.Name(), "GetContent").UpdateSince(start)
-	return b, base.setDriverName(e)
+	return b, traceError(span, base.setDriverName(e))
 }
 
 // PutContent wraps PutContent of underlying storage driver.
 func (base *Base) PutContent(ctx context.Context, path string, content []byte) error {
 	ctx, done := dcontext.WithTrace(ctx)
 	defer done("%s.PutContent(%q)", base.Name(), path)
+	ctx, span := base.startSpan(ctx, "PutContent", path)
+	defer span.End()
 
 	if !storagedriver.PathRegexp.MatchString(path) {
 		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
 	start := time.Now()
-	err := base.setDriverName(base.StorageDriver.PutContent(ctx, path, content))
+	err := traceError(span, base.setDriverName(base.StorageDriver.PutContent(ctx, path, content)))
 	storageAction.WithValues(base.Name(), "PutContent").UpdateSince(start)
 	return err
 }
@@ -125,6 +153,8 @@ func (base *Base) PutContent(ctx context.Context, path string, content []byte) e
 func (base *Base) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
 	ctx, done := dcontext.WithTrace(ctx)
 	defer done("%s.Reader(%q, %d)", base.Name(), path, offset)
+	ctx, span := base.startSpan(ctx, "Reader", path)
+	defer span.End()
 
 	if offset < 0 {
 		return nil, storagedriver.InvalidOffsetError{Path: path, Offset: offset, DriverName: base.StorageDriver.Name()}
@@ -135,26 +165,30 @@ func (base *Base) Reader(ctx context.Context, path string, offset int64) (io.Rea
 	}
 
 	rc, e := base.StorageDriver.Reader(ctx, path, offset)
-	return rc, base.setDriverName(e)
+	return rc, traceError(span, base.setDriverName(e))
 }
 
 // Writer wraps Writer of underlying storage driver.
 func (base *Base) Writer(ctx context.Context, path string, append bool) (storagedriver.FileWriter, error) {
 	ctx, done := dcontext.WithTrace(ctx)
 	defer done("%s.Writer(%q, %v)", base.Name(), path, append)
+	ctx, span := base.startSpan(ctx, "Writer", path)
+	defer span.End()
 
 	if !storagedriver.PathRegexp.MatchString(path) {
 		return nil, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
 	writer, e := base.StorageDriver.Writer(ctx, path, append)
-	return writer, base.setDriverName(e)
+	return writer, traceError(span, base.setDriverName(e))
 }
 
 // Stat wraps Stat of underlying storage driver.
 func (base *Base) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
 	ctx, done := dcontext.WithTrace(ctx)
 	defer done("%s.Stat(%q)", base.Name(), path)
+	ctx, span := base.startSpan(ctx, "Stat", path)
+	defer span.End()
 
 	if !storagedriver.PathRegexp.MatchString(path) && path != "/" {
 		return nil, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
@@ -163,13 +197,15 @@ func (base *Base) Stat(ctx context.Context, path string) (storagedriver.FileInfo
 	start := time.Now()
 	fi, e := base.StorageDriver.Stat(ctx, path)
 	storageAction.WithValues(base.Name(), "Stat").UpdateSince(start)
-	return fi, base.setDriverName(e)
+	return fi, traceError(span, base.setDriverName(e))
 }
 
 // List wraps List of underlying storage driver.
 func (base *Base) List(ctx context.Context, path string) ([]string, error) {
 	ctx, done := dcontext.WithTrace(ctx)
 	defer done("%s.List(%q)", base.Name(), path)
+	ctx, span := base.startSpan(ctx, "List", path)
+	defer span.End()
 
 	if !storagedriver.PathRegexp.MatchString(path) && path != "/" {
 		return nil, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
@@ -178,13 +214,15 @@ func (base *Base) List(ctx context.Context, path string) ([]string, error) {
 	start := time.Now()
 	str, e := base.StorageDriver.List(ctx, path)
 	storageAction.WithValues(base.Name(), "List").UpdateSince(start)
-	return str, base.setDriverName(e)
+	return str, traceError(span, base.setDriverName(e))
 }
 
 // Move wraps Move of underlying storage driver.
 func (base *Base) Move(ctx context.Context, sourcePath string, destPath string) error {
 	ctx, done := dcontext.WithTrace(ctx)
 	defer done("%s.Move(%q, %q", base.Name(), sourcePath, destPath)
+	ctx, span := base.startSpan(ctx, "Move", sourcePath)
+	defer span.End()
 
 	if !storagedriver.PathRegexp.MatchString(sourcePath) {
 		return storagedriver.InvalidPathError{Path: sourcePath, DriverName: base.StorageDriver.Name()}
@@ -193,7 +231,7 @@ func (base *Base) Move(ctx context.Context, sourcePath string, destPath string)
 	}
 
 	start := time.Now()
-	err := base.setDriverName(base.StorageDriver.Move(ctx, sourcePath, destPath))
+	err := traceError(span, base.setDriverName(base.StorageDriver.Move(ctx, sourcePath, destPath)))
 	storageAction.WithValues(base.Name(), "Move").UpdateSince(start)
 	return err
 }
@@ -202,13 +240,15 @@ func (base *Base) Move(ctx context.Context, sourcePath string, destPath string)
 func (base *Base) Delete(ctx context.Context, path string) error {
 	ctx, done := dcontext.WithTrace(ctx)
 	defer done("%s.Delete(%q)", base.Name(), path)
+	ctx, span := base.startSpan(ctx, "Delete", path)
+	defer span.End()
 
 	if !storagedriver.PathRegexp.MatchString(path) {
 		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
 	start := time.Now()
-	err := base.setDriverName(base.StorageDriver.Delete(ctx, path))
+	err := traceError(span, base.setDriverName(base.StorageDriver.Delete(ctx, path)))
 	storageAction.WithValues(base.Name(), "Delete").UpdateSince(start)
 	return err
 }
@@ -217,6 +257,8 @@ func (base *Base) Delete(ctx context.Context, path string) error {
 func (base *Base) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
 	ctx, done := dcontext.WithTrace(ctx)
 	defer done("%s.URLFor(%q)", base.Name(), path)
+	ctx, span := base.startSpan(ctx, "URLFor", path)
+	defer span.End()
 
 	if !storagedriver.PathRegexp.MatchString(path) {
 		return "", storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
@@ -225,17 +267,19 @@ func (base *Base) URLFor(ctx context.Context, path string, options map[string]in
 	start := time.Now()
 	str, e := base.StorageDriver.URLFor(ctx, path, options)
 	storageAction.WithValues(base.Name(), "URLFor").UpdateSince(start)
-	return str, base.setDriverName(e)
+	return str, traceError(span, base.setDriverName(e))
 }
 
 // Walk wraps Walk of underlying storage driver.
 func (base *Base) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
 	ctx, done := dcontext.WithTrace(ctx)
 	defer done("%s.Walk(%q)", base.Name(), path)
+	ctx, span := base.startSpan(ctx, "Walk", path)
+	defer span.End()
 
 	if !storagedriver.PathRegexp.MatchString(path) && path != "/" {
 		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
-	return base.setDriverName(base.StorageDriver.Walk(ctx, path, f))
+	return traceError(span, base.setDriverName(base.StorageDriver.Walk(ctx, path, f)))
 }
@@ -0,0 +1,40 @@
+package base_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/tracing"
+	"github.com/docker/distribution/tracing/tracingtest"
+)
+
+// TestTracing ensures that the storage actions are traced as part of a traced
+// operation only.
+func TestTracing(t *testing.T) {
+	recorder, restore := tracingtest.Record()
+	defer restore()
+
+	driver := inmemory.New()
+	ctx := context.Background()
+	if err := driver.PutContent(ctx, "/content", []byte("content")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Fatalf("expected no span outside of a traced operation, got %d", len(spans))
+	}
+
+	ctx, parent := tracing.StartSpan(ctx, "parent")
+	if _, err := driver.GetContent(ctx, "/content"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected a storage and a parent span, got %d spans", len(spans))
+	}
+	if spans[0].Name() != "storage.GetContent" || spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("expected the span %s to be a child of the parent span", spans[0].Name())
+	}
+}
@@ -13,6 +13,7 @@ import (
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/registry/storage/driver/base"
 	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/docker/distribution/registry/storage/driver/signedurl"
 )
 
 const (
@@ -31,6 +32,10 @@ const (
 type DriverParameters struct {
 	RootDirectory string
 	MaxThreads    uint64
+
+	// SignedURLs issues the URLs returned by URLFor, which is unsupported
+	// if nil.
+	SignedURLs *signedurl.Signer
 }
 
 func init() {
@@ -46,6 +51,7 @@ func (factory *filesystemDriverFactory) Create(parameters map[string]interface{}
 
 type driver struct {
 	rootDirectory string
+	signedURLs    *signedurl.Signer
 }
 
 type baseEmbed struct {
@@ -62,6 +68,7 @@ type Driver struct {
 // Optional Parameters:
 // - rootdirectory
 // - maxthreads
+// - signedurl
 func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 	params, err := fromParametersImpl(parameters)
 	if err != nil || params == nil {
@@ -75,6 +82,7 @@ func fromParametersImpl(parameters map[string]interface{}) (*DriverParameters, e
 		err           error
 		maxThreads    = defaultMaxThreads
 		rootDirectory = defaultRootDirectory
+		signedURLs    *signedurl.Signer
 	)
 
 	if parameters != nil {
@@ -86,18 +94,24 @@ func fromParametersImpl(parameters map[string]interface{}) (*DriverParameters, e
 		if err != nil {
 			return nil, fmt.Errorf("maxthreads config error: %s", err.Error())
 		}
+
+		signedURLs, err = signedurl.FromDriverParameters(parameters)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	params := &DriverParameters{
 		RootDirectory: rootDirectory,
 		MaxThreads:    maxThreads,
+		SignedURLs:    signedURLs,
 	}
 	return params, nil
 }
 
 // New constructs a new Driver with a given rootDirectory
 func New(params DriverParameters) *Driver {
-	fsDriver := &driver{rootDirectory: params.RootDirectory}
+	fsDriver := &driver{rootDirectory: params.RootDirectory, signedURLs: params.SignedURLs}
 
 	return &Driver{
 		baseEmbed: baseEmbed{
@@ -282,10 +296,14 @@ func (d *driver) Delete(ctx context.Context, subPath string) error {
 	return err
 }
 
-// URLFor returns a URL which may be used to retrieve the content stored at the given path.
-// May return an UnsupportedMethodErr in certain StorageDriver implementations.
+// URLFor returns a signed URL which may be used to retrieve the content
+// stored at the given path, if the driver is configured to issue them.
+// Returns an UnsupportedMethodErr otherwise.
 func (d *driver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
-	return "", storagedriver.ErrUnsupportedMethod{}
+	if d.signedURLs == nil {
+		return "", storagedriver.ErrUnsupportedMethod{}
+	}
+	return d.signedURLs.URLFor(path, options)
 }
 
 // Walk traverses a filesystem defined within driver, starting
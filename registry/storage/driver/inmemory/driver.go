@@ -10,6 +10,7 @@ import (
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/registry/storage/driver/base"
 	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/docker/distribution/registry/storage/driver/signedurl"
 )
 
 const driverName = "inmemory"
@@ -22,12 +23,17 @@ func init() {
 type inMemoryDriverFactory struct{}
 
 func (factory *inMemoryDriverFactory) Create(parameters map[string]interface{}) (storagedriver.StorageDriver, error) {
-	return New(), nil
+	signedURLs, err := signedurl.FromDriverParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	return newDriver(signedURLs), nil
 }
 
 type driver struct {
-	root  *dir
-	mutex sync.RWMutex
+	root       *dir
+	mutex      sync.RWMutex
+	signedURLs *signedurl.Signer
 }
 
 // baseEmbed allows us to hide the Base embed.
@@ -45,6 +51,12 @@ var _ storagedriver.StorageDriver = &Driver{}
 
 // New constructs a new Driver.
 func New() *Driver {
+	return newDriver(nil)
+}
+
+// newDriver constructs a new Driver issuing the URLs returned by URLFor
+// with signedURLs, if set.
+func newDriver(signedURLs *signedurl.Signer) *Driver {
 	return &Driver{
 		baseEmbed: baseEmbed{
 			Base: base.Base{
@@ -55,6 +67,7 @@ func New() *Driver {
 							mod: time.Now(),
 						},
 					},
+					signedURLs: signedURLs,
 				},
 			},
 		},
@@ -236,10 +249,14 @@ func (d *driver) Delete(ctx context.Context, path string) error {
 	}
 }
 
-// URLFor returns a URL which may be used to retrieve the content stored at the given path.
-// May return an UnsupportedMethodErr in certain StorageDriver implementations.
+// URLFor returns a signed URL which may be used to retrieve the content
+// stored at the given path, if the driver is configured to issue them.
+// Returns an UnsupportedMethodErr otherwise.
 func (d *driver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
-	return "", storagedriver.ErrUnsupportedMethod{}
+	if d.signedURLs == nil {
+		return "", storagedriver.ErrUnsupportedMethod{}
+	}
+	return d.signedURLs.URLFor(path, options)
 }
 
 // Walk traverses a filesystem defined within driver, starting
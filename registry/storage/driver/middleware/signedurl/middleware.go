@@ -0,0 +1,55 @@
+// Package middleware provides a storage middleware which makes the storage
+// driver return URLs to the blob download route of the registry, signed
+// with its HTTP secret and valid for a limited time, for any storage driver.
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+	"github.com/docker/distribution/registry/storage/driver/signedurl"
+)
+
+type signedURLStorageMiddleware struct {
+	storagedriver.StorageDriver
+	signer *signedurl.Signer
+}
+
+var _ storagedriver.StorageDriver = &signedURLStorageMiddleware{}
+
+// newSignedURLStorageMiddleware constructs a storage middleware issuing
+// signed URLs.
+//
+// Required options:
+//
+//   - baseurl
+//
+// Optional options:
+//
+//   - duration
+func newSignedURLStorageMiddleware(sd storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	if _, ok := options["baseurl"]; !ok {
+		return nil, fmt.Errorf("no baseurl provided")
+	}
+	signer, err := signedurl.FromParameters(options)
+	if err != nil {
+		return nil, err
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("no http secret provided")
+	}
+
+	return &signedURLStorageMiddleware{StorageDriver: sd, signer: signer}, nil
+}
+
+// URLFor returns a signed URL to the blob download route of the registry,
+// rather than a URL of the storage backend.
+func (s *signedURLStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	return s.signer.URLFor(path, options)
+}
+
+func init() {
+	storagemiddleware.Register("signedurl", newSignedURLStorageMiddleware)
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/registry/storage/driver/signedurl"
+)
+
+func TestSignedURLMiddleware(t *testing.T) {
+	if _, err := newSignedURLStorageMiddleware(inmemory.New(), map[string]interface{}{
+		signedurl.SecretParameter: "secret",
+	}); err == nil {
+		t.Fatal("expected error without baseurl")
+	}
+	if _, err := newSignedURLStorageMiddleware(inmemory.New(), map[string]interface{}{
+		"baseurl": "https://cdn.example.com/v2/_blobs",
+	}); err == nil {
+		t.Fatal("expected error without http secret")
+	}
+
+	middleware, err := newSignedURLStorageMiddleware(inmemory.New(), map[string]interface{}{
+		"baseurl":                 "https://cdn.example.com/v2/_blobs",
+		signedurl.SecretParameter: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := middleware.URLFor(context.Background(), "/foo/data", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "cdn.example.com" || u.Path != "/v2/_blobs/foo/data" {
+		t.Fatalf("unexpected signed url %s", signed)
+	}
+}
@@ -0,0 +1,208 @@
+// Package signedurl issues and verifies time-limited URLs to download the
+// content stored at a storage driver path, for drivers which cannot issue
+// such URLs themselves.
+//
+// A signed URL is the base URL of the blob download route followed by the
+// driver path, with two query parameters: "expires", the Unix time at which
+// the URL expires, and "signature", the unpadded base64url encoding of the
+// HMAC-SHA256 of the driver path, a newline and the "expires" value, keyed
+// with the HTTP secret of the registry. The registry serves the route itself,
+// but any server sharing the secret, such as a sidecar behind a CDN, can
+// verify the URLs with Verify.
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+const (
+	// DefaultDuration is the time for which the URLs are valid, unless
+	// configured otherwise.
+	DefaultDuration = 20 * time.Minute
+
+	// ExpiresParam is the query parameter holding the expiration time of a
+	// signed URL.
+	ExpiresParam = "expires"
+
+	// SignatureParam is the query parameter holding the signature of a
+	// signed URL.
+	SignatureParam = "signature"
+
+	// SecretParameter is the driver parameter, and storage middleware
+	// option, under which the registry provides its HTTP secret.
+	SecretParameter = "httpsecret"
+)
+
+var (
+	// ErrInvalidSignature is returned when verifying a URL without a valid
+	// signature.
+	ErrInvalidSignature = errors.New("signedurl: invalid signature")
+
+	// ErrExpired is returned when verifying a URL which expired.
+	ErrExpired = errors.New("signedurl: url expired")
+)
+
+// Signer issues signed URLs for driver paths.
+type Signer struct {
+	baseURL  *url.URL
+	secret   []byte
+	duration time.Duration
+}
+
+// New returns a Signer issuing URLs under baseURL, valid for duration.
+// baseURL may omit the scheme and host, for URLs served by the registry
+// itself.
+func New(baseURL string, secret string, duration time.Duration) (*Signer, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("no baseurl provided")
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse signedurl baseurl: %s", baseURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("signedurl baseurl must not have a query or fragment: %s", baseURL)
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("no secret provided")
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("signedurl duration must be positive")
+	}
+
+	return &Signer{baseURL: u, secret: []byte(secret), duration: duration}, nil
+}
+
+// FromParameters returns a Signer configured by the "baseurl" and "duration"
+// parameters, signing with the secret provided by the registry. It returns
+// nil if the secret is not provided, as is the case when the storage is used
+// by tools which do not serve blobs.
+func FromParameters(parameters map[string]interface{}) (*Signer, error) {
+	secret, _ := parameters[SecretParameter].(string)
+	if secret == "" {
+		return nil, nil
+	}
+
+	baseURL, ok := parameters["baseurl"].(string)
+	if !ok {
+		return nil, fmt.Errorf("baseurl must be a string")
+	}
+
+	duration := DefaultDuration
+	if d, ok := parameters["duration"]; ok {
+		switch d := d.(type) {
+		case time.Duration:
+			duration = d
+		case string:
+			dur, err := time.ParseDuration(d)
+			if err != nil {
+				return nil, fmt.Errorf("invalid duration: %s", err)
+			}
+			duration = dur
+		default:
+			return nil, fmt.Errorf("invalid duration: %v", d)
+		}
+	}
+
+	return New(baseURL, secret, duration)
+}
+
+// FromDriverParameters returns a Signer configured by the "signedurl"
+// parameter of a storage driver, or nil if it is not set.
+func FromDriverParameters(parameters map[string]interface{}) (*Signer, error) {
+	if parameters == nil {
+		return nil, nil
+	}
+	raw, ok := parameters["signedurl"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	options := make(map[string]interface{})
+	switch raw := raw.(type) {
+	case map[string]interface{}:
+		for k, v := range raw {
+			options[k] = v
+		}
+	case map[interface{}]interface{}:
+		for k, v := range raw {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("signedurl: invalid parameter %v", k)
+			}
+			options[key] = v
+		}
+	default:
+		return nil, fmt.Errorf("signedurl parameter must be a map, got %T", raw)
+	}
+	options[SecretParameter] = parameters[SecretParameter]
+
+	signer, err := FromParameters(options)
+	if err != nil {
+		return nil, fmt.Errorf("signedurl: %s", err)
+	}
+	return signer, nil
+}
+
+// URLFor returns a signed URL to download the content stored at the driver
+// path. Only the GET and HEAD methods are supported, and the "expiry" option
+// overrides the configured duration, as for the storage drivers.
+func (s *Signer) URLFor(driverPath string, options map[string]interface{}) (string, error) {
+	if method, ok := options["method"]; ok {
+		methodString, ok := method.(string)
+		if !ok || (methodString != http.MethodGet && methodString != http.MethodHead) {
+			return "", storagedriver.ErrUnsupportedMethod{}
+		}
+	}
+
+	expires := time.Now().Add(s.duration)
+	if et, ok := options["expiry"].(time.Time); ok {
+		expires = et
+	}
+
+	u := *s.baseURL
+	u.Path = path.Join(u.Path, driverPath)
+	u.RawPath = ""
+	u.RawQuery = url.Values{
+		ExpiresParam:   {strconv.FormatInt(expires.Unix(), 10)},
+		SignatureParam: {sign(s.secret, driverPath, expires.Unix())},
+	}.Encode()
+
+	return u.String(), nil
+}
+
+// Verify checks that the query parameters of a URL sign the driver path with
+// the secret, and that the URL has not expired at now.
+func Verify(secret string, driverPath string, query url.Values, now time.Time) error {
+	expires, err := strconv.ParseInt(query.Get(ExpiresParam), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	signature := query.Get(SignatureParam)
+	if !hmac.Equal([]byte(signature), []byte(sign([]byte(secret), driverPath, expires))) {
+		return ErrInvalidSignature
+	}
+
+	if now.Unix() >= expires {
+		return ErrExpired
+	}
+	return nil
+}
+
+func sign(secret []byte, driverPath string, expires int64) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(driverPath + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,115 @@
+package signedurl
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	signer, err := New("https://cdn.example.com/v2/_blobs", "secret", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	driverPath := "/docker/registry/v2/blobs/sha256/ab/abcd/data"
+	signed, err := signer.URLFor(driverPath, map[string]interface{}{"method": http.MethodGet})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "cdn.example.com" || u.Path != "/v2/_blobs"+driverPath {
+		t.Fatalf("unexpected signed url %s", signed)
+	}
+
+	now := time.Now()
+	if err := Verify("secret", driverPath, u.Query(), now); err != nil {
+		t.Fatalf("unexpected error verifying signed url: %v", err)
+	}
+	if err := Verify("other", driverPath, u.Query(), now); err != ErrInvalidSignature {
+		t.Fatalf("expected invalid signature with another secret, got %v", err)
+	}
+	if err := Verify("secret", driverPath+"x", u.Query(), now); err != ErrInvalidSignature {
+		t.Fatalf("expected invalid signature for another path, got %v", err)
+	}
+	if err := Verify("secret", driverPath, u.Query(), now.Add(2*time.Minute)); err != ErrExpired {
+		t.Fatalf("expected expired url, got %v", err)
+	}
+
+	query := u.Query()
+	query.Set(ExpiresParam, query.Get(ExpiresParam)+"0")
+	if err := Verify("secret", driverPath, query, now); err != ErrInvalidSignature {
+		t.Fatalf("expected invalid signature with another expiration, got %v", err)
+	}
+
+	expiry := now.Add(time.Hour)
+	signed, err = signer.URLFor(driverPath, map[string]interface{}{"expiry": expiry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ = url.Parse(signed)
+	if err := Verify("secret", driverPath, u.Query(), now.Add(30*time.Minute)); err != nil {
+		t.Fatalf("expected the expiry option to be honored, got %v", err)
+	}
+
+	_, err = signer.URLFor(driverPath, map[string]interface{}{"method": http.MethodPut})
+	if _, ok := err.(storagedriver.ErrUnsupportedMethod); !ok {
+		t.Fatalf("expected unsupported method, got %v", err)
+	}
+}
+
+func TestFromDriverParameters(t *testing.T) {
+	signer, err := FromDriverParameters(map[string]interface{}{
+		"rootdirectory": "/var/lib/registry",
+	})
+	if err != nil || signer != nil {
+		t.Fatalf("expected no signer without signedurl parameter, got %v, %v", signer, err)
+	}
+
+	// tools using the storage without serving blobs do not provide a secret
+	signer, err = FromDriverParameters(map[string]interface{}{
+		"signedurl": map[interface{}]interface{}{"baseurl": "/v2/_blobs"},
+	})
+	if err != nil || signer != nil {
+		t.Fatalf("expected no signer without secret, got %v, %v", signer, err)
+	}
+
+	signer, err = FromDriverParameters(map[string]interface{}{
+		"signedurl":     map[interface{}]interface{}{"baseurl": "/v2/_blobs", "duration": "5m"},
+		SecretParameter: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.duration != 5*time.Minute {
+		t.Fatalf("unexpected duration %v", signer.duration)
+	}
+	signed, err := signer.URLFor("/foo/data", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(signed, "/v2/_blobs/foo/data?") {
+		t.Fatalf("unexpected signed url %s", signed)
+	}
+
+	for _, invalid := range []interface{}{
+		"/v2/_blobs",
+		map[interface{}]interface{}{},
+		map[interface{}]interface{}{"baseurl": "/v2/_blobs", "duration": "soon"},
+		map[interface{}]interface{}{"baseurl": "/v2/_blobs?foo=bar"},
+	} {
+		if _, err := FromDriverParameters(map[string]interface{}{
+			"signedurl":     invalid,
+			SecretParameter: "secret",
+		}); err == nil {
+			t.Errorf("expected error for signedurl parameter %v", invalid)
+		}
+	}
+}
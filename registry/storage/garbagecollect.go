@@ -3,8 +3,11 @@ package storage
 import (
 	"context"
 	"fmt"
+	"path"
+	"time"
 
 	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
 	"github.com/docker/distribution/manifest/schema2"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/driver"
@@ -19,14 +22,36 @@ func emit(format string, a ...interface{}) {
 type GCOpts struct {
 	DryRun         bool
 	RemoveUntagged bool
+
+	// GracePeriod allows the collection to run while the registry accepts
+	// writes. Manifests, blobs and repository links written within the grace
+	// period before or at any time after the collection started are never
+	// removed: each manifest and blob is checked again right before it is
+	// deleted. When zero, the registry must be read-only or stopped.
+	GracePeriod time.Duration
+
+	// Logger, if set, receives progress output at debug level in place of
+	// standard output.
+	Logger dcontext.Logger
+
+	// Usage, if set, has the usage of the repositories reduced by the
+	// manifests, layer links and blobs removed. The links of every
+	// repository are then checked for each blob removed.
+	Usage *UsageAccounting
+
+	// ManifestDeleted and BlobDeleted, if set, are called for each manifest
+	// and blob removed.
+	ManifestDeleted func(repo reference.Named, dgst digest.Digest)
+	BlobDeleted     func(dgst digest.Digest)
 }
 
 // ManifestDel contains manifest structure which will be deleted
 type ManifestDel struct {
-	Name   string
-	Digest digest.Digest
-	Tags   []string
-	Layers []digest.Digest
+	Name    string
+	Digest  digest.Digest
+	Tags    []string
+	Layers  []digest.Digest
+	Subject digest.Digest
 }
 
 // MarkAndSweep performs a mark and sweep of registry data
@@ -36,6 +61,12 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 		return fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
 	}
 
+	emit := emit
+	if opts.Logger != nil {
+		emit = opts.Logger.Debugf
+	}
+	cutoff := time.Now().Add(-opts.GracePeriod)
+
 	// mark
 	markSet := make(map[digest.Digest]struct{})
 	manifestArr := make([]ManifestDel, 0)
@@ -62,6 +93,65 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 			return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
 		}
 
+		// retained holds the manifests of this repository which are kept.
+		retained := make(map[digest.Digest]struct{})
+
+		// markManifest marks the manifest's blob and everything it references.
+		markManifest := func(dgst digest.Digest, manifest distribution.Manifest) {
+			emit("%s: marking manifest %s ", repoName, dgst)
+			retained[dgst] = struct{}{}
+			markSet[dgst] = struct{}{}
+
+			descriptors := manifest.References()
+			for _, descriptor := range descriptors {
+				markSet[descriptor.Digest] = struct{}{}
+				emit("%s: marking blob %s", repoName, descriptor.Digest)
+			}
+		}
+
+		// scheduleDeletion records an untagged manifest for removal.
+		scheduleDeletion := func(dgst digest.Digest, manifest distribution.Manifest) error {
+			emit("manifest eligible for deletion: %s", dgst)
+			// fetch all tags from repository
+			// all of these tags could contain manifest in history
+			// which means that we need check (and delete) those references when deleting manifest
+			allTags, err := repository.Tags(ctx).All(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve tags %v", err)
+			}
+
+			manifestDel := ManifestDel{
+				Name:   repoName,
+				Digest: dgst,
+				Tags:   allTags,
+				Layers: []digest.Digest{},
+			}
+
+			if subject := manifestSubject(manifest); subject != nil {
+				manifestDel.Subject = subject.Digest
+			}
+
+			for _, ref := range manifest.References() {
+				if ref.MediaType == schema2.MediaTypeLayer ||
+					ref.MediaType == schema2.MediaTypeImageConfig {
+					manifestDel.Layers = append(manifestDel.Layers, ref.Digest)
+				}
+			}
+
+			manifestArr = append(manifestArr, manifestDel)
+			return nil
+		}
+
+		// Untagged manifests which declare a subject, such as signatures
+		// and SBOMs, are held back until the rest of the repository has
+		// been marked: they are retained exactly when their subject is.
+		type untaggedReferrer struct {
+			dgst     digest.Digest
+			manifest distribution.Manifest
+			subject  digest.Digest
+		}
+		var referrers []untaggedReferrer
+
 		err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
 			manifest, err := manifestService.Get(ctx, dgst)
 			if err != nil {
@@ -75,44 +165,20 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 					return fmt.Errorf("failed to retrieve tags for digest %v: %v", dgst, err)
 				}
 				if len(tags) == 0 {
-					emit("manifest eligible for deletion: %s", dgst)
-					// fetch all tags from repository
-					// all of these tags could contain manifest in history
-					// which means that we need check (and delete) those references when deleting manifest
-					allTags, err := repository.Tags(ctx).All(ctx)
-					if err != nil {
-						return fmt.Errorf("failed to retrieve tags %v", err)
+					if subject := manifestSubject(manifest); subject != nil {
+						referrers = append(referrers, untaggedReferrer{
+							dgst:     dgst,
+							manifest: manifest,
+							subject:  subject.Digest,
+						})
+						return nil
 					}
 
-					manifestDel := ManifestDel{
-						Name:   repoName,
-						Digest: dgst,
-						Tags:   allTags,
-						Layers: []digest.Digest{},
-					}
-
-					for _, ref := range manifest.References() {
-						if ref.MediaType == schema2.MediaTypeLayer ||
-							ref.MediaType == schema2.MediaTypeImageConfig {
-							manifestDel.Layers = append(manifestDel.Layers, ref.Digest)
-						}
-					}
-
-					manifestArr = append(manifestArr, manifestDel)
-
-					return nil
+					return scheduleDeletion(dgst, manifest)
 				}
 			}
-			// Mark the manifest's blob
-			emit("%s: marking manifest %s ", repoName, dgst)
-			markSet[dgst] = struct{}{}
-
-			descriptors := manifest.References()
-			for _, descriptor := range descriptors {
-				markSet[descriptor.Digest] = struct{}{}
-				emit("%s: marking blob %s", repoName, descriptor.Digest)
-			}
 
+			markManifest(dgst, manifest)
 			return nil
 		})
 
@@ -124,24 +190,101 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 		if _, ok := err.(driver.PathNotFoundError); ok {
 			return nil
 		}
+		if err != nil {
+			return err
+		}
 
-		return err
+		// Referrers may themselves be the subject of other referrers, so
+		// keep resolving until no more are retained.
+		for retainedReferrer := true; retainedReferrer; {
+			retainedReferrer = false
+			remaining := referrers[:0]
+			for _, r := range referrers {
+				if _, ok := retained[r.subject]; ok {
+					markManifest(r.dgst, r.manifest)
+					retainedReferrer = true
+					continue
+				}
+				remaining = append(remaining, r)
+			}
+			referrers = remaining
+		}
+
+		for _, r := range referrers {
+			if err := scheduleDeletion(r.dgst, r.manifest); err != nil {
+				return err
+			}
+		}
+
+		return nil
 	})
 	if err != nil {
 		return fmt.Errorf("failed to mark: %v", err)
 	}
 
+	if opts.GracePeriod > 0 {
+		// Content pushed while the repositories were being marked has not
+		// been seen by the mark phase, so pick it up from the link times.
+		manifestArr, err = markRecent(ctx, storageDriver, registry, cutoff, markSet, manifestArr, emit)
+		if err != nil {
+			return fmt.Errorf("failed to mark recent content: %v", err)
+		}
+	}
+
 	// sweep
 	vacuum := NewVacuum(ctx, storageDriver)
+	if opts.GracePeriod > 0 && !opts.DryRun {
+		// A tag may have been moved to a manifest since it was marked. The
+		// manifests are all checked before any is deleted, so that the layer
+		// links of those which are kept are not removed.
+		remaining := manifestArr[:0]
+		for _, obj := range manifestArr {
+			rescued, err := rescueManifest(ctx, storageDriver, registry, obj, cutoff, markSet)
+			if err != nil {
+				return err
+			}
+			if rescued {
+				emit("%s: manifest %s was tagged or linked during the collection, skipping", obj.Name, obj.Digest)
+				continue
+			}
+			remaining = append(remaining, obj)
+		}
+		manifestArr = remaining
+	}
 	if !opts.DryRun {
 		for _, obj := range manifestArr {
-			err = vacuum.RemoveManifest(obj.Name, obj.Digest, obj.Tags)
+			err = opts.Usage.unlink(ctx, obj.Name, func() error {
+				return vacuum.RemoveManifest(obj.Name, obj.Digest, obj.Tags)
+			}, manifestRevisionLinkPathSpec{name: obj.Name, revision: obj.Digest})
 			if err != nil {
 				return fmt.Errorf("failed to delete manifest %s: %v", obj.Digest, err)
 			}
+			named, err := reference.WithName(obj.Name)
+			if err != nil {
+				return fmt.Errorf("failed to parse repo name %s: %v", obj.Name, err)
+			}
+			repository, err := registry.Repository(ctx, named)
+			if err != nil {
+				return fmt.Errorf("failed to construct repository: %v", err)
+			}
+			if opts.ManifestDeleted != nil {
+				opts.ManifestDeleted(named, obj.Digest)
+			}
+			err = clearCachedManifest(ctx, repository, obj.Digest)
+			if err != nil {
+				return fmt.Errorf("failed to clear cached manifest %s: %v", obj.Digest, err)
+			}
+			if obj.Subject != "" {
+				err = vacuum.RemoveReferrerLink(obj.Name, obj.Subject, obj.Digest)
+				if err != nil {
+					return fmt.Errorf("failed to delete referrer link %s for manifest %s: %v", obj.Digest, obj.Name, err)
+				}
+			}
 			for _, layerDgst := range obj.Layers {
 				if _, ok := markSet[layerDgst]; !ok {
-					err := vacuum.RemoveLayerLink(obj.Name, layerDgst)
+					err := opts.Usage.unlink(ctx, obj.Name, func() error {
+						return vacuum.RemoveLayerLink(obj.Name, layerDgst)
+					}, layerLinkPathSpec{name: obj.Name, digest: layerDgst})
 					if err != nil {
 						return fmt.Errorf("failed to delete layer link %s for manifest %s: %v", layerDgst, obj.Name, err)
 					}
@@ -153,25 +296,322 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 	deleteSet := make(map[digest.Digest]struct{})
 	err = blobService.Enumerate(ctx, func(dgst digest.Digest) error {
 		// check if digest is in markSet. If not, delete it!
-		if _, ok := markSet[dgst]; !ok {
-			deleteSet[dgst] = struct{}{}
+		if _, ok := markSet[dgst]; ok {
+			return nil
 		}
+		if opts.GracePeriod > 0 {
+			// the blob may have been uploaded after the mark phase
+			recent, err := writtenSince(ctx, storageDriver, blobDataPathSpec{digest: dgst}, cutoff)
+			if err != nil {
+				return err
+			}
+			if recent {
+				emit("blob %s is within the grace period, skipping", dgst)
+				return nil
+			}
+		}
+		deleteSet[dgst] = struct{}{}
 		return nil
 	})
 	if err != nil {
 		return fmt.Errorf("error enumerating blobs: %v", err)
 	}
 	emit("\n%d blobs marked, %d blobs and %d manifests eligible for deletion", len(markSet), len(deleteSet), len(manifestArr))
+
+	var repositories []string
+	if (opts.GracePeriod > 0 || opts.Usage != nil) && !opts.DryRun {
+		err = repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+			repositories = append(repositories, repoName)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to enumerate repositories: %v", err)
+		}
+	}
 	for dgst := range deleteSet {
 		emit("blob eligible for deletion: %s", dgst)
 		if opts.DryRun {
 			continue
 		}
-		err = vacuum.RemoveBlob(string(dgst))
+		if opts.GracePeriod > 0 {
+			// the blob may have been uploaded, mounted or linked since the
+			// mark phase
+			recent, err := blobWrittenSince(ctx, storageDriver, repositories, dgst, cutoff)
+			if err != nil {
+				return err
+			}
+			if recent {
+				emit("blob %s was written or linked during the collection, skipping", dgst)
+				continue
+			}
+		}
+		err = removeBlob(ctx, vacuum, opts.Usage, repositories, dgst)
 		if err != nil {
 			return fmt.Errorf("failed to delete blob %s: %v", dgst, err)
 		}
+		if opts.BlobDeleted != nil {
+			opts.BlobDeleted(dgst)
+		}
 	}
 
 	return err
 }
+
+// removeBlob removes the blob, releasing its usage from the repositories
+// which still link to it.
+func removeBlob(ctx context.Context, vacuum Vacuum, usage *UsageAccounting, repositories []string, dgst digest.Digest) error {
+	if usage == nil {
+		return vacuum.RemoveBlob(string(dgst))
+	}
+
+	sizes := make(map[string]int64)
+	for _, repoName := range repositories {
+		for _, spec := range []pathSpec{
+			layerLinkPathSpec{name: repoName, digest: dgst},
+			manifestRevisionLinkPathSpec{name: repoName, revision: dgst},
+		} {
+			size, err := usage.linkedSize(ctx, spec)
+			if err != nil {
+				return err
+			}
+			sizes[repoName] += size
+		}
+	}
+
+	if err := vacuum.RemoveBlob(string(dgst)); err != nil {
+		return err
+	}
+	for repoName, size := range sizes {
+		if size == 0 {
+			continue
+		}
+		if err := usage.add(ctx, repoName, -size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markRecent marks the manifests and blobs which have been linked into a
+// repository since cutoff, so that content pushed while a collection is
+// running is never swept. Manifests scheduled for deletion are dropped from
+// the schedule when they, or their subject, have been linked again.
+func markRecent(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, cutoff time.Time, markSet map[digest.Digest]struct{}, manifestArr []ManifestDel, emit func(string, ...interface{})) ([]ManifestDel, error) {
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	// markManifest marks the manifest and everything it references, if it
+	// still exists.
+	markManifest := func(repoName string, dgst digest.Digest) (bool, error) {
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+		}
+		repository, err := registry.Repository(ctx, named)
+		if err != nil {
+			return false, fmt.Errorf("failed to construct repository: %v", err)
+		}
+		manifestService, err := repository.Manifests(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to construct manifest service: %v", err)
+		}
+
+		manifest, err := manifestService.Get(ctx, dgst)
+		if err != nil {
+			if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+				// deleted since it was linked
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
+		}
+
+		emit("%s: marking recent manifest %s", repoName, dgst)
+		markSet[dgst] = struct{}{}
+		for _, descriptor := range manifest.References() {
+			markSet[descriptor.Digest] = struct{}{}
+		}
+		return true, nil
+	}
+
+	// rescued holds, per repository, the manifests which were linked since
+	// cutoff.
+	rescued := make(map[string]map[digest.Digest]struct{})
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		rescued[repoName] = make(map[digest.Digest]struct{})
+
+		revisionsPath, err := pathFor(manifestRevisionsPathSpec{name: repoName})
+		if err != nil {
+			return err
+		}
+		err = walkRecentLinks(ctx, storageDriver, revisionsPath, cutoff, func(dgst digest.Digest) error {
+			marked, err := markManifest(repoName, dgst)
+			if marked {
+				rescued[repoName][dgst] = struct{}{}
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		layersPath, err := pathFor(layersPathSpec{name: repoName})
+		if err != nil {
+			return err
+		}
+		return walkRecentLinks(ctx, storageDriver, layersPath, cutoff, func(dgst digest.Digest) error {
+			emit("%s: marking recent blob %s", repoName, dgst)
+			markSet[dgst] = struct{}{}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Referrers of a rescued manifest must be kept along with it, which may
+	// in turn rescue their own referrers.
+	for rescuedManifest := true; rescuedManifest; {
+		rescuedManifest = false
+		remaining := manifestArr[:0]
+		for _, obj := range manifestArr {
+			_, linked := rescued[obj.Name][obj.Digest]
+			_, subjectKept := rescued[obj.Name][obj.Subject]
+			if !linked && !(obj.Subject != "" && subjectKept) {
+				remaining = append(remaining, obj)
+				continue
+			}
+
+			if !linked {
+				marked, err := markManifest(obj.Name, obj.Digest)
+				if err != nil {
+					return nil, err
+				}
+				if !marked {
+					continue
+				}
+				rescued[obj.Name][obj.Digest] = struct{}{}
+				rescuedManifest = true
+			}
+		}
+		manifestArr = remaining
+	}
+
+	return manifestArr, nil
+}
+
+// rescueManifest checks, right before the manifests are deleted, whether a
+// manifest scheduled for deletion has been linked again since cutoff or is now tagged.
+// If so, the manifest and what it references are marked, and it must be kept.
+func rescueManifest(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, obj ManifestDel, cutoff time.Time, markSet map[digest.Digest]struct{}) (bool, error) {
+	named, err := reference.WithName(obj.Name)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse repo name %s: %v", obj.Name, err)
+	}
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		return false, fmt.Errorf("failed to construct repository: %v", err)
+	}
+
+	linked, err := writtenSince(ctx, storageDriver, manifestRevisionLinkPathSpec{name: obj.Name, revision: obj.Digest}, cutoff)
+	if err != nil {
+		return false, err
+	}
+	if !linked {
+		tags, err := repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: obj.Digest})
+		if err != nil {
+			return false, fmt.Errorf("failed to retrieve tags for digest %v: %v", obj.Digest, err)
+		}
+		if len(tags) == 0 {
+			return false, nil
+		}
+	}
+
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to construct manifest service: %v", err)
+	}
+	manifest, err := manifestService.Get(ctx, obj.Digest)
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve manifest for digest %v: %v", obj.Digest, err)
+	}
+	markSet[obj.Digest] = struct{}{}
+	for _, descriptor := range manifest.References() {
+		markSet[descriptor.Digest] = struct{}{}
+	}
+	return true, nil
+}
+
+// blobWrittenSince checks, right before it is deleted, whether a blob was
+// uploaded since cutoff, or linked since cutoff into one of the repositories
+// as a layer or a manifest revision.
+func blobWrittenSince(ctx context.Context, storageDriver driver.StorageDriver, repositories []string, dgst digest.Digest, cutoff time.Time) (bool, error) {
+	recent, err := writtenSince(ctx, storageDriver, blobDataPathSpec{digest: dgst}, cutoff)
+	if err != nil || recent {
+		return recent, err
+	}
+	for _, repoName := range repositories {
+		for _, spec := range []pathSpec{
+			layerLinkPathSpec{name: repoName, digest: dgst},
+			manifestRevisionLinkPathSpec{name: repoName, revision: dgst},
+		} {
+			recent, err := writtenSince(ctx, storageDriver, spec, cutoff)
+			if err != nil || recent {
+				return recent, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// walkRecentLinks calls fn with the target of each link file under root
+// which was written at or after cutoff.
+func walkRecentLinks(ctx context.Context, storageDriver driver.StorageDriver, root string, cutoff time.Time, fn func(digest.Digest) error) error {
+	err := storageDriver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" || fileInfo.ModTime().Before(cutoff) {
+			return nil
+		}
+
+		content, err := storageDriver.GetContent(ctx, fileInfo.Path())
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				// removed since the walk listed it
+				return nil
+			}
+			return err
+		}
+
+		dgst, err := digest.Parse(string(content))
+		if err != nil {
+			return err
+		}
+
+		return fn(dgst)
+	})
+
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		// nothing has been linked of this kind
+		return nil
+	}
+	return err
+}
+
+// writtenSince reports whether the file at the path described by spec was
+// written at or after cutoff. A missing file has not been written.
+func writtenSince(ctx context.Context, storageDriver driver.StorageDriver, spec pathSpec, cutoff time.Time) (bool, error) {
+	p, err := pathFor(spec)
+	if err != nil {
+		return false, err
+	}
+
+	fileInfo, err := storageDriver.Stat(ctx, p)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return !fileInfo.ModTime().Before(cutoff), nil
+}
@@ -1,18 +1,21 @@
 package storage
 
 import (
+	"context"
 	"io"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
-	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/ocischema"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/registry/storage/driver/inmemory"
 	"github.com/docker/distribution/testutil"
 	"github.com/docker/libtrust"
 	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 type image struct {
@@ -279,9 +282,16 @@ func TestDeleteManifestIfTagNotFound(t *testing.T) {
 	}
 
 	// Run GC (removes everything because no manifests with tags exist)
+	var deletedManifests, deletedBlobs int
 	err = MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
 		DryRun:         false,
 		RemoveUntagged: true,
+		ManifestDeleted: func(reference.Named, digest.Digest) {
+			deletedManifests++
+		},
+		BlobDeleted: func(digest.Digest) {
+			deletedBlobs++
+		},
 	})
 	if err != nil {
 		t.Fatalf("Failed mark and sweep: %v", err)
@@ -295,6 +305,10 @@ func TestDeleteManifestIfTagNotFound(t *testing.T) {
 	if len(before2) == len(after2) {
 		t.Fatalf("Garbage collection affected manifest storage: %d == %d", len(before2), len(after2))
 	}
+	if deletedBlobs != len(before1)-len(after1) || deletedManifests != len(before2)-len(after2) {
+		t.Fatalf("expected the %d blobs and %d manifests removed to be reported, got %d and %d",
+			len(before1)-len(after1), len(before2)-len(after2), deletedBlobs, deletedManifests)
+	}
 }
 
 func TestGCWithMissingManifests(t *testing.T) {
@@ -501,3 +515,260 @@ func TestOrphanBlobDeleted(t *testing.T) {
 		}
 	}
 }
+
+// pushingNamespace runs push once the first skip+1 enumerations of the
+// repositories have completed: the mark phase of a collection, followed by
+// the skip next ones.
+type pushingNamespace struct {
+	distribution.Namespace
+	push func()
+	skip int
+}
+
+func (n *pushingNamespace) Enumerate(ctx context.Context, ingester func(string) error) error {
+	err := n.Namespace.(distribution.RepositoryEnumerator).Enumerate(ctx, ingester)
+	if n.skip > 0 {
+		n.skip--
+		return err
+	}
+	if n.push != nil {
+		n.push()
+		n.push = nil
+	}
+	return err
+}
+
+func TestGCGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "online")
+
+	orphans, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(repo, orphans); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+	old := uploadRandomSchema2Image(t, repo)
+	recent := uploadRandomSchema2Image(t, repo)
+	tagged := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	// Age everything pushed so far past the grace period, except for the
+	// recent manifest which is pushed again.
+	time.Sleep(50 * time.Millisecond)
+	if _, err := makeManifestService(t, repo).Put(ctx, recent.manifest); err != nil {
+		t.Fatalf("manifest upload failed: %v", err)
+	}
+
+	var pushed image
+	namespace := &pushingNamespace{
+		Namespace: registry,
+		push: func() {
+			pushed = uploadRandomSchema2Image(t, repo)
+		},
+	}
+
+	err = MarkAndSweep(ctx, inmemoryDriver, namespace, GCOpts{
+		DryRun:         false,
+		RemoveUntagged: true,
+		GracePeriod:    25 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	blobs := allBlobs(t, registry)
+	for dgst := range orphans {
+		if _, ok := blobs[dgst]; ok {
+			t.Fatalf("Orphan layer outside the grace period is present: %v", dgst)
+		}
+	}
+	if _, ok := blobs[old.manifestDigest]; ok {
+		t.Fatalf("Untagged manifest outside the grace period is present: %v", old.manifestDigest)
+	}
+	for _, im := range []image{recent, pushed} {
+		if _, ok := blobs[im.manifestDigest]; !ok {
+			t.Fatalf("Recently pushed manifest was deleted: %v", im.manifestDigest)
+		}
+		for dgst := range im.layers {
+			if _, ok := blobs[dgst]; !ok {
+				t.Fatalf("Recently pushed layer was deleted: %v", dgst)
+			}
+		}
+	}
+}
+
+// TestGCGracePeriodRechecks ensures that the content linked after the
+// recent links were walked, right before the sweep, is kept.
+func TestGCGracePeriodRechecks(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "online")
+	other := makeRepository(t, registry, "other")
+
+	orphans, err := testutil.CreateRandomLayers(2)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(repo, orphans); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+	untagged := uploadRandomSchema2Image(t, repo)
+	tagged := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	otherImage := uploadRandomSchema2Image(t, other)
+	if err := other.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: otherImage.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	var mounted, deleted digest.Digest
+	for dgst := range orphans {
+		if mounted == "" {
+			mounted = dgst
+		} else {
+			deleted = dgst
+		}
+	}
+
+	namespace := &pushingNamespace{
+		Namespace: registry,
+		// after the mark phase and the walk of the recent links
+		skip: 1,
+		push: func() {
+			canonical, err := reference.WithDigest(repo.Named(), mounted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := other.Blobs(ctx).Create(ctx, WithMountFrom(canonical)); err == nil {
+				t.Fatal("expected the blob to be mounted")
+			}
+			if err := repo.Tags(ctx).Tag(ctx, "moved", distribution.Descriptor{Digest: untagged.manifestDigest}); err != nil {
+				t.Fatalf("failed to tag manifest: %v", err)
+			}
+		},
+	}
+
+	err = MarkAndSweep(ctx, inmemoryDriver, namespace, GCOpts{
+		DryRun:         false,
+		RemoveUntagged: true,
+		GracePeriod:    25 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	blobs := allBlobs(t, registry)
+	if _, ok := blobs[deleted]; ok {
+		t.Fatalf("Orphan layer outside the grace period is present: %v", deleted)
+	}
+	if _, ok := blobs[mounted]; !ok {
+		t.Fatalf("Layer mounted during the collection was deleted: %v", mounted)
+	}
+	if _, ok := blobs[untagged.manifestDigest]; !ok {
+		t.Fatalf("Manifest tagged during the collection was deleted: %v", untagged.manifestDigest)
+	}
+	for dgst := range untagged.layers {
+		if _, ok := blobs[dgst]; !ok {
+			t.Fatalf("Layer of the manifest tagged during the collection was deleted: %v", dgst)
+		}
+	}
+	if _, err := makeManifestService(t, repo).Get(ctx, untagged.manifestDigest); err != nil {
+		t.Fatalf("Manifest tagged during the collection cannot be fetched: %v", err)
+	}
+}
+
+func TestGCRetainsReferrersOfTaggedSubjects(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "referrers")
+	manifestService := makeManifestService(t, repo)
+
+	putManifest := func(content string, subject *distribution.Descriptor) distribution.Descriptor {
+		config, err := repo.Blobs(ctx).Put(ctx, v1.MediaTypeImageConfig, []byte(content))
+		if err != nil {
+			t.Fatalf("failed to upload config: %v", err)
+		}
+		config.MediaType = v1.MediaTypeImageConfig
+
+		m, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned: ocischema.SchemaVersion,
+			Config:    config,
+			Layers:    []distribution.Descriptor{},
+			Subject:   subject,
+		})
+		if err != nil {
+			t.Fatalf("failed to make manifest: %v", err)
+		}
+
+		dgst, err := manifestService.Put(ctx, m)
+		if err != nil {
+			t.Fatalf("manifest upload failed: %v", err)
+		}
+		_, payload, _ := m.Payload()
+		return distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: dgst, Size: int64(len(payload))}
+	}
+
+	subject := putManifest("subject", nil)
+	referrer := putManifest("referrer", &subject)
+	// a referrer of a referrer is retained transitively
+	nested := putManifest("nested", &referrer)
+
+	if err := repo.Tags(ctx).Tag(ctx, "latest", subject); err != nil {
+		t.Fatalf("failed to tag subject: %v", err)
+	}
+
+	err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:         false,
+		RemoveUntagged: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	manifests := allManifests(t, manifestService)
+	for _, d := range []distribution.Descriptor{subject, referrer, nested} {
+		if _, ok := manifests[d.Digest]; !ok {
+			t.Fatalf("manifest %s was removed although its subject is tagged", d.Digest)
+		}
+	}
+
+	if err := repo.Tags(ctx).Untag(ctx, "latest"); err != nil {
+		t.Fatalf("failed to untag subject: %v", err)
+	}
+
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:         false,
+		RemoveUntagged: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	manifests = allManifests(t, manifestService)
+	for _, d := range []distribution.Descriptor{subject, referrer, nested} {
+		if _, ok := manifests[d.Digest]; ok {
+			t.Fatalf("manifest %s was not removed after its subject was untagged", d.Digest)
+		}
+	}
+
+	referrersPath, err := pathFor(manifestReferrersPathSpec{name: "referrers", subject: subject.Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inmemoryDriver.Stat(ctx, path.Join(referrersPath, referrer.Digest.Algorithm().String(), referrer.Digest.Hex())); err == nil {
+		t.Fatalf("referrer link for %s was not removed", referrer.Digest)
+	}
+}
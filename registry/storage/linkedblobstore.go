@@ -12,8 +12,10 @@ import (
 	dcontext "github.com/docker/distribution/context"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/tracing"
 	"github.com/docker/distribution/uuid"
 	"github.com/opencontainers/go-digest"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // linkPathFunc describes a function that can resolve a link based on the
@@ -41,11 +43,24 @@ type linkedBlobStore struct {
 
 	// linkDirectoryPathSpec locates the root directories in which one might find links
 	linkDirectoryPathSpec pathSpec
+
+	// usage, if set, accounts the size of the blobs linked into and
+	// deleted from the repository.
+	usage *UsageAccounting
 }
 
 var _ distribution.BlobStore = &linkedBlobStore{}
 
-func (lbs *linkedBlobStore) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+func (lbs *linkedBlobStore) Stat(ctx context.Context, dgst digest.Digest) (_ distribution.Descriptor, err error) {
+	ctx, span := tracing.StartSpan(ctx, "(*linkedBlobStore).Stat", attribute.String("registry.digest", dgst.String()))
+	defer func() {
+		// unknown blobs are expected, before uploads and mounts
+		if err != distribution.ErrBlobUnknown {
+			tracing.RecordError(span, err)
+		}
+		span.End()
+	}()
+
 	return lbs.blobStore.statter.Stat(ctx, dgst)
 }
 
@@ -124,8 +139,10 @@ func WithMountFrom(ref reference.Canonical) distribution.BlobCreateOption {
 }
 
 // Writer begins a blob write session, returning a handle.
-func (lbs *linkedBlobStore) Create(ctx context.Context, options ...distribution.BlobCreateOption) (distribution.BlobWriter, error) {
+func (lbs *linkedBlobStore) Create(ctx context.Context, options ...distribution.BlobCreateOption) (_ distribution.BlobWriter, err error) {
 	dcontext.GetLogger(ctx).Debug("(*linkedBlobStore).Writer")
+	ctx, span := tracing.StartSpan(ctx, "(*linkedBlobStore).Create")
+	defer func() { tracing.EndSpan(span, err) }()
 
 	var opts distribution.CreateOptions
 
@@ -171,8 +188,10 @@ func (lbs *linkedBlobStore) Create(ctx context.Context, options ...distribution.
 	return lbs.newBlobUpload(ctx, uuid, path, startedAt, false)
 }
 
-func (lbs *linkedBlobStore) Resume(ctx context.Context, id string) (distribution.BlobWriter, error) {
+func (lbs *linkedBlobStore) Resume(ctx context.Context, id string) (_ distribution.BlobWriter, err error) {
 	dcontext.GetLogger(ctx).Debug("(*linkedBlobStore).Resume")
+	ctx, span := tracing.StartSpan(ctx, "(*linkedBlobStore).Resume", attribute.String("registry.upload", id))
+	defer func() { tracing.EndSpan(span, err) }()
 
 	startedAtPath, err := pathFor(uploadStartedAtPathSpec{
 		name: lbs.repository.Named().Name(),
@@ -218,13 +237,16 @@ func (lbs *linkedBlobStore) Resume(ctx context.Context, id string) (distribution
 	return bw, nil
 }
 
-func (lbs *linkedBlobStore) Delete(ctx context.Context, dgst digest.Digest) error {
+func (lbs *linkedBlobStore) Delete(ctx context.Context, dgst digest.Digest) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "(*linkedBlobStore).Delete", attribute.String("registry.digest", dgst.String()))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	if !lbs.deleteEnabled {
 		return distribution.ErrUnsupported
 	}
 
 	// Ensure the blob is available for deletion
-	_, err := lbs.blobAccessController.Stat(ctx, dgst)
+	desc, err := lbs.blobAccessController.Stat(ctx, dgst)
 	if err != nil {
 		return err
 	}
@@ -234,6 +256,10 @@ func (lbs *linkedBlobStore) Delete(ctx context.Context, dgst digest.Digest) erro
 		return err
 	}
 
+	if lbs.usage != nil {
+		return lbs.usage.add(ctx, lbs.repository.Named().Name(), -desc.Size)
+	}
+
 	return nil
 }
 
@@ -354,7 +380,28 @@ func (lbs *linkedBlobStore) linkBlob(ctx context.Context, canonical distribution
 			return err
 		}
 
+		// Only account for the canonical digest, when it is first linked.
+		// Its size is reserved before the link is written, so that content
+		// exceeding the quota is never linked.
+		accounted := false
+		if lbs.usage != nil && dgst == canonical.Digest {
+			if _, err := lbs.driver.Stat(ctx, blobLinkPath); err != nil {
+				if _, ok := err.(driver.PathNotFoundError); !ok {
+					return err
+				}
+				if err := lbs.usage.reserve(ctx, lbs.repository.Named().Name(), canonical.Size); err != nil {
+					return err
+				}
+				accounted = true
+			}
+		}
+
 		if err := lbs.blobStore.link(ctx, blobLinkPath, canonical.Digest); err != nil {
+			if accounted {
+				if err := lbs.usage.add(ctx, lbs.repository.Named().Name(), -canonical.Size); err != nil {
+					dcontext.GetLogger(ctx).Errorf("error releasing the usage of %s: %v", canonical.Digest, err)
+				}
+			}
 			return err
 		}
 	}
@@ -12,8 +12,10 @@ import (
 	"github.com/docker/distribution/manifest/ocischema"
 	"github.com/docker/distribution/manifest/schema1" //nolint:staticcheck // Ignore SA1019: "github.com/docker/distribution/manifest/schema1" is deprecated, as it's used for backward compatibility.
 	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/tracing"
 	"github.com/opencontainers/go-digest"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // A ManifestHandler gets and puts manifests of a particular type.
@@ -44,6 +46,7 @@ func (o skipLayerOption) Apply(m distribution.ManifestService) error {
 type manifestStore struct {
 	repository *repository
 	blobStore  *linkedBlobStore
+	referrers  *referrerStore
 	ctx        context.Context
 
 	skipDependencyVerification bool
@@ -56,10 +59,17 @@ type manifestStore struct {
 }
 
 var _ distribution.ManifestService = &manifestStore{}
+var _ distribution.ReferrersProvider = &manifestStore{}
 
 func (ms *manifestStore) Exists(ctx context.Context, dgst digest.Digest) (bool, error) {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Exists")
 
+	if ms.repository.manifestCache != nil {
+		if _, err := ms.repository.manifestCache.GetManifest(ctx, dgst); err == nil {
+			return true, nil
+		}
+	}
+
 	_, err := ms.blobStore.Stat(ms.ctx, dgst)
 	if err != nil {
 		if err == distribution.ErrBlobUnknown {
@@ -72,13 +82,15 @@ func (ms *manifestStore) Exists(ctx context.Context, dgst digest.Digest) (bool,
 	return true, nil
 }
 
-func (ms *manifestStore) Get(ctx context.Context, dgst digest.Digest, options ...distribution.ManifestServiceOption) (distribution.Manifest, error) {
+func (ms *manifestStore) Get(ctx context.Context, dgst digest.Digest, options ...distribution.ManifestServiceOption) (_ distribution.Manifest, err error) {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Get")
+	ctx, span := tracing.StartSpan(ctx, "(*manifestStore).Get", attribute.String("registry.digest", dgst.String()))
+	defer func() { tracing.EndSpan(span, err) }()
 
 	// TODO(stevvooe): Need to check descriptor from above to ensure that the
 	// mediatype is as we expect for the manifest store.
 
-	content, err := ms.blobStore.Get(ctx, dgst)
+	content, err := ms.content(ctx, dgst)
 	if err != nil {
 		if err == distribution.ErrBlobUnknown {
 			return nil, distribution.ErrManifestUnknownRevision{
@@ -129,29 +141,174 @@ func (ms *manifestStore) Get(ctx context.Context, dgst digest.Digest, options ..
 	return nil, fmt.Errorf("unrecognized manifest schema version %d", versioned.SchemaVersion)
 }
 
-func (ms *manifestStore) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
+// content returns the payload of the manifest, preferring the manifest cache
+// of the repository.
+func (ms *manifestStore) content(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	if ms.repository.manifestCache == nil {
+		return ms.blobStore.Get(ctx, dgst)
+	}
+
+	content, cacheErr := ms.repository.manifestCache.GetManifest(ctx, dgst)
+	if cacheErr == nil {
+		return content, nil
+	}
+
+	content, err := ms.blobStore.Get(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheErr == distribution.ErrBlobUnknown {
+		if err := ms.repository.manifestCache.SetManifest(ctx, dgst, content); err != nil {
+			dcontext.GetLoggerWithField(ctx, "manifest", dgst).WithError(err).Error("error from cache setting manifest")
+		}
+	} else {
+		// do not store in the cache as it may trigger many set calls
+		dcontext.GetLoggerWithField(ctx, "manifest", dgst).WithError(cacheErr).Error("error from cache getting manifest")
+	}
+
+	return content, nil
+}
+
+func (ms *manifestStore) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (_ digest.Digest, err error) {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Put")
+	ctx, span := tracing.StartSpan(ctx, "(*manifestStore).Put")
+	defer func() { tracing.EndSpan(span, err) }()
 
+	var handler ManifestHandler
 	switch manifest.(type) {
 	case *schema1.SignedManifest: //nolint:staticcheck // Ignore SA1019: "github.com/docker/distribution/manifest/schema1" is deprecated, as it's used for backward compatibility.
-		return ms.schema1Handler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.schema1Handler
 	case *schema2.DeserializedManifest:
-		return ms.schema2Handler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.schema2Handler
 	case *ocischema.DeserializedManifest:
-		return ms.ocischemaHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.ocischemaHandler
 	case *manifestlist.DeserializedManifestList:
-		return ms.manifestListHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.manifestListHandler
 	case *ocischema.DeserializedImageIndex:
-		return ms.ocischemaIndexHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.ocischemaIndexHandler
+	default:
+		return "", fmt.Errorf("unrecognized manifest type %T", manifest)
+	}
+
+	dgst, err := handler.Put(ctx, manifest, ms.skipDependencyVerification)
+	if err != nil {
+		return dgst, err
 	}
 
-	return "", fmt.Errorf("unrecognized manifest type %T", manifest)
+	// the repository is listed in the catalog once it has a manifest
+	if index := ms.repository.registry.repositoryIndex; index != nil {
+		if err := index.Add(ctx, ms.repository.Named().Name()); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error adding repository %s to the repository index: %v", ms.repository.Named().Name(), err)
+		}
+	}
+	return dgst, nil
 }
 
 // Delete removes the revision of the specified manifest.
-func (ms *manifestStore) Delete(ctx context.Context, dgst digest.Digest) error {
+func (ms *manifestStore) Delete(ctx context.Context, dgst digest.Digest) (err error) {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Delete")
-	return ms.blobStore.Delete(ctx, dgst)
+	ctx, span := tracing.StartSpan(ctx, "(*manifestStore).Delete", attribute.String("registry.digest", dgst.String()))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	// Look up the subject before the revision goes away, so the referrers
+	// index can be cleaned up afterwards.
+	var subject *distribution.Descriptor
+	m, err := ms.Get(ctx, dgst)
+	switch err.(type) {
+	case nil:
+		subject = manifestSubject(m)
+	case distribution.ErrManifestUnknownRevision:
+		// reported by the delete below
+	default:
+		dcontext.GetLogger(ctx).Errorf("error resolving subject of manifest %s before delete: %v", dgst, err)
+	}
+
+	err = ms.blobStore.Delete(ctx, dgst)
+
+	// the manifest may be cached even when it is already gone from the
+	// storage
+	if ms.repository.manifestCache != nil {
+		if cacheErr := ms.repository.manifestCache.ClearManifest(ctx, dgst); cacheErr != nil && err == nil {
+			err = cacheErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if subject != nil {
+		if err := ms.referrers.unlink(ctx, subject.Digest, dgst); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error unlinking referrer %s from subject %s: %v", dgst, subject.Digest, err)
+		}
+	}
+
+	return nil
+}
+
+// clearCachedManifest removes a manifest removed from the storage without
+// going through the manifest store from the manifest cache of the repository.
+func clearCachedManifest(ctx context.Context, repo distribution.Repository, dgst digest.Digest) error {
+	r, ok := repo.(*repository)
+	if !ok || r.manifestCache == nil {
+		return nil
+	}
+	return r.manifestCache.ClearManifest(ctx, dgst)
+}
+
+// Referrers returns descriptors for the manifests in the repository which
+// declare the given digest as their subject.
+func (ms *manifestStore) Referrers(ctx context.Context, subject digest.Digest) ([]distribution.Descriptor, error) {
+	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Referrers")
+
+	var referrers []distribution.Descriptor
+	err := ms.referrers.enumerate(ctx, subject, func(dgst digest.Digest) error {
+		m, err := ms.Get(ctx, dgst)
+		if err != nil {
+			if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+				// the referrer has been deleted since it was indexed
+				return nil
+			}
+			return err
+		}
+
+		var artifactType string
+		var annotations map[string]string
+		switch m := m.(type) {
+		case *ocischema.DeserializedManifest:
+			// Per the OCI distribution spec, the config media type stands
+			// in for the artifact type when the manifest does not set one.
+			artifactType = m.ArtifactType
+			if artifactType == "" {
+				artifactType = m.Config.MediaType
+			}
+			annotations = m.Annotations
+		case *ocischema.DeserializedImageIndex:
+			artifactType = m.ArtifactType
+			annotations = m.Annotations
+		default:
+			return nil
+		}
+
+		mediaType, payload, err := m.Payload()
+		if err != nil {
+			return err
+		}
+
+		referrers = append(referrers, distribution.Descriptor{
+			MediaType:    mediaType,
+			Digest:       dgst,
+			Size:         int64(len(payload)),
+			ArtifactType: artifactType,
+			Annotations:  annotations,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return referrers, nil
 }
 
 func (ms *manifestStore) Enumerate(ctx context.Context, ingester func(digest.Digest) error) error {
@@ -586,3 +586,212 @@ func ociIndexFromDesriptorsWithMediaType(descriptors []distribution.Descriptor,
 
 	return &d, nil
 }
+
+// TestOCIManifestReferrers ensures that manifests declaring a subject are
+// indexed as referrers of that subject and removed from the index on delete.
+func TestOCIManifestReferrers(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "foo/referrers")
+	manifestService := makeManifestService(t, repo)
+
+	referrersProvider, ok := manifestService.(distribution.ReferrersProvider)
+	if !ok {
+		t.Fatalf("manifest service does not implement distribution.ReferrersProvider")
+	}
+
+	putManifest := func(configMediaType, artifactType string, subject *distribution.Descriptor) (distribution.Manifest, digest.Digest) {
+		config, err := repo.Blobs(ctx).Put(ctx, configMediaType, []byte(configMediaType+artifactType))
+		if err != nil {
+			t.Fatalf("unexpected error putting config: %v", err)
+		}
+		config.MediaType = configMediaType
+
+		m, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned:    ocischema.SchemaVersion,
+			Config:       config,
+			Layers:       []distribution.Descriptor{},
+			ArtifactType: artifactType,
+			Subject:      subject,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error building manifest: %v", err)
+		}
+
+		dgst, err := manifestService.Put(ctx, m)
+		if err != nil {
+			t.Fatalf("unexpected error putting manifest: %v", err)
+		}
+		return m, dgst
+	}
+
+	subject, subjectDigest := putManifest(v1.MediaTypeImageConfig, "", nil)
+	mediaType, payload, err := subject.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	subjectDesc := &distribution.Descriptor{
+		MediaType: mediaType,
+		Digest:    subjectDigest,
+		Size:      int64(len(payload)),
+	}
+
+	referrers, err := referrersProvider.Referrers(ctx, subjectDigest)
+	if err != nil {
+		t.Fatalf("unexpected error listing referrers: %v", err)
+	}
+	if len(referrers) != 0 {
+		t.Fatalf("expected no referrers before any were pushed, got %v", referrers)
+	}
+
+	_, signatureDigest := putManifest(v1.MediaTypeImageConfig, "application/vnd.example.signature", subjectDesc)
+	_, sbomDigest := putManifest("application/vnd.example.sbom", "", subjectDesc)
+
+	referrers, err = referrersProvider.Referrers(ctx, subjectDigest)
+	if err != nil {
+		t.Fatalf("unexpected error listing referrers: %v", err)
+	}
+
+	expected := map[digest.Digest]string{
+		signatureDigest: "application/vnd.example.signature",
+		sbomDigest:      "application/vnd.example.sbom", // falls back to the config media type
+	}
+	if len(referrers) != len(expected) {
+		t.Fatalf("expected %d referrers, got %d: %v", len(expected), len(referrers), referrers)
+	}
+	for _, referrer := range referrers {
+		artifactType, ok := expected[referrer.Digest]
+		if !ok {
+			t.Fatalf("unexpected referrer %s", referrer.Digest)
+		}
+		if referrer.ArtifactType != artifactType {
+			t.Errorf("referrer %s: expected artifact type %q, got %q", referrer.Digest, artifactType, referrer.ArtifactType)
+		}
+		if referrer.MediaType != v1.MediaTypeImageManifest {
+			t.Errorf("referrer %s: unexpected media type %q", referrer.Digest, referrer.MediaType)
+		}
+		if referrer.Size == 0 {
+			t.Errorf("referrer %s: expected a non-zero size", referrer.Digest)
+		}
+	}
+
+	if err := manifestService.Delete(ctx, signatureDigest); err != nil {
+		t.Fatalf("unexpected error deleting referrer: %v", err)
+	}
+
+	referrers, err = referrersProvider.Referrers(ctx, subjectDigest)
+	if err != nil {
+		t.Fatalf("unexpected error listing referrers: %v", err)
+	}
+	if len(referrers) != 1 || referrers[0].Digest != sbomDigest {
+		t.Fatalf("expected only %s to remain a referrer, got %v", sbomDigest, referrers)
+	}
+
+	linkPath, err := pathFor(manifestReferrerLinkPathSpec{
+		name:     repo.Named().Name(),
+		subject:  subjectDigest,
+		revision: signatureDigest,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inmemoryDriver.Stat(ctx, linkPath); err == nil {
+		t.Fatalf("expected referrer link %s to be removed on delete", linkPath)
+	}
+}
+
+func TestManifestCache(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver, ManifestCacheProvider(memory.NewInMemoryManifestCacheProvider(memory.UnlimitedSize)))
+	repo := makeRepository(t, registry, "foo/cached")
+	manifestService := makeManifestService(t, repo)
+	tagService := repo.Tags(ctx)
+	manifestCache := repo.(*repository).manifestCache
+
+	// changes made behind the back of the cache are not seen
+	uncachedRepo := makeRepository(t, createRegistry(t, inmemoryDriver), "foo/cached")
+	uncachedTagService := uncachedRepo.Tags(ctx)
+
+	first := uploadRandomSchema2Image(t, repo)
+	second := uploadRandomSchema2Image(t, repo)
+
+	checkTag := func(expected digest.Digest) {
+		t.Helper()
+		desc, err := tagService.Get(ctx, "latest")
+		if expected == "" {
+			if _, ok := err.(distribution.ErrTagUnknown); !ok {
+				t.Fatalf("expected unknown tag, got %v, %v", desc, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error getting tag: %v", err)
+		}
+		if desc.Digest != expected {
+			t.Fatalf("expected tag to resolve to %s, got %s", expected, desc.Digest)
+		}
+	}
+	checkCached := func(dgst digest.Digest, expected bool) {
+		t.Helper()
+		if _, err := manifestCache.GetManifest(ctx, dgst); (err == nil) != expected {
+			t.Fatalf("expected manifest %s to be cached: %v, got %v", dgst, expected, err)
+		}
+	}
+
+	if err := tagService.Tag(ctx, "latest", distribution.Descriptor{Digest: first.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging: %v", err)
+	}
+	checkTag(first.manifestDigest)
+
+	if err := uncachedTagService.Tag(ctx, "latest", distribution.Descriptor{Digest: second.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging: %v", err)
+	}
+	checkTag(first.manifestDigest)
+
+	// tagging and untagging invalidate the tag
+	if err := tagService.Tag(ctx, "latest", distribution.Descriptor{Digest: second.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging: %v", err)
+	}
+	checkTag(second.manifestDigest)
+
+	if err := tagService.Untag(ctx, "latest"); err != nil {
+		t.Fatalf("unexpected error untagging: %v", err)
+	}
+	checkTag("")
+
+	// deleting the manifest invalidates it along with its tags
+	if err := tagService.Tag(ctx, "latest", distribution.Descriptor{Digest: first.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging: %v", err)
+	}
+	checkTag(first.manifestDigest)
+	checkCached(first.manifestDigest, false)
+	if _, err := manifestService.Get(ctx, first.manifestDigest); err != nil {
+		t.Fatalf("unexpected error getting manifest: %v", err)
+	}
+	checkCached(first.manifestDigest, true)
+
+	if err := manifestService.Delete(ctx, first.manifestDigest); err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+	checkCached(first.manifestDigest, false)
+	if _, _, err := manifestCache.GetTag(ctx, "latest"); err == nil {
+		t.Fatalf("expected the tag of the deleted manifest to be cleared")
+	}
+
+	// so does garbage collection
+	if err := tagService.Untag(ctx, "latest"); err != nil {
+		t.Fatalf("unexpected error untagging: %v", err)
+	}
+	if _, err := manifestService.Get(ctx, second.manifestDigest); err != nil {
+		t.Fatalf("unexpected error getting manifest: %v", err)
+	}
+	checkCached(second.manifestDigest, true)
+
+	if err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{RemoveUntagged: true}); err != nil {
+		t.Fatalf("failed garbage collection: %v", err)
+	}
+	checkCached(second.manifestDigest, false)
+}
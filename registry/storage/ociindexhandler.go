@@ -12,6 +12,7 @@ import (
 // ocischemaIndexHandler is a ManifestHandler that covers the OCI Image Index.
 type ocischemaIndexHandler struct {
 	*manifestListHandler
+	referrers *referrerStore
 }
 
 var _ ManifestHandler = &manifestListHandler{}
@@ -26,3 +27,30 @@ func (ms *ocischemaIndexHandler) Unmarshal(ctx context.Context, dgst digest.Dige
 
 	return m, nil
 }
+
+func (ms *ocischemaIndexHandler) Put(ctx context.Context, manifestList distribution.Manifest, skipDependencyVerification bool) (digest.Digest, error) {
+	dcontext.GetLogger(ms.ctx).Debug("(*ociIndexHandler).Put")
+
+	subject := manifestSubject(manifestList)
+	if subject != nil {
+		// The subject is not required to exist in the repository, but it
+		// must be addressable.
+		if err := subject.Digest.Validate(); err != nil {
+			return "", distribution.ErrManifestVerification{err}
+		}
+	}
+
+	revision, err := ms.manifestListHandler.Put(ctx, manifestList, skipDependencyVerification)
+	if err != nil {
+		return "", err
+	}
+
+	if subject != nil {
+		if err := ms.referrers.link(ctx, subject.Digest, revision); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error linking referrer to subject %s: %v", subject.Digest, err)
+			return "", err
+		}
+	}
+
+	return revision, nil
+}
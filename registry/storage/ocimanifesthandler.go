@@ -16,6 +16,7 @@ import (
 type ocischemaManifestHandler struct {
 	repository   distribution.Repository
 	blobStore    distribution.BlobStore
+	referrers    *referrerStore
 	ctx          context.Context
 	manifestURLs manifestURLs
 }
@@ -56,6 +57,13 @@ func (ms *ocischemaManifestHandler) Put(ctx context.Context, manifest distributi
 		return "", err
 	}
 
+	if m.Subject != nil {
+		if err := ms.referrers.link(ctx, m.Subject.Digest, revision.Digest); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error linking referrer to subject %s: %v", m.Subject.Digest, err)
+			return "", err
+		}
+	}
+
 	return revision.Digest, nil
 }
 
@@ -69,6 +77,14 @@ func (ms *ocischemaManifestHandler) verifyManifest(ctx context.Context, mnfst oc
 		return fmt.Errorf("unrecognized manifest schema version %d", mnfst.Manifest.SchemaVersion)
 	}
 
+	if mnfst.Subject != nil {
+		// The subject is not required to exist in the repository, but it
+		// must be addressable.
+		if err := mnfst.Subject.Digest.Validate(); err != nil {
+			return distribution.ErrManifestVerification{err}
+		}
+	}
+
 	if skipDependencyVerification {
 		return nil
 	}
@@ -27,29 +27,42 @@ const (
 //	├── blob
 //	│   └── <algorithm>
 //	│       └── <split directory content addressable storage>
-//	└── repositories
-//	    └── <name>
-//	        ├── _layers
-//	        │   └── <layer links to blob store>
-//	        ├── _manifests
-//	        │   ├── revisions
-//	        │   │   └── <manifest digest path>
-//	        │   │       └── link
-//	        │   └── tags
-//	        │       └── <tag>
-//	        │           ├── current
-//	        │           │   └── link
-//	        │           └── index
-//	        │               └── <algorithm>
-//	        │                   └── <hex digest>
-//	        │                       └── link
-//	        └── _uploads
-//	            └── <id>
-//	                ├── data
-//	                ├── hashstates
-//	                │   └── <algorithm>
-//	                │       └── <offset>
-//	                └── startedat
+//	├── repositories
+//	│   └── <name>
+//	│       ├── _layers
+//	│       │   └── <layer links to blob store>
+//	│       ├── _manifests
+//	│       │   ├── revisions
+//	│       │   │   └── <manifest digest path>
+//	│       │   │       └── link
+//	│       │   ├── referrers
+//	│       │   │   └── <subject digest path>
+//	│       │   │       └── <manifest digest path>
+//	│       │   │           └── link
+//	│       │   └── tags
+//	│       │       └── <tag>
+//	│       │           ├── current
+//	│       │           │   └── link
+//	│       │           └── index
+//	│       │               └── <algorithm>
+//	│       │                   └── <hex digest>
+//	│       │                       └── link
+//	│       └── _uploads
+//	│           └── <id>
+//	│               ├── data
+//	│               ├── hashstates
+//	│               │   └── <algorithm>
+//	│               │       └── <offset>
+//	│               └── startedat
+//	├── quarantine
+//	│   └── <quarantined blobs and links, at their path relative to <root>/v2>
+//	└── usage
+//	    ├── namespaces
+//	    │   └── <namespace>
+//	    │       └── _usage
+//	    └── repositories
+//	        └── <name>
+//	            └── _usage
 //
 // The storage backend layout is broken up into a content-addressable blob
 // store and repositories. The content-addressable blob store holds most data
@@ -83,6 +96,11 @@ const (
 //	manifestRevisionPathSpec:      <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/
 //	manifestRevisionLinkPathSpec:  <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/link
 //
+//	Referrers:
+//
+//	manifestReferrersPathSpec:     <root>/v2/repositories/<name>/_manifests/referrers/<algorithm>/<hex digest>/
+//	manifestReferrerLinkPathSpec:  <root>/v2/repositories/<name>/_manifests/referrers/<algorithm>/<hex digest>/<algorithm>/<hex digest>/link
+//
 //	Tags:
 //
 //	manifestTagsPathSpec:                  <root>/v2/repositories/<name>/_manifests/tags/
@@ -110,6 +128,14 @@ const (
 //	blobDataPathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
 //	blobMediaTypePathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
 //
+//	Quota usage:
+//
+//	usagePathSpec:                  <root>/v2/usage/<key>/_usage
+//
+//	Quarantine:
+//
+//	quarantinePathSpec:             <root>/v2/quarantine/<path relative to <root>/v2>
+//
 // For more information on the semantic meaning of each path and their
 // contents, please see the path spec documentation.
 func pathFor(spec pathSpec) (string, error) {
@@ -147,6 +173,28 @@ func pathFor(spec pathSpec) (string, error) {
 		}
 
 		return path.Join(root, "link"), nil
+	case manifestReferrersPathSpec:
+		components, err := digestPathComponents(v.subject, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(repoPrefix, v.name, "_manifests", "referrers"), components...)...), nil
+	case manifestReferrerLinkPathSpec:
+		root, err := pathFor(manifestReferrersPathSpec{
+			name:    v.name,
+			subject: v.subject,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		components, err := digestPathComponents(v.revision, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, path.Join(components...), "link"), nil
 	case manifestTagsPathSpec:
 		return path.Join(append(repoPrefix, v.name, "_manifests", "tags")...), nil
 	case manifestTagPathSpec:
@@ -243,6 +291,14 @@ func pathFor(spec pathSpec) (string, error) {
 		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "hashstates", string(v.alg), offset)...), nil
 	case repositoriesRootPathSpec:
 		return path.Join(repoPrefix...), nil
+	case usagePathSpec:
+		return path.Join(append(rootPrefix, "usage", v.key, "_usage")...), nil
+	case quarantinePathSpec:
+		root := path.Join(rootPrefix...)
+		if !strings.HasPrefix(v.path, root+"/") {
+			return "", fmt.Errorf("cannot quarantine %s outside of %s", v.path, root)
+		}
+		return path.Join(root, "quarantine", strings.TrimPrefix(v.path, root)), nil
 	default:
 		// TODO(sday): This is an internal error. Ensure it doesn't escape (panic?).
 		return "", fmt.Errorf("unknown path spec: %#v", v)
@@ -284,6 +340,26 @@ type manifestRevisionLinkPathSpec struct {
 
 func (manifestRevisionLinkPathSpec) pathSpec() {}
 
+// manifestReferrersPathSpec describes the directory path holding the links to
+// all manifests which declare the given subject.
+type manifestReferrersPathSpec struct {
+	name    string
+	subject digest.Digest
+}
+
+func (manifestReferrersPathSpec) pathSpec() {}
+
+// manifestReferrerLinkPathSpec describes the path components required to
+// record that the manifest revision declares subject as its subject. The
+// contents of this file should just be the digest of the referring manifest.
+type manifestReferrerLinkPathSpec struct {
+	name     string
+	subject  digest.Digest
+	revision digest.Digest
+}
+
+func (manifestReferrerLinkPathSpec) pathSpec() {}
+
 // manifestTagsPathSpec describes the path elements required to point to the
 // manifest tags directory.
 type manifestTagsPathSpec struct {
@@ -436,6 +512,23 @@ type repositoriesRootPathSpec struct{}
 
 func (repositoriesRootPathSpec) pathSpec() {}
 
+// usagePathSpec describes the path of a quota usage counter, such as
+// "repositories/<name>" or "namespaces/<namespace>".
+type usagePathSpec struct {
+	key string
+}
+
+func (usagePathSpec) pathSpec() {}
+
+// quarantinePathSpec describes the path to which a corrupted blob or a
+// dangling link is moved, keeping its path in the storage so that it can be
+// moved back.
+type quarantinePathSpec struct {
+	path string
+}
+
+func (quarantinePathSpec) pathSpec() {}
+
 // digestPathComponents provides a consistent path breakdown for a given
 // digest. For a generic digest, it will be as follows:
 //
@@ -465,6 +558,25 @@ func digestPathComponents(dgst digest.Digest, multilevel bool) ([]string, error)
 	return append(prefix, suffix...), nil
 }
 
+// isBlobDataPath returns whether the driver path is the path of the data of a
+// blob, as returned for a blobDataPathSpec.
+func isBlobDataPath(driverPath string) bool {
+	root, err := pathFor(blobsPathSpec{})
+	if err != nil || !strings.HasPrefix(driverPath, root+"/") {
+		return false
+	}
+
+	// <algorithm>/<first two bytes of digest>/<full digest>/data
+	components := strings.Split(strings.TrimPrefix(driverPath, root+"/"), "/")
+	if len(components) != 4 {
+		return false
+	}
+
+	dgst := digest.NewDigestFromEncoded(digest.Algorithm(components[0]), components[2])
+	dataPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	return err == nil && dataPath == driverPath
+}
+
 // Reconstructs a digest from a path
 func digestFromPath(digestPath string) (digest.Digest, error) {
 	digestPath = strings.TrimSuffix(digestPath, "/data")
@@ -25,6 +25,21 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/revisions/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/link",
 		},
+		{
+			spec: manifestReferrersPathSpec{
+				name:    "foo/bar",
+				subject: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/referrers/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+		},
+		{
+			spec: manifestReferrerLinkPathSpec{
+				name:     "foo/bar",
+				subject:  "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				revision: "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/referrers/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/sha256/0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef/link",
+		},
 		{
 			spec: manifestTagsPathSpec{
 				name: "foo/bar",
@@ -87,6 +102,10 @@ func TestPathMapper(t *testing.T) {
 			spec:     layersPathSpec{name: "foo/bar"},
 			expected: "/docker/registry/v2/repositories/foo/bar/_layers",
 		},
+		{
+			spec:     quarantinePathSpec{path: "/docker/registry/v2/blobs/sha256/ab/abcdef/data"},
+			expected: "/docker/registry/v2/quarantine/blobs/sha256/ab/abcdef/data",
+		},
 	} {
 		p, err := pathFor(testcase.spec)
 		if err != nil {
@@ -134,3 +153,22 @@ func TestDigestFromPath(t *testing.T) {
 		}
 	}
 }
+
+func TestIsBlobDataPath(t *testing.T) {
+	for _, testcase := range []struct {
+		path     string
+		expected bool
+	}{
+		{"/docker/registry/v2/blobs/sha256/99/9943fffae777400c0344c58869c4c2619c329ca3ad4df540feda74d291dd7c86/data", true},
+		{"/docker/registry/v2/blobs/sha256/98/9943fffae777400c0344c58869c4c2619c329ca3ad4df540feda74d291dd7c86/data", false},
+		{"/docker/registry/v2/blobs/sha256/99/9943fffae777400c0344c58869c4c2619c329ca3ad4df540feda74d291dd7c86", false},
+		{"/docker/registry/v2/blobs/sha256/99/../99/9943fffae777400c0344c58869c4c2619c329ca3ad4df540feda74d291dd7c86/data", false},
+		{"/docker/registry/v2/repositories/foo/bar/_layers/sha256/9943fffae777400c0344c58869c4c2619c329ca3ad4df540feda74d291dd7c86/link", false},
+		{"/docker/registry/v2/blobs/a/b/c/data", false},
+		{"/etc/passwd", false},
+	} {
+		if result := isBlobDataPath(testcase.path); result != testcase.expected {
+			t.Fatalf("unexpected result %v for %s", result, testcase.path)
+		}
+	}
+}
@@ -3,11 +3,16 @@ package storage
 import (
 	"context"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
 	storageDriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/uuid"
+	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
 )
 
@@ -53,6 +58,103 @@ func PurgeUploads(ctx context.Context, driver storageDriver.StorageDriver, older
 	return deleted, errors
 }
 
+// Upload describes an upload session in progress.
+type Upload struct {
+	Repository string    `json:"repository"`
+	ID         string    `json:"id"`
+	StartedAt  time.Time `json:"startedAt"`
+
+	// Size is the number of bytes uploaded so far.
+	Size int64 `json:"size"`
+
+	// HashStateOffset is the offset of the latest hash state saved, from
+	// which the digest of the upload is resumed. It is zero when no hash
+	// state has been saved.
+	HashStateOffset int64 `json:"hashStateOffset"`
+}
+
+// ListUploads returns the upload sessions in progress, sorted by repository
+// and start time. If name is not empty, only the uploads to that repository
+// are returned. Errors met reading an upload do not stop the listing, and
+// are returned along with the uploads.
+func ListUploads(ctx context.Context, driver storageDriver.StorageDriver, name string) ([]Upload, []error) {
+	outstanding, errors := getOutstandingUploads(ctx, driver)
+
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return nil, append(errors, err)
+	}
+
+	uploads := make([]Upload, 0, len(outstanding))
+	for id, ud := range outstanding {
+		// the containing directory is <root>/<name>/_uploads/<id>
+		repository := strings.TrimPrefix(path.Dir(path.Dir(ud.containingDir)), root+"/")
+		if ud.containingDir == "" || (name != "" && repository != name) {
+			continue
+		}
+		upload := Upload{
+			Repository: repository,
+			ID:         id,
+			StartedAt:  ud.startedAt,
+		}
+
+		dataPath, err := pathFor(uploadDataPathSpec{name: repository, id: id})
+		if err != nil {
+			return nil, append(errors, err)
+		}
+		if fi, err := driver.Stat(ctx, dataPath); err == nil {
+			upload.Size = fi.Size()
+		} else if _, ok := err.(storageDriver.PathNotFoundError); !ok {
+			errors = pushError(errors, dataPath, err)
+		}
+
+		hashStatesPath, err := pathFor(uploadHashStatePathSpec{name: repository, id: id, alg: digest.Canonical, list: true})
+		if err != nil {
+			return nil, append(errors, err)
+		}
+		hashStates, err := driver.List(ctx, hashStatesPath)
+		if _, ok := err.(storageDriver.PathNotFoundError); err != nil && !ok {
+			errors = pushError(errors, hashStatesPath, err)
+		}
+		for _, p := range hashStates {
+			// the hash states are named after their offset
+			if offset, err := strconv.ParseInt(path.Base(p), 0, 64); err == nil && offset > upload.HashStateOffset {
+				upload.HashStateOffset = offset
+			}
+		}
+
+		uploads = append(uploads, upload)
+	}
+
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].Repository != uploads[j].Repository {
+			return uploads[i].Repository < uploads[j].Repository
+		}
+		return uploads[i].StartedAt.Before(uploads[j].StartedAt)
+	})
+	return uploads, errors
+}
+
+// CancelUpload cancels the upload session of the repository, removing its
+// files. It returns distribution.ErrBlobUploadUnknown if there is no such
+// upload.
+func CancelUpload(ctx context.Context, registry distribution.Namespace, name reference.Named, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return distribution.ErrBlobUploadUnknown
+	}
+
+	repository, err := registry.Repository(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	upload, err := repository.Blobs(ctx).Resume(ctx, id)
+	if err != nil {
+		return err
+	}
+	return upload.Cancel(ctx)
+}
+
 // getOutstandingUploads walks the upload directory, collecting files
 // which could be eligible for deletion.  The only reliable way to
 // classify the age of a file is with the date stored in the startedAt
@@ -7,6 +7,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/registry/storage/driver/inmemory"
 	"github.com/docker/distribution/uuid"
@@ -163,3 +165,86 @@ func TestPurgeMissingStartedAt(t *testing.T) {
 		t.Errorf("Files unexpectedly deleted: %s", deleted)
 	}
 }
+
+func TestListUploads(t *testing.T) {
+	d := inmemory.New()
+	ctx := context.Background()
+	registry, err := NewRegistry(ctx, d)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	startedAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	otherID := uuid.Generate().String()
+	addUploads(ctx, t, d, otherID, "other/repo", startedAt)
+
+	name, _ := reference.WithName("test/repo")
+	repo, err := registry.Repository(ctx, name)
+	if err != nil {
+		t.Fatalf("error getting repository: %v", err)
+	}
+	upload, err := repo.Blobs(ctx).Create(ctx)
+	if err != nil {
+		t.Fatalf("error creating upload: %v", err)
+	}
+	if _, err := upload.Write([]byte("some content")); err != nil {
+		t.Fatalf("error writing upload: %v", err)
+	}
+	// closing the upload saves its hash state
+	if err := upload.Close(); err != nil {
+		t.Fatalf("error closing upload: %v", err)
+	}
+
+	uploads, errs := ListUploads(ctx, d, "")
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %q", errs)
+	}
+	if len(uploads) != 2 {
+		t.Fatalf("expected 2 uploads, got %v", uploads)
+	}
+	if uploads[0].Repository != "other/repo" || uploads[0].ID != otherID || !uploads[0].StartedAt.Equal(startedAt) || uploads[0].Size != 0 || uploads[0].HashStateOffset != 0 {
+		t.Errorf("unexpected upload %+v", uploads[0])
+	}
+	if uploads[1].Repository != "test/repo" || uploads[1].ID != upload.ID() || uploads[1].Size != 12 || uploads[1].HashStateOffset != 12 {
+		t.Errorf("unexpected upload %+v", uploads[1])
+	}
+
+	uploads, errs = ListUploads(ctx, d, "test/repo")
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %q", errs)
+	}
+	if len(uploads) != 1 || uploads[0].ID != upload.ID() {
+		t.Errorf("expected the upload to test/repo only, got %v", uploads)
+	}
+}
+
+func TestCancelUpload(t *testing.T) {
+	fs, ctx := testUploadFS(t, 1, "test-repo", time.Now())
+	registry, err := NewRegistry(ctx, fs)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	uploads, _ := ListUploads(ctx, fs, "")
+	if len(uploads) != 1 {
+		t.Fatalf("expected a single upload, got %v", uploads)
+	}
+
+	name, _ := reference.WithName("test-repo")
+	for _, id := range []string{uuid.Generate().String(), "../../_layers"} {
+		if err := CancelUpload(ctx, registry, name, id); err != distribution.ErrBlobUploadUnknown {
+			t.Errorf("expected cancelling unknown upload %s to fail with %v, got %v", id, distribution.ErrBlobUploadUnknown, err)
+		}
+	}
+
+	if err := CancelUpload(ctx, registry, name, uploads[0].ID); err != nil {
+		t.Fatalf("error cancelling upload: %v", err)
+	}
+	id := uploads[0].ID
+	uploads, _ = ListUploads(ctx, fs, "")
+	if len(uploads) != 0 {
+		t.Errorf("expected no uploads left, got %v", uploads)
+	}
+	if err := CancelUpload(ctx, registry, name, id); err != distribution.ErrBlobUploadUnknown {
+		t.Errorf("expected cancelling the upload again to fail, got %v", err)
+	}
+}
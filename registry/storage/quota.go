@@ -0,0 +1,417 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// UsageStore keeps the counters with which UsageAccounting tracks the number
+// of bytes stored by repositories and namespaces.
+type UsageStore interface {
+	// Usage returns the counter stored under key. ok is false if no counter
+	// is stored under key.
+	Usage(ctx context.Context, key string) (usage int64, ok bool, err error)
+
+	// SetUsage stores a counter under key.
+	SetUsage(ctx context.Context, key string, usage int64) error
+
+	// AddUsage adds delta to the counter stored under key. It does nothing
+	// if no counter is stored under key.
+	AddUsage(ctx context.Context, key string, delta int64) error
+
+	// AddUsageWithin adds delta to the counters stored under keys, unless
+	// it would make one of them exceed the limit at the same index, a zero
+	// limit meaning no limit. The check and the update are atomic. It
+	// returns the index of the first counter which would exceed its limit,
+	// or -1 once delta is added. Counters which are not stored are neither
+	// checked nor changed.
+	AddUsageWithin(ctx context.Context, keys []string, limits []int64, delta int64) (int, error)
+}
+
+// UsageLimits are the numbers of bytes which repositories, and the
+// repositories of namespaces, may store. A zero limit means no limit.
+type UsageLimits struct {
+	// Repository applies to the repositories without a limit of their own.
+	Repository   int64
+	Repositories map[string]int64
+	Namespaces   map[string]int64
+}
+
+// ErrQuotaExceeded is returned when linking content into a repository would
+// make it, or one of its namespaces, exceed its limit.
+type ErrQuotaExceeded struct {
+	// Name is the repository the content is linked into.
+	Name string
+
+	// Namespace is set when the limit of a namespace would be exceeded
+	// rather than the limit of the repository.
+	Namespace string
+
+	Usage int64
+	Limit int64
+	Size  int64
+}
+
+func (err ErrQuotaExceeded) Error() string {
+	if err.Namespace != "" {
+		return fmt.Sprintf("storing %d bytes in %s would exceed the limit of %d bytes of namespace %s, which stores %d bytes", err.Size, err.Name, err.Limit, err.Namespace, err.Usage)
+	}
+	return fmt.Sprintf("storing %d bytes in %s would exceed its limit of %d bytes, as it stores %d bytes", err.Size, err.Name, err.Limit, err.Usage)
+}
+
+// UsageAccounting tracks the number of bytes of the blobs and manifests
+// linked into each repository, and into the repositories of a set of
+// namespaces. A blob linked into several repositories counts towards the
+// usage of each of them.
+//
+// Counters are computed from the content of the storage the first time they
+// are needed, then kept up to date as content is linked into repositories
+// and deleted from them, including by garbage collection and the retention
+// policies when they are given the UsageAccounting. Content is only linked
+// into a repository if it fits within the limits.
+type UsageAccounting struct {
+	store      UsageStore
+	limits     UsageLimits
+	namespaces []string
+	registry   *registry
+}
+
+// NewUsageAccounting returns a UsageAccounting which keeps its counters in
+// store and enforces limits. Along with the usage of each repository, the
+// total usage of the repositories of each of the namespaces with a limit is
+// tracked.
+func NewUsageAccounting(store UsageStore, limits UsageLimits) *UsageAccounting {
+	namespaces := make([]string, 0, len(limits.Namespaces))
+	for namespace := range limits.Namespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	return &UsageAccounting{
+		store:      store,
+		limits:     limits,
+		namespaces: namespaces,
+	}
+}
+
+// EnableUsageAccounting is a functional option for NewRegistry. It accounts
+// the content linked into repositories with ua. A UsageAccounting may only
+// be used with a single registry.
+func EnableUsageAccounting(ua *UsageAccounting) RegistryOption {
+	return func(registry *registry) error {
+		ua.registry = registry
+		registry.usage = ua
+		return nil
+	}
+}
+
+// repositoryUsageKey returns the key of the counter of a repository.
+func repositoryUsageKey(name string) string {
+	return path.Join("repositories", name)
+}
+
+// namespaceUsageKey returns the key of the counter of a namespace.
+func namespaceUsageKey(namespace string) string {
+	return path.Join("namespaces", namespace)
+}
+
+// inNamespace returns whether the repository is part of the namespace.
+func inNamespace(name, namespace string) bool {
+	return strings.HasPrefix(name, namespace+"/")
+}
+
+// RepositoryUsage returns the number of bytes stored by the repository.
+func (ua *UsageAccounting) RepositoryUsage(ctx context.Context, name string) (int64, error) {
+	key := repositoryUsageKey(name)
+	usage, ok, err := ua.store.Usage(ctx, key)
+	if err != nil || ok {
+		return usage, err
+	}
+
+	usage, err = ua.registry.repositoryUsage(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	return usage, ua.store.SetUsage(ctx, key, usage)
+}
+
+// NamespaceUsage returns the number of bytes stored by the repositories of
+// the namespace. The namespace must be one of those given to
+// NewUsageAccounting.
+func (ua *UsageAccounting) NamespaceUsage(ctx context.Context, namespace string) (int64, error) {
+	key := namespaceUsageKey(namespace)
+	usage, ok, err := ua.store.Usage(ctx, key)
+	if err != nil || ok {
+		return usage, err
+	}
+
+	usage = 0
+	err = ua.registry.Enumerate(ctx, func(name string) error {
+		if !inNamespace(name, namespace) {
+			return nil
+		}
+		repoUsage, err := ua.RepositoryUsage(ctx, name)
+		usage += repoUsage
+		return err
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		err = nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return usage, ua.store.SetUsage(ctx, key, usage)
+}
+
+// add accounts delta bytes to the repository and to its namespaces.
+func (ua *UsageAccounting) add(ctx context.Context, name string, delta int64) error {
+	if err := ua.store.AddUsage(ctx, repositoryUsageKey(name), delta); err != nil {
+		return err
+	}
+	for _, namespace := range ua.namespaces {
+		if !inNamespace(name, namespace) {
+			continue
+		}
+		if err := ua.store.AddUsage(ctx, namespaceUsageKey(namespace), delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reserve accounts size more bytes to the repository and to its namespaces,
+// unless it would make one of them exceed its limit, in which case an
+// ErrQuotaExceeded is returned.
+func (ua *UsageAccounting) reserve(ctx context.Context, name string, size int64) error {
+	// only the counters which are stored are checked
+	if _, err := ua.RepositoryUsage(ctx, name); err != nil {
+		return err
+	}
+	limit, ok := ua.limits.Repositories[name]
+	if !ok {
+		limit = ua.limits.Repository
+	}
+	keys := []string{repositoryUsageKey(name)}
+	limits := []int64{limit}
+	namespaces := []string{""}
+	for _, namespace := range ua.namespaces {
+		if !inNamespace(name, namespace) {
+			continue
+		}
+		if _, err := ua.NamespaceUsage(ctx, namespace); err != nil {
+			return err
+		}
+		keys = append(keys, namespaceUsageKey(namespace))
+		limits = append(limits, ua.limits.Namespaces[namespace])
+		namespaces = append(namespaces, namespace)
+	}
+
+	i, err := ua.store.AddUsageWithin(ctx, keys, limits, size)
+	if err != nil || i < 0 {
+		return err
+	}
+	usage, _, err := ua.store.Usage(ctx, keys[i])
+	if err != nil {
+		return err
+	}
+	return ErrQuotaExceeded{
+		Name:      name,
+		Namespace: namespaces[i],
+		Usage:     usage,
+		Limit:     limits[i],
+		Size:      size,
+	}
+}
+
+// linkedSize returns the size of the blob linked at the path of spec, or
+// zero if there is no such link or the blob is gone.
+func (ua *UsageAccounting) linkedSize(ctx context.Context, spec pathSpec) (int64, error) {
+	linkPath, err := pathFor(spec)
+	if err != nil {
+		return 0, err
+	}
+	dgst, err := ua.registry.blobStore.readlink(ctx, linkPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return 0, nil
+		}
+		return 0, err
+	}
+	desc, err := ua.registry.statter.Stat(ctx, dgst)
+	if err == distribution.ErrBlobUnknown {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return desc.Size, nil
+}
+
+// unlink calls remove to remove the links at the paths of specs from the
+// repository, then releases the usage of the blobs they linked. A nil
+// UsageAccounting only calls remove.
+func (ua *UsageAccounting) unlink(ctx context.Context, name string, remove func() error, specs ...pathSpec) error {
+	if ua == nil {
+		return remove()
+	}
+
+	var size int64
+	for _, spec := range specs {
+		linked, err := ua.linkedSize(ctx, spec)
+		if err != nil {
+			return err
+		}
+		size += linked
+	}
+	if err := remove(); err != nil {
+		return err
+	}
+	if size == 0 {
+		return nil
+	}
+	return ua.add(ctx, name, -size)
+}
+
+// repositoryUsage computes the number of bytes of the layers and manifests
+// linked into the repository.
+func (reg *registry) repositoryUsage(ctx context.Context, name string) (int64, error) {
+	var usage int64
+	for _, spec := range []pathSpec{layersPathSpec{name: name}, manifestRevisionsPathSpec{name: name}} {
+		rootPath, err := pathFor(spec)
+		if err != nil {
+			return 0, err
+		}
+
+		err = reg.driver.Walk(ctx, rootPath, func(fileInfo driver.FileInfo) error {
+			if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+				return nil
+			}
+
+			dgst, err := reg.blobStore.readlink(ctx, fileInfo.Path())
+			if err != nil {
+				return err
+			}
+			desc, err := reg.statter.Stat(ctx, dgst)
+			if err == distribution.ErrBlobUnknown {
+				// dangling link to a blob removed by garbage collection
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			usage += desc.Size
+			return nil
+		})
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return usage, nil
+}
+
+// storageUsageStore is a UsageStore which keeps the counters in the storage
+// backend, next to the repositories.
+type storageUsageStore struct {
+	driver driver.StorageDriver
+
+	// mu serializes the updates of the counters, which are only
+	// consistent when a single registry instance uses the storage.
+	mu sync.Mutex
+}
+
+// NewStorageUsageStore returns a UsageStore which keeps the counters in the
+// storage backend. The counters are only kept consistent when a single
+// registry instance updates them.
+func NewStorageUsageStore(storageDriver driver.StorageDriver) UsageStore {
+	return &storageUsageStore{driver: storageDriver}
+}
+
+func (s *storageUsageStore) Usage(ctx context.Context, key string) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage(ctx, key)
+}
+
+func (s *storageUsageStore) SetUsage(ctx context.Context, key string, usage int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.setUsage(ctx, key, usage)
+}
+
+func (s *storageUsageStore) AddUsage(ctx context.Context, key string, delta int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage, ok, err := s.usage(ctx, key)
+	if err != nil || !ok {
+		return err
+	}
+	return s.setUsage(ctx, key, usage+delta)
+}
+
+func (s *storageUsageStore) AddUsageWithin(ctx context.Context, keys []string, limits []int64, delta int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usages := make([]int64, len(keys))
+	stored := make([]bool, len(keys))
+	for i, key := range keys {
+		usage, ok, err := s.usage(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if ok && limits[i] > 0 && usage+delta > limits[i] {
+			return i, nil
+		}
+		usages[i], stored[i] = usage, ok
+	}
+	for i, key := range keys {
+		if !stored[i] {
+			continue
+		}
+		if err := s.setUsage(ctx, key, usages[i]+delta); err != nil {
+			return 0, err
+		}
+	}
+	return -1, nil
+}
+
+func (s *storageUsageStore) usage(ctx context.Context, key string) (int64, bool, error) {
+	usagePath, err := pathFor(usagePathSpec{key: key})
+	if err != nil {
+		return 0, false, err
+	}
+
+	content, err := s.driver.GetContent(ctx, usagePath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	usage, err := strconv.ParseInt(string(content), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid usage counter %s: %v", usagePath, err)
+	}
+	return usage, true, nil
+}
+
+func (s *storageUsageStore) setUsage(ctx context.Context, key string, usage int64) error {
+	usagePath, err := pathFor(usagePathSpec{key: key})
+	if err != nil {
+		return err
+	}
+	return s.driver.PutContent(ctx, usagePath, []byte(strconv.FormatInt(usage, 10)))
+}
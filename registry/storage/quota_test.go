@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestUsageAccounting(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	// Push content before accounting is enabled, so that the counters are
+	// computed from the storage.
+	reg := createRegistry(t, inmemoryDriver)
+	firstRepo := makeRepository(t, reg, "team/first")
+	first := uploadRandomSchema2Image(t, firstRepo)
+
+	ua := NewUsageAccounting(NewStorageUsageStore(inmemoryDriver), UsageLimits{Namespaces: map[string]int64{"team": 1 << 30}})
+	reg = createRegistry(t, inmemoryDriver, EnableUsageAccounting(ua))
+
+	blobSize := func(repo distribution.Repository, dgst digest.Digest) int64 {
+		desc, err := repo.Blobs(ctx).Stat(ctx, dgst)
+		if err != nil {
+			t.Fatalf("failed to stat %s: %v", dgst, err)
+		}
+		return desc.Size
+	}
+	imageSize := func(repo distribution.Repository, im image) int64 {
+		_, payload, err := im.manifest.Payload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := int64(len(payload))
+		for _, ref := range im.manifest.References() {
+			size += blobSize(repo, ref.Digest)
+		}
+		return size
+	}
+	checkUsage := func(name string, expected int64) {
+		t.Helper()
+		usage, err := ua.RepositoryUsage(ctx, name)
+		if err != nil {
+			t.Fatalf("failed to get usage of %s: %v", name, err)
+		}
+		if usage != expected {
+			t.Fatalf("expected usage of %s to be %d, got %d", name, expected, usage)
+		}
+	}
+	checkNamespaceUsage := func(expected int64) {
+		t.Helper()
+		usage, err := ua.NamespaceUsage(ctx, "team")
+		if err != nil {
+			t.Fatalf("failed to get namespace usage: %v", err)
+		}
+		if usage != expected {
+			t.Fatalf("expected namespace usage to be %d, got %d", expected, usage)
+		}
+	}
+
+	firstSize := imageSize(firstRepo, first)
+	checkUsage("team/first", firstSize)
+	checkNamespaceUsage(firstSize)
+
+	second := makeRepository(t, reg, "team/second")
+	im := uploadRandomSchema2Image(t, second)
+	secondSize := imageSize(second, im)
+	checkUsage("team/second", secondSize)
+	checkNamespaceUsage(firstSize + secondSize)
+
+	// Linking the same content again does not change the usage.
+	manifests, err := second.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manifests.Put(ctx, im.manifest); err != nil {
+		t.Fatalf("failed to put manifest again: %v", err)
+	}
+	checkUsage("team/second", secondSize)
+
+	// Content outside of the namespace is accounted to the repository only.
+	otherRepo := makeRepository(t, reg, "other")
+	other := uploadRandomSchema2Image(t, otherRepo)
+	checkUsage("other", imageSize(otherRepo, other))
+	checkNamespaceUsage(firstSize + secondSize)
+
+	// Deleting content releases its usage.
+	layer := im.manifest.References()[1]
+	layerSize := blobSize(second, layer.Digest)
+	if err := second.Blobs(ctx).Delete(ctx, layer.Digest); err != nil {
+		t.Fatalf("failed to delete layer: %v", err)
+	}
+	if err := manifests.Delete(ctx, im.manifestDigest); err != nil {
+		t.Fatalf("failed to delete manifest: %v", err)
+	}
+	_, payload, _ := im.manifest.Payload()
+	remaining := secondSize - layerSize - int64(len(payload))
+	checkUsage("team/second", remaining)
+	checkNamespaceUsage(firstSize + remaining)
+
+	// The counters match the content of the storage.
+	for _, name := range []string{"team/first", "team/second", "other"} {
+		counted, err := ua.RepositoryUsage(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		computed, err := reg.(*registry).repositoryUsage(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counted != computed {
+			t.Fatalf("usage of %s was counted as %d, but is %d", name, counted, computed)
+		}
+	}
+}
+
+func TestUsageAccountingLimits(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	ua := NewUsageAccounting(NewStorageUsageStore(inmemoryDriver), UsageLimits{
+		Repository: 100,
+		Namespaces: map[string]int64{"team": 150},
+	})
+	reg := createRegistry(t, inmemoryDriver, EnableUsageAccounting(ua))
+	first := makeRepository(t, reg, "team/first")
+	second := makeRepository(t, reg, "team/second")
+
+	put := func(repo distribution.Repository, content string) error {
+		_, err := repo.Blobs(ctx).Put(ctx, "application/octet-stream", []byte(content))
+		return err
+	}
+
+	if err := put(first, strings.Repeat("a", 60)); err != nil {
+		t.Fatalf("failed to put blob: %v", err)
+	}
+	err := put(first, strings.Repeat("b", 60))
+	if expected := (ErrQuotaExceeded{Name: "team/first", Usage: 60, Limit: 100, Size: 60}); err != expected {
+		t.Fatalf("expected %v, got %v", expected, err)
+	}
+	if err := put(second, strings.Repeat("c", 60)); err != nil {
+		t.Fatalf("failed to put blob: %v", err)
+	}
+	err = put(second, strings.Repeat("d", 40))
+	if expected := (ErrQuotaExceeded{Name: "team/second", Namespace: "team", Usage: 120, Limit: 150, Size: 40}); err != expected {
+		t.Fatalf("expected %v, got %v", expected, err)
+	}
+
+	// the rejected content is neither linked nor accounted
+	linked, err := reg.(*registry).repositoryUsage(ctx, "team/second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked != 60 {
+		t.Fatalf("expected 60 bytes to be linked into team/second, got %d", linked)
+	}
+	usage, err := ua.NamespaceUsage(ctx, "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != 120 {
+		t.Fatalf("expected namespace usage to be 120, got %d", usage)
+	}
+}
+
+func TestUsageAccountingRemovals(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	ua := NewUsageAccounting(NewStorageUsageStore(inmemoryDriver), UsageLimits{Namespaces: map[string]int64{"team": 1 << 30}})
+	reg := createRegistry(t, inmemoryDriver, EnableUsageAccounting(ua))
+	repo := makeRepository(t, reg, "team/repo")
+	other := makeRepository(t, reg, "team/other")
+
+	tagged := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	uploadRandomSchema2Image(t, repo)
+	otherImage := uploadRandomSchema2Image(t, other)
+	if err := other.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: otherImage.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	// a layer uploaded without a manifest referencing it
+	if _, err := other.Blobs(ctx).Put(ctx, "application/octet-stream", []byte("unreferenced")); err != nil {
+		t.Fatalf("failed to put blob: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	checkUsage := func(msg string) {
+		t.Helper()
+		for _, name := range []string{"team/repo", "team/other"} {
+			counted, err := ua.RepositoryUsage(ctx, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			computed, err := reg.(*registry).repositoryUsage(ctx, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counted != computed {
+				t.Fatalf("%s: usage of %s was counted as %d, but is %d", msg, name, counted, computed)
+			}
+		}
+	}
+	checkUsage("before removals")
+
+	rules := []RetentionRule{{UntaggedOlderThan: time.Millisecond}}
+	if err := ApplyRetention(ctx, inmemoryDriver, reg, rules, RetentionOpts{Usage: ua}); err != nil {
+		t.Fatalf("failed to apply retention: %v", err)
+	}
+	checkUsage("after retention")
+
+	if err := MarkAndSweep(ctx, inmemoryDriver, reg, GCOpts{Usage: ua}); err != nil {
+		t.Fatalf("failed to garbage collect: %v", err)
+	}
+	checkUsage("after garbage collection")
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"path"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/ocischema"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// referrerStore maintains the index of manifests which declare a subject
+// within a repository. Each referring manifest is recorded as a link under
+// the directory of its subject, so that all referrers of a manifest can be
+// found without scanning every revision in the repository.
+type referrerStore struct {
+	repository *repository
+	blobStore  *blobStore
+}
+
+// link records that the manifest revision declares subject as its subject.
+func (rs *referrerStore) link(ctx context.Context, subject, revision digest.Digest) error {
+	linkPath, err := pathFor(manifestReferrerLinkPathSpec{
+		name:     rs.repository.Named().Name(),
+		subject:  subject,
+		revision: revision,
+	})
+	if err != nil {
+		return err
+	}
+
+	return rs.blobStore.link(ctx, linkPath, revision)
+}
+
+// unlink removes the record of revision referring to subject. Removing a
+// link which does not exist is not an error.
+func (rs *referrerStore) unlink(ctx context.Context, subject, revision digest.Digest) error {
+	linkPath, err := pathFor(manifestReferrerLinkPathSpec{
+		name:     rs.repository.Named().Name(),
+		subject:  subject,
+		revision: revision,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := rs.blobStore.driver.Delete(ctx, path.Dir(linkPath)); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// enumerate calls ingester with the digest of each manifest revision which
+// has been linked as a referrer of subject. There is no ordering guaranteed.
+func (rs *referrerStore) enumerate(ctx context.Context, subject digest.Digest, ingester func(digest.Digest) error) error {
+	rootPath, err := pathFor(manifestReferrersPathSpec{
+		name:    rs.repository.Named().Name(),
+		subject: subject,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = rs.blobStore.driver.Walk(ctx, rootPath, func(fileInfo storagedriver.FileInfo) error {
+		if fileInfo.IsDir() {
+			return nil
+		}
+
+		if path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+
+		revision, err := rs.blobStore.readlink(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+
+		return ingester(revision)
+	})
+
+	if _, ok := err.(storagedriver.PathNotFoundError); ok {
+		// nothing refers to this subject yet
+		return nil
+	}
+
+	return err
+}
+
+// manifestSubject returns the subject declared by the manifest, or nil if the
+// manifest type does not support subjects or none is declared.
+func manifestSubject(m distribution.Manifest) *distribution.Descriptor {
+	switch m := m.(type) {
+	case *ocischema.DeserializedManifest:
+		return m.Subject
+	case *ocischema.DeserializedImageIndex:
+		return m.Subject
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"regexp"
+	"sync"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/reference"
@@ -18,13 +19,16 @@ type registry struct {
 	blobServer                   *blobServer
 	statter                      *blobStatter // global statter service.
 	blobDescriptorCacheProvider  cache.BlobDescriptorCacheProvider
+	manifestCacheProvider        cache.ManifestCacheProvider
+	repositoryIndex              cache.RepositoryIndex
 	deleteEnabled                bool
 	schema1Enabled               bool
 	resumableDigestEnabled       bool
 	schema1SigningKey            libtrust.PrivateKey
 	blobDescriptorServiceFactory distribution.BlobDescriptorServiceFactory
-	manifestURLs                 manifestURLs
+	manifestURLs                 *ManifestURLs
 	driver                       storagedriver.StorageDriver
+	usage                        *UsageAccounting
 }
 
 // manifestURLs holds regular expressions for controlling manifest URL whitelisting
@@ -33,6 +37,36 @@ type manifestURLs struct {
 	deny  *regexp.Regexp
 }
 
+// ManifestURLs holds the regular expressions validating the URLs of the
+// foreign layers of the manifests pushed. They may be replaced while the
+// registry is serving requests.
+type ManifestURLs struct {
+	mu   sync.RWMutex
+	urls manifestURLs
+}
+
+// NewManifestURLs returns a validation accepting the URLs which match allow
+// and do not match deny. A nil regular expression is not checked.
+func NewManifestURLs(allow, deny *regexp.Regexp) *ManifestURLs {
+	return &ManifestURLs{urls: manifestURLs{allow: allow, deny: deny}}
+}
+
+// Set replaces the regular expressions. The manifests pushed to the
+// repositories already opened are still validated by the previous ones.
+func (m *ManifestURLs) Set(allow, deny *regexp.Regexp) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.urls = manifestURLs{allow: allow, deny: deny}
+}
+
+func (m *ManifestURLs) get() manifestURLs {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.urls
+}
+
 // RegistryOption is the type used for functional options for NewRegistry.
 type RegistryOption func(*registry) error
 
@@ -67,7 +101,7 @@ func DisableDigestResumption(registry *registry) error {
 // ManifestURLsAllowRegexp is a functional option for NewRegistry.
 func ManifestURLsAllowRegexp(r *regexp.Regexp) RegistryOption {
 	return func(registry *registry) error {
-		registry.manifestURLs.allow = r
+		registry.manifestURLs.urls.allow = r
 		return nil
 	}
 }
@@ -75,7 +109,16 @@ func ManifestURLsAllowRegexp(r *regexp.Regexp) RegistryOption {
 // ManifestURLsDenyRegexp is a functional option for NewRegistry.
 func ManifestURLsDenyRegexp(r *regexp.Regexp) RegistryOption {
 	return func(registry *registry) error {
-		registry.manifestURLs.deny = r
+		registry.manifestURLs.urls.deny = r
+		return nil
+	}
+}
+
+// ManifestURLsValidation is a functional option for NewRegistry. The URLs of
+// the foreign layers are validated by urls, which may be replaced later on.
+func ManifestURLsValidation(urls *ManifestURLs) RegistryOption {
+	return func(registry *registry) error {
+		registry.manifestURLs = urls
 		return nil
 	}
 }
@@ -118,6 +161,27 @@ func BlobDescriptorCacheProvider(blobDescriptorCacheProvider cache.BlobDescripto
 	}
 }
 
+// ManifestCacheProvider returns a functional option for NewRegistry. It
+// caches the resolution of tags and the manifest payloads of the
+// repositories.
+func ManifestCacheProvider(manifestCacheProvider cache.ManifestCacheProvider) RegistryOption {
+	return func(registry *registry) error {
+		registry.manifestCacheProvider = manifestCacheProvider
+		return nil
+	}
+}
+
+// RepositoryIndex returns a functional option for NewRegistry. It records the
+// repositories in the index as their first manifest is pushed, and removes
+// them from it when they are removed, so the catalog is listed from the index
+// once it is complete. See BuildRepositoryIndex.
+func RepositoryIndex(repositoryIndex cache.RepositoryIndex) RegistryOption {
+	return func(registry *registry) error {
+		registry.repositoryIndex = repositoryIndex
+		return nil
+	}
+}
+
 // NewRegistry creates a new registry instance from the provided driver. The
 // resulting registry may be shared by multiple goroutines but is cheap to
 // allocate. If the Redirect option is specified, the backend blob server will
@@ -142,6 +206,7 @@ func NewRegistry(ctx context.Context, driver storagedriver.StorageDriver, option
 		},
 		statter:                statter,
 		resumableDigestEnabled: true,
+		manifestURLs:           &ManifestURLs{},
 		driver:                 driver,
 	}
 
@@ -173,11 +238,21 @@ func (reg *registry) Repository(ctx context.Context, canonicalName reference.Nam
 		}
 	}
 
+	var manifestCache cache.ManifestCache
+	if reg.manifestCacheProvider != nil {
+		var err error
+		manifestCache, err = reg.manifestCacheProvider.RepositoryScoped(canonicalName.Name())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &repository{
 		ctx:             ctx,
 		registry:        reg,
 		name:            canonicalName,
 		descriptorCache: descriptorCache,
+		manifestCache:   manifestCache,
 	}, nil
 }
 
@@ -195,6 +270,7 @@ type repository struct {
 	ctx             context.Context
 	name            reference.Named
 	descriptorCache distribution.BlobDescriptorService
+	manifestCache   cache.ManifestCache
 }
 
 // Name returns the name of the repository.
@@ -233,6 +309,7 @@ func (repo *repository) Manifests(ctx context.Context, options ...distribution.M
 		repository:           repo,
 		deleteEnabled:        repo.registry.deleteEnabled,
 		blobAccessController: statter,
+		usage:                repo.registry.usage,
 
 		// TODO(stevvooe): linkPath limits this blob store to only
 		// manifests. This instance cannot be used for blob checks.
@@ -259,32 +336,41 @@ func (repo *repository) Manifests(ctx context.Context, options ...distribution.M
 		}
 	}
 
+	referrers := &referrerStore{
+		repository: repo,
+		blobStore:  repo.blobStore,
+	}
+
 	manifestListHandler := &manifestListHandler{
 		ctx:        ctx,
 		repository: repo,
 		blobStore:  blobStore,
 	}
 
+	manifestURLs := repo.registry.manifestURLs.get()
 	ms := &manifestStore{
 		ctx:            ctx,
 		repository:     repo,
 		blobStore:      blobStore,
+		referrers:      referrers,
 		schema1Handler: v1Handler,
 		schema2Handler: &schema2ManifestHandler{
 			ctx:          ctx,
 			repository:   repo,
 			blobStore:    blobStore,
-			manifestURLs: repo.registry.manifestURLs,
+			manifestURLs: manifestURLs,
 		},
 		manifestListHandler: manifestListHandler,
 		ocischemaHandler: &ocischemaManifestHandler{
 			ctx:          ctx,
 			repository:   repo,
 			blobStore:    blobStore,
-			manifestURLs: repo.registry.manifestURLs,
+			referrers:    referrers,
+			manifestURLs: manifestURLs,
 		},
 		ocischemaIndexHandler: &ocischemaIndexHandler{
 			manifestListHandler: manifestListHandler,
+			referrers:           referrers,
 		},
 	}
 
@@ -331,5 +417,6 @@ func (repo *repository) Blobs(ctx context.Context) distribution.BlobStore {
 		linkDirectoryPathSpec:  layersPathSpec{name: repo.name.Name()},
 		deleteEnabled:          repo.registry.deleteEnabled,
 		resumableDigestEnabled: repo.resumableDigestEnabled,
+		usage:                  repo.registry.usage,
 	}
 }
@@ -0,0 +1,359 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// RetentionRule selects tags or manifests of a set of repositories to keep
+// or expire.
+type RetentionRule struct {
+	// Repository selects the repositories the rule applies to. A nil
+	// expression selects all repositories.
+	Repository *regexp.Regexp
+
+	// Tags selects the tags the rule applies to. A nil expression selects
+	// all tags.
+	Tags *regexp.Regexp
+
+	// Protect keeps the selected tags, even when another rule expires them.
+	Protect bool
+
+	// KeepLast expires all but the KeepLast most recently pushed selected
+	// tags. When zero, the rule expires no tags.
+	KeepLast int
+
+	// UntaggedOlderThan expires untagged manifests pushed longer ago than
+	// this duration. With a Tags expression, only the manifests which a
+	// selected tag pointed at before being moved are expired. When zero, the
+	// rule expires no manifests.
+	UntaggedOlderThan time.Duration
+}
+
+// RetentionOpts contains options for ApplyRetention.
+type RetentionOpts struct {
+	// DryRun reports expired content without removing it.
+	DryRun bool
+
+	// TagExpired, if set, is called for each tag expired by the rules.
+	TagExpired func(repo reference.Named, tag string, desc distribution.Descriptor)
+
+	// ManifestExpired, if set, is called for each manifest expired by the
+	// rules.
+	ManifestExpired func(repo reference.Named, dgst digest.Digest)
+
+	// Usage, if set, has the usage of the repositories reduced by the
+	// manifests removed.
+	Usage *UsageAccounting
+}
+
+// ApplyRetention evaluates the retention rules against every repository of
+// the registry, untagging expired tags and removing expired manifests.
+// Untagged manifests are never removed while another manifest which is kept
+// references them or is their subject. Blobs are left in place for garbage
+// collection.
+func ApplyRetention(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, rules []RetentionRule, opts RetentionOpts) error {
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	vacuum := NewVacuum(ctx, storageDriver)
+	return repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		var repoRules []RetentionRule
+		for _, rule := range rules {
+			if rule.Repository == nil || rule.Repository.MatchString(repoName) {
+				repoRules = append(repoRules, rule)
+			}
+		}
+		if len(repoRules) == 0 {
+			return nil
+		}
+
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+		}
+		repository, err := registry.Repository(ctx, named)
+		if err != nil {
+			return fmt.Errorf("failed to construct repository: %v", err)
+		}
+
+		tagged, err := expireTags(ctx, storageDriver, repository, repoRules, opts)
+		if err != nil {
+			return err
+		}
+
+		return expireManifests(ctx, storageDriver, vacuum, repository, repoRules, tagged, opts)
+	})
+}
+
+// retainedTag is a tag of a repository along with the time it was last
+// pushed.
+type retainedTag struct {
+	name     string
+	desc     distribution.Descriptor
+	pushedAt time.Time
+}
+
+// expireTags untags the tags of the repository expired by the rules, and
+// returns the digests of the manifests which were tagged before, whether
+// their tags are kept or expired.
+func expireTags(ctx context.Context, storageDriver driver.StorageDriver, repository distribution.Repository, rules []RetentionRule, opts RetentionOpts) (map[digest.Digest]struct{}, error) {
+	repoName := repository.Named().Name()
+	tagService := repository.Tags(ctx)
+
+	allTags, err := tagService.All(ctx)
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+			return nil, fmt.Errorf("failed to retrieve tags %v", err)
+		}
+	}
+
+	tags := make([]retainedTag, 0, len(allTags))
+	for _, tag := range allTags {
+		desc, err := tagService.Get(ctx, tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				// untagged since it was listed
+				continue
+			}
+			return nil, fmt.Errorf("failed to retrieve tag %s: %v", tag, err)
+		}
+
+		currentPath, err := pathFor(manifestTagCurrentPathSpec{name: repoName, tag: tag})
+		if err != nil {
+			return nil, err
+		}
+		fileInfo, err := storageDriver.Stat(ctx, currentPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat tag %s: %v", tag, err)
+		}
+
+		tags = append(tags, retainedTag{name: tag, desc: desc, pushedAt: fileInfo.ModTime()})
+	}
+
+	// most recently pushed first
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].pushedAt.After(tags[j].pushedAt)
+	})
+
+	protected := make(map[string]struct{})
+	for _, rule := range rules {
+		if !rule.Protect {
+			continue
+		}
+		for _, tag := range tags {
+			if rule.Tags == nil || rule.Tags.MatchString(tag.name) {
+				protected[tag.name] = struct{}{}
+			}
+		}
+	}
+
+	expired := make(map[string]struct{})
+	for _, rule := range rules {
+		if rule.KeepLast <= 0 {
+			continue
+		}
+		selected := 0
+		for _, tag := range tags {
+			if rule.Tags != nil && !rule.Tags.MatchString(tag.name) {
+				continue
+			}
+			selected++
+			if selected <= rule.KeepLast {
+				continue
+			}
+			if _, ok := protected[tag.name]; !ok {
+				expired[tag.name] = struct{}{}
+			}
+		}
+	}
+
+	tagged := make(map[digest.Digest]struct{})
+	for _, tag := range tags {
+		tagged[tag.desc.Digest] = struct{}{}
+		if _, ok := expired[tag.name]; !ok {
+			continue
+		}
+
+		if opts.TagExpired != nil {
+			opts.TagExpired(repository.Named(), tag.name, tag.desc)
+		}
+		if opts.DryRun {
+			continue
+		}
+		if err := tagService.Untag(ctx, tag.name); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				return nil, fmt.Errorf("failed to untag %s: %v", tag.name, err)
+			}
+		}
+	}
+
+	return tagged, nil
+}
+
+// expireManifests removes the untagged manifests of the repository expired
+// by the rules. Each rule expires the manifests pushed longer ago than its
+// own UntaggedOlderThan which it selects: all of them when it has no Tags
+// expression, or else those which a selected tag pointed at before being
+// moved. The manifests in tagged are left in place, including those whose
+// tags were expired by this run, which are removed by a later run.
+func expireManifests(ctx context.Context, storageDriver driver.StorageDriver, vacuum Vacuum, repository distribution.Repository, rules []RetentionRule, tagged map[digest.Digest]struct{}, opts RetentionOpts) error {
+	var untaggedRules []RetentionRule
+	for _, rule := range rules {
+		if rule.UntaggedOlderThan > 0 {
+			untaggedRules = append(untaggedRules, rule)
+		}
+	}
+	if len(untaggedRules) == 0 {
+		return nil
+	}
+	now := time.Now()
+
+	repoName := repository.Named().Name()
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to construct manifest service: %v", err)
+	}
+	manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+	if !ok {
+		return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+	}
+	tagService := repository.Tags(ctx)
+	tagsProvider, ok := tagService.(distribution.TagManifestsProvider)
+	if !ok {
+		return fmt.Errorf("unable to convert TagService into TagManifestsProvider")
+	}
+
+	// Index the tags which have pointed at each manifest, to select the
+	// manifests of the rules with a Tags expression, and so that their
+	// history is cleaned up along with them.
+	allTags, err := tagService.All(ctx)
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+			return fmt.Errorf("failed to retrieve tags %v", err)
+		}
+	}
+	history := make(map[digest.Digest][]string)
+	for _, tag := range allTags {
+		dgsts, err := tagsProvider.ManifestDigests(ctx, tag)
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				// untagged since it was listed
+				continue
+			}
+			return fmt.Errorf("failed to retrieve manifests of tag %s: %v", tag, err)
+		}
+		for _, dgst := range dgsts {
+			history[dgst] = append(history[dgst], tag)
+		}
+	}
+
+	selects := func(rule RetentionRule, dgst digest.Digest) bool {
+		if rule.Tags == nil {
+			return true
+		}
+		for _, tag := range history[dgst] {
+			if rule.Tags.MatchString(tag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	manifests := make(map[digest.Digest]distribution.Manifest)
+	candidates := make(map[digest.Digest]struct{})
+	err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+		manifest, err := manifestService.Get(ctx, dgst)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
+		}
+		manifests[dgst] = manifest
+
+		if _, ok := tagged[dgst]; ok {
+			return nil
+		}
+		for _, rule := range untaggedRules {
+			if !selects(rule, dgst) {
+				continue
+			}
+			recent, err := writtenSince(ctx, storageDriver, manifestRevisionLinkPathSpec{name: repoName, revision: dgst}, now.Add(-rule.UntaggedOlderThan))
+			if err != nil {
+				return err
+			}
+			if !recent {
+				candidates[dgst] = struct{}{}
+				break
+			}
+		}
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Manifests referenced by a kept manifest, such as the platform
+	// manifests of an index, are kept along with it, as are referrers of a
+	// kept subject.
+	for keptManifest := true; keptManifest; {
+		keptManifest = false
+		for dgst, manifest := range manifests {
+			_, candidate := candidates[dgst]
+			if !candidate {
+				for _, ref := range manifest.References() {
+					if _, ok := candidates[ref.Digest]; ok {
+						delete(candidates, ref.Digest)
+						keptManifest = true
+					}
+				}
+				continue
+			}
+			if subject := manifestSubject(manifest); subject != nil {
+				if _, ok := manifests[subject.Digest]; ok {
+					if _, ok := candidates[subject.Digest]; !ok {
+						delete(candidates, dgst)
+						keptManifest = true
+					}
+				}
+			}
+		}
+	}
+
+	for dgst := range candidates {
+		if opts.ManifestExpired != nil {
+			opts.ManifestExpired(repository.Named(), dgst)
+		}
+		if opts.DryRun {
+			continue
+		}
+
+		err := opts.Usage.unlink(ctx, repoName, func() error {
+			return vacuum.RemoveManifest(repoName, dgst, history[dgst])
+		}, manifestRevisionLinkPathSpec{name: repoName, revision: dgst})
+		if err != nil {
+			return fmt.Errorf("failed to delete manifest %s: %v", dgst, err)
+		}
+		if err := clearCachedManifest(ctx, repository, dgst); err != nil {
+			return fmt.Errorf("failed to clear cached manifest %s: %v", dgst, err)
+		}
+		if subject := manifestSubject(manifests[dgst]); subject != nil {
+			if err := vacuum.RemoveReferrerLink(repoName, subject.Digest, dgst); err != nil {
+				return fmt.Errorf("failed to delete referrer link %s for manifest %s: %v", dgst, repoName, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestRetentionKeepLastTags(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "retention/tags")
+	other := makeRepository(t, registry, "other")
+
+	for _, tag := range []string{"v1", "build-1", "build-2", "build-3", "latest"} {
+		im := uploadRandomSchema2Image(t, repo)
+		if err := repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: im.manifestDigest}); err != nil {
+			t.Fatalf("failed to tag manifest: %v", err)
+		}
+		// order the tags by push time
+		time.Sleep(5 * time.Millisecond)
+	}
+	im := uploadRandomSchema2Image(t, other)
+	if err := other.Tags(ctx).Tag(ctx, "build-1", distribution.Descriptor{Digest: im.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	rules := []RetentionRule{
+		{Tags: regexp.MustCompile(`^v\d+`), Protect: true},
+		{Repository: regexp.MustCompile(`^retention/`), KeepLast: 2},
+	}
+
+	var expired []string
+	opts := RetentionOpts{
+		DryRun: true,
+		TagExpired: func(repo reference.Named, tag string, desc distribution.Descriptor) {
+			expired = append(expired, repo.Name()+":"+tag)
+		},
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		expired = nil
+		opts.DryRun = dryRun
+		if err := ApplyRetention(ctx, inmemoryDriver, registry, rules, opts); err != nil {
+			t.Fatalf("failed to apply retention: %v", err)
+		}
+
+		sort.Strings(expired)
+		expected := []string{"retention/tags:build-1", "retention/tags:build-2"}
+		if !reflect.DeepEqual(expired, expected) {
+			t.Fatalf("dryrun=%t: expected expired tags %v, got %v", dryRun, expected, expired)
+		}
+	}
+
+	tags, err := repo.Tags(ctx).All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"build-3", "latest", "v1"}; !reflect.DeepEqual(tags, expected) {
+		t.Fatalf("expected remaining tags %v, got %v", expected, tags)
+	}
+
+	tags, err = other.Tags(ctx).All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"build-1"}; !reflect.DeepEqual(tags, expected) {
+		t.Fatalf("expected tags of a repository without rules to be kept, got %v", tags)
+	}
+}
+
+func TestRetentionUntaggedManifests(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "retention/untagged")
+	manifestService := makeManifestService(t, repo)
+
+	putManifest := func(content string, subject *distribution.Descriptor) distribution.Descriptor {
+		config, err := repo.Blobs(ctx).Put(ctx, v1.MediaTypeImageConfig, []byte(content))
+		if err != nil {
+			t.Fatalf("failed to upload config: %v", err)
+		}
+		config.MediaType = v1.MediaTypeImageConfig
+
+		m, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned: ocischema.SchemaVersion,
+			Config:    config,
+			Layers:    []distribution.Descriptor{},
+			Subject:   subject,
+		})
+		if err != nil {
+			t.Fatalf("failed to make manifest: %v", err)
+		}
+
+		dgst, err := manifestService.Put(ctx, m)
+		if err != nil {
+			t.Fatalf("manifest upload failed: %v", err)
+		}
+		_, payload, _ := m.Payload()
+		return distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: dgst, Size: int64(len(payload))}
+	}
+
+	untagged := putManifest("untagged", nil)
+	platform := putManifest("platform", nil)
+	index, err := ocischema.FromDescriptors([]distribution.Descriptor{platform}, nil)
+	if err != nil {
+		t.Fatalf("failed to make index: %v", err)
+	}
+	indexDigest, err := manifestService.Put(ctx, index)
+	if err != nil {
+		t.Fatalf("index upload failed: %v", err)
+	}
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: indexDigest}); err != nil {
+		t.Fatalf("failed to tag index: %v", err)
+	}
+	signature := putManifest("signature", &distribution.Descriptor{MediaType: v1.MediaTypeImageIndex, Digest: indexDigest})
+
+	time.Sleep(50 * time.Millisecond)
+	recent := putManifest("recent", nil)
+
+	var expired []digest.Digest
+	err = ApplyRetention(ctx, inmemoryDriver, registry, []RetentionRule{{UntaggedOlderThan: 25 * time.Millisecond}}, RetentionOpts{
+		ManifestExpired: func(repo reference.Named, dgst digest.Digest) {
+			expired = append(expired, dgst)
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to apply retention: %v", err)
+	}
+
+	if len(expired) != 1 || expired[0] != untagged.Digest {
+		t.Fatalf("expected only %s to expire, got %v", untagged.Digest, expired)
+	}
+
+	manifests := allManifests(t, manifestService)
+	if _, ok := manifests[untagged.Digest]; ok {
+		t.Fatalf("expired manifest %s is present", untagged.Digest)
+	}
+	for _, dgst := range []digest.Digest{indexDigest, platform.Digest, signature.Digest, recent.Digest} {
+		if _, ok := manifests[dgst]; !ok {
+			t.Fatalf("manifest %s was removed", dgst)
+		}
+	}
+}
+
+func TestRetentionUntaggedManifestsPerRule(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "retention/rules")
+
+	tag := func(tag string) digest.Digest {
+		im := uploadRandomSchema2Image(t, repo)
+		if err := repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: im.manifestDigest}); err != nil {
+			t.Fatalf("failed to tag manifest: %v", err)
+		}
+		return im.manifestDigest
+	}
+
+	// untagged by moving their tag
+	build := tag("build")
+	tag("build")
+	release := tag("release")
+	tag("release")
+	never := uploadRandomSchema2Image(t, repo).manifestDigest
+	// untagged by the expiry of its tag
+	old := tag("old")
+	time.Sleep(5 * time.Millisecond)
+	tag("new")
+	time.Sleep(50 * time.Millisecond)
+
+	rules := []RetentionRule{
+		{Tags: regexp.MustCompile(`^build$`), UntaggedOlderThan: 25 * time.Millisecond},
+		{Tags: regexp.MustCompile(`^release$`), UntaggedOlderThan: time.Hour},
+		{Tags: regexp.MustCompile(`^(old|new)$`), KeepLast: 1, UntaggedOlderThan: 25 * time.Millisecond},
+	}
+
+	var expiredTags []string
+	var expiredManifests []digest.Digest
+	opts := RetentionOpts{
+		TagExpired: func(repo reference.Named, tag string, desc distribution.Descriptor) {
+			expiredTags = append(expiredTags, tag)
+		},
+		ManifestExpired: func(repo reference.Named, dgst digest.Digest) {
+			expiredManifests = append(expiredManifests, dgst)
+		},
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		expiredTags, expiredManifests = nil, nil
+		opts.DryRun = dryRun
+		if err := ApplyRetention(ctx, inmemoryDriver, registry, rules, opts); err != nil {
+			t.Fatalf("failed to apply retention: %v", err)
+		}
+
+		if expected := []string{"old"}; !reflect.DeepEqual(expiredTags, expected) {
+			t.Fatalf("dryrun=%t: expected expired tags %v, got %v", dryRun, expected, expiredTags)
+		}
+		if expected := []digest.Digest{build}; !reflect.DeepEqual(expiredManifests, expected) {
+			t.Fatalf("dryrun=%t: expected expired manifests %v, got %v", dryRun, expected, expiredManifests)
+		}
+	}
+
+	manifests := allManifests(t, makeManifestService(t, repo))
+	if _, ok := manifests[build]; ok {
+		t.Fatalf("expired manifest %s is present", build)
+	}
+	for _, dgst := range []digest.Digest{release, never, old} {
+		if _, ok := manifests[dgst]; !ok {
+			t.Fatalf("manifest %s was removed", dgst)
+		}
+	}
+}
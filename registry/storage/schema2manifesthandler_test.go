@@ -315,3 +315,49 @@ func TestVerifyManifestBlobLayerAndConfig(t *testing.T) {
 		checkFn(m, c.Err)
 	}
 }
+
+func TestVerifyManifestForeignLayerURLsReplaced(t *testing.T) {
+	ctx := context.Background()
+	urls := NewManifestURLs(regexp.MustCompile("^https?://foo"), nil)
+	registry := createRegistry(t, inmemory.New(), ManifestURLsValidation(urls))
+
+	repo := makeRepository(t, registry, "test")
+	config, err := repo.Blobs(ctx).Put(ctx, schema2.MediaTypeImageConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dm, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 2,
+			MediaType:     schema2.MediaTypeManifest,
+		},
+		Config: config,
+		Layers: []distribution.Descriptor{{
+			Digest:    "sha256:463435349086340864309863409683460843608348608934092322395278926a",
+			Size:      6323,
+			MediaType: schema2.MediaTypeForeignLayer,
+			URLs:      []string{"https://bar/layer"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func() error {
+		_, err := makeManifestService(t, makeRepository(t, registry, "test")).Put(ctx, dm)
+		if verr, ok := err.(distribution.ErrManifestVerification); ok && len(verr) > 0 {
+			return verr[0]
+		}
+		return err
+	}
+	if err := put(); err != errInvalidURL {
+		t.Fatalf("expected %v, got %v", errInvalidURL, err)
+	}
+
+	// the repositories opened once replaced validate with the new expressions
+	urls.Set(regexp.MustCompile("^https?://bar"), nil)
+	if err := put(); err != nil {
+		t.Fatalf("unexpected error once the expressions are replaced: %v", err)
+	}
+}
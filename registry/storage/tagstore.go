@@ -4,10 +4,15 @@ import (
 	"context"
 	"path"
 	"sort"
+	"time"
 
 	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/cache"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/tracing"
 	"github.com/opencontainers/go-digest"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var _ distribution.TagService = &tagStore{}
@@ -23,7 +28,10 @@ type tagStore struct {
 }
 
 // All returns all tags
-func (ts *tagStore) All(ctx context.Context) ([]string, error) {
+func (ts *tagStore) All(ctx context.Context) (_ []string, err error) {
+	ctx, span := tracing.StartSpan(ctx, "(*tagStore).All")
+	defer func() { tracing.EndSpan(span, err) }()
+
 	var tags []string
 
 	pathSpec, err := pathFor(manifestTagPathSpec{
@@ -57,7 +65,10 @@ func (ts *tagStore) All(ctx context.Context) ([]string, error) {
 
 // Tag tags the digest with the given tag, updating the the store to point at
 // the current tag. The digest must point to a manifest.
-func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
+func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descriptor) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "(*tagStore).Tag", attribute.String("registry.tag", tag), attribute.String("registry.digest", desc.Digest.String()))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	currentPath, err := pathFor(manifestTagCurrentPathSpec{
 		name: ts.repository.Named().Name(),
 		tag:  tag,
@@ -74,11 +85,21 @@ func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descr
 	}
 
 	// Overwrite the current link
-	return ts.blobStore.link(ctx, currentPath, desc.Digest)
+	if err := ts.blobStore.link(ctx, currentPath, desc.Digest); err != nil {
+		return err
+	}
+
+	if ts.repository.manifestCache != nil {
+		return ts.repository.manifestCache.ClearTag(ctx, tag)
+	}
+	return nil
 }
 
 // resolve the current revision for name and tag.
-func (ts *tagStore) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
+func (ts *tagStore) Get(ctx context.Context, tag string) (_ distribution.Descriptor, err error) {
+	ctx, span := tracing.StartSpan(ctx, "(*tagStore).Get", attribute.String("registry.tag", tag))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	currentPath, err := pathFor(manifestTagCurrentPathSpec{
 		name: ts.repository.Named().Name(),
 		tag:  tag,
@@ -87,6 +108,18 @@ func (ts *tagStore) Get(ctx context.Context, tag string) (distribution.Descripto
 		return distribution.Descriptor{}, err
 	}
 
+	var (
+		cacheErr error
+		version  cache.TagVersion
+	)
+	if ts.repository.manifestCache != nil {
+		var revision digest.Digest
+		revision, version, cacheErr = ts.repository.manifestCache.GetTag(ctx, tag)
+		if cacheErr == nil {
+			return distribution.Descriptor{Digest: revision}, nil
+		}
+	}
+
 	revision, err := ts.blobStore.readlink(ctx, currentPath)
 	if err != nil {
 		switch err.(type) {
@@ -97,11 +130,28 @@ func (ts *tagStore) Get(ctx context.Context, tag string) (distribution.Descripto
 		return distribution.Descriptor{}, err
 	}
 
+	if ts.repository.manifestCache != nil {
+		switch cacheErr.(type) {
+		case distribution.ErrTagUnknown:
+			// the tag is not cached if it was moved or removed since the
+			// version was read, as the revision may predate that
+			if err := ts.repository.manifestCache.SetTag(ctx, tag, revision, version); err != nil {
+				dcontext.GetLoggerWithField(ctx, "tag", tag).WithError(err).Error("error from cache setting tag")
+			}
+		default:
+			// do not store in the cache as it may trigger many set calls
+			dcontext.GetLoggerWithField(ctx, "tag", tag).WithError(cacheErr).Error("error from cache getting tag")
+		}
+	}
+
 	return distribution.Descriptor{Digest: revision}, nil
 }
 
 // Untag removes the tag association
-func (ts *tagStore) Untag(ctx context.Context, tag string) error {
+func (ts *tagStore) Untag(ctx context.Context, tag string) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "(*tagStore).Untag", attribute.String("registry.tag", tag))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	tagPath, err := pathFor(manifestTagPathSpec{
 		name: ts.repository.Named().Name(),
 		tag:  tag,
@@ -110,7 +160,15 @@ func (ts *tagStore) Untag(ctx context.Context, tag string) error {
 		return err
 	}
 
-	return ts.blobStore.driver.Delete(ctx, tagPath)
+	err = ts.blobStore.driver.Delete(ctx, tagPath)
+
+	// the tag may be cached even when it is already gone from the storage
+	if ts.repository.manifestCache != nil {
+		if cacheErr := ts.repository.manifestCache.ClearTag(ctx, tag); cacheErr != nil && err == nil {
+			return cacheErr
+		}
+	}
+	return err
 }
 
 // linkedBlobStore returns the linkedBlobStore for the named tag, allowing one
@@ -171,6 +229,60 @@ func (ts *tagStore) Lookup(ctx context.Context, desc distribution.Descriptor) ([
 	return tags, nil
 }
 
+// Describe returns the manifest the tag points to, with its media type and
+// size, along with the modification time of the tag link, which is the time
+// the tag was last pushed.
+func (ts *tagStore) Describe(ctx context.Context, tag string) (distribution.TagDescription, error) {
+	modTime, err := ts.ModTime(ctx, tag)
+	if err != nil {
+		return distribution.TagDescription{}, err
+	}
+
+	desc, err := ts.Get(ctx, tag)
+	if err != nil {
+		return distribution.TagDescription{}, err
+	}
+
+	manifests, err := ts.repository.Manifests(ctx)
+	if err != nil {
+		return distribution.TagDescription{}, err
+	}
+	manifest, err := manifests.Get(ctx, desc.Digest)
+	if err != nil {
+		return distribution.TagDescription{}, err
+	}
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return distribution.TagDescription{}, err
+	}
+
+	desc.MediaType = mediaType
+	desc.Size = int64(len(payload))
+	return distribution.TagDescription{Descriptor: desc, ModTime: modTime}, nil
+}
+
+// ModTime returns the modification time of the tag link, which is the time
+// the tag was last pushed.
+func (ts *tagStore) ModTime(ctx context.Context, tag string) (time.Time, error) {
+	currentPath, err := pathFor(manifestTagCurrentPathSpec{
+		name: ts.repository.Named().Name(),
+		tag:  tag,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	fi, err := ts.blobStore.driver.Stat(ctx, currentPath)
+	if err != nil {
+		switch err.(type) {
+		case storagedriver.PathNotFoundError:
+			return time.Time{}, distribution.ErrTagUnknown{Tag: tag}
+		}
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
 func (ts *tagStore) ManifestDigests(ctx context.Context, tag string) ([]digest.Digest, error) {
 	tagLinkPath := func(name string, dgst digest.Digest) (string, error) {
 		return pathFor(manifestTagIndexEntryLinkPathSpec{
@@ -4,6 +4,7 @@ import (
 	"context"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/manifest"
@@ -306,6 +307,63 @@ func TestTagIndexes(t *testing.T) {
 	}
 }
 
+func TestTagDescribe(t *testing.T) {
+	env := testTagStore(t)
+	tagStore := env.ts
+	ctx := env.ctx
+
+	describer, ok := tagStore.(distribution.TagDescriber)
+	if !ok {
+		t.Fatal("tagStore does not implement TagDescriber interface")
+	}
+
+	if _, err := describer.Describe(ctx, "latest"); err == nil {
+		t.Fatal("expected an error describing an unknown tag")
+	} else if _, ok := err.(distribution.ErrTagUnknown); !ok {
+		t.Fatalf("unexpected error describing an unknown tag: %v", err)
+	}
+
+	conf, err := env.bs.Put(ctx, schema2.MediaTypeImageConfig, []byte{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    conf,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := env.ms.Put(ctx, dm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := env.gbs.Stat(ctx, dgst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	if err := tagStore.Tag(ctx, "latest", desc); err != nil {
+		t.Fatal(err)
+	}
+
+	description, err := describer.Describe(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, payload, _ := dm.Payload()
+	if description.Digest != dgst || description.MediaType != schema2.MediaTypeManifest || description.Size != int64(len(payload)) {
+		t.Errorf("unexpected description: %+v", description)
+	}
+	if description.ModTime.Before(before.Add(-time.Second)) {
+		t.Errorf("expected the tag modification time to be the tagging time, got %v", description.ModTime)
+	}
+	if modTime, err := describer.ModTime(ctx, "latest"); err != nil || !modTime.Equal(description.ModTime) {
+		t.Errorf("expected the modification time %v, got %v, %v", description.ModTime, modTime, err)
+	}
+}
+
 func digestMap(dgsts []digest.Digest) map[digest.Digest]struct{} {
 	set := make(map[digest.Digest]struct{})
 	for _, dgst := range dgsts {
@@ -106,6 +106,24 @@ func (v Vacuum) RemoveLayerLink(manifestName string, dgst digest.Digest) error {
 	return v.driver.Delete(v.ctx, layerLinkPath)
 }
 
+// RemoveReferrerLink removes the link recording that the manifest dgst
+// refers to subject
+func (v Vacuum) RemoveReferrerLink(manifestName string, subject, dgst digest.Digest) error {
+	referrerLinkPath, err := pathFor(manifestReferrerLinkPathSpec{name: manifestName, subject: subject, revision: dgst})
+	if err != nil {
+		return err
+	}
+	referrerPath := path.Dir(referrerLinkPath)
+
+	dcontext.GetLogger(v.ctx).Infof("Deleting referrer link path : %s", referrerPath)
+
+	err = v.driver.Delete(v.ctx, referrerPath)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
 // RemoveRepository removes a repository directory from the
 // filesystem
 func (v Vacuum) RemoveRepository(repoName string) error {
@@ -0,0 +1,369 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// The kinds of problems found by Verify.
+const (
+	// ProblemCorruptBlob is a blob whose content does not hash to its
+	// digest, such as a partially written or bit rotten blob.
+	ProblemCorruptBlob = "corrupt-blob"
+
+	// ProblemDanglingLink is a manifest revision or layer link of a
+	// repository to a blob which does not exist.
+	ProblemDanglingLink = "dangling-link"
+
+	// ProblemMissingReference is a blob referenced by a manifest which does
+	// not exist.
+	ProblemMissingReference = "missing-reference"
+
+	// ProblemInvalidManifest is a manifest revision which cannot be read.
+	ProblemInvalidManifest = "invalid-manifest"
+)
+
+// VerifyOpts contains options for the verification of the stored content.
+type VerifyOpts struct {
+	// Quarantine moves the corrupt blobs and the dangling links under the
+	// quarantine directory of the storage, out of reach of the registry.
+	// Manifests with missing references are reported only.
+	Quarantine bool
+}
+
+// VerifyProblem describes a bad object found by Verify.
+type VerifyProblem struct {
+	Kind string `json:"kind"`
+
+	// Repository is the repository of the link or the manifest, empty for
+	// blobs.
+	Repository string `json:"repository,omitempty"`
+
+	// Digest is the digest of the blob, or the target of the link.
+	Digest digest.Digest `json:"digest"`
+
+	// Path is the path of the object in the storage.
+	Path string `json:"path"`
+
+	Detail string `json:"detail,omitempty"`
+
+	// Quarantined tells whether the object has been moved to the quarantine
+	// directory.
+	Quarantined bool `json:"quarantined"`
+}
+
+// VerifyReport reports the content verified by Verify and the problems
+// found.
+type VerifyReport struct {
+	Blobs     int             `json:"blobs"`
+	Manifests int             `json:"manifests"`
+	Links     int             `json:"links"`
+	Problems  []VerifyProblem `json:"problems"`
+}
+
+// Verify checks the integrity of the content stored by the registry. It
+// hashes every blob again and compares it to its digest, then checks that the
+// manifest revision and layer links of the repositories point to existing
+// blobs, and that the blobs referenced by the manifests exist.
+//
+// Verify can run while the registry accepts writes: content removed while it
+// runs is skipped.
+func Verify(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts VerifyOpts) (*VerifyReport, error) {
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+	log := dcontext.GetLogger(ctx)
+	report := &VerifyReport{Problems: []VerifyProblem{}}
+
+	// quarantine moves the object of the problem under the quarantine
+	// directory
+	quarantine := func(problem *VerifyProblem) error {
+		if !opts.Quarantine {
+			return nil
+		}
+		quarantinePath, err := pathFor(quarantinePathSpec{path: problem.Path})
+		if err != nil {
+			return err
+		}
+		if err := storageDriver.Move(ctx, problem.Path, quarantinePath); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				// removed since it was verified
+				return nil
+			}
+			return err
+		}
+		problem.Quarantined = true
+		return nil
+	}
+
+	// verify the blobs, remembering those which are left in place
+	present := make(map[digest.Digest]struct{})
+	err := registry.Blobs().Enumerate(ctx, func(dgst digest.Digest) error {
+		log.Debugf("verifying blob %s", dgst)
+		blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+		if err != nil {
+			return err
+		}
+
+		intact, err := verifyBlob(ctx, storageDriver, blobPath, dgst)
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				// removed since the walk listed it
+				return nil
+			}
+			return fmt.Errorf("failed to verify blob %s: %v", dgst, err)
+		}
+		report.Blobs++
+		if intact {
+			present[dgst] = struct{}{}
+			return nil
+		}
+
+		problem := VerifyProblem{
+			Kind:   ProblemCorruptBlob,
+			Digest: dgst,
+			Path:   blobPath,
+			Detail: "content does not match the digest",
+		}
+		if err := quarantine(&problem); err != nil {
+			return fmt.Errorf("failed to quarantine blob %s: %v", dgst, err)
+		}
+		if problem.Quarantined {
+			if err := forgetBlob(ctx, registry, dgst); err != nil {
+				return err
+			}
+		} else {
+			present[dgst] = struct{}{}
+		}
+		report.Problems = append(report.Problems, problem)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify blobs: %v", err)
+	}
+
+	// exists tells whether the blob exists, including the blobs written
+	// since they were verified
+	exists := func(dgst digest.Digest) (bool, error) {
+		if _, ok := present[dgst]; ok {
+			return true, nil
+		}
+		blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+		if err != nil {
+			return false, err
+		}
+		if _, err := storageDriver.Stat(ctx, blobPath); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+
+	// verify the links and the manifests of the repositories
+	err = repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		log.Debugf("verifying repository %s", repoName)
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+		}
+		repository, err := registry.Repository(ctx, named)
+		if err != nil {
+			return fmt.Errorf("failed to construct repository: %v", err)
+		}
+		manifestService, err := repository.Manifests(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to construct manifest service: %v", err)
+		}
+
+		// checkLink reports the link if its target does not exist, and
+		// returns whether it does. The digest of a link whose content
+		// cannot be parsed is empty.
+		checkLink := func(linkPath string, dgst digest.Digest, manifest bool) (bool, error) {
+			report.Links++
+			detail := "link content is not a digest"
+			if dgst != "" {
+				ok, err := exists(dgst)
+				if err != nil || ok {
+					return ok, err
+				}
+				detail = "linked blob does not exist"
+			}
+
+			problem := VerifyProblem{
+				Kind:       ProblemDanglingLink,
+				Repository: repoName,
+				Digest:     dgst,
+				Path:       linkPath,
+				Detail:     detail,
+			}
+			if err := quarantine(&problem); err != nil {
+				return false, fmt.Errorf("failed to quarantine link %s: %v", linkPath, err)
+			}
+			if problem.Quarantined && dgst != "" {
+				if err := forgetLinkedBlob(ctx, repository, dgst, manifest); err != nil {
+					return false, err
+				}
+			}
+			report.Problems = append(report.Problems, problem)
+			return false, nil
+		}
+
+		revisionsPath, err := pathFor(manifestRevisionsPathSpec{name: repoName})
+		if err != nil {
+			return err
+		}
+		err = walkLinks(ctx, storageDriver, revisionsPath, func(linkPath string, dgst digest.Digest) error {
+			ok, err := checkLink(linkPath, dgst, true)
+			if err != nil || !ok {
+				return err
+			}
+
+			manifest, err := manifestService.Get(ctx, dgst)
+			if err != nil {
+				if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+					// deleted since it was linked
+					return nil
+				}
+				report.Problems = append(report.Problems, VerifyProblem{
+					Kind:       ProblemInvalidManifest,
+					Repository: repoName,
+					Digest:     dgst,
+					Path:       linkPath,
+					Detail:     err.Error(),
+				})
+				return nil
+			}
+			report.Manifests++
+
+			for _, descriptor := range manifest.References() {
+				ok, err := exists(descriptor.Digest)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					blobPath, err := pathFor(blobDataPathSpec{digest: descriptor.Digest})
+					if err != nil {
+						return err
+					}
+					report.Problems = append(report.Problems, VerifyProblem{
+						Kind:       ProblemMissingReference,
+						Repository: repoName,
+						Digest:     descriptor.Digest,
+						Path:       blobPath,
+						Detail:     fmt.Sprintf("referenced by manifest %s", dgst),
+					})
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		layersPath, err := pathFor(layersPathSpec{name: repoName})
+		if err != nil {
+			return err
+		}
+		return walkLinks(ctx, storageDriver, layersPath, func(linkPath string, dgst digest.Digest) error {
+			_, err := checkLink(linkPath, dgst, false)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify repositories: %v", err)
+	}
+
+	return report, nil
+}
+
+// verifyBlob reports whether the content of the blob at blobPath hashes to
+// its digest.
+func verifyBlob(ctx context.Context, storageDriver driver.StorageDriver, blobPath string, dgst digest.Digest) (bool, error) {
+	rc, err := storageDriver.Reader(ctx, blobPath, 0)
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+
+	verifier := dgst.Verifier()
+	if _, err := io.Copy(verifier, rc); err != nil {
+		return false, err
+	}
+	return verifier.Verified(), nil
+}
+
+// forgetBlob removes the blob, which has been quarantined, from the
+// descriptor cache of the registry.
+func forgetBlob(ctx context.Context, ns distribution.Namespace, dgst digest.Digest) error {
+	reg, ok := ns.(*registry)
+	if !ok || reg.blobDescriptorCacheProvider == nil {
+		return nil
+	}
+	if err := reg.blobDescriptorCacheProvider.Clear(ctx, dgst); err != nil && err != distribution.ErrBlobUnknown {
+		return fmt.Errorf("failed to clear cached descriptor of blob %s: %v", dgst, err)
+	}
+	return nil
+}
+
+// forgetLinkedBlob removes the blob, whose link has been quarantined, from
+// the caches of the repository.
+func forgetLinkedBlob(ctx context.Context, r distribution.Repository, dgst digest.Digest, manifest bool) error {
+	repo, ok := r.(*repository)
+	if !ok {
+		return nil
+	}
+	if repo.descriptorCache != nil {
+		if err := repo.descriptorCache.Clear(ctx, dgst); err != nil && err != distribution.ErrBlobUnknown {
+			return fmt.Errorf("failed to clear cached descriptor of blob %s: %v", dgst, err)
+		}
+	}
+	if manifest {
+		if err := clearCachedManifest(ctx, repo, dgst); err != nil {
+			return fmt.Errorf("failed to clear cached manifest %s: %v", dgst, err)
+		}
+	}
+	return nil
+}
+
+// walkLinks calls fn with the path and the target of each link file under
+// root. The target is empty when the content of the link is not a digest.
+func walkLinks(ctx context.Context, storageDriver driver.StorageDriver, root string, fn func(string, digest.Digest) error) error {
+	err := storageDriver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+
+		content, err := storageDriver.GetContent(ctx, fileInfo.Path())
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				// removed since the walk listed it
+				return nil
+			}
+			return err
+		}
+
+		dgst, err := digest.Parse(string(content))
+		if err != nil {
+			dgst = ""
+		}
+
+		return fn(fileInfo.Path(), dgst)
+	})
+
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		// nothing has been linked of this kind
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"testing"
+
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+// problemsOfKind returns the digests of the problems of the given kind.
+func problemsOfKind(report *VerifyReport, kind string) map[digest.Digest]VerifyProblem {
+	problems := make(map[digest.Digest]VerifyProblem)
+	for _, problem := range report.Problems {
+		if problem.Kind == kind {
+			problems[problem.Digest] = problem
+		}
+	}
+	return problems
+}
+
+func TestVerifyIntact(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "palailogos")
+	uploadRandomSchema2Image(t, repo)
+	uploadRandomSchema2Image(t, repo)
+
+	report, err := Verify(ctx, inmemoryDriver, registry, VerifyOpts{Quarantine: true})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+
+	if len(report.Problems) != 0 {
+		t.Errorf("expected no problems, got %v", report.Problems)
+	}
+	// two layers and a manifest per image, and the config they share
+	if report.Blobs != 7 {
+		t.Errorf("expected 7 blobs verified, got %d", report.Blobs)
+	}
+	if report.Manifests != 2 {
+		t.Errorf("expected 2 manifests verified, got %d", report.Manifests)
+	}
+	// a revision link per manifest, and a layer link per layer and config
+	if report.Links != 7 {
+		t.Errorf("expected 7 links verified, got %d", report.Links)
+	}
+}
+
+func TestVerifyCorruptBlob(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "komnenos")
+	image := uploadRandomSchema2Image(t, repo)
+
+	corrupt := getAnyKey(image.layers)
+	blobPath, err := pathFor(blobDataPathSpec{digest: corrupt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inmemoryDriver.PutContent(ctx, blobPath, []byte("bit rot")); err != nil {
+		t.Fatalf("Failed to corrupt blob: %v", err)
+	}
+
+	// reported only
+	report, err := Verify(ctx, inmemoryDriver, registry, VerifyOpts{})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if len(report.Problems) != 1 {
+		t.Fatalf("expected a single problem, got %v", report.Problems)
+	}
+	problem := report.Problems[0]
+	if problem.Kind != ProblemCorruptBlob || problem.Digest != corrupt || problem.Path != blobPath || problem.Quarantined {
+		t.Errorf("unexpected problem %v", problem)
+	}
+	if _, err := inmemoryDriver.Stat(ctx, blobPath); err != nil {
+		t.Errorf("expected the corrupt blob to be left in place: %v", err)
+	}
+
+	// quarantined, along with the link to it
+	report, err = Verify(ctx, inmemoryDriver, registry, VerifyOpts{Quarantine: true})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if problem, ok := problemsOfKind(report, ProblemCorruptBlob)[corrupt]; !ok || !problem.Quarantined {
+		t.Errorf("expected the corrupt blob to be quarantined, got %v", report.Problems)
+	}
+	if problem, ok := problemsOfKind(report, ProblemDanglingLink)[corrupt]; !ok || !problem.Quarantined {
+		t.Errorf("expected the layer link to be quarantined, got %v", report.Problems)
+	}
+	if _, ok := problemsOfKind(report, ProblemMissingReference)[corrupt]; !ok {
+		t.Errorf("expected the manifest reference to be reported, got %v", report.Problems)
+	}
+	if _, err := inmemoryDriver.Stat(ctx, blobPath); err == nil {
+		t.Errorf("expected the corrupt blob to be moved")
+	}
+	quarantinePath, err := pathFor(quarantinePathSpec{path: blobPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := inmemoryDriver.GetContent(ctx, quarantinePath)
+	if err != nil || string(content) != "bit rot" {
+		t.Errorf("expected the corrupt blob in quarantine, got %q: %v", content, err)
+	}
+	if _, err := repo.Blobs(ctx).Stat(ctx, corrupt); err == nil {
+		t.Errorf("expected the corrupt blob to be unknown to the repository")
+	}
+
+	// the manifest still references the blob
+	report, err = Verify(ctx, inmemoryDriver, registry, VerifyOpts{Quarantine: true})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if len(report.Problems) != 1 || report.Problems[0].Kind != ProblemMissingReference {
+		t.Errorf("expected the missing reference only, got %v", report.Problems)
+	}
+}
+
+func TestVerifyDanglingLinks(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "doukas")
+	image := uploadRandomSchema2Image(t, repo)
+
+	for _, dgst := range []digest.Digest{getAnyKey(image.layers), image.manifestDigest} {
+		blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := inmemoryDriver.Delete(ctx, path.Dir(blobPath)); err != nil {
+			t.Fatalf("Failed to delete blob: %v", err)
+		}
+	}
+
+	report, err := Verify(ctx, inmemoryDriver, registry, VerifyOpts{Quarantine: true})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+
+	dangling := problemsOfKind(report, ProblemDanglingLink)
+	if len(dangling) != 2 || len(report.Problems) != 2 {
+		t.Fatalf("expected two dangling links, got %v", report.Problems)
+	}
+	for dgst, problem := range dangling {
+		if problem.Repository != "doukas" || !problem.Quarantined {
+			t.Errorf("unexpected problem %v", problem)
+		}
+		if _, err := inmemoryDriver.Stat(ctx, problem.Path); err == nil {
+			t.Errorf("expected the link to %s to be moved", dgst)
+		}
+	}
+
+	revisionPath, err := pathFor(manifestRevisionLinkPathSpec{name: "doukas", revision: image.manifestDigest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dangling[image.manifestDigest].Path != revisionPath {
+		t.Errorf("expected the revision link %s to be reported, got %v", revisionPath, report.Problems)
+	}
+	quarantinePath, err := pathFor(quarantinePathSpec{path: revisionPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inmemoryDriver.Stat(ctx, quarantinePath); err != nil {
+		t.Errorf("expected the revision link in quarantine: %v", err)
+	}
+
+	// the quarantined links are no longer walked
+	report, err = Verify(ctx, inmemoryDriver, registry, VerifyOpts{})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if len(report.Problems) != 0 {
+		t.Errorf("expected no problems, got %v", report.Problems)
+	}
+}
+
+func TestVerifyInvalidLink(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "angelos")
+	image := uploadRandomSchema2Image(t, repo)
+
+	linkPath, err := pathFor(layerLinkPathSpec{name: "angelos", digest: getAnyKey(image.layers)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inmemoryDriver.PutContent(ctx, linkPath, []byte("not a digest")); err != nil {
+		t.Fatalf("Failed to corrupt link: %v", err)
+	}
+
+	report, err := Verify(ctx, inmemoryDriver, registry, VerifyOpts{})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if len(report.Problems) != 1 {
+		t.Fatalf("expected a single problem, got %v", report.Problems)
+	}
+	problem := report.Problems[0]
+	if problem.Kind != ProblemDanglingLink || problem.Digest != "" || problem.Path != linkPath {
+		t.Errorf("unexpected problem %v", problem)
+	}
+}
@@ -2,6 +2,7 @@ package distribution
 
 import (
 	"context"
+	"time"
 
 	"github.com/opencontainers/go-digest"
 )
@@ -35,3 +36,26 @@ type TagManifestsProvider interface {
 	// includes currently linked digest. There is no ordering guaranteed
 	ManifestDigests(ctx context.Context, tag string) ([]digest.Digest, error)
 }
+
+// TagDescription describes a tag and the manifest it points to.
+type TagDescription struct {
+	// Descriptor is the descriptor of the manifest, including its media
+	// type and size.
+	Descriptor
+
+	// ModTime is the time at which the tag was last pushed.
+	ModTime time.Time
+}
+
+// TagDescriber provides method to retrieve the manifest a tag points to along
+// with the time at which the tag was last pushed
+type TagDescriber interface {
+	// Describe returns the description of the tag, or ErrTagUnknown if
+	// the tag does not exist.
+	Describe(ctx context.Context, tag string) (TagDescription, error)
+
+	// ModTime returns the time at which the tag was last pushed, or
+	// ErrTagUnknown if the tag does not exist. Unlike Describe, it does not
+	// read the manifest.
+	ModTime(ctx context.Context, tag string) (time.Time, error)
+}
@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"sync"
 )
 
 // RequestResponseMap is an ordered mapping from Requests to Responses
@@ -87,6 +88,7 @@ type Response struct {
 // testHandler is an http.Handler with a defined mapping from Request to an
 // ordered list of Response objects
 type testHandler struct {
+	mu          sync.Mutex
 	responseMap map[string][]Response
 }
 
@@ -126,15 +128,18 @@ func (app *testHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	app.mu.Lock()
 	responses, ok := app.responseMap[request.String()]
 
 	if !ok || len(responses) == 0 {
+		app.mu.Unlock()
 		http.NotFound(w, r)
 		return
 	}
 
 	response := responses[0]
 	app.responseMap[request.String()] = responses[1:]
+	app.mu.Unlock()
 
 	responseHeader := w.Header()
 	for k, v := range response.Headers {
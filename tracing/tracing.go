@@ -0,0 +1,215 @@
+// Package tracing instruments the registry with OpenTelemetry spans, and
+// exports them over OTLP. The W3C trace context is extracted from the
+// requests served, and injected into the requests sent.
+//
+// Tracing is off until Configure installs a tracer provider: spans are then
+// no-ops, although the trace context of the requests served is still
+// propagated to the requests they cause.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/version"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the registry.
+const instrumentationName = "github.com/docker/distribution"
+
+// defaultServiceName is the service name of the spans when none is
+// configured.
+const defaultServiceName = "registry"
+
+var (
+	mu       sync.RWMutex
+	provider trace.TracerProvider = trace.NewNoopTracerProvider()
+
+	propagator = propagation.TraceContext{}
+)
+
+// Configure installs a tracer provider exporting the spans over OTLP/HTTP,
+// as configured. The returned function flushes the spans not exported yet
+// and stops the exporter. Nothing is installed if tracing is not enabled.
+func Configure(ctx context.Context, config configuration.Tracing) (func(context.Context) error, error) {
+	if !config.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var opts []otlptracehttp.Option
+	if config.Endpoint != "" {
+		u, err := url.Parse(config.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tracing endpoint %q: %v", config.Endpoint, err)
+		}
+		switch u.Scheme {
+		case "http":
+			opts = append(opts, otlptracehttp.WithInsecure())
+		case "https":
+		default:
+			return nil, fmt.Errorf("invalid tracing endpoint %q: the scheme must be http or https", config.Endpoint)
+		}
+		opts = append(opts, otlptracehttp.WithEndpoint(u.Host))
+		if u.Path != "" {
+			opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+		}
+	}
+	if len(config.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(config.Headers))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace exporter: %v", err)
+	}
+
+	ratio := config.SamplingRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("invalid tracing sampling ratio %v: it must be greater than 0 and at most 1", ratio)
+	}
+	tp := newProvider(config.ServiceName, sdktrace.WithBatcher(exporter),
+		// the sampling decision of the client is followed
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))))
+	setProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Install installs a tracer provider sampling every span and handing it to
+// processor, such as the span recorder of the tests. The returned function
+// restores the previous tracer provider.
+func Install(processor sdktrace.SpanProcessor) func() {
+	previous := setProvider(newProvider("", sdktrace.WithSpanProcessor(processor)))
+	return func() {
+		setProvider(previous)
+	}
+}
+
+// newProvider returns a tracer provider for the service, sampling every span
+// unless a sampler is given.
+func newProvider(serviceName string, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceVersionKey.String(version.Version),
+	)
+	return sdktrace.NewTracerProvider(append([]sdktrace.TracerProviderOption{sdktrace.WithResource(res)}, opts...)...)
+}
+
+// setProvider installs the tracer provider and returns the previous one.
+func setProvider(tp trace.TracerProvider) trace.TracerProvider {
+	mu.Lock()
+	defer mu.Unlock()
+
+	previous := provider
+	provider = tp
+	return previous
+}
+
+func tracer() trace.Tracer {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return provider.Tracer(instrumentationName, trace.WithInstrumentationVersion(version.Version))
+}
+
+// StartSpan starts a span as a child of the span of ctx, if any.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records the error, if any, and ends the span.
+func EndSpan(span trace.Span, err error) {
+	RecordError(span, err)
+	span.End()
+}
+
+// RecordError records the error, if any, on the span and marks the span as
+// failed. It returns the error.
+func RecordError(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// StartServerSpan starts the span of a request served under the named route,
+// as a child of the span propagated in its headers, if any.
+func StartServerSpan(r *http.Request, route string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	attrs = append(semconv.HTTPServerAttributesFromHTTPRequest("", route, r), attrs...)
+	return tracer().Start(ctx, r.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrs...))
+}
+
+// EndServerSpan records the status code of the response and ends the span of
+// the request served.
+func EndServerSpan(span trace.Span, status int) {
+	if status != 0 {
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(status, trace.SpanKindServer))
+	}
+	span.End()
+}
+
+// clientSpanKey marks the context of a request whose client span has been
+// started.
+type clientSpanKey struct{}
+
+// Transport returns a round tripper starting a client span for each request
+// sent through base, and propagating it in the headers of the request. The
+// requests sent through several such round trippers get a single span.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if ctx.Value(clientSpanKey{}) != nil {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, span := tracer().Start(ctx, "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPClientAttributesFromHTTPRequest(req)...))
+	ctx = context.WithValue(ctx, clientSpanKey{}, struct{}{})
+
+	// the request must not be modified
+	req = req.Clone(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		EndSpan(span, err)
+		return nil, err
+	}
+	// the span ends with the response headers, the body is not waited for
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(resp.StatusCode)...)
+	span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(resp.StatusCode, trace.SpanKindClient))
+	span.End()
+	return resp, nil
+}
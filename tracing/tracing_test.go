@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestConfigureDisabled(t *testing.T) {
+	shutdown, err := Configure(context.Background(), configuration.Tracing{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error shutting down: %v", err)
+	}
+}
+
+func TestConfigureInvalid(t *testing.T) {
+	for _, config := range []configuration.Tracing{
+		{Enabled: true, Endpoint: "grpc://collector:4317"},
+		{Enabled: true, Endpoint: "http://collector:4318", SamplingRatio: 1.5},
+		{Enabled: true, Endpoint: "http://collector:4318", SamplingRatio: -1},
+	} {
+		if _, err := Configure(context.Background(), config); err == nil {
+			t.Errorf("expected an error configuring %+v", config)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	defer Install(recorder)()
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	ctx, parent := StartSpan(context.Background(), "parent")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nested transports send a single span
+	client := &http.Client{Transport: Transport(Transport(nil))}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	if req.Header.Get("traceparent") != "" {
+		t.Errorf("expected the request to be left unmodified")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	clientSpan := spans[0]
+	if clientSpan.SpanKind() != trace.SpanKindClient || clientSpan.Name() != "HTTP GET" {
+		t.Errorf("unexpected client span %s of kind %v", clientSpan.Name(), clientSpan.SpanKind())
+	}
+	if clientSpan.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("expected the client span to be a child of the parent span")
+	}
+	expected := "00-" + clientSpan.SpanContext().TraceID().String() + "-" + clientSpan.SpanContext().SpanID().String() + "-01"
+	if traceparent != expected {
+		t.Errorf("expected traceparent %q, got %q", expected, traceparent)
+	}
+}
+
+func TestStartServerSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	defer Install(recorder)()
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/foo/manifests/latest", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	_, span := StartServerSpan(req, "manifest")
+	EndServerSpan(span, http.StatusOK)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected a single span, got %d", len(spans))
+	}
+	server := spans[0]
+	if server.Name() != "GET manifest" || server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("unexpected server span %s of kind %v", server.Name(), server.SpanKind())
+	}
+	if traceID := server.SpanContext().TraceID().String(); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the propagated trace, got %s", traceID)
+	}
+	if spanID := server.Parent().SpanID().String(); spanID != "00f067aa0ba902b7" {
+		t.Errorf("expected the propagated parent span, got %s", spanID)
+	}
+}
@@ -0,0 +1,15 @@
+// Package tracingtest provides utilities for testing the tracing of the
+// registry.
+package tracingtest
+
+import (
+	"github.com/docker/distribution/tracing"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Record installs a tracer provider keeping the spans in memory. The returned
+// function restores the previous tracer provider.
+func Record() (*tracetest.SpanRecorder, func()) {
+	recorder := tracetest.NewSpanRecorder()
+	return recorder, tracing.Install(recorder)
+}